@@ -0,0 +1,132 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/imitablerabbit/githubrelease/pkg/release"
+)
+
+// writeActionsOutput writes the release as step outputs to the GITHUB_OUTPUT file, and a summary
+// of it with a table of the uploaded assets to the GITHUB_STEP_SUMMARY file, when running in
+// GitHub Actions. Nothing is written outside of Actions, where the files are not set.
+func writeActionsOutput(rel *release.Release, results []assetResult) error {
+	if path := os.Getenv("GITHUB_OUTPUT"); path != "" {
+		if err := appendFile(path, actionsOutputs(rel, results)); err != nil {
+			return fmt.Errorf("writing GITHUB_OUTPUT: %v", err)
+		}
+	}
+	if path := os.Getenv("GITHUB_STEP_SUMMARY"); path != "" {
+		if err := appendFile(path, actionsSummary(rel, results)); err != nil {
+			return fmt.Errorf("writing GITHUB_STEP_SUMMARY: %v", err)
+		}
+	}
+	return nil
+}
+
+// actionsOutputs returns the step outputs of the release in the format of the GITHUB_OUTPUT file.
+// The assets are a JSON array, so that a later step can use them with fromJSON.
+func actionsOutputs(rel *release.Release, results []assetResult) string {
+	if results == nil {
+		results = []assetResult{}
+	}
+	assets, _ := json.Marshal(results)
+	var b strings.Builder
+	for _, output := range []struct{ name, value string }{
+		{"id", strconv.Itoa(rel.ID)},
+		{"tag_name", rel.TagName},
+		{"name", rel.Name},
+		{"url", rel.HTMLURL},
+		{"upload_url", rel.UploadURL},
+		{"draft", strconv.FormatBool(rel.Draft)},
+		{"prerelease", strconv.FormatBool(rel.PreRelease)},
+		{"assets", string(assets)},
+	} {
+		writeActionsOutputValue(&b, output.name, output.value)
+	}
+	return b.String()
+}
+
+// writeActionsOutputValue writes the output as name=value, or between random delimiters if the
+// value has more than one line.
+func writeActionsOutputValue(b *strings.Builder, name, value string) {
+	if !strings.ContainsAny(value, "\r\n") {
+		fmt.Fprintf(b, "%s=%s\n", name, value)
+		return
+	}
+	random := make([]byte, 8)
+	rand.Read(random)
+	delimiter := "ghadelimiter_" + hex.EncodeToString(random)
+	fmt.Fprintf(b, "%s<<%s\n%s\n%s\n", name, delimiter, value, delimiter)
+}
+
+// actionsSummary returns the Markdown summary of the release, with a table of its assets.
+func actionsSummary(rel *release.Release, results []assetResult) string {
+	var b strings.Builder
+	title := rel.Name
+	if title == "" {
+		title = rel.TagName
+	}
+	fmt.Fprintf(&b, "### Release [%s](%s)\n\n", markdownEscape(title), rel.HTMLURL)
+	state := "published"
+	switch {
+	case rel.Draft:
+		state = "draft"
+	case rel.PreRelease:
+		state = "pre-release"
+	}
+	fmt.Fprintf(&b, "Tag `%s`, %s.\n\n", rel.TagName, state)
+	if len(results) == 0 {
+		return b.String()
+	}
+	var uploaded, failed int
+	b.WriteString("| Asset | Size | State |\n|---|---:|---|\n")
+	for _, r := range results {
+		name := markdownEscape(r.Name)
+		if r.BrowserDownloadURL != "" {
+			name = fmt.Sprintf("[%s](%s)", name, r.BrowserDownloadURL)
+		}
+		size := ""
+		if r.Size > 0 {
+			size = formatBytes(float64(r.Size))
+		}
+		state := r.State
+		switch r.State {
+		case assetUploaded:
+			uploaded++
+		case assetFailed:
+			failed++
+			state = fmt.Sprintf("%s: %s", r.State, markdownEscape(r.Error))
+		}
+		fmt.Fprintf(&b, "| %s | %s | %s |\n", name, size, state)
+	}
+	fmt.Fprintf(&b, "\n%d of %d asset(s) uploaded", uploaded, len(results))
+	if failed > 0 {
+		fmt.Fprintf(&b, ", %d failed", failed)
+	}
+	b.WriteString(".\n\n")
+	return b.String()
+}
+
+// markdownEscape escapes the characters that would break a Markdown table cell or link text.
+func markdownEscape(s string) string {
+	return strings.NewReplacer("|", `\|`, "[", `\[`, "]", `\]`, "\n", " ").Replace(s)
+}
+
+// appendFile appends the text to the file, creating it if it does not exist.
+func appendFile(path, text string) error {
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := file.WriteString(text); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
@@ -0,0 +1,264 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/imitablerabbit/githubrelease/pkg/release"
+)
+
+// announceAccept asks for the body of the release as both Markdown and rendered HTML, so that the
+// feeds can include the HTML and the posts the Markdown.
+const announceAccept = "application/vnd.github.full+json"
+
+// announceFormats are the formats that announce can write, in the order they are written.
+var announceFormats = []string{"atom", "rss", "markdown", "json"}
+
+// slugPattern matches the runs of characters that are replaced with a dash in file names.
+var slugPattern = regexp.MustCompile(`[^a-z0-9]+`)
+
+// announcement is the release being announced.
+type announcement struct {
+	rel       *release.Release
+	repo      string
+	title     string
+	published time.Time
+	author    string
+	slug      string
+}
+
+// runAnnounce writes the release out as an Atom entry, an RSS item, a Markdown post and a JSON
+// Feed item, for a website to publish.
+func runAnnounce(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("announce", flag.ContinueOnError)
+	cf := addClientFlags(fs)
+	rf := addReleaseFlags(fs)
+	dir := fs.String("dir", "announcements", "The directory to write the announcements to")
+	formats := fs.String("format", strings.Join(announceFormats, ","), "Comma separated formats to write: atom, rss, markdown and json")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	selected := strings.Split(*formats, ",")
+	for _, format := range selected {
+		if !containsString(announceFormats, format) {
+			return withExitCode(exitValidation, fmt.Errorf("unsupported -format %q, expected atom, rss, markdown or json", format))
+		}
+	}
+
+	ctx, cancel := cf.withTimeout(ctx)
+	defer cancel()
+	client, err := cf.newClient(ctx)
+	if err != nil {
+		return err
+	}
+	client.Accept = announceAccept
+	rel, err := rf.getRelease(ctx, client)
+	if err != nil {
+		return err
+	}
+	if rel.Draft {
+		return fmt.Errorf("release %d for tag %s is a draft, publish it before announcing it", rel.ID, rel.TagName)
+	}
+	a := newAnnouncement(client.User+"/"+client.Repo, rel)
+
+	if err := os.MkdirAll(*dir, 0755); err != nil {
+		return err
+	}
+	for _, format := range announceFormats {
+		if !containsString(selected, format) {
+			continue
+		}
+		name, data, err := a.render(format)
+		if err != nil {
+			return fmt.Errorf("writing %s announcement: %v", format, err)
+		}
+		path := filepath.Join(*dir, name)
+		if err := ioutil.WriteFile(path, data, 0644); err != nil {
+			return err
+		}
+		log.Printf("info: wrote %s", path)
+		fmt.Println(path)
+	}
+	return nil
+}
+
+// newAnnouncement returns the announcement of the release. The title is the release name, or the
+// repo and tag if it has none.
+func newAnnouncement(repo string, rel *release.Release) *announcement {
+	a := &announcement{rel: rel, repo: repo, title: rel.Name}
+	if a.title == "" {
+		a.title = repo + " " + rel.TagName
+	}
+	a.published = rel.PublishedAt
+	if a.published.IsZero() {
+		a.published = time.Now()
+	}
+	a.published = a.published.UTC()
+	if rel.Author != nil {
+		a.author = rel.Author.Login
+	}
+	_, name, _ := strings.Cut(repo, "/")
+	// Jekyll posts are named after their date, so every format uses the same name.
+	a.slug = a.published.Format("2006-01-02") + "-" + strings.Trim(slugPattern.ReplaceAllString(strings.ToLower(name+"-"+rel.TagName), "-"), "-")
+	return a
+}
+
+// html returns the rendered body of the release, or the Markdown if GitHub did not render it.
+func (a *announcement) html() string {
+	if a.rel.BodyHTML != "" {
+		return a.rel.BodyHTML
+	}
+	return a.rel.Body
+}
+
+// render returns the file name and contents of the announcement in the format.
+func (a *announcement) render(format string) (string, []byte, error) {
+	switch format {
+	case "atom":
+		data, err := a.atom()
+		return a.slug + ".atom.xml", data, err
+	case "rss":
+		data, err := a.rss()
+		return a.slug + ".rss.xml", data, err
+	case "markdown":
+		return a.slug + ".md", a.markdown(), nil
+	}
+	data, err := a.jsonFeed()
+	return a.slug + ".json", data, err
+}
+
+// atomEntry is an entry of an Atom feed.
+type atomEntry struct {
+	XMLName xml.Name `xml:"http://www.w3.org/2005/Atom entry"`
+	ID      string   `xml:"id"`
+	Title   string   `xml:"title"`
+	Updated string   `xml:"updated"`
+	Link    struct {
+		Rel  string `xml:"rel,attr"`
+		Href string `xml:"href,attr"`
+	} `xml:"link"`
+	Author *struct {
+		Name string `xml:"name"`
+	} `xml:"author,omitempty"`
+	Content struct {
+		Type string `xml:"type,attr"`
+		Body string `xml:",chardata"`
+	} `xml:"content"`
+}
+
+// atom returns the release as an Atom feed entry.
+func (a *announcement) atom() ([]byte, error) {
+	entry := atomEntry{ID: a.rel.HTMLURL, Title: a.title, Updated: a.published.Format(time.RFC3339)}
+	entry.Link.Rel, entry.Link.Href = "alternate", a.rel.HTMLURL
+	entry.Content.Type, entry.Content.Body = "html", a.html()
+	if a.author != "" {
+		entry.Author = &struct {
+			Name string `xml:"name"`
+		}{Name: a.author}
+	}
+	return marshalXML(entry)
+}
+
+// rssItem is an item of an RSS 2.0 feed.
+type rssItem struct {
+	XMLName xml.Name `xml:"item"`
+	Title   string   `xml:"title"`
+	Link    string   `xml:"link"`
+	GUID    struct {
+		IsPermaLink bool   `xml:"isPermaLink,attr"`
+		Value       string `xml:",chardata"`
+	} `xml:"guid"`
+	PubDate     string `xml:"pubDate"`
+	Description string `xml:"description"`
+}
+
+// rss returns the release as an RSS feed item.
+func (a *announcement) rss() ([]byte, error) {
+	item := rssItem{Title: a.title, Link: a.rel.HTMLURL, PubDate: a.published.Format(time.RFC1123Z), Description: a.html()}
+	item.GUID.IsPermaLink, item.GUID.Value = true, a.rel.HTMLURL
+	return marshalXML(item)
+}
+
+// marshalXML returns the indented XML of v, followed by a newline.
+func marshalXML(v interface{}) ([]byte, error) {
+	data, err := xml.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+// markdown returns the release as a Markdown post with front matter that both Hugo and Jekyll
+// read.
+func (a *announcement) markdown() []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "---\n")
+	fmt.Fprintf(&b, "title: %s\n", yamlQuote(a.title))
+	fmt.Fprintf(&b, "date: %s\n", a.published.Format(time.RFC3339))
+	if a.author != "" {
+		fmt.Fprintf(&b, "author: %s\n", yamlQuote(a.author))
+	}
+	fmt.Fprintf(&b, "tags: [release]\n")
+	fmt.Fprintf(&b, "repo: %s\n", yamlQuote(a.repo))
+	fmt.Fprintf(&b, "tag: %s\n", yamlQuote(a.rel.TagName))
+	fmt.Fprintf(&b, "release_url: %s\n", yamlQuote(a.rel.HTMLURL))
+	fmt.Fprintf(&b, "prerelease: %t\n", a.rel.PreRelease)
+	fmt.Fprintf(&b, "---\n\n")
+	if body := strings.TrimSpace(a.rel.Body); body != "" {
+		fmt.Fprintf(&b, "%s\n\n", body)
+	}
+	fmt.Fprintf(&b, "[Download %s](%s)\n", a.rel.TagName, a.rel.HTMLURL)
+	return []byte(b.String())
+}
+
+// yamlQuote quotes the value as a YAML double quoted string.
+func yamlQuote(s string) string {
+	// JSON strings are valid YAML double quoted strings.
+	data, _ := json.Marshal(s)
+	return string(data)
+}
+
+// jsonFeed returns the release as a JSON Feed 1.1 item.
+func (a *announcement) jsonFeed() ([]byte, error) {
+	item := map[string]interface{}{
+		"id":             a.rel.HTMLURL,
+		"url":            a.rel.HTMLURL,
+		"title":          a.title,
+		"content_html":   a.html(),
+		"content_text":   a.rel.Body,
+		"date_published": a.published.Format(time.RFC3339),
+		"tags":           []string{"release"},
+	}
+	if a.author != "" {
+		item["authors"] = []map[string]string{{"name": a.author}}
+	}
+	var b bytes.Buffer
+	enc := json.NewEncoder(&b)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(item); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// containsString reports whether the value is in the list.
+func containsString(list []string, value string) bool {
+	for _, v := range list {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
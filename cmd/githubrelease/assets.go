@@ -0,0 +1,255 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/imitablerabbit/githubrelease/pkg/release"
+)
+
+// stringsFlag is a flag that can be repeated, each value is appended to the list.
+type stringsFlag []string
+
+func (s *stringsFlag) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *stringsFlag) Set(value string) error {
+	*s = append(*s, value)
+	return nil
+}
+
+// listUploadsDir returns the files in the uploads directory as assets. Sub directories are
+// ignored unless recursive is set, in which case every file below the directory is returned.
+func listUploadsDir(dir string, recursive bool) ([]release.AssetUpload, error) {
+	if recursive {
+		return walkDir(dir)
+	}
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var assets []release.AssetUpload
+	for _, f := range files {
+		// Just ignore sub directories, this should just be a directory full of .tar.gz files
+		if f.IsDir() {
+			continue
+		}
+		assets = append(assets, release.AssetUpload{Path: filepath.Join(dir, f.Name()), Name: f.Name()})
+	}
+	return assets, nil
+}
+
+// walkDir returns every file below the directory as an asset.
+func walkDir(dir string) ([]release.AssetUpload, error) {
+	var assets []release.AssetUpload
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() {
+			assets = append(assets, release.AssetUpload{Path: path, Name: d.Name()})
+		}
+		return nil
+	})
+	return assets, err
+}
+
+// parseAssetFlag splits an -asset value of the form pattern[#name][=label] into its parts. The
+// name renames the uploaded file and the label is the display name shown on the release page.
+func parseAssetFlag(value string) (pattern, name, label string) {
+	// The query of a URL can have = in it, so only the part after the # is split.
+	if isRemoteAsset(value) {
+		pattern, name, _ = strings.Cut(value, "#")
+		name, label, _ = strings.Cut(name, "=")
+		return pattern, name, label
+	}
+	pattern, label, _ = strings.Cut(value, "=")
+	if i := strings.LastIndex(pattern, "#"); i >= 0 {
+		pattern, name = pattern[:i], pattern[i+1:]
+	}
+	return pattern, name, label
+}
+
+// expandAssetFlag returns the assets for an -asset value, with the name and label applied. A
+// name can only be given if the pattern matches a single file.
+func expandAssetFlag(value string) ([]release.AssetUpload, error) {
+	pattern, name, label := parseAssetFlag(value)
+	expand := expandAssetPattern
+	if isRemoteAsset(pattern) {
+		expand = expandRemoteAsset
+	}
+	assets, err := expand(pattern)
+	if err != nil {
+		return nil, err
+	}
+	if name != "" && len(assets) != 1 {
+		return nil, fmt.Errorf("can only rename a single file to %s but %d files matched", name, len(assets))
+	}
+	for i := range assets {
+		if name != "" {
+			assets[i].Name = name
+		}
+		assets[i].Label = label
+	}
+	return assets, nil
+}
+
+// expandAssetPattern returns the files matched by an -asset value. The value can be a file, a
+// directory which is walked recursively, or a glob pattern. Patterns support the usual * ? and
+// [] wildcards, and ** to match any number of directories.
+func expandAssetPattern(pattern string) ([]release.AssetUpload, error) {
+	if !hasGlobMeta(pattern) {
+		info, err := os.Stat(pattern)
+		if err != nil {
+			return nil, err
+		}
+		if info.IsDir() {
+			return walkDir(pattern)
+		}
+		return []release.AssetUpload{{Path: pattern, Name: info.Name()}}, nil
+	}
+
+	root := globRoot(pattern)
+	re, err := globRegexp(filepath.ToSlash(filepath.Clean(pattern)))
+	if err != nil {
+		return nil, err
+	}
+
+	var assets []release.AssetUpload
+	err = filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() && re.MatchString(filepath.ToSlash(filepath.Clean(path))) {
+			assets = append(assets, release.AssetUpload{Path: path, Name: d.Name()})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(assets) == 0 {
+		return nil, fmt.Errorf("no files match %s", pattern)
+	}
+	return assets, nil
+}
+
+// globRoot returns the deepest directory of the pattern that doesn't contain any wildcards, which
+// is walked to find the files that match it. The volume, such as C: or \\server\share on Windows,
+// is kept out of the split so that it is never walked from as a relative path, and a pattern that
+// is relative to the current directory of a drive, such as C:*.zip, is walked from that drive. A
+// pattern without wildcards is returned as it is.
+func globRoot(pattern string) string {
+	volume := filepath.VolumeName(pattern)
+	parts := strings.Split(filepath.ToSlash(pattern[len(volume):]), "/")
+	for i, part := range parts {
+		if !hasGlobMeta(part) {
+			continue
+		}
+		switch {
+		case i == 0 && volume == "":
+			return "."
+		case i == 0:
+			return volume
+		case i == 1 && parts[0] == "":
+			return volume + string(filepath.Separator)
+		}
+		return volume + filepath.FromSlash(strings.Join(parts[:i], "/"))
+	}
+	return pattern
+}
+
+// hasGlobMeta reports whether the path contains any glob wildcards.
+func hasGlobMeta(path string) bool {
+	return strings.ContainsAny(path, "*?[")
+}
+
+// globRegexp converts a slash separated glob pattern into a regular expression. * and ? do not
+// match the path separator, ** matches across directories.
+func globRegexp(pattern string) (*regexp.Regexp, error) {
+	var b strings.Builder
+	b.WriteString("^")
+	for i := 0; i < len(pattern); i++ {
+		switch ch := pattern[i]; ch {
+		case '*':
+			if i+1 < len(pattern) && pattern[i+1] == '*' {
+				i++
+				// **/ also matches no directories at all
+				if i+1 < len(pattern) && pattern[i+1] == '/' {
+					i++
+					b.WriteString("(?:.*/)?")
+				} else {
+					b.WriteString(".*")
+				}
+				continue
+			}
+			b.WriteString("[^/]*")
+		case '?':
+			b.WriteString("[^/]")
+		case '[':
+			end := strings.IndexByte(pattern[i:], ']')
+			if end < 0 {
+				return nil, fmt.Errorf("invalid pattern %s: unclosed [", pattern)
+			}
+			class := pattern[i+1 : i+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			b.WriteString("[" + class + "]")
+			i += end
+		default:
+			b.WriteString(regexp.QuoteMeta(string(ch)))
+		}
+	}
+	b.WriteString("$")
+	return regexp.Compile(b.String())
+}
+
+// filterAssets keeps the assets whose names match at least one include pattern, if there are
+// any, and none of the exclude patterns. The patterns are matched against the file name.
+func filterAssets(assets []release.AssetUpload, include, exclude []string) ([]release.AssetUpload, error) {
+	if len(include) == 0 && len(exclude) == 0 {
+		return assets, nil
+	}
+	var filtered []release.AssetUpload
+	for _, asset := range assets {
+		included := len(include) == 0
+		for _, pattern := range include {
+			match, err := filepath.Match(pattern, asset.Name)
+			if err != nil {
+				return nil, fmt.Errorf("invalid -include pattern %s: %v", pattern, err)
+			}
+			included = included || match
+		}
+		for _, pattern := range exclude {
+			match, err := filepath.Match(pattern, asset.Name)
+			if err != nil {
+				return nil, fmt.Errorf("invalid -exclude pattern %s: %v", pattern, err)
+			}
+			included = included && !match
+		}
+		if included {
+			filtered = append(filtered, asset)
+		}
+	}
+	return filtered, nil
+}
+
+// checkDuplicateNames makes sure no two assets would be uploaded with the same name, which
+// GitHub rejects. This is easy to do by accident when walking directories.
+func checkDuplicateNames(assets []release.AssetUpload) error {
+	paths := map[string]string{}
+	for _, asset := range assets {
+		if other, ok := paths[asset.Name]; ok {
+			return fmt.Errorf("%s and %s would both be uploaded as %s", other, asset.Path, asset.Name)
+		}
+		paths[asset.Name] = asset.Path
+	}
+	return nil
+}
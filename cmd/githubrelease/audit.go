@@ -0,0 +1,363 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/imitablerabbit/githubrelease/pkg/release"
+)
+
+// auditResponseLimit is the most of a response body that is read for the ids and names in an
+// audit record.
+const auditResponseLimit = 1 << 20
+
+var (
+	auditMu sync.Mutex
+	// auditLogs are the open -audit-log destinations, shared by the transports of a command.
+	auditLogs = map[string]*auditLog{}
+)
+
+// auditRecord is a line of the -audit-log, describing a change that the command made.
+type auditRecord struct {
+	Time      time.Time `json:"time"`
+	Action    string    `json:"action"`
+	Actor     string    `json:"actor,omitempty"`
+	Command   string    `json:"command"`
+	Repo      string    `json:"repo,omitempty"`
+	Tag       string    `json:"tag,omitempty"`
+	ReleaseID int       `json:"release_id,omitempty"`
+	Asset     string    `json:"asset,omitempty"`
+	AssetID   int       `json:"asset_id,omitempty"`
+	Method    string    `json:"method"`
+	URL       string    `json:"url"`
+	Status    int       `json:"status"`
+	RequestID string    `json:"request_id,omitempty"`
+}
+
+// auditNote is what a command knows about a change that its request does not say, such as the
+// name of an asset that is deleted by its id.
+type auditNote struct {
+	// action replaces the action found from the request if it is set, e.g. asset.replaced for an
+	// asset that is deleted so that it can be uploaded again.
+	action string
+	tag    string
+	asset  string
+}
+
+type auditNoteKey struct{}
+
+// withAuditNote returns a context whose requests are recorded in the -audit-log with the note.
+func withAuditNote(ctx context.Context, note auditNote) context.Context {
+	return context.WithValue(ctx, auditNoteKey{}, note)
+}
+
+// auditLog writes audit records as JSON lines to a file or syslog.
+type auditLog struct {
+	mu     sync.Mutex
+	w      io.Writer
+	syslog bool
+}
+
+// openAuditLog opens the -audit-log destination: syslog for the local syslog daemon,
+// syslog://host:port or syslog+tcp://host:port for a remote one, or else a file that is appended
+// to.
+func openAuditLog(dest string) (*auditLog, error) {
+	switch {
+	case dest == "syslog":
+		for _, path := range []string{"/dev/log", "/var/run/syslog", "/var/run/log"} {
+			if conn, err := net.Dial("unixgram", path); err == nil {
+				return &auditLog{w: conn, syslog: true}, nil
+			}
+		}
+		return nil, fmt.Errorf("no local syslog socket found, use syslog://host:port")
+	case strings.HasPrefix(dest, "syslog://"), strings.HasPrefix(dest, "syslog+tcp://"):
+		u, err := url.Parse(dest)
+		if err != nil || u.Host == "" {
+			return nil, fmt.Errorf("invalid syslog address %q", dest)
+		}
+		network := "udp"
+		if u.Scheme == "syslog+tcp" {
+			network = "tcp"
+		}
+		conn, err := net.Dial(network, u.Host)
+		if err != nil {
+			return nil, fmt.Errorf("connecting to syslog: %v", err)
+		}
+		return &auditLog{w: conn, syslog: true}, nil
+	}
+	f, err := os.OpenFile(dest, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return &auditLog{w: f}, nil
+}
+
+// write appends the record as a line. A syslog message has the user facility and notice
+// severity.
+func (l *auditLog) write(record auditRecord) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	if l.syslog {
+		host, _ := os.Hostname()
+		line = []byte(fmt.Sprintf("<13>%s %s githubrelease[%d]: %s", record.Time.Format(time.Stamp), host, os.Getpid(), line))
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	_, err = l.w.Write(append(line, '\n'))
+	return err
+}
+
+// auditTransport wraps the transport with an auditingTransport if -audit-log is set, and returns it
+// as it is otherwise.
+func (cf *clientFlags) auditTransport(transport http.RoundTripper) (http.RoundTripper, error) {
+	if cf.auditLog == "" {
+		return transport, nil
+	}
+	auditMu.Lock()
+	defer auditMu.Unlock()
+	l, ok := auditLogs[cf.auditLog]
+	if !ok {
+		var err error
+		if l, err = openAuditLog(cf.auditLog); err != nil {
+			return nil, fmt.Errorf("opening -audit-log: %v", err)
+		}
+		auditLogs[cf.auditLog] = l
+	}
+	return &auditingTransport{next: transport, log: l, command: cf.command, apiURL: cf.auditAPIURL(), appID: cf.appID, actors: map[string]string{}}, nil
+}
+
+// auditAPIURL returns the api URL of the -provider, which the actor of a token is looked up on.
+func (cf *clientFlags) auditAPIURL() string {
+	switch cf.provider {
+	case providerGitea:
+		return release.NormalizeGiteaAPIURL(cf.apiURL)
+	case providerGitLab:
+		apiURL := cf.apiURL
+		if apiURL == release.DefaultAPIURL {
+			apiURL = gitlabDefaultURL
+		}
+		return release.NormalizeGitLabAPIURL(apiURL)
+	}
+	return release.NormalizeAPIURL(cf.apiURL)
+}
+
+// auditingTransport records every request that changes a repository in the -audit-log, once it
+// has succeeded. Requests that only read, and those that fail and so change nothing, are not
+// recorded.
+type auditingTransport struct {
+	next    http.RoundTripper
+	log     *auditLog
+	command string
+	apiURL  string
+	appID   int64
+
+	mu sync.Mutex
+	// actors are the users that the tokens belong to, by the Authorization header they are sent in.
+	actors map[string]string
+}
+
+// auditRepoPath matches the path of a repository api request, with the owner, repo and the rest
+// of the path.
+var auditRepoPath = regexp.MustCompile(`/repos/([^/]+)/([^/]+)/(.+)$`)
+
+func (t *auditingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.next.RoundTrip(req)
+	if err != nil || resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp, err
+	}
+	record, ok := auditAction(req)
+	if !ok {
+		return resp, err
+	}
+	resp.Body = t.readIDs(resp, &record)
+	note, _ := req.Context().Value(auditNoteKey{}).(auditNote)
+	if note.action != "" {
+		record.Action = note.action
+	}
+	if note.tag != "" && record.Tag == "" {
+		record.Tag = note.tag
+	}
+	if note.asset != "" && record.Asset == "" {
+		record.Asset = note.asset
+	}
+	record.Time = time.Now().UTC()
+	record.Command = t.command
+	record.Actor = t.actor(req)
+	record.Method = req.Method
+	record.URL = redact(req.URL.String())
+	record.Status = resp.StatusCode
+	record.RequestID = resp.Header.Get("X-GitHub-Request-Id")
+	if record.RequestID == "" {
+		record.RequestID = resp.Header.Get("X-Request-Id")
+	}
+	if err := t.log.write(record); err != nil {
+		log.Printf("warn: writing to the audit log: %v", err)
+	}
+	return resp, nil
+}
+
+// auditAction returns the record for a request that changes a repository, with the action and
+// what the path says about it, or false for a request that does not.
+func auditAction(req *http.Request) (auditRecord, bool) {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return auditRecord{}, false
+	}
+	m := auditRepoPath.FindStringSubmatch(req.URL.Path)
+	if m == nil {
+		return auditRecord{}, false
+	}
+	record := auditRecord{Repo: m[1] + "/" + m[2]}
+	parts := strings.Split(m[3], "/")
+	id := func(s string) int {
+		n, _ := strconv.Atoi(s)
+		return n
+	}
+	switch {
+	case m[3] == "releases/generate-notes":
+		// Generating notes only reads.
+		return auditRecord{}, false
+	case m[3] == "releases" && req.Method == http.MethodPost:
+		record.Action = "release.created"
+	case len(parts) == 2 && parts[0] == "releases" && req.Method == http.MethodPatch:
+		record.Action = "release.edited"
+		if publishesRelease(req) {
+			record.Action = "release.published"
+		}
+		record.ReleaseID = id(parts[1])
+	case len(parts) == 2 && parts[0] == "releases" && req.Method == http.MethodDelete:
+		record.Action = "release.deleted"
+		record.ReleaseID = id(parts[1])
+	case len(parts) == 3 && parts[0] == "releases" && parts[2] == "assets" && req.Method == http.MethodPost:
+		record.Action = "asset.uploaded"
+		record.ReleaseID = id(parts[1])
+		record.Asset = req.URL.Query().Get("name")
+	case len(parts) == 3 && parts[0] == "releases" && parts[1] == "assets" && req.Method == http.MethodPatch:
+		record.Action = "asset.edited"
+		record.AssetID = id(parts[2])
+	case len(parts) == 3 && parts[0] == "releases" && parts[1] == "assets" && req.Method == http.MethodDelete:
+		record.Action = "asset.deleted"
+		record.AssetID = id(parts[2])
+	case m[3] == "git/refs" && req.Method == http.MethodPost:
+		// The action becomes tag.created once the response shows that the ref is a tag.
+		record.Action = "ref.created"
+	case strings.HasPrefix(m[3], "git/refs/tags/") && req.Method == http.MethodDelete:
+		record.Action = "tag.deleted"
+		record.Tag = strings.TrimPrefix(m[3], "git/refs/tags/")
+	case m[3] == "git/tags" && req.Method == http.MethodPost:
+		// The annotated tag object, which is only visible once the tag ref is created.
+		record.Action = "tag_object.created"
+	case strings.HasPrefix(m[3], "contents/"):
+		record.Action = "file.updated"
+	default:
+		record.Action = "repo.changed"
+	}
+	return record, true
+}
+
+// publishesRelease returns whether the release edit request sets draft to false.
+func publishesRelease(req *http.Request) bool {
+	if req.GetBody == nil {
+		return false
+	}
+	body, err := req.GetBody()
+	if err != nil {
+		return false
+	}
+	defer body.Close()
+	var edit struct {
+		Draft *bool `json:"draft"`
+	}
+	return json.NewDecoder(body).Decode(&edit) == nil && edit.Draft != nil && !*edit.Draft
+}
+
+// readIDs fills in the ids, tag and names of the record from the JSON response, and returns the
+// body to read the response from in its place.
+func (t *auditingTransport) readIDs(resp *http.Response, record *auditRecord) io.ReadCloser {
+	data, err := ioutil.ReadAll(io.LimitReader(resp.Body, auditResponseLimit))
+	body := struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(data), resp.Body), resp.Body}
+	if err != nil || len(data) == 0 {
+		return body
+	}
+	var fields struct {
+		ID      int    `json:"id"`
+		Name    string `json:"name"`
+		TagName string `json:"tag_name"`
+		Tag     string `json:"tag"`
+		Ref     string `json:"ref"`
+	}
+	if json.Unmarshal(data, &fields) != nil {
+		return body
+	}
+	switch {
+	case strings.HasPrefix(record.Action, "release."):
+		record.ReleaseID, record.Tag = fields.ID, fields.TagName
+	case strings.HasPrefix(record.Action, "asset."):
+		record.AssetID, record.Asset = fields.ID, fields.Name
+	case record.Action == "tag_object.created":
+		record.Tag = fields.Tag
+	case record.Action == "ref.created":
+		if tag := strings.TrimPrefix(fields.Ref, "refs/tags/"); tag != fields.Ref {
+			record.Action, record.Tag = "tag.created", tag
+		}
+	}
+	return body
+}
+
+// actor returns the user that the token of the request belongs to, from GET /user, which is
+// looked up once for each token. A GitHub App installation token has no user, so it is recorded
+// as the app.
+func (t *auditingTransport) actor(req *http.Request) string {
+	token := req.Header.Get("Authorization") + req.Header.Get("PRIVATE-TOKEN")
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if actor, ok := t.actors[token]; ok {
+		return actor
+	}
+	actor := ""
+	lookup, err := http.NewRequestWithContext(req.Context(), http.MethodGet, strings.TrimSuffix(t.apiURL, "/")+"/user", nil)
+	if err == nil {
+		for _, h := range []string{"Authorization", "PRIVATE-TOKEN", "User-Agent", "Accept"} {
+			if v := req.Header.Get(h); v != "" {
+				lookup.Header.Set(h, v)
+			}
+		}
+		if resp, err := t.next.RoundTrip(lookup); err == nil {
+			var user struct {
+				Login    string `json:"login"`
+				Username string `json:"username"`
+			}
+			if resp.StatusCode == http.StatusOK && json.NewDecoder(resp.Body).Decode(&user) == nil {
+				actor = user.Login
+				if actor == "" {
+					actor = user.Username
+				}
+			}
+			resp.Body.Close()
+		}
+	}
+	if actor == "" && t.appID != 0 {
+		actor = fmt.Sprintf("app/%d", t.appID)
+	}
+	t.actors[token] = actor
+	return actor
+}
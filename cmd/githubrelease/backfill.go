@@ -0,0 +1,227 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/imitablerabbit/githubrelease/pkg/release"
+)
+
+// The sources of the notes of backfilled releases.
+const (
+	backfillNotesGitHub  = "github"
+	backfillNotesCommits = "commits"
+	backfillNotesNone    = "none"
+)
+
+// backfillFlags are the flags of the backfill command.
+type backfillFlags struct {
+	tagPrefix      string
+	notes          string
+	draft          bool
+	autoPrerelease bool
+	dateNote       bool
+	dryRun         *bool
+}
+
+// datedTag is a tag with the date of its commit.
+type datedTag struct {
+	release.RepoTag
+	date time.Time
+}
+
+// runBackfill creates releases for the tags that do not have one, oldest first, for repos that
+// started making releases after they started tagging.
+func runBackfill(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("backfill", flag.ContinueOnError)
+	cf := addClientFlags(fs)
+	cf.writesReleases = true
+	f := &backfillFlags{}
+	fs.StringVar(&f.tagPrefix, "tag-prefix", "", "Only backfill the tags that start with this prefix, e.g. api/ for api/v1.2.0")
+	fs.StringVar(&f.notes, "notes", backfillNotesGitHub, "The notes of each release: github to have GitHub generate them, commits to list the commit messages since the previous tag, or none")
+	fs.BoolVar(&f.draft, "draft", false, "Create the releases as drafts")
+	fs.BoolVar(&f.autoPrerelease, "auto-prerelease", false, "Mark the releases for tags with a SemVer pre-release suffix or a major version of 0 as pre-releases. Otherwise only tags with a suffix are")
+	fs.BoolVar(&f.dateNote, "date-note", true, "End the notes with the date of the tag, as the release is published on the day it is backfilled")
+	f.dryRun = addDryRunFlag(fs)
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	switch f.notes {
+	case backfillNotesGitHub, backfillNotesCommits, backfillNotesNone:
+	default:
+		return withExitCode(exitValidation, fmt.Errorf("unsupported -notes %q, expected github, commits or none", f.notes))
+	}
+
+	ctx, cancel := cf.withTimeout(ctx)
+	defer cancel()
+	client, err := cf.newClient(ctx)
+	if err != nil {
+		return err
+	}
+	tags, missing, err := f.findMissing(ctx, client)
+	if err != nil {
+		return err
+	}
+	if len(missing) == 0 {
+		log.Printf("info: every tag has a release")
+		return nil
+	}
+	log.Printf("info: %d of %d tag(s) have no release", len(missing), len(tags))
+
+	latest := f.latestTag(tags)
+	var p *plan
+	if *f.dryRun {
+		p = newPlan(client)
+	}
+	for _, i := range missing {
+		req, err := f.releaseRequest(ctx, client, tags, i)
+		if err != nil {
+			return err
+		}
+		// Releases are marked as the latest by creation date, so only the newest tag may be.
+		req.MakeLatest = release.MakeLatestFalse
+		if tags[i].Name == latest && !req.Draft && !req.PreRelease {
+			req.MakeLatest = release.MakeLatestTrue
+		}
+		if p != nil {
+			if err := p.request("POST", "releases", req); err != nil {
+				return err
+			}
+			continue
+		}
+		rel, err := client.CreateRelease(ctx, req)
+		if err != nil {
+			return fmt.Errorf("creating release for %s: %v", tags[i].Name, err)
+		}
+		log.Printf("info: created release %d for %s", rel.ID, rel.TagName)
+		fmt.Println(rel.HTMLURL)
+	}
+	return nil
+}
+
+// findMissing returns the tags with the prefix sorted by the date of their commits, oldest first,
+// and the indexes of those without a release. Tags of the same commit are sorted by version.
+func (f *backfillFlags) findMissing(ctx context.Context, client *release.Client) ([]datedTag, []int, error) {
+	repoTags, err := client.ListAllTags(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	releases, err := client.ListAllReleases(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	released := map[string]bool{}
+	for _, rel := range releases {
+		released[rel.TagName] = true
+	}
+
+	var tags []datedTag
+	for _, tag := range repoTags {
+		if !strings.HasPrefix(tag.Name, f.tagPrefix) {
+			continue
+		}
+		commit, err := client.GetCommit(ctx, tag.Commit.SHA)
+		if err != nil {
+			return nil, nil, fmt.Errorf("dating %s: %v", tag.Name, err)
+		}
+		tags = append(tags, datedTag{RepoTag: tag, date: commit.Commit.Committer.Date})
+	}
+	sort.SliceStable(tags, func(i, j int) bool {
+		if !tags[i].date.Equal(tags[j].date) {
+			return tags[i].date.Before(tags[j].date)
+		}
+		vi, iok := parseSemver(tagVersion(tags[i].Name))
+		vj, jok := parseSemver(tagVersion(tags[j].Name))
+		if iok && jok {
+			return vi.less(vj)
+		}
+		return tags[i].Name < tags[j].Name
+	})
+
+	var missing []int
+	for i, tag := range tags {
+		if !released[tag.Name] {
+			missing = append(missing, i)
+		}
+	}
+	return tags, missing, nil
+}
+
+// latestTag returns the newest tag that is not a pre-release, which should end up marked as the
+// latest release if it is backfilled.
+func (f *backfillFlags) latestTag(tags []datedTag) string {
+	for i := len(tags) - 1; i >= 0; i-- {
+		if !f.prerelease(tags[i].Name) {
+			return tags[i].Name
+		}
+	}
+	return ""
+}
+
+// prerelease reports whether the release for the tag is a pre-release.
+func (f *backfillFlags) prerelease(tag string) bool {
+	v, ok := parseSemver(tagVersion(tag))
+	switch {
+	case !ok:
+		return false
+	case v.PreRelease != "":
+		return true
+	}
+	return f.autoPrerelease && v.Major == 0
+}
+
+// releaseRequest returns the request that creates the release for tags[i], with the notes of the
+// changes since the tag before it. The notes of a full release cover the changes since the full
+// release before it, skipping the pre-releases in between.
+func (f *backfillFlags) releaseRequest(ctx context.Context, client *release.Client, tags []datedTag, i int) (*release.CreateReleaseRequest, error) {
+	tag := tags[i]
+	previous := ""
+	for j := i - 1; j >= 0; j-- {
+		if f.prerelease(tag.Name) || !f.prerelease(tags[j].Name) {
+			previous = tags[j].Name
+			break
+		}
+	}
+	req := &release.CreateReleaseRequest{
+		TagName:         tag.Name,
+		TargetCommitish: tag.Commit.SHA,
+		Name:            tag.Name,
+		Draft:           f.draft,
+		PreRelease:      f.prerelease(tag.Name),
+	}
+	switch f.notes {
+	case backfillNotesGitHub:
+		notes, err := client.GenerateReleaseNotes(ctx, &release.GenerateNotesRequest{TagName: tag.Name, PreviousTagName: previous})
+		if err != nil {
+			return nil, fmt.Errorf("generating notes for %s: %v", tag.Name, err)
+		}
+		req.Body = notes.Body
+	case backfillNotesCommits:
+		if previous == "" {
+			break
+		}
+		commits, err := client.CompareCommits(ctx, previous, tag.Name)
+		if err != nil {
+			return nil, err
+		}
+		var b strings.Builder
+		for j := len(commits) - 1; j >= 0; j-- {
+			subject, _, _ := strings.Cut(commits[j].Commit.Message, "\n")
+			sha := commits[j].SHA
+			if len(sha) > 7 {
+				sha = sha[:7]
+			}
+			fmt.Fprintf(&b, "- %s (%s)\n", subject, sha)
+		}
+		req.Body = strings.TrimSuffix(b.String(), "\n")
+	}
+	if f.dateNote && !tag.date.IsZero() {
+		req.Body = joinBody(req.Body, fmt.Sprintf("_Tagged on %s._", tag.date.UTC().Format("2006-01-02")))
+	}
+	return req, nil
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// bandwidthUnits are the units accepted in a bandwidth, e.g. 10MB/s. The SI units are powers of
+// 1000 and the IEC units are powers of 1024.
+var bandwidthUnits = []struct {
+	suffix string
+	size   float64
+}{
+	{"KiB", 1 << 10}, {"MiB", 1 << 20}, {"GiB", 1 << 30},
+	{"KB", 1e3}, {"MB", 1e6}, {"GB", 1e9},
+	{"K", 1e3}, {"M", 1e6}, {"G", 1e9},
+	{"B", 1},
+}
+
+// bandwidthFlag is a flag for a number of bytes per second, such as 10MB/s or 512KiB. Zero means
+// no limit.
+type bandwidthFlag int64
+
+func (b *bandwidthFlag) String() string {
+	if *b == 0 {
+		return ""
+	}
+	return formatBytes(float64(*b)) + "/s"
+}
+
+func (b *bandwidthFlag) Set(value string) error {
+	n, err := parseBandwidth(value)
+	if err != nil {
+		return err
+	}
+	*b = bandwidthFlag(n)
+	return nil
+}
+
+// parseBandwidth parses a bandwidth such as 10MB/s into bytes per second. A number without a unit
+// is a number of bytes.
+func parseBandwidth(value string) (int64, error) {
+	s := strings.TrimSuffix(strings.TrimSpace(value), "/s")
+	size := 1.0
+	for _, unit := range bandwidthUnits {
+		if strings.HasSuffix(strings.ToUpper(s), strings.ToUpper(unit.suffix)) {
+			s, size = strings.TrimSpace(s[:len(s)-len(unit.suffix)]), unit.size
+			break
+		}
+	}
+	n, err := strconv.ParseFloat(s, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid bandwidth %q, expected a rate such as 10MB/s", value)
+	}
+	return int64(n * size), nil
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/imitablerabbit/githubrelease/pkg/release"
+)
+
+// maxBodyLength is the most characters that GitHub keeps of a release body.
+const maxBodyLength = 125000
+
+// overflowNames are the names that the full notes of a truncated body are uploaded as, the first
+// one that is not already an asset is used.
+var overflowNames = []string{"CHANGELOG.md", "RELEASE_NOTES.md"}
+
+// overflowBody returns the body as it is if GitHub can keep all of it. Otherwise the body is cut
+// at the last line that fits, with a link to the full notes, which are written to a file in a
+// temporary directory to be uploaded as an asset. The cleanup function removes the file.
+func overflowBody(client *release.Client, tag, body string, assets []release.AssetUpload) (string, *release.AssetUpload, func(), error) {
+	cleanup := func() {}
+	length := utf8.RuneCountInString(body)
+	if length <= maxBodyLength {
+		return body, nil, cleanup, nil
+	}
+	name := ""
+	for _, candidate := range overflowNames {
+		if !hasAssetNamed(assets, candidate) {
+			name = candidate
+			break
+		}
+	}
+	if name == "" {
+		return "", nil, cleanup, fmt.Errorf("the release body is %d characters, more than the %d that GitHub keeps, and %s are already assets so the full notes cannot be uploaded", length, maxBodyLength, strings.Join(overflowNames, " and "))
+	}
+
+	webURL, err := release.WebURL(client.APIURL)
+	if err != nil {
+		return "", nil, cleanup, err
+	}
+	link := fmt.Sprintf("%s/%s/%s/releases/download/%s/%s", webURL, client.User, client.Repo, url.PathEscape(tag), name)
+	footer := fmt.Sprintf("\n\n---\n\nThese release notes are too long for GitHub and have been cut short, see the [full changelog](%s).", link)
+	truncated := truncateBody(body, maxBodyLength-utf8.RuneCountInString(footer)) + footer
+
+	dir, err := ioutil.TempDir("", "githubrelease-notes")
+	if err != nil {
+		return "", nil, cleanup, err
+	}
+	cleanup = func() { os.RemoveAll(dir) }
+	path := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(path, []byte(body+"\n"), 0644); err != nil {
+		return "", nil, cleanup, err
+	}
+	log.Printf("warn: the release body is %d characters, more than the %d that GitHub keeps, cutting it short and uploading the full notes as %s", length, maxBodyLength, name)
+	return truncated, &release.AssetUpload{Path: path, Name: name, ContentType: "text/markdown"}, cleanup, nil
+}
+
+// truncateBody returns the lines of the body that fit in the number of characters. A code block
+// that is cut off is closed so that the rest of the body is not shown as code.
+func truncateBody(body string, max int) string {
+	fence := "\n```"
+	cut := body
+	if utf8.RuneCountInString(cut) > max-len(fence) {
+		runes := []rune(body)[:max-len(fence)]
+		cut = string(runes)
+		if i := strings.LastIndex(cut, "\n"); i > 0 {
+			cut = cut[:i]
+		}
+	}
+	cut = strings.TrimRight(cut, "\n")
+	open := false
+	for _, line := range strings.Split(cut, "\n") {
+		if strings.HasPrefix(strings.TrimSpace(line), "```") {
+			open = !open
+		}
+	}
+	if open {
+		cut += fence
+	}
+	return cut
+}
+
+// hasAssetNamed reports whether one of the assets has the name.
+func hasAssetNamed(assets []release.AssetUpload, name string) bool {
+	for _, asset := range assets {
+		if asset.Name == name {
+			return true
+		}
+	}
+	return false
+}
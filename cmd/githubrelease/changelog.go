@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"strings"
+)
+
+// changelogLinkRef matches the link reference definitions that Keep a Changelog puts after the
+// last section, e.g. "[1.2.3]: https://github.com/o/r/compare/v1.2.2...v1.2.3".
+var changelogLinkRef = regexp.MustCompile(`^\[[^\]]+\]:\s`)
+
+// changelogHeading is a heading in a changelog with its level, 1 for #, and the line it is on.
+type changelogHeading struct {
+	level int
+	text  string
+	line  int
+
+	// setext is set for a heading underlined with = or -, whose underline is the next line.
+	setext bool
+}
+
+// changelogHeadings returns the headings of the markdown lines, skipping any in code blocks.
+func changelogHeadings(lines []string) []changelogHeading {
+	var headings []changelogHeading
+	fence := ""
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if fence != "" {
+			if strings.HasPrefix(trimmed, fence) {
+				fence = ""
+			}
+			continue
+		}
+		if strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~") {
+			fence = trimmed[:3]
+			continue
+		}
+		if strings.HasPrefix(line, "#") {
+			level := len(line) - len(strings.TrimLeft(line, "#"))
+			text := line[level:]
+			if level <= 6 && (text == "" || text[0] == ' ' || text[0] == '\t') {
+				headings = append(headings, changelogHeading{level: level, text: strings.Trim(strings.TrimSpace(text), "#"), line: i})
+			}
+			continue
+		}
+		// A line of text underlined with = is a level 1 heading and with - a level 2 heading.
+		if trimmed != "" && i+1 < len(lines) {
+			underline := strings.TrimSpace(lines[i+1])
+			if underline != "" && strings.Trim(underline, "=") == "" {
+				headings = append(headings, changelogHeading{level: 1, text: trimmed, line: i, setext: true})
+			} else if len(underline) > 1 && strings.Trim(underline, "-") == "" && !strings.HasPrefix(trimmed, "-") {
+				headings = append(headings, changelogHeading{level: 2, text: trimmed, line: i, setext: true})
+			}
+		}
+	}
+	return headings
+}
+
+// changelogSection returns the notes under the heading for the version in the changelog, up to
+// the next heading of the same or a higher level, and whether there is a heading for it. Headings
+// such as "## [1.2.3] - 2024-01-31", "## v1.2.3 (2024-01-31)" and "### [1.2.3](compare-url)" are
+// recognized, with or without a v before the version.
+func changelogSection(changelog, version string) (string, bool) {
+	match := regexp.MustCompile(`(^|[^0-9A-Za-z.])v?` + regexp.QuoteMeta(version) + `($|[^0-9A-Za-z.-])`)
+	lines := strings.Split(strings.ReplaceAll(changelog, "\r\n", "\n"), "\n")
+	headings := changelogHeadings(lines)
+	for i, h := range headings {
+		if !match.MatchString(h.text) {
+			continue
+		}
+		start, end := h.line+1, len(lines)
+		if h.setext {
+			start++
+		}
+		for _, next := range headings[i+1:] {
+			if next.level <= h.level {
+				end = next.line
+				break
+			}
+		}
+		section := lines[start:end]
+		for len(section) > 0 {
+			last := strings.TrimSpace(section[len(section)-1])
+			if last != "" && !changelogLinkRef.MatchString(last) {
+				break
+			}
+			section = section[:len(section)-1]
+		}
+		return strings.TrimSpace(strings.Join(section, "\n")), true
+	}
+	return "", false
+}
+
+// readChangelogSection reads the changelog file and returns the notes in its section for the
+// version, or an error if it has no section for the version or the section is empty, so that a
+// release is never published with empty notes.
+func readChangelogSection(path, version string) (string, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("reading changelog: %v", err)
+	}
+	notes, ok := changelogSection(string(data), version)
+	if !ok {
+		return "", fmt.Errorf("%s has no section for %s, add one with a heading such as \"## [%s] - YYYY-MM-DD\"", path, version, version)
+	}
+	if notes == "" {
+		return "", fmt.Errorf("the section for %s in %s is empty", version, path)
+	}
+	return notes, nil
+}
@@ -0,0 +1,302 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/imitablerabbit/githubrelease/pkg/release"
+)
+
+// The outcomes of a pre-flight check.
+const (
+	checkOK   = "ok"
+	checkWarn = "warn"
+	checkFail = "fail"
+)
+
+// checkResult is the outcome of a single pre-flight check.
+type checkResult struct {
+	Check   string `json:"check"`
+	Repo    string `json:"repo,omitempty"`
+	Status  string `json:"status"`
+	Message string `json:"message"`
+}
+
+// checkReport is the validation report written by the check command.
+type checkReport struct {
+	OK         bool          `json:"ok"`
+	Tag        string        `json:"tag,omitempty"`
+	Assets     int           `json:"assets"`
+	UploadSize int64         `json:"upload_size"`
+	Checks     []checkResult `json:"checks"`
+}
+
+// add records the outcome of a check. The report fails if any check fails.
+func (r *checkReport) add(check, repo, status, format string, v ...interface{}) {
+	r.Checks = append(r.Checks, checkResult{Check: check, Repo: repo, Status: status, Message: fmt.Sprintf(format, v...)})
+	if status == checkFail {
+		r.OK = false
+	}
+}
+
+// runCheck validates a release before anything is created. It accepts the same flags as create,
+// so a pipeline can run check with the arguments it is about to pass to create.
+func runCheck(ctx context.Context, args []string) error {
+	fs, cf, uf, f := newCreateFlagSet()
+	fs.Init("check", fs.ErrorHandling())
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if err := checkOutputFormat(*f.output); err != nil {
+		return err
+	}
+	if f.all || len(f.components) > 0 {
+		return withExitCode(exitValidation, fmt.Errorf("check does not support -all or -component, check each component with its -tag-prefix and flags instead"))
+	}
+	ctx, cancel := cf.withTimeout(ctx)
+	defer cancel()
+
+	report := &checkReport{OK: true}
+	var err error
+	if err := readBodyFile(f.bodyFile, &f.body); err != nil {
+		report.add("flags", "", checkFail, "%v", err)
+	} else if err := f.check(); err != nil {
+		report.add("flags", "", checkFail, "%v", err)
+	} else {
+		report.add("flags", "", checkOK, "the flags are valid")
+	}
+	if uf.pkg {
+		if uf.packageTag, err = packageTag(ctx, cf, f); err != nil {
+			report.add("assets", "", checkFail, "%v", err)
+		}
+		_, uf.projectName, _ = cf.forEachRepo()[0].repoName()
+	}
+	checkAssets(report, uf)
+	for _, rcf := range cf.forEachRepo() {
+		if err := checkRepo(ctx, report, rcf, f); err != nil {
+			return err
+		}
+	}
+
+	if err := writeCheckReport(*f.output, report); err != nil {
+		return err
+	}
+	if !report.OK {
+		return withExitCode(exitValidation, fmt.Errorf("the release failed %d check(s)", countFailed(report)))
+	}
+	return nil
+}
+
+// checkAssets lists the assets that would be uploaded and checks them against the GitHub limits.
+func checkAssets(report *checkReport, uf *uploadFlags) {
+	assets, cleanup, err := uf.prepareAssets()
+	defer cleanup()
+	if err != nil {
+		report.add("assets", "", checkFail, "%v", err)
+		return
+	}
+	report.Assets = len(assets)
+	for _, asset := range assets {
+		// The size of a remote asset is only known once it is streamed.
+		if isRemoteAsset(asset.Path) {
+			report.add("assets", "", checkOK, "%s is streamed from %s", asset.Name, displayURL(asset.Path))
+			continue
+		}
+		info, err := os.Stat(asset.Path)
+		if err != nil {
+			report.add("assets", "", checkFail, "%v", err)
+			continue
+		}
+		report.UploadSize += info.Size()
+		switch {
+		case info.Size() > release.MaxAssetSize:
+			report.add("assets", "", checkFail, "%s is %s, GitHub only accepts assets up to %s", asset.Name,
+				formatBytes(float64(info.Size())), formatBytes(release.MaxAssetSize))
+		case info.Size() == 0:
+			report.add("assets", "", checkWarn, "%s is empty", asset.Name)
+		}
+	}
+	if len(assets) == 0 {
+		report.add("assets", "", checkWarn, "there are no assets to upload")
+		return
+	}
+	report.add("assets", "", checkOK, "%d asset(s) to upload, %s in total", len(assets), formatBytes(float64(report.UploadSize)))
+}
+
+// checkRepo checks the token, the repository and the release tag and target in the repo of the
+// client flags. Only an error that stops the checks, such as the command being interrupted, is
+// returned, everything else is added to the report.
+func checkRepo(ctx context.Context, report *checkReport, cf *clientFlags, f *createFlags) error {
+	client, err := cf.newClient(ctx)
+	if err != nil {
+		report.add("token", strings.Join(cf.repos, ","), checkFail, "%v", err)
+		return nil
+	}
+	repo := client.User + "/" + client.Repo
+
+	token, err := client.GetTokenInfo(ctx)
+	switch {
+	case err != nil && ctx.Err() != nil:
+		return ctx.Err()
+	case err != nil:
+		// Installation tokens cannot read the user, the repository permissions are checked below.
+		report.add("token", repo, checkWarn, "%v", err)
+	case !token.HasRepoScope():
+		report.add("token", repo, checkFail, "the token for %s has scopes %q, creating releases needs repo or public_repo", token.Login, strings.Join(token.Scopes, ", "))
+	case token.Classic:
+		report.add("token", repo, checkOK, "authenticated as %s with scopes %s", token.Login, strings.Join(token.Scopes, ", "))
+	default:
+		report.add("token", repo, checkOK, "authenticated as %s", token.Login)
+	}
+
+	r, err := client.GetRepository(ctx)
+	switch {
+	case err != nil && ctx.Err() != nil:
+		return ctx.Err()
+	case err != nil:
+		report.add("repo", repo, checkFail, "%v", err)
+		// Nothing else can be checked without access to the repository.
+		return nil
+	case r.Archived:
+		report.add("repo", repo, checkFail, "%s is archived and read only", r.FullName)
+	case !r.Permissions.Push && r.Permissions.Pull:
+		report.add("repo", repo, checkFail, "the token cannot push to %s, which creating releases needs", r.FullName)
+	case token != nil && token.Classic:
+		report.add("repo", repo, checkOK, "the token can create releases in %s", r.FullName)
+	default:
+		// Fine-grained and app tokens have permissions of their own, which cannot be read.
+		if err := client.CheckReleasePermission(ctx); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			report.add("repo", repo, checkFail, "%v", err)
+		} else {
+			report.add("repo", repo, checkOK, "the token can create releases in %s", r.FullName)
+		}
+	}
+
+	tag := f.tag
+	if f.bump != "" {
+		if tag, err = nextTag(ctx, client, f.bump, f.targetCommitish, f.tagPrefix); err != nil {
+			report.add("tag", repo, checkFail, "%v", err)
+			return nil
+		}
+	} else if tag != "" && !strings.HasPrefix(tag, f.tagPrefix) {
+		tag = f.tagPrefix + tag
+	}
+	report.Tag = tag
+	checkTag(ctx, report, client, repo, tag, f.updateExisting)
+	if f.changelog != "" && tag != "" {
+		if _, err := readChangelogSection(f.changelog, releaseVersion(tag)); err != nil {
+			report.add("changelog", repo, checkFail, "%v", err)
+		} else {
+			report.add("changelog", repo, checkOK, "%s has notes for %s", f.changelog, releaseVersion(tag))
+		}
+	}
+
+	target, err := client.ResolveTarget(ctx, f.targetCommitish)
+	if err != nil {
+		report.add("target", repo, checkFail, "%v", err)
+	} else {
+		report.add("target", repo, checkOK, "%s is a %s at %s", f.targetCommitish, target.Kind, shortSHA(target.SHA))
+	}
+	if f.requireChecks && tag != "" && err == nil {
+		if _, err := f.resolveTarget(ctx, client, tag); err != nil {
+			report.add("checks", repo, checkFail, "%v", err)
+		} else {
+			report.add("checks", repo, checkOK, "the checks on the released commit have passed")
+		}
+	}
+	return nil
+}
+
+// checkTag checks that the tag is a valid git tag name, preferably a SemVer version, and that
+// there is no release for it yet unless it is going to be updated.
+func checkTag(ctx context.Context, report *checkReport, client *release.Client, repo, tag string, updateExisting bool) {
+	if tag == "" {
+		report.add("tag", repo, checkFail, "-release-tag or -bump is required")
+		return
+	}
+	if err := checkRefName(tag); err != nil {
+		report.add("tag", repo, checkFail, "%v", err)
+		return
+	}
+	if _, ok := parseSemver(tagVersion(tag)); !ok {
+		report.add("tag", repo, checkWarn, "%s is not a SemVer version", tag)
+	}
+	existing, err := client.FindReleaseByTag(ctx, tag)
+	switch {
+	case err != nil:
+		report.add("tag", repo, checkFail, "%v", err)
+	case existing != nil && updateExisting:
+		report.add("tag", repo, checkOK, "release %d for %s will be updated", existing.ID, tag)
+	case existing != nil:
+		report.add("tag", repo, checkFail, "release %d already exists for %s, use -update-existing to update it", existing.ID, tag)
+	default:
+		report.add("tag", repo, checkOK, "%s has no release yet", tag)
+	}
+}
+
+// checkRefName returns an error if the tag is not a valid git reference name, following the rules
+// of git check-ref-format.
+func checkRefName(tag string) error {
+	invalid := func(reason string) error {
+		return fmt.Errorf("%q is not a valid tag name: %s", tag, reason)
+	}
+	switch {
+	case strings.HasPrefix(tag, "-"):
+		return invalid("it starts with -")
+	case strings.HasPrefix(tag, "/") || strings.HasSuffix(tag, "/") || strings.Contains(tag, "//"):
+		return invalid("it has an empty path component")
+	case strings.HasSuffix(tag, ".") || strings.HasSuffix(tag, ".lock"):
+		return invalid("it ends with . or .lock")
+	case strings.Contains(tag, "..") || strings.Contains(tag, "@{") || tag == "@":
+		return invalid("it contains .. or @{")
+	case strings.ContainsAny(tag, " ~^:?*[\\"):
+		return invalid("it contains a space or one of ~^:?*[\\")
+	}
+	for _, part := range strings.Split(tag, "/") {
+		if strings.HasPrefix(part, ".") {
+			return invalid("a path component starts with .")
+		}
+	}
+	for _, r := range tag {
+		if r < 0x20 || r == 0x7f {
+			return invalid("it contains a control character")
+		}
+	}
+	return nil
+}
+
+// countFailed returns the number of failed checks in the report.
+func countFailed(report *checkReport) int {
+	failed := 0
+	for _, c := range report.Checks {
+		if c.Status == checkFail {
+			failed++
+		}
+	}
+	return failed
+}
+
+// writeCheckReport writes the report to stdout as a table, or as JSON with -output json.
+func writeCheckReport(format string, report *checkReport) error {
+	if format == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(report); err != nil {
+			return fmt.Errorf("writing json output: %v", err)
+		}
+		return nil
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "STATUS\tCHECK\tREPO\tMESSAGE")
+	for _, c := range report.Checks {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", c.Status, c.Check, c.Repo, c.Message)
+	}
+	return w.Flush()
+}
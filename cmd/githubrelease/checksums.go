@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/imitablerabbit/githubrelease/pkg/release"
+)
+
+// checksumAssets writes a checksums file for each of the comma separated algorithms into a
+// temporary directory and returns them as assets to upload alongside the others. With a single
+// algorithm the file is called filename, with several the algorithm is added before the
+// extension, e.g. checksums.sha512.txt. The caller should remove the returned directory.
+func checksumAssets(assets []release.AssetUpload, algorithms, filename string) ([]release.AssetUpload, string, error) {
+	dir, err := ioutil.TempDir("", "githubrelease-checksums")
+	if err != nil {
+		return nil, "", err
+	}
+	algs := strings.Split(algorithms, ",")
+	var checksums []release.AssetUpload
+	for _, alg := range algs {
+		alg = strings.ToLower(strings.TrimSpace(alg))
+		name := filename
+		if len(algs) > 1 {
+			ext := filepath.Ext(filename)
+			name = strings.TrimSuffix(filename, ext) + "." + alg + ext
+		}
+		path := filepath.Join(dir, name)
+		f, err := os.Create(path)
+		if err != nil {
+			os.RemoveAll(dir)
+			return nil, "", err
+		}
+		err = release.WriteChecksums(f, assets, alg)
+		f.Close()
+		if err != nil {
+			os.RemoveAll(dir)
+			return nil, "", fmt.Errorf("writing %s checksums: %v", alg, err)
+		}
+		checksums = append(checksums, release.AssetUpload{Path: path, Name: name, ContentType: "text/plain; charset=utf-8"})
+	}
+	return checksums, dir, nil
+}
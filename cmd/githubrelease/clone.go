@@ -0,0 +1,213 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+
+	"github.com/imitablerabbit/githubrelease/pkg/release"
+)
+
+// cloneFlags are the flags of the clone command.
+type cloneFlags struct {
+	from           string
+	to             string
+	tag            string
+	fromPAT        string
+	fromAPIURL     string
+	updateExisting bool
+	makeLatest     *string
+	dryRun         *bool
+}
+
+// runClone copies a release and its assets from one repository to another. The assets are
+// streamed from the download of each one to its upload, so nothing is written to disk.
+func runClone(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("clone", flag.ContinueOnError)
+	cf := addClientFlags(fs)
+	cf.writesReleases = true
+	f := &cloneFlags{}
+	fs.StringVar(&f.from, "from", "", "The owner/repo to copy the release from")
+	fs.StringVar(&f.to, "to", "", "The owner/repo to copy the release to")
+	fs.StringVar(&f.tag, "tag", "", "The tag of the release to copy")
+	fs.StringVar(&f.fromPAT, "from-pat", "", "Token for the -from repo, for copying from a private repo or another host. Defaults to -pat")
+	fs.StringVar(&f.fromAPIURL, "from-api-url", "", "Base URL of the API of the -from repo, for copying from another host. Defaults to -api-url")
+	fs.BoolVar(&f.updateExisting, "update-existing", false, "Update the release in the -to repo if there already is one for the tag, uploading only the assets it is missing")
+	f.makeLatest = addMakeLatestFlag(fs)
+	f.dryRun = addDryRunFlag(fs)
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	for _, repo := range []struct{ flag, value string }{{"-from", f.from}, {"-to", f.to}} {
+		if owner, name, ok := strings.Cut(repo.value, "/"); !ok || owner == "" || name == "" {
+			return withExitCode(exitValidation, fmt.Errorf("%s must be given as owner/repo", repo.flag))
+		}
+	}
+	if f.tag == "" {
+		return withExitCode(exitValidation, fmt.Errorf("-tag is required"))
+	}
+	if err := checkMakeLatest(*f.makeLatest); err != nil {
+		return err
+	}
+
+	ctx, cancel := cf.withTimeout(ctx)
+	defer cancel()
+	src, dst := *cf, *cf
+	src.repos, dst.repos = stringsFlag{f.from}, stringsFlag{f.to}
+	src.writesReleases = false
+	if f.fromPAT != "" {
+		src.pat = f.fromPAT
+		addSecret(f.fromPAT)
+	}
+	if f.fromAPIURL != "" {
+		src.apiURL = f.fromAPIURL
+	}
+	from, err := src.newClient(ctx)
+	if err != nil {
+		return fmt.Errorf("%s: %v", f.from, err)
+	}
+	to, err := dst.newClient(ctx)
+	if err != nil {
+		return fmt.Errorf("%s: %v", f.to, err)
+	}
+
+	rel, err := f.clone(ctx, from, to)
+	if err != nil || *f.dryRun {
+		return err
+	}
+	fmt.Println(rel.HTMLURL)
+	return nil
+}
+
+// clone copies the release for the tag. The copy is created as a draft and published once all of
+// its assets are uploaded, unless the release being copied is a draft itself.
+func (f *cloneFlags) clone(ctx context.Context, from, to *release.Client) (*release.Release, error) {
+	rel, err := from.FindReleaseByTag(ctx, f.tag)
+	if err != nil {
+		return nil, err
+	}
+	if rel == nil {
+		return nil, withExitCode(exitNotFound, fmt.Errorf("%s has no release for tag %s", f.from, f.tag))
+	}
+	existing, err := to.FindReleaseByTag(ctx, f.tag)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil && !f.updateExisting {
+		return nil, withExitCode(exitTagConflict, fmt.Errorf("%s already has release %d for tag %s, use -update-existing to update it", f.to, existing.ID, f.tag))
+	}
+	target, err := f.cloneTarget(ctx, from, to)
+	if err != nil {
+		return nil, err
+	}
+	all, _, err := listDownloads(ctx, from, rel, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if *f.dryRun {
+		p := newPlan(to)
+		if existing != nil {
+			prerelease := rel.PreRelease
+			if err := p.request("PATCH", fmt.Sprintf("releases/%d", existing.ID), &release.EditReleaseRequest{Name: rel.Name, Body: rel.Body, PreRelease: &prerelease}); err != nil {
+				return nil, err
+			}
+			p.copies(existing, all)
+			return existing, nil
+		}
+		crr := &release.CreateReleaseRequest{TagName: f.tag, TargetCommitish: target, Name: rel.Name, Body: rel.Body, Draft: true, PreRelease: rel.PreRelease}
+		if err := p.request("POST", "releases", crr); err != nil {
+			return nil, err
+		}
+		p.copies(&release.Release{UploadURL: "<upload_url>"}, all)
+		if !rel.Draft {
+			draft := false
+			if err := p.request("PATCH", "releases/<id>", &release.EditReleaseRequest{Draft: &draft, MakeLatest: *f.makeLatest}); err != nil {
+				return nil, err
+			}
+		}
+		return rel, nil
+	}
+
+	copied := existing
+	uploaded := map[string]bool{}
+	if existing != nil {
+		prerelease := rel.PreRelease
+		if copied, err = to.EditRelease(ctx, existing.ID, &release.EditReleaseRequest{Name: rel.Name, Body: rel.Body, PreRelease: &prerelease}); err != nil {
+			return nil, err
+		}
+		_, have, err := listDownloads(ctx, to, copied, nil, nil)
+		if err != nil {
+			return nil, err
+		}
+		for _, asset := range have {
+			uploaded[asset.name] = true
+		}
+	} else {
+		crr := &release.CreateReleaseRequest{TagName: f.tag, TargetCommitish: target, Name: rel.Name, Body: rel.Body, Draft: true, PreRelease: rel.PreRelease}
+		if copied, err = to.CreateRelease(ctx, crr); err != nil {
+			return nil, err
+		}
+		log.Printf("info: created draft release %d for %s in %s", copied.ID, f.tag, f.to)
+	}
+
+	for _, asset := range all {
+		if uploaded[asset.name] {
+			log.Printf("info: skipping %s, it is already on the release", asset.name)
+			continue
+		}
+		if err := streamAsset(ctx, from, to, copied, asset); err != nil {
+			if copied.Draft && !rel.Draft {
+				log.Printf("warn: draft release %d in %s is missing assets, run clone with -update-existing to finish it", copied.ID, f.to)
+			}
+			return copied, fmt.Errorf("copying %s: %v", asset.name, err)
+		}
+	}
+	if copied.Draft && !rel.Draft {
+		return publishRelease(ctx, to, copied, *f.makeLatest)
+	}
+	return copied, nil
+}
+
+// cloneTarget returns the commit to create the tag at in the -to repo, which is not used if the
+// tag already exists there. The commit of the tag in the -from repo is used if the -to repo has
+// it, such as a fork or a mirror of the repository, and the default branch if it does not.
+func (f *cloneFlags) cloneTarget(ctx context.Context, from, to *release.Client) (string, error) {
+	exists, err := to.TagExists(ctx, f.tag)
+	if err != nil {
+		return "", err
+	}
+	if !exists {
+		commit, err := from.ResolveCommit(ctx, f.tag)
+		if err != nil {
+			return "", err
+		}
+		if _, err := to.ResolveCommit(ctx, commit); err == nil {
+			return commit, nil
+		}
+		log.Printf("warn: %s does not have commit %s of %s, the tag will be created on its default branch", f.to, commit, f.tag)
+	}
+	repo, err := to.GetRepository(ctx)
+	if err != nil {
+		return "", err
+	}
+	return repo.DefaultBranch, nil
+}
+
+// streamAsset uploads the asset of the release in one repo to the release in the other as it is
+// downloaded, keeping its name, label and content type.
+func streamAsset(ctx context.Context, from, to *release.Client, rel *release.Release, asset releaseAsset) error {
+	upload := release.AssetUpload{Name: asset.name, Label: asset.label, ContentType: asset.contentType}
+	_, err := to.UploadAssetStream(ctx, rel, upload, asset.size, func() (io.ReadCloser, error) {
+		body, _, err := from.DownloadAsset(ctx, asset.id, 0)
+		return body, err
+	})
+	if err != nil {
+		return err
+	}
+	log.Printf("info: copied %s, %s", asset.name, formatBytes(float64(asset.size)))
+	return nil
+}
@@ -0,0 +1,401 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// describeFlags is called with the flag set of a command instead of parsing the command line when
+// it is set, so that the flags of every command can be described without running them.
+var describeFlags func(fs *flag.FlagSet)
+
+// errFlagsDescribed stops a command once its flags have been described.
+var errFlagsDescribed = errors.New("flags described")
+
+// The completion and man commands describe the other commands, so they are added here rather than
+// in the commands list, which they read.
+func init() {
+	commands = append(commands,
+		command{"completion", "Print a completion script for bash, zsh, fish or powershell", runCompletion},
+		command{"man", "Print the man page in roff format", runMan},
+	)
+}
+
+// commandDoc is a command with its flags, for the completion scripts and man page.
+type commandDoc struct {
+	name        string
+	description string
+	usage       string
+	flags       []flagDoc
+}
+
+// flagDoc is a flag of a command.
+type flagDoc struct {
+	name     string
+	usage    string
+	value    string
+	isBool   bool
+	defValue string
+}
+
+// commandDocs describes every command other than completion and man, in the order that they are
+// listed in the usage.
+func commandDocs() []commandDoc {
+	var docs []commandDoc
+	for _, cmd := range commands {
+		if cmd.name == "completion" || cmd.name == "man" {
+			continue
+		}
+		fs := commandFlags(cmd)
+		if fs == nil {
+			continue
+		}
+		doc := commandDoc{name: cmd.name, description: cmd.description, usage: "githubrelease " + cmd.name + " [flags]"}
+		// A command with arguments sets its own usage, whose first line is the synopsis.
+		var out bytes.Buffer
+		fs.SetOutput(&out)
+		fs.Usage()
+		if line := strings.SplitN(out.String(), "\n", 2)[0]; strings.HasPrefix(line, "Usage: ") {
+			doc.usage = strings.TrimPrefix(line, "Usage: ")
+		}
+		fs.VisitAll(func(f *flag.Flag) {
+			value, usage := flag.UnquoteUsage(f)
+			doc.flags = append(doc.flags, flagDoc{name: f.Name, usage: usage, value: value, isBool: value == "", defValue: f.DefValue})
+		})
+		docs = append(docs, doc)
+	}
+	return docs
+}
+
+// commandFlags returns the flag set of the command, which is captured by running the command
+// until it parses its flags. It is nil if the command does not use parseFlags.
+func commandFlags(cmd command) *flag.FlagSet {
+	var captured *flag.FlagSet
+	describeFlags = func(fs *flag.FlagSet) { captured = fs }
+	defer func() { describeFlags = nil }()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	cmd.run(ctx, nil)
+	return captured
+}
+
+// runCompletion prints the completion script for the shell, which completes the commands and
+// their flags.
+func runCompletion(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("completion", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: githubrelease completion bash|zsh|fish|powershell\n\n")
+		fmt.Fprintf(fs.Output(), "Load the script in the shell, e.g. for bash:\n\n  source <(githubrelease completion bash)\n")
+	}
+	if err := fs.Parse(args); err != nil {
+		return withExitCode(exitUsage, err)
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return withExitCode(exitUsage, fmt.Errorf("expected the shell, bash, zsh, fish or powershell"))
+	}
+	docs := commandDocs()
+	switch fs.Arg(0) {
+	case "bash":
+		return writeBashCompletion(os.Stdout, docs)
+	case "zsh":
+		return writeZshCompletion(os.Stdout, docs)
+	case "fish":
+		return writeFishCompletion(os.Stdout, docs)
+	case "powershell", "pwsh":
+		return writePowerShellCompletion(os.Stdout, docs)
+	}
+	return withExitCode(exitUsage, fmt.Errorf("unsupported shell %q, expected bash, zsh, fish or powershell", fs.Arg(0)))
+}
+
+// commandNames returns the names of the commands, including completion and man.
+func commandNames() []string {
+	names := make([]string, len(commands))
+	for i, cmd := range commands {
+		names[i] = cmd.name
+	}
+	return names
+}
+
+// flagNames returns the flags of the command as --name, with a trailing = for the flags that take a
+// value.
+func (d commandDoc) flagNames(equals bool) []string {
+	names := make([]string, len(d.flags))
+	for i, f := range d.flags {
+		names[i] = "--" + f.name
+		if equals && !f.isBool {
+			names[i] += "="
+		}
+	}
+	return names
+}
+
+func writeBashCompletion(w io.Writer, docs []commandDoc) error {
+	var b strings.Builder
+	b.WriteString("# bash completion for githubrelease, load it with: source <(githubrelease completion bash)\n\n")
+	b.WriteString("_githubrelease() {\n")
+	b.WriteString("    local cur=\"${COMP_WORDS[COMP_CWORD]}\" cmd=create flags i\n")
+	b.WriteString("    for ((i = 1; i < COMP_CWORD; i++)); do\n")
+	b.WriteString("        if [[ ${COMP_WORDS[i]} != -* ]]; then\n")
+	b.WriteString("            cmd=${COMP_WORDS[i]}\n")
+	b.WriteString("            break\n")
+	b.WriteString("        fi\n")
+	b.WriteString("    done\n")
+	fmt.Fprintf(&b, "    if [[ $COMP_CWORD -eq 1 && $cur != -* ]]; then\n")
+	fmt.Fprintf(&b, "        COMPREPLY=($(compgen -W %q -- \"$cur\"))\n", strings.Join(commandNames(), " "))
+	b.WriteString("        return\n")
+	b.WriteString("    fi\n")
+	b.WriteString("    case $cmd in\n")
+	for _, d := range docs {
+		fmt.Fprintf(&b, "    %s) flags=%q ;;\n", d.name, strings.Join(d.flagNames(true), " "))
+	}
+	b.WriteString("    completion) flags=\"bash zsh fish powershell\" ;;\n")
+	b.WriteString("    esac\n")
+	b.WriteString("    if [[ $cur == -*=* ]]; then\n")
+	b.WriteString("        # The value of a flag is completed as a file name.\n")
+	b.WriteString("        COMPREPLY=($(compgen -f -- \"${cur#*=}\"))\n")
+	b.WriteString("    elif [[ $cur == -* || $cmd == completion ]]; then\n")
+	b.WriteString("        COMPREPLY=($(compgen -W \"$flags\" -- \"$cur\"))\n")
+	b.WriteString("        [[ ${COMPREPLY[0]} == *= ]] && compopt -o nospace\n")
+	b.WriteString("    else\n")
+	b.WriteString("        COMPREPLY=($(compgen -f -- \"$cur\"))\n")
+	b.WriteString("    fi\n")
+	b.WriteString("}\n\n")
+	b.WriteString("complete -F _githubrelease githubrelease\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// zshEscape escapes the text for a description in a zsh _arguments spec.
+func zshEscape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `'`, `'\''`, `[`, `\[`, `]`, `\]`, `:`, `\:`).Replace(s)
+}
+
+func writeZshCompletion(w io.Writer, docs []commandDoc) error {
+	var b strings.Builder
+	b.WriteString("#compdef githubrelease\n")
+	b.WriteString("# zsh completion for githubrelease, save it as _githubrelease in a directory in $fpath\n\n")
+	b.WriteString("_githubrelease() {\n")
+	b.WriteString("    local -a commands\n")
+	b.WriteString("    commands=(\n")
+	for _, cmd := range commands {
+		fmt.Fprintf(&b, "        '%s:%s'\n", cmd.name, zshEscape(cmd.description))
+	}
+	b.WriteString("    )\n")
+	b.WriteString("    local cmd=create\n")
+	b.WriteString("    if (( CURRENT == 2 )) && [[ $words[2] != -* ]]; then\n")
+	b.WriteString("        _describe -t commands command commands\n")
+	b.WriteString("        return\n")
+	b.WriteString("    fi\n")
+	b.WriteString("    if [[ $words[2] != -* ]]; then\n")
+	b.WriteString("        cmd=$words[2]\n")
+	b.WriteString("        shift words\n")
+	b.WriteString("        (( CURRENT-- ))\n")
+	b.WriteString("    fi\n")
+	b.WriteString("    case $cmd in\n")
+	for _, d := range docs {
+		fmt.Fprintf(&b, "    %s)\n        _arguments \\\n", d.name)
+		for _, f := range d.flags {
+			if f.isBool {
+				fmt.Fprintf(&b, "            '--%s[%s]' \\\n", f.name, zshEscape(f.usage))
+			} else {
+				fmt.Fprintf(&b, "            '--%s=[%s]:%s:_files' \\\n", f.name, zshEscape(f.usage), f.value)
+			}
+		}
+		b.WriteString("            '*:file:_files'\n        ;;\n")
+	}
+	b.WriteString("    completion)\n        _values shell bash zsh fish powershell\n        ;;\n")
+	b.WriteString("    esac\n")
+	b.WriteString("}\n\n")
+	b.WriteString("_githubrelease \"$@\"\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// fishEscape quotes the text for a fish command line.
+func fishEscape(s string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(s) + "'"
+}
+
+func writeFishCompletion(w io.Writer, docs []commandDoc) error {
+	var b strings.Builder
+	b.WriteString("# fish completion for githubrelease, load it with: githubrelease completion fish | source\n\n")
+	b.WriteString("complete -c githubrelease -f\n")
+	names := strings.Join(commandNames(), " ")
+	for _, cmd := range commands {
+		fmt.Fprintf(&b, "complete -c githubrelease -n 'not __fish_seen_subcommand_from %s' -a %s -d %s\n", names, cmd.name, fishEscape(cmd.description))
+	}
+	for _, d := range docs {
+		condition := "__fish_seen_subcommand_from " + d.name
+		if d.name == "create" {
+			// create is the default command, so its flags can be given without it.
+			condition = "not __fish_seen_subcommand_from " + names + "; or " + condition
+		}
+		for _, f := range d.flags {
+			value := ""
+			if !f.isBool {
+				value = " -r -F"
+			}
+			fmt.Fprintf(&b, "complete -c githubrelease -n %s -l %s%s -d %s\n", fishEscape(condition), f.name, value, fishEscape(f.usage))
+		}
+	}
+	b.WriteString("complete -c githubrelease -n '__fish_seen_subcommand_from completion' -a 'bash zsh fish powershell'\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// powerShellEscape quotes the text for a PowerShell single quoted string.
+func powerShellEscape(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+func writePowerShellCompletion(w io.Writer, docs []commandDoc) error {
+	var b strings.Builder
+	b.WriteString("# PowerShell completion for githubrelease, load it with:\n")
+	b.WriteString("# githubrelease completion powershell | Out-String | Invoke-Expression\n\n")
+	b.WriteString("$githubreleaseCommands = [ordered]@{\n")
+	for _, cmd := range commands {
+		fmt.Fprintf(&b, "    %s = %s\n", powerShellEscape(cmd.name), powerShellEscape(cmd.description))
+	}
+	b.WriteString("}\n")
+	b.WriteString("$githubreleaseFlags = @{\n")
+	for _, d := range docs {
+		fmt.Fprintf(&b, "    %s = @(\n", powerShellEscape(d.name))
+		for _, f := range d.flags {
+			fmt.Fprintf(&b, "        @(%s, %s)\n", powerShellEscape("--"+f.name), powerShellEscape(f.usage))
+		}
+		b.WriteString("    )\n")
+	}
+	b.WriteString("}\n\n")
+	b.WriteString("Register-ArgumentCompleter -Native -CommandName githubrelease -ScriptBlock {\n")
+	b.WriteString("    param($wordToComplete, $commandAst, $cursorPosition)\n")
+	b.WriteString("    $words = @($commandAst.CommandElements | Select-Object -Skip 1 | ForEach-Object { $_.ToString() })\n")
+	b.WriteString("    $cmd = 'create'\n")
+	b.WriteString("    if ($words.Count -gt 0 -and -not $words[0].StartsWith('-') -and ($words.Count -gt 1 -or $wordToComplete -eq '')) {\n")
+	b.WriteString("        $cmd = $words[0]\n")
+	b.WriteString("    } elseif (-not $wordToComplete.StartsWith('-')) {\n")
+	b.WriteString("        foreach ($name in $githubreleaseCommands.Keys) {\n")
+	b.WriteString("            if ($name -like \"$wordToComplete*\") {\n")
+	b.WriteString("                [System.Management.Automation.CompletionResult]::new($name, $name, 'ParameterValue', $githubreleaseCommands[$name])\n")
+	b.WriteString("            }\n")
+	b.WriteString("        }\n")
+	b.WriteString("        return\n")
+	b.WriteString("    }\n")
+	b.WriteString("    if ($cmd -eq 'completion') {\n")
+	b.WriteString("        'bash', 'zsh', 'fish', 'powershell' | Where-Object { $_ -like \"$wordToComplete*\" } | ForEach-Object {\n")
+	b.WriteString("            [System.Management.Automation.CompletionResult]::new($_, $_, 'ParameterValue', $_)\n")
+	b.WriteString("        }\n")
+	b.WriteString("        return\n")
+	b.WriteString("    }\n")
+	b.WriteString("    foreach ($flag in $githubreleaseFlags[$cmd]) {\n")
+	b.WriteString("        if ($flag[0] -like \"$wordToComplete*\") {\n")
+	b.WriteString("            [System.Management.Automation.CompletionResult]::new($flag[0], $flag[0], 'ParameterName', $flag[1])\n")
+	b.WriteString("        }\n")
+	b.WriteString("    }\n")
+	b.WriteString("}\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// runMan prints the man page of the tool, with every command and its flags, in roff format.
+func runMan(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("man", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: githubrelease man > githubrelease.1\n\n")
+		fmt.Fprintf(fs.Output(), "View it with man ./githubrelease.1, or install it in a man1 directory such as /usr/local/share/man/man1.\n")
+	}
+	if err := fs.Parse(args); err != nil {
+		return withExitCode(exitUsage, err)
+	}
+	if fs.NArg() != 0 {
+		fs.Usage()
+		return withExitCode(exitUsage, fmt.Errorf("man takes no arguments"))
+	}
+	return writeManPage(os.Stdout, commandDocs(), time.Now())
+}
+
+// roffEscape escapes the text for roff, so that backslashes and lines starting with . or ' are
+// printed as they are.
+func roffEscape(s string) string {
+	s = strings.NewReplacer(`\`, `\e`, "-", `\-`).Replace(s)
+	if strings.HasPrefix(s, ".") || strings.HasPrefix(s, "'") {
+		s = `\&` + s
+	}
+	return s
+}
+
+func writeManPage(w io.Writer, docs []commandDoc, now time.Time) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, ".TH GITHUBRELEASE 1 %q %q \"User Commands\"\n", now.Format("2006-01-02"), "githubrelease "+version)
+	b.WriteString(".SH NAME\n")
+	b.WriteString("githubrelease \\- create and manage GitHub releases and their assets\n")
+	b.WriteString(".SH SYNOPSIS\n")
+	b.WriteString(".B githubrelease\n")
+	b.WriteString(".I command\n")
+	b.WriteString("[\\fIflags\\fR]\n")
+	b.WriteString(".SH DESCRIPTION\n")
+	b.WriteString("githubrelease creates GitHub releases, uploads their assets and manages the releases of a repository.\n")
+	b.WriteString("If no command is given then \\fBcreate\\fR is used, so its flags can be passed directly.\n")
+	b.WriteString("Flags can be given with one or two dashes, and every flag can also be set with a GITHUBRELEASE_ environment variable or in a config file.\n")
+	b.WriteString(".SH COMMANDS\n")
+	for _, cmd := range commands {
+		fmt.Fprintf(&b, ".TP\n.B %s\n%s\n", cmd.name, roffEscape(cmd.description))
+	}
+	for _, d := range docs {
+		fmt.Fprintf(&b, ".SH %s\n", strings.ToUpper(roffEscape(d.name)))
+		fmt.Fprintf(&b, "%s.\n.PP\n.B %s\n", roffEscape(d.description), roffEscape(d.usage))
+		for _, f := range d.flags {
+			b.WriteString(".TP\n")
+			if f.isBool {
+				fmt.Fprintf(&b, "\\fB\\-\\-%s\\fR\n", roffEscape(f.name))
+			} else {
+				fmt.Fprintf(&b, "\\fB\\-\\-%s\\fR=\\fI%s\\fR\n", roffEscape(f.name), roffEscape(f.value))
+			}
+			usage := f.usage
+			if !f.isBool && f.defValue != "" && f.defValue != "[]" && f.defValue != "0" {
+				usage += fmt.Sprintf(" (default %s)", f.defValue)
+			}
+			b.WriteString(roffEscape(usage) + "\n")
+		}
+	}
+	b.WriteString(".SH ENVIRONMENT\n")
+	b.WriteString("Every flag can be set with an environment variable named GITHUBRELEASE_ followed by the flag name in upper case with \\- replaced by _, e.g. GITHUBRELEASE_PAT.\n")
+	var standard []string
+	for env := range standardEnv {
+		standard = append(standard, env)
+	}
+	sort.Strings(standard)
+	for _, env := range standard {
+		fmt.Fprintf(&b, ".TP\n.B %s\nUsed for \\fB\\-\\-%s\\fR.\n", env, roffEscape(standardEnv[env]))
+	}
+	b.WriteString(".TP\n.B GITHUB_REPOSITORY\nUsed for \\fB\\-\\-user\\fR and \\fB\\-\\-repo\\fR, from owner/repo.\n")
+	b.WriteString(".SH EXIT STATUS\n")
+	for _, code := range []struct {
+		code        int
+		description string
+	}{
+		{exitOK, "success"},
+		{exitFailure, "any other failure"},
+		{exitUsage, "invalid command line"},
+		{exitValidation, "the flags, config or assets failed validation"},
+		{exitAuth, "the token was rejected or lacks permissions"},
+		{exitNotFound, "the repository, release or tag was not found"},
+		{exitTagConflict, "a release already exists for the tag"},
+		{exitPartialUpload, "the release was created but some assets failed to upload"},
+		{exitNetwork, "a network error or timeout"},
+	} {
+		fmt.Fprintf(&b, ".TP\n.B %d\n%s\n", code.code, code.description)
+	}
+	b.WriteString(".SH SEE ALSO\n")
+	b.WriteString("https://github.com/imitablerabbit/githubrelease\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/imitablerabbit/githubrelease/pkg/release"
+)
+
+// The compression methods of -compress.
+const (
+	compressNone = "none"
+	compressGzip = "gzip"
+	compressZstd = "zstd"
+)
+
+// compressedExtensions are the extensions of files that are already compressed, or are packages
+// that are installed as they are, which -compress leaves alone.
+var compressedExtensions = []string{
+	".gz", ".tgz", ".zst", ".tzst", ".xz", ".txz", ".bz2", ".tbz2", ".lz4", ".zip", ".7z",
+	".deb", ".rpm", ".apk", ".dmg", ".pkg", ".msi", ".jar", ".whl", ".nupkg", ".snap", ".appimage",
+}
+
+// compressLevels are the levels that each method accepts. 0 is the default level of the method.
+var compressLevels = map[string][2]int{
+	compressGzip: {gzip.BestSpeed, gzip.BestCompression},
+	compressZstd: {1, 19},
+}
+
+// checkCompress checks the -compress method and -compress-level.
+func checkCompress(method string, level int) error {
+	switch method {
+	case "", compressNone:
+		return nil
+	case compressGzip, compressZstd:
+	default:
+		return fmt.Errorf("unsupported -compress %q, expected zstd, gzip or none", method)
+	}
+	levels := compressLevels[method]
+	if level != 0 && (level < levels[0] || level > levels[1]) {
+		return fmt.Errorf("-compress-level for %s must be from %d to %d", method, levels[0], levels[1])
+	}
+	return nil
+}
+
+// isCompressed reports whether the file name has the extension of a compressed file or package.
+func isCompressed(name string) bool {
+	ext := strings.ToLower(filepath.Ext(name))
+	for _, compressed := range compressedExtensions {
+		if ext == compressed {
+			return true
+		}
+	}
+	return false
+}
+
+// recompressedName returns the name of the .tar.gz or .tgz archive as a .tar.zst, or false if the
+// asset is not a gzipped tarball.
+func recompressedName(name string) (string, bool) {
+	lower := strings.ToLower(name)
+	for _, ext := range []string{".tar.gz", ".tgz"} {
+		if strings.HasSuffix(lower, ext) {
+			return name[:len(name)-len(ext)] + ".tar.zst", true
+		}
+	}
+	return "", false
+}
+
+// compressAssets compresses the assets that aren't already compressed with the method, adding
+// .gz or .zst to their names, and recompresses the .tar.gz archives as .tar.zst if recompress is
+// set. The compressed files are written to a temporary directory, which the caller should remove,
+// and replace the original assets in the returned list. Labels are kept.
+func compressAssets(assets []release.AssetUpload, method string, level int, recompress bool) ([]release.AssetUpload, string, error) {
+	dir, err := ioutil.TempDir("", "githubrelease-compressed")
+	if err != nil {
+		return nil, "", err
+	}
+	compressed := make([]release.AssetUpload, 0, len(assets))
+	for _, asset := range assets {
+		name := asset.Name
+		if name == "" {
+			name = filepath.Base(asset.Path)
+		}
+		out := asset
+		if tarName, ok := recompressedName(name); ok && recompress {
+			out.Name, out.ContentType = tarName, "application/zstd"
+			out.Path = filepath.Join(dir, tarName)
+			err = recompressZstd(asset.Path, out.Path, level)
+		} else if method == compressGzip && !isCompressed(name) {
+			out.Name, out.ContentType = name+".gz", "application/gzip"
+			out.Path = filepath.Join(dir, out.Name)
+			err = compressGzipFile(asset.Path, out.Path, level)
+		} else if method == compressZstd && !isCompressed(name) {
+			out.Name, out.ContentType = name+".zst", "application/zstd"
+			out.Path = filepath.Join(dir, out.Name)
+			err = runCommand("zstd", zstdArgs(level, "-o", out.Path, asset.Path)...)
+		} else {
+			compressed = append(compressed, asset)
+			continue
+		}
+		if err != nil {
+			os.RemoveAll(dir)
+			return nil, "", fmt.Errorf("compressing %s: %v", name, err)
+		}
+		if err := logCompression(asset.Path, out); err != nil {
+			os.RemoveAll(dir)
+			return nil, "", err
+		}
+		compressed = append(compressed, out)
+	}
+	return compressed, dir, nil
+}
+
+// logCompression logs the size of the compressed asset against the original file.
+func logCompression(original string, asset release.AssetUpload) error {
+	before, err := os.Stat(original)
+	if err != nil {
+		return err
+	}
+	after, err := os.Stat(asset.Path)
+	if err != nil {
+		return err
+	}
+	log.Printf("info: compressed %s to %s, %d to %d bytes", filepath.Base(original), asset.Name, before.Size(), after.Size())
+	return nil
+}
+
+// zstdArgs returns the arguments of the zstd command for the level, followed by args.
+func zstdArgs(level int, args ...string) []string {
+	zargs := []string{"-q", "-f"}
+	if level != 0 {
+		zargs = append(zargs, fmt.Sprintf("-%d", level))
+	}
+	return append(zargs, args...)
+}
+
+// compressGzipFile writes the file gzipped to dst. The header has no name or modification time so
+// that the same file always compresses to the same bytes.
+func compressGzipFile(src, dst string, level int) error {
+	if level == 0 {
+		level = gzip.DefaultCompression
+	}
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	zw, err := gzip.NewWriterLevel(out, level)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(zw, in); err != nil {
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+	return out.Close()
+}
+
+// recompressZstd decompresses the gzipped file and pipes it through zstd into dst, so that the
+// tarball itself is unchanged.
+func recompressZstd(src, dst string, level int) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	zr, err := gzip.NewReader(in)
+	if err != nil {
+		return fmt.Errorf("reading %s: %v", src, err)
+	}
+	args := zstdArgs(level, "-o", dst)
+	log.Printf("info: running zstd %s", strings.Join(args, " "))
+	cmd := exec.Command("zstd", args...)
+	cmd.Stdin = zr
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("running zstd: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+)
+
+// defaultConfigFiles are the config files that are used if -config is not given, the first one
+// that exists is read.
+var defaultConfigFiles = []string{".githubrelease.yml", ".githubrelease.yaml"}
+
+// parseFlags registers the -config and logging flags, parses the command line and then fills in
+// any flags that were not set on the command line from the environment and then the config file.
+// Command line flags take precedence over the environment, which takes precedence over the config
+// file. The logger is set up from the final flag values.
+func parseFlags(fs *flag.FlagSet, args []string) error {
+	return parseComponentFlags(fs, args, "")
+}
+
+// parseComponentFlags is parseFlags for one of the components under components: in the config
+// file. The values of the component take precedence over the rest of the config file.
+func parseComponentFlags(fs *flag.FlagSet, args []string, component string) error {
+	configPath := fs.String("config", "", "YAML config file with default values for the flags. Defaults to .githubrelease.yml if it exists")
+	lf := addLogFlags(fs)
+	if describeFlags != nil {
+		describeFlags(fs)
+		return errFlagsDescribed
+	}
+	if err := fs.Parse(args); err != nil {
+		return withExitCode(exitUsage, err)
+	}
+	if err := applyDefaults(fs, *configPath, component); err != nil {
+		return withExitCode(exitValidation, err)
+	}
+	return withExitCode(exitValidation, lf.setup(fs))
+}
+
+// applyDefaults fills in the flags that were not set on the command line from the environment
+// and the config file at path, or the default config file if path is empty.
+func applyDefaults(fs *flag.FlagSet, path, component string) error {
+	if err := applyEnv(fs); err != nil {
+		return err
+	}
+	required := true
+	if path == "" {
+		path, required = findConfigFile(), false
+	}
+	if path == "" {
+		if component != "" {
+			return fmt.Errorf("component %s: no config file found", component)
+		}
+		return nil
+	}
+	config, err := readConfig(path)
+	if err != nil {
+		if !required && component == "" && os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("reading config %s: %v", path, err)
+	}
+	if component != "" {
+		if config, err = componentConfig(config, fs.Name(), component); err != nil {
+			return fmt.Errorf("config %s: %v", path, err)
+		}
+	}
+	if err := applyConfig(fs, config); err != nil {
+		return fmt.Errorf("config %s: %v", path, err)
+	}
+	return nil
+}
+
+// configComponents returns the names of the components in the config file given by -config, or
+// the default config file, in sorted order.
+func configComponents(fs *flag.FlagSet) ([]string, error) {
+	path := fs.Lookup("config").Value.String()
+	if path == "" {
+		path = findConfigFile()
+	}
+	if path == "" {
+		return nil, fmt.Errorf("no config file found with components")
+	}
+	config, err := readConfig(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading config %s: %v", path, err)
+	}
+	components, _ := config["components"].(map[string]interface{})
+	if len(components) == 0 {
+		return nil, fmt.Errorf("config %s has no components", path)
+	}
+	names := make([]string, 0, len(components))
+	for name := range components {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// componentConfig returns a copy of the config with the values of the component merged over the
+// section for the command, so that they take precedence over the rest of the config.
+func componentConfig(config map[string]interface{}, command, component string) (map[string]interface{}, error) {
+	components, _ := config["components"].(map[string]interface{})
+	values, ok := components[component].(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("unknown component %s", component)
+	}
+	section := map[string]interface{}{}
+	if commandSection, ok := config[command].(map[string]interface{}); ok {
+		for key, value := range commandSection {
+			section[key] = value
+		}
+	}
+	for key, value := range values {
+		section[key] = value
+	}
+	merged := map[string]interface{}{}
+	for key, value := range config {
+		merged[key] = value
+	}
+	merged[command] = section
+	return merged, nil
+}
+
+// findConfigFile returns the first default config file that exists, or an empty string.
+func findConfigFile() string {
+	for _, path := range defaultConfigFiles {
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+	}
+	return ""
+}
+
+// readConfig reads and parses the YAML config file.
+func readConfig(path string) (map[string]interface{}, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return parseYAML(data)
+}
+
+// applyConfig sets the flags that were not set on the command line from the config. The keys of
+// the config are flag names. Top level keys are used by every command that has the flag, and
+// values in a section named after the command, e.g. create:, override them for that command
+// only. Sequences set flags that can be repeated, such as -asset, once for each item and are
+// joined with commas for any other flag.
+func applyConfig(fs *flag.FlagSet, config map[string]interface{}) error {
+	values := map[string][]string{}
+	for key, value := range config {
+		if _, isSection := value.(map[string]interface{}); isSection {
+			continue
+		}
+		if fs.Lookup(key) == nil {
+			// The flag belongs to a different command.
+			continue
+		}
+		v, err := configValues(key, value)
+		if err != nil {
+			return err
+		}
+		values[key] = v
+	}
+	if section, ok := config[fs.Name()].(map[string]interface{}); ok {
+		for key, value := range section {
+			if fs.Lookup(key) == nil {
+				return fmt.Errorf("unknown %s flag %s", fs.Name(), key)
+			}
+			v, err := configValues(fs.Name()+"."+key, value)
+			if err != nil {
+				return err
+			}
+			values[key] = v
+		}
+	}
+
+	set := flagsSet(fs)
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if set[key] || key == "config" {
+			continue
+		}
+		v := values[key]
+		if _, repeatable := fs.Lookup(key).Value.(*stringsFlag); !repeatable {
+			// Flags that take comma separated lists can be given as sequences too.
+			v = []string{strings.Join(v, ",")}
+		}
+		for _, v := range v {
+			if err := fs.Set(key, v); err != nil {
+				return fmt.Errorf("invalid value %q for %s: %v", v, key, err)
+			}
+		}
+	}
+	return nil
+}
+
+// configValues returns the flag values for a config value, which is either a scalar or a
+// sequence of scalars.
+func configValues(key string, value interface{}) ([]string, error) {
+	switch v := value.(type) {
+	case string:
+		return []string{v}, nil
+	case []interface{}:
+		values := make([]string, 0, len(v))
+		for _, item := range v {
+			s, ok := item.(string)
+			if !ok {
+				return nil, fmt.Errorf("%s must be a list of values", key)
+			}
+			values = append(values, s)
+		}
+		return values, nil
+	}
+	return nil, fmt.Errorf("%s must be a value or a list of values", key)
+}
@@ -0,0 +1,856 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/imitablerabbit/githubrelease/pkg/release"
+)
+
+// createFlags are the flags that describe the release to create.
+type createFlags struct {
+	tag                  string
+	bump                 string
+	targetCommitish      string
+	name                 string
+	body                 string
+	bodyFile             string
+	changelog            string
+	appendBody           string
+	draft                bool
+	prerelease           bool
+	makeLatest           *string
+	discussionCategory   string
+	autoPrerelease       bool
+	createTag            bool
+	tagMessage           string
+	taggerName           string
+	taggerEmail          string
+	signTag              bool
+	tagSignKey           string
+	generateNotesFromGit bool
+	previousTag          string
+	generateNotes        bool
+	generateNotesFromPRs bool
+	notesTemplate        string
+	localizedNotes       stringsFlag
+	primaryLanguage      string
+	localizedNotesAs     string
+	localized            []localizedNote
+	policyFile           string
+	requireChecks        bool
+	milestone            string
+	closeMilestone       bool
+	publishAfterUpload   bool
+	deleteDraftOnCancel  bool
+	mirrors              stringsFlag
+	images               stringsFlag
+	registryUsername     string
+	registryPassword     string
+	homebrew             bool
+	scoop                bool
+	updateExisting       bool
+	tagPrefix            string
+	all                  bool
+	components           stringsFlag
+	component            string
+	dryRun               *bool
+	notify               *bool
+	hooks                *bool
+	interactive          bool
+	output               *string
+}
+
+// addCreateFlags registers the release flags on the flag set.
+func addCreateFlags(fs *flag.FlagSet) *createFlags {
+	f := &createFlags{}
+
+	// Command line flags that can be used to create the release data
+	fs.StringVar(&f.tag, "release-tag", "", "The tag_name that should be used for the release. This does not have to be related to an actual git tag, although it probably should be.")
+	fs.StringVar(&f.bump, "bump", "", "Use the next SemVer tag after the latest tag as release-tag: major, minor, patch or auto. See the next command")
+	fs.StringVar(&f.targetCommitish, "target", "master", "The commit/branch/tag that the release should be based on")
+	fs.StringVar(&f.name, "name", "", "The name of the release")
+	fs.StringVar(&f.body, "body", "", "The body of the release")
+	fs.StringVar(&f.bodyFile, "body-file", "", "Read the body of the release from this file, or stdin if it is -")
+	fs.StringVar(&f.changelog, "changelog", "", "Add the section for the version of release-tag in this changelog, e.g. CHANGELOG.md, to the body. Fails if it has no section for the version")
+	fs.StringVar(&f.appendBody, "append-body", "", "Text to append to the body of the existing release for release-tag. Requires -update-existing")
+	fs.BoolVar(&f.draft, "draft", false, "Is this release a draft? i.e. should it be shown publically")
+	fs.BoolVar(&f.prerelease, "prerelease", false, "Is this release a pre-release?")
+	f.makeLatest = addMakeLatestFlag(fs)
+	fs.StringVar(&f.discussionCategory, "discussion-category", "", "Open a GitHub Discussion linked to the release in this existing discussion category")
+
+	// Mark the release as a pre-release when the tag has a SemVer pre-release suffix, e.g. v1.2.3-rc.1
+	fs.BoolVar(&f.autoPrerelease, "auto-prerelease", false, "Mark the release as a pre-release if release-tag has a SemVer pre-release suffix or major version 0")
+
+	// Create an annotated tag object and ref for the release tag before creating the release. This is
+	// skipped if the tag already exists in the repository.
+	fs.BoolVar(&f.createTag, "create-tag", false, "Create an annotated tag for release-tag pointing at target before creating the release, if the tag does not already exist")
+	fs.StringVar(&f.tagMessage, "tag-message", "", "Message of the tag created by -create-tag. Defaults to the release name, or release-tag")
+	fs.StringVar(&f.taggerName, "tagger-name", "", "Name of the tagger for -create-tag. Defaults to the authenticated user, or git config user.name with -sign-tag")
+	fs.StringVar(&f.taggerEmail, "tagger-email", "", "Email of the tagger for -create-tag. Defaults to the authenticated user, or git config user.email with -sign-tag")
+	fs.BoolVar(&f.signTag, "sign-tag", false, "Sign the tag created by -create-tag with gpg")
+	fs.StringVar(&f.tagSignKey, "tag-sign-key", "", "The gpg key id to sign the tag with. Defaults to the gpg default key")
+
+	// Generate the body from the commits since the previous tag, grouped by conventional commit type.
+	fs.BoolVar(&f.generateNotesFromGit, "generate-notes-from-git", false, "Generate the release body from the local git log since the previous tag, grouped by conventional commit type. Appended to -body if both are given")
+	fs.StringVar(&f.previousTag, "previous-tag", "", "The tag to generate release notes from. Defaults to the tag before release-tag")
+
+	// Have GitHub generate the body with its own changelog generator.
+	fs.BoolVar(&f.generateNotes, "generate-notes", false, "Have GitHub generate the release notes. Any -body is added before the generated notes")
+
+	// Generate the body from the pull requests merged since the previous tag, grouped by label.
+	fs.BoolVar(&f.generateNotesFromPRs, "generate-notes-from-prs", false, "Generate the release body from the pull requests merged since the previous tag, grouped by label and crediting their authors. Appended to -body if both are given")
+	fs.StringVar(&f.notesTemplate, "notes-template", "", "Go template file to render the -generate-notes-from-prs notes with, instead of the default layout")
+
+	// Bilingual projects keep the notes for each language in their own template.
+	fs.Var(&f.localizedNotes, "localized-notes", "Go template file with the release notes in one language, as lang=path or a glob pattern such as notes.*.md for notes.en.md and notes.ja.md. Added after -body. Can be repeated")
+	fs.StringVar(&f.primaryLanguage, "primary-language", "en", "The language of the -localized-notes that comes first, and that is added to the body with -localized-notes-as assets")
+	fs.StringVar(&f.localizedNotesAs, "localized-notes-as", localizedSections, "How to add the -localized-notes to the release: sections, under a heading for each language, or assets, with only the primary language in the body and the rest uploaded as RELEASE_NOTES.<lang>.md")
+
+	// Block the release if it breaks the rules of the policy, e.g. it has no changelog section.
+	fs.BoolVar(&f.requireChecks, "require-checks", false, "Fail before creating the release unless every CI check and commit status on the commit that is released has passed")
+	fs.StringVar(&f.policyFile, "policy-file", "", "Check the release against this policy before creating it and fail listing the violations: a YAML file of built-in rules, or a rego policy with opa if it ends in .rego")
+
+	// List the closed issues and pull requests of a milestone in the body, and close it once released.
+	fs.StringVar(&f.milestone, "milestone", "", "Add the closed issues and pull requests of the milestone with this title to the release body")
+	fs.BoolVar(&f.closeMilestone, "close-milestone", false, "Close the -milestone once the release is published")
+
+	// Pin the container images of the release by digest in the body, so they can be deployed by digest.
+	fs.Var(&f.images, "image", "Resolve this container image, e.g. ghcr.io/org/app:{{.Tag}}, to its digest and list it in the release body. Can be a template and can be repeated")
+	fs.StringVar(&f.registryUsername, "registry-username", "", "Username for the container registry of -image. ghcr.io uses the GitHub token if it is not set")
+	fs.StringVar(&f.registryPassword, "registry-password", "", "Password or token for the container registry of -image")
+
+	// Keep the release hidden as a draft until every asset has been uploaded.
+	fs.BoolVar(&f.publishAfterUpload, "publish-after-upload", false, "Create the release as a draft and only publish it once every asset has been uploaded")
+
+	// Remove the draft that this run created if it is interrupted before the release is finished.
+	fs.BoolVar(&f.deleteDraftOnCancel, "delete-draft-on-cancel", false, "If the command is interrupted or times out after creating a new draft release, delete the draft")
+
+	// Keep a copy of the release in object storage, for mirrors and users who cannot reach GitHub.
+	fs.Var(&f.mirrors, "mirror", "Copy the assets and a release.json manifest to this s3://, gs:// or az:// URL once the release is created. Can be a template and can be repeated")
+
+	// Update the Homebrew formula and Scoop manifest described in the config file with the new archives.
+	fs.BoolVar(&f.homebrew, "homebrew", false, "Update the Homebrew formula described in the homebrew section of the config file once the release is created")
+	fs.BoolVar(&f.scoop, "scoop", false, "Update the Scoop manifest described in the scoop section of the config file once the release is created")
+
+	// Prompt for the release on the terminal, for maintainers releasing by hand.
+	fs.BoolVar(&f.interactive, "interactive", false, "Ask for the tag, name, notes, draft and pre-release state and the assets to upload on the terminal, and confirm before creating the release")
+
+	f.dryRun = addDryRunFlag(fs)
+	f.notify = addNotifyFlag(fs)
+	f.hooks = addHooksFlag(fs)
+	f.output = addOutputFlag(fs)
+
+	// Make re-runs idempotent by updating the release for the tag if it already exists.
+	fs.BoolVar(&f.updateExisting, "update-existing", false, "If a release already exists for release-tag, update its metadata and replace its assets instead of failing")
+
+	// Monorepos define a release for each component in the config file, under components:.
+	fs.StringVar(&f.tagPrefix, "tag-prefix", "", "Prefix added to release-tag, and used to find the latest tag for -bump, e.g. api/ for api/v1.2.0")
+	fs.BoolVar(&f.all, "all", false, "Create a release for every component in the config file")
+	fs.Var(&f.components, "component", "Create a release for this component in the config file. Can be repeated")
+
+	return f
+}
+
+// check validates the combination of flags.
+func (f *createFlags) check() error {
+	if err := checkOutputFormat(*f.output); err != nil {
+		return err
+	}
+	if err := checkMakeLatest(*f.makeLatest); err != nil {
+		return err
+	}
+	if f.appendBody != "" && f.body != "" {
+		return fmt.Errorf("-append-body and -body cannot be used together")
+	}
+	if f.appendBody != "" && !f.updateExisting {
+		return fmt.Errorf("-append-body can only be used with -update-existing")
+	}
+	if f.publishAfterUpload && f.draft {
+		return fmt.Errorf("-publish-after-upload and -draft cannot be used together")
+	}
+	generators := 0
+	for _, generate := range []bool{f.generateNotes, f.generateNotesFromGit, f.generateNotesFromPRs} {
+		if generate {
+			generators++
+		}
+	}
+	if generators > 1 {
+		return fmt.Errorf("only one of -generate-notes, -generate-notes-from-git and -generate-notes-from-prs can be used")
+	}
+	if f.notesTemplate != "" && !f.generateNotesFromPRs {
+		return fmt.Errorf("-notes-template can only be used with -generate-notes-from-prs")
+	}
+	if f.localizedNotesAs != localizedSections && f.localizedNotesAs != localizedAssets {
+		return fmt.Errorf("unsupported -localized-notes-as %q, expected sections or assets", f.localizedNotesAs)
+	}
+	if f.closeMilestone && f.milestone == "" {
+		return fmt.Errorf("-close-milestone requires -milestone")
+	}
+	if f.bump != "" && f.tag != "" {
+		return fmt.Errorf("-bump and -release-tag cannot be used together")
+	}
+	if f.interactive && f.bodyFile == "-" {
+		return fmt.Errorf("-interactive cannot read the body from stdin, it is edited in $EDITOR instead")
+	}
+	return checkMirrors(f.mirrors)
+}
+
+// newCreateFlagSet returns the flag set for the create command.
+func newCreateFlagSet() (*flag.FlagSet, *clientFlags, *uploadFlags, *createFlags) {
+	fs := flag.NewFlagSet("create", flag.ContinueOnError)
+	cf := addClientFlags(fs)
+	cf.writesReleases = true
+	addProviderFlag(fs, cf)
+	uf := addUploadFlags(fs, cf)
+	f := addCreateFlags(fs)
+	return fs, cf, uf, f
+}
+
+// runCreate creates a new release and uploads the assets to it. With -all or -component a
+// release is created for each of the components in the config file instead.
+func runCreate(ctx context.Context, args []string) error {
+	fs, cf, uf, f := newCreateFlagSet()
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	ctx, cancel := cf.withTimeout(ctx)
+	defer cancel()
+	if f.all || len(f.components) > 0 {
+		if f.interactive {
+			return withExitCode(exitValidation, fmt.Errorf("-interactive cannot be used with -all or -component"))
+		}
+		return createComponents(ctx, fs, args, f)
+	}
+	return createReleases(ctx, cf, uf, f)
+}
+
+// createComponents creates a release for each of the selected components in the config file, in
+// turn. The flags are parsed again for each component so that its config values are used. An
+// error is returned if the release of any component fails, after trying the rest.
+func createComponents(ctx context.Context, fs *flag.FlagSet, args []string, f *createFlags) error {
+	names, err := configComponents(fs)
+	if err != nil {
+		return err
+	}
+	if !f.all {
+		if err := checkComponents(names, f.components); err != nil {
+			return err
+		}
+		names = f.components
+	} else if len(f.components) > 0 {
+		return fmt.Errorf("-all and -component cannot be used together")
+	}
+
+	var failed []string
+	for _, name := range names {
+		log.Printf("info: creating release for component %s", name)
+		cfs, ccf, cuf, component := newCreateFlagSet()
+		err := parseComponentFlags(cfs, args, name)
+		if err == nil {
+			component.component = name
+			err = createReleases(ctx, ccf, cuf, component)
+		}
+		if err != nil {
+			log.Printf("error: component %s: %v", name, err)
+			failed = append(failed, name)
+			if ctx.Err() != nil {
+				break
+			}
+		}
+	}
+	log.Printf("info: released %d of %d component(s)", len(names)-len(failed), len(names))
+	if len(failed) > 0 {
+		return fmt.Errorf("release failed for %d component(s): %s", len(failed), strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+// checkComponents returns an error if any of the selected components is not in the config file.
+func checkComponents(names, selected []string) error {
+	known := map[string]bool{}
+	for _, name := range names {
+		known[name] = true
+	}
+	for _, name := range selected {
+		if !known[name] {
+			return fmt.Errorf("unknown component %s, expected one of %s", name, strings.Join(names, ", "))
+		}
+	}
+	return nil
+}
+
+// createReleases creates the release described by the flags in each -repo. An error is returned
+// if any of them fail, after trying the rest.
+func createReleases(ctx context.Context, cf *clientFlags, uf *uploadFlags, f *createFlags) error {
+	if err := readBodyFile(f.bodyFile, &f.body); err != nil {
+		return err
+	}
+	if err := f.check(); err != nil {
+		return withExitCode(exitValidation, err)
+	}
+	// The changelog is checked before the assets are prepared so that a missing section fails
+	// fast. The tag from -bump is only known once the repo is read, so it is checked later.
+	if f.changelog != "" && f.tag != "" {
+		if _, err := readChangelogSection(f.changelog, releaseVersion(f.tag)); err != nil {
+			return withExitCode(exitValidation, err)
+		}
+	}
+	if len(f.localizedNotes) > 0 {
+		var err error
+		if f.localized, err = readLocalizedNotes(f.localizedNotes, f.primaryLanguage); err != nil {
+			return withExitCode(exitValidation, err)
+		}
+	}
+	if err := checkProvider(cf, uf, f); err != nil {
+		return withExitCode(exitValidation, err)
+	}
+	var p *prompter
+	if f.interactive {
+		var err error
+		if p, err = newPrompter(); err != nil {
+			return withExitCode(exitValidation, err)
+		}
+		if err := f.promptRelease(ctx, cf, p); err != nil {
+			return err
+		}
+	}
+
+	// Work out what is going to be uploaded before anything is created, so that missing files
+	// are caught before the release exists.
+	if uf.pkg {
+		tag, err := packageTag(ctx, cf, f)
+		if err != nil {
+			return err
+		}
+		_, uf.projectName, _ = cf.forEachRepo()[0].repoName()
+		uf.packageTag = tag
+	}
+	assets, cleanup, err := uf.prepareAssets()
+	defer cleanup()
+	if err != nil {
+		return withExitCode(exitValidation, err)
+	}
+	err = checkRemoteFeatures(remoteAssetsIn(assets), []flagUse{
+		{"mirror", len(f.mirrors) > 0},
+		{"homebrew", f.homebrew},
+		{"scoop", f.scoop},
+		{"provider " + cf.provider, cf.provider != providerGitHub},
+	})
+	if err != nil {
+		return withExitCode(exitValidation, err)
+	}
+	if p != nil {
+		if assets, err = selectAssets(p, assets); err != nil {
+			return err
+		}
+		ok, err := f.confirmRelease(cf, p, assets)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return fmt.Errorf("release cancelled")
+		}
+	}
+
+	if cf.provider != providerGitHub {
+		rel, err := f.createOnProvider(ctx, cf, uf, assets)
+		f.sendNotifications(uf.flags, cf, rel, assets, err)
+		return err
+	}
+	repos := cf.forEachRepo()
+	if len(repos) == 1 {
+		rel, err := f.create(ctx, cf, uf, assets)
+		f.sendNotifications(uf.flags, cf, rel, assets, err)
+		f.failureHooks(uf.flags, cf, rel, err)
+		return err
+	}
+	var failed []string
+	for _, rcf := range repos {
+		repo := rcf.repos[0]
+		log.Printf("info: creating release in %s", repo)
+		// Each repo gets its own copy as the upload flags are changed for existing releases.
+		ruf := *uf
+		rel, err := f.create(ctx, rcf, &ruf, assets)
+		f.sendNotifications(uf.flags, rcf, rel, assets, err)
+		f.failureHooks(uf.flags, rcf, rel, err)
+		if err != nil {
+			log.Printf("error: %s: %v", repo, err)
+			failed = append(failed, repo)
+			if ctx.Err() != nil {
+				break
+			}
+			continue
+		}
+		if rel != nil {
+			log.Printf("info: %s: released %s", repo, rel.HTMLURL)
+		}
+	}
+	log.Printf("info: released to %d of %d repo(s)", len(repos)-len(failed), len(repos))
+	if len(failed) > 0 {
+		return fmt.Errorf("release failed in %d repo(s): %s", len(failed), strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+// create creates the release in the repo of the client flags and uploads the assets to it. The
+// release is nil for a dry run.
+func (f *createFlags) create(ctx context.Context, cf *clientFlags, uf *uploadFlags, assets []release.AssetUpload) (*release.Release, error) {
+	client, err := cf.newClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+	tag := f.tag
+	if f.bump != "" {
+		if tag, err = nextTag(ctx, client, f.bump, f.targetCommitish, f.tagPrefix); err != nil {
+			return nil, err
+		}
+	} else if !strings.HasPrefix(tag, f.tagPrefix) {
+		tag = f.tagPrefix + tag
+	}
+	target, err := f.resolveTarget(ctx, client, tag)
+	if err != nil {
+		return nil, err
+	}
+
+	// The name and body can be templates, these are executed before any generated notes are
+	// added so that the notes are never treated as a template.
+	name, body, appendBody, tagMessage := f.name, f.body, f.appendBody, f.tagMessage
+	data := newTemplateData(ctx, client, tag, f.targetCommitish)
+	data.Component = f.component
+	for _, t := range []struct {
+		name  string
+		value *string
+	}{{"name", &name}, {"body", &body}, {"append-body", &appendBody}, {"tag-message", &tagMessage}} {
+		if *t.value, err = executeTemplate(t.name, *t.value, data); err != nil {
+			return nil, err
+		}
+	}
+	if len(f.localized) > 0 {
+		var notesAssets []release.AssetUpload
+		var cleanup func()
+		body, notesAssets, cleanup, err = localizedBody(body, f.localized, f.localizedNotesAs, data)
+		defer cleanup()
+		if err != nil {
+			return nil, err
+		}
+		// The assets are shared by every -repo, so the notes are added to a copy.
+		assets = append(append([]release.AssetUpload{}, assets...), notesAssets...)
+	}
+	mirrors := make([]string, len(f.mirrors))
+	for i, mirror := range f.mirrors {
+		if mirrors[i], err = executeTemplate("mirror", mirror, data); err != nil {
+			return nil, err
+		}
+	}
+	images := make([]string, len(f.images))
+	for i, image := range f.images {
+		if images[i], err = executeTemplate("image", image, data); err != nil {
+			return nil, err
+		}
+	}
+	formulas, err := readFormulaConfigs(uf.flags, f.homebrew, f.scoop)
+	if err != nil {
+		return nil, err
+	}
+	var pkgRepos []packageRepo
+	if uf.publishPkgs {
+		if pkgRepos, err = readPackageRepos(uf.flags); err != nil {
+			return nil, err
+		}
+	}
+	hks, err := loadHooks(uf.flags, *f.hooks)
+	if err != nil {
+		return nil, err
+	}
+
+	if f.changelog != "" {
+		notes, err := readChangelogSection(f.changelog, releaseVersion(tag))
+		if err != nil {
+			return nil, withExitCode(exitValidation, err)
+		}
+		body = joinBody(body, notes)
+	}
+	if f.generateNotesFromGit {
+		notes, err := gitNotes(tag, f.previousTag)
+		if err != nil {
+			return nil, fmt.Errorf("generating release notes: %v", err)
+		}
+		body = joinBody(body, notes)
+	}
+	if f.generateNotesFromPRs {
+		notes, err := prNotes(ctx, client, tag, f.previousTag, f.targetCommitish, f.notesTemplate)
+		if err != nil {
+			return nil, fmt.Errorf("generating release notes: %v", err)
+		}
+		body = joinBody(body, notes)
+	}
+
+	var milestone *release.Milestone
+	if f.milestone != "" {
+		if milestone, err = findMilestone(ctx, client, f.milestone); err != nil {
+			return nil, err
+		}
+		notes, err := milestoneNotes(ctx, client, milestone)
+		if err != nil {
+			return nil, fmt.Errorf("generating milestone notes: %v", err)
+		}
+		body = joinBody(body, notes)
+	}
+	if len(uf.sboms) > 0 {
+		body = joinBody(body, sbomNotes(uf.sboms))
+	}
+	if len(uf.splits) > 0 {
+		body = joinBody(body, splitNotes(uf.splits))
+	}
+	if len(images) > 0 {
+		addSecret(f.registryPassword)
+		auth := &registryAuth{username: f.registryUsername, password: f.registryPassword, ghToken: client.PAT}
+		notes, err := imageNotes(ctx, cf, auth, images)
+		if err != nil {
+			return nil, err
+		}
+		body = joinBody(body, notes)
+	}
+
+	isPrerelease := f.prerelease
+	if f.autoPrerelease {
+		isPrerelease = detectPrerelease(tag, isPrerelease)
+	}
+	if f.policyFile != "" {
+		input := &policyInput{
+			Repo:       client.User + "/" + client.Repo,
+			Tag:        tag,
+			Version:    releaseVersion(tag),
+			Target:     target,
+			Name:       name,
+			Body:       body,
+			Draft:      f.draft || f.publishAfterUpload,
+			PreRelease: isPrerelease,
+		}
+		if err := checkPolicy(ctx, client, f.policyFile, input, assets); err != nil {
+			return nil, err
+		}
+	}
+	run := hookRun{command: "create", repo: client.User + "/" + client.Repo}
+	if *f.dryRun {
+		newPlan(client).hooks(hks, hookBeforeCreate)
+	} else {
+		run.rel = &release.Release{TagName: tag, Name: name, Draft: f.draft || f.publishAfterUpload, PreRelease: isPrerelease}
+		if err := hks.run(ctx, hookBeforeCreate, run); err != nil {
+			return nil, err
+		}
+	}
+
+	if f.createTag {
+		opts := release.CreateTagOptions{Message: tagMessage}
+		if opts.Message == "" {
+			opts.Message = name
+		}
+		if opts.Message == "" {
+			opts.Message = tag
+		}
+		if opts.Tagger, err = tagger(f.taggerName, f.taggerEmail, f.signTag); err != nil {
+			return nil, err
+		}
+		if f.signTag {
+			opts.Sign = gpgTagSigner(f.tagSignKey, cf.fips)
+		}
+		if *f.dryRun {
+			if err := newPlan(client).createTag(ctx, tag, target, opts); err != nil {
+				return nil, err
+			}
+		} else if err := client.CreateAnnotatedTag(ctx, tag, target, opts); err != nil {
+			return nil, fmt.Errorf("creating tag: %v", err)
+		}
+	}
+
+	var existing *release.Release
+	if f.updateExisting {
+		existing, err = client.FindReleaseByTag(ctx, tag)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if existing == nil {
+		if existing, err = uf.journaledRelease(ctx, client, tag); err != nil {
+			return nil, err
+		}
+	}
+
+	req := &release.CreateReleaseRequest{
+		TagName:         tag,
+		TargetCommitish: target,
+		Name:            name,
+		Body:            body,
+		Draft:           f.draft || f.publishAfterUpload,
+		PreRelease:      isPrerelease,
+		MakeLatest:      *f.makeLatest,
+
+		DiscussionCategoryName: f.discussionCategory,
+	}
+	if f.publishAfterUpload {
+		// GitHub ignores make_latest on drafts, so it is sent again when the release is published.
+		req.MakeLatest = ""
+	}
+	if f.generateNotes {
+		// GitHub can only add its notes to a release as it is created and always picks the
+		// previous tag itself, otherwise the notes are fetched separately.
+		if existing == nil && f.previousTag == "" {
+			req.GenerateReleaseNotes = true
+		} else {
+			notes, err := client.GenerateReleaseNotes(ctx, &release.GenerateNotesRequest{
+				TagName:         tag,
+				TargetCommitish: target,
+				PreviousTagName: f.previousTag,
+			})
+			if err != nil {
+				return nil, err
+			}
+			req.Body = joinBody(req.Body, notes.Body)
+		}
+	}
+	// GitHub cuts bodies that are too long short without saying so, so the full notes are
+	// uploaded instead.
+	body, overflow, cleanup, err := overflowBody(client, tag, req.Body, assets)
+	defer cleanup()
+	if err != nil {
+		return nil, err
+	}
+	if overflow != nil {
+		req.Body = body
+		assets = append(append([]release.AssetUpload{}, assets...), *overflow)
+	}
+
+	if *f.dryRun {
+		p := newPlan(client)
+		if err := p.createRelease(ctx, existing, req, appendBody, assets); err != nil {
+			return nil, err
+		}
+		if f.closeMilestone && !f.draft {
+			if err := p.request("PATCH", fmt.Sprintf("milestones/%d", milestone.Number), map[string]string{"state": "closed"}); err != nil {
+				return nil, err
+			}
+		}
+		p.mirrors(mirrors, assets)
+		p.formulas(formulas)
+		p.hooks(hks, hookAfterUpload)
+		if !f.draft {
+			p.hooks(hks, hookAfterPublish)
+		}
+		return nil, p.packageRepos(pkgRepos, client.User+"/"+client.Repo, tag, assets)
+	}
+
+	var rel *release.Release
+	if existing != nil {
+		log.Printf("info: release %d already exists for tag %s, updating it", existing.ID, tag)
+		rel, err = updateRelease(ctx, client, existing, req, appendBody)
+		if err != nil {
+			return nil, fmt.Errorf("updating release: %v", err)
+		}
+	} else {
+		if appendBody != "" {
+			req.Body = appendBody
+		}
+		rel, err = client.CreateRelease(ctx, req)
+		if err != nil {
+			return nil, fmt.Errorf("creating release: %v", err)
+		}
+	}
+	if rel.DiscussionURL != "" {
+		log.Printf("info: release discussion is at %s", rel.DiscussionURL)
+	}
+
+	if existing != nil && !uf.skipExisting && !uf.skipUnchanged && !uf.resume {
+		// Replace the assets of the existing release, rather than having the uploads rejected.
+		uf.clobber = true
+	}
+	results, err := uploadAssets(ctx, client, rel, assets, uf)
+	run.rel, run.assets = rel, results
+	if err == nil {
+		err = hks.run(ctx, hookAfterUpload, run)
+	}
+	if err == nil && f.publishAfterUpload {
+		rel, err = publishRelease(ctx, client, rel, *f.makeLatest)
+	}
+	if err == nil && f.closeMilestone {
+		if rel.Draft {
+			log.Printf("warn: not closing milestone %s as release %d is still a draft", milestone.Title, rel.ID)
+		} else {
+			err = closeMilestone(ctx, client, milestone)
+		}
+	}
+	if err == nil && len(mirrors) > 0 {
+		// The release is only mirrored once it is complete on GitHub.
+		err = mirrorRelease(client.User+"/"+client.Repo, mirrors, rel, assets, results)
+	}
+	if err == nil && len(pkgRepos) > 0 {
+		err = publishPackages(ctx, cf, pkgRepos, client.User+"/"+client.Repo, rel.TagName, results)
+	}
+	if err == nil && len(formulas) > 0 {
+		err = updateFormulas(ctx, cf, client.User+"/"+client.Repo, formulas, rel, assets, results)
+	}
+	if err == nil && !rel.Draft {
+		run.rel = rel
+		err = hks.run(ctx, hookAfterPublish, run)
+	}
+	if err != nil && ctx.Err() != nil && f.deleteDraftOnCancel && existing == nil && rel.Draft {
+		deleteCancelledDraft(client, rel)
+	}
+	if outputErr := writeReleaseOutput(*f.output, rel, results); outputErr != nil {
+		return rel, outputErr
+	}
+	return rel, err
+}
+
+// sendNotifications sends the notifications in the config file for the release in the repo of
+// the client flags, or for the error if it failed. Nothing is sent for a dry run.
+func (f *createFlags) sendNotifications(fs *flag.FlagSet, cf *clientFlags, rel *release.Release, assets []release.AssetUpload, err error) {
+	if !*f.notify || *f.dryRun {
+		return
+	}
+	owner, repo, _ := cf.repoName()
+	tag := f.tag
+	if tag != "" && !strings.HasPrefix(tag, f.tagPrefix) {
+		tag = f.tagPrefix + tag
+	}
+	notify(fs, cf, newNotifyData("create", owner+"/"+repo, tag, rel, assets, err))
+}
+
+// failureHooks runs the on.failure hooks if the release in the repo of the client flags failed.
+// The hooks are not run for a dry run.
+func (f *createFlags) failureHooks(fs *flag.FlagSet, cf *clientFlags, rel *release.Release, err error) {
+	if err == nil || *f.dryRun {
+		return
+	}
+	owner, repo, _ := cf.repoName()
+	if rel == nil {
+		rel = &release.Release{TagName: f.tag}
+	}
+	runFailureHooks(fs, *f.hooks, hookRun{command: "create", repo: owner + "/" + repo, rel: rel, err: err})
+}
+
+// tagger returns the tagger for the tag, or nil to let GitHub use the authenticated user. A signed
+// tag needs the tagger to be known up front, so it defaults to the local git user.name and
+// user.email.
+func tagger(name, email string, sign bool) (*release.Tagger, error) {
+	if sign {
+		for _, v := range []struct {
+			key   string
+			value *string
+		}{{"user.name", &name}, {"user.email", &email}} {
+			if *v.value != "" {
+				continue
+			}
+			value, err := git("config", v.key)
+			if err != nil {
+				return nil, fmt.Errorf("-sign-tag needs -tagger-name and -tagger-email or git config %s: %v", v.key, err)
+			}
+			*v.value = value
+		}
+	}
+	if name == "" && email == "" {
+		return nil, nil
+	}
+	if name == "" || email == "" {
+		return nil, fmt.Errorf("-tagger-name and -tagger-email must be used together")
+	}
+	return &release.Tagger{Name: name, Email: email}, nil
+}
+
+// publishRelease publishes the draft release once its assets have been uploaded, marking it as
+// the latest release according to makeLatest.
+func publishRelease(ctx context.Context, c *release.Client, rel *release.Release, makeLatest string) (*release.Release, error) {
+	published, err := c.PublishReleaseLatest(ctx, rel.ID, makeLatest)
+	if err != nil {
+		return rel, fmt.Errorf("publishing release: %v", err)
+	}
+	log.Printf("info: published release %d for tag %s", published.ID, published.TagName)
+	return published, nil
+}
+
+// deleteCancelledDraft deletes the draft release created by a run that was cancelled. The run's
+// context is already done, so the delete is given its own short deadline.
+func deleteCancelledDraft(c *release.Client, rel *release.Release) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := c.DeleteRelease(withAuditNote(ctx, auditNote{tag: rel.TagName}), rel.ID); err != nil {
+		log.Printf("warn: unable to delete draft release %d after cancelling: %v", rel.ID, err)
+		return
+	}
+	log.Printf("info: deleted draft release %d for tag %s after cancelling", rel.ID, rel.TagName)
+}
+
+// joinBody adds the generated release notes after the body, separated by a blank line.
+func joinBody(body, notes string) string {
+	if body == "" {
+		return notes
+	}
+	return body + "\n\n" + notes
+}
+
+// updateRelease changes the metadata of the existing release to match the create request.
+func updateRelease(ctx context.Context, c *release.Client, existing *release.Release, req *release.CreateReleaseRequest, appendText string) (*release.Release, error) {
+	return c.EditRelease(ctx, existing.ID, updateRequest(existing, req, appendText))
+}
+
+// updateRequest returns the edit request that updates the existing release to match the create
+// request. The body is only replaced if one was given, or the text is appended to it if
+// appendText is set.
+func updateRequest(existing *release.Release, req *release.CreateReleaseRequest, appendText string) *release.EditReleaseRequest {
+	erq := &release.EditReleaseRequest{
+		TagName:         req.TagName,
+		TargetCommitish: req.TargetCommitish,
+		Name:            req.Name,
+		Body:            req.Body,
+		Draft:           &req.Draft,
+		PreRelease:      &req.PreRelease,
+		MakeLatest:      req.MakeLatest,
+
+		DiscussionCategoryName: req.DiscussionCategoryName,
+	}
+	if appendText != "" {
+		erq.Body = release.AppendBody(existing.Body, appendText)
+	}
+	return erq
+}
+
+// deleteExistingAssets deletes the assets on the release that have the same name as one of the
+// assets that is about to be uploaded, so that they are replaced rather than rejected as duplicates.
+func deleteExistingAssets(ctx context.Context, c *release.Client, rel *release.Release, assets []release.AssetUpload) error {
+	replaced, err := replacedAssets(ctx, c, rel, assets)
+	if err != nil {
+		return err
+	}
+	for _, asset := range replaced {
+		log.Printf("info: replacing existing asset %s", asset.Name)
+		if err := c.DeleteAsset(withAuditNote(ctx, auditNote{action: "asset.replaced", tag: rel.TagName, asset: asset.Name}), asset.ID); err != nil {
+			return fmt.Errorf("deleting existing asset %s: %v", asset.Name, err)
+		}
+	}
+	return nil
+}
+
+// replacedAssets returns the assets on the release that have the same name as one of the assets
+// that is about to be uploaded.
+func replacedAssets(ctx context.Context, c *release.Client, rel *release.Release, assets []release.AssetUpload) ([]release.Asset, error) {
+	names := map[string]bool{}
+	for _, asset := range assets {
+		names[asset.Name] = true
+	}
+	existing, err := c.ListReleaseAssets(ctx, rel.ID)
+	if err != nil {
+		return nil, err
+	}
+	var replaced []release.Asset
+	for _, asset := range existing {
+		if names[asset.Name] {
+			replaced = append(replaced, asset)
+		}
+	}
+	return replaced, nil
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/imitablerabbit/githubrelease/pkg/releasetest"
+)
+
+func TestCreate(t *testing.T) {
+	srv := releasetest.NewServer()
+	defer srv.Close()
+	assets := writeAssets(t, map[string]string{"app-linux.tar.gz": "linux", "app-darwin.tar.gz": "darwin"})
+
+	// The default -target of master is a branch of every fake repo.
+	status := runGithubrelease(t, srv, "create", "-release-tag", "v1.0.0", "-name", "v1.0.0",
+		"-asset", assets["app-linux.tar.gz"], "-asset", assets["app-darwin.tar.gz"])
+	if status != exitOK {
+		t.Fatalf("create exited with %d, want %d", status, exitOK)
+	}
+
+	releases := srv.Releases("octo", "app")
+	if len(releases) != 1 || releases[0].TagName != "v1.0.0" || releases[0].Draft {
+		t.Fatalf("releases = %+v, want a published v1.0.0", releases)
+	}
+	if len(releases[0].Assets) != 2 {
+		t.Errorf("release has %d assets, want 2", len(releases[0].Assets))
+	}
+	if _, ok := srv.Ref("octo", "app", "refs/tags/v1.0.0"); !ok {
+		t.Errorf("release was not tagged")
+	}
+}
+
+func TestCreateTargetCommit(t *testing.T) {
+	srv := releasetest.NewServer()
+	defer srv.Close()
+	sha := srv.AddCommit("octo", "app", "release")
+
+	// A short SHA is sent to GitHub as the full SHA of the commit.
+	if status := runGithubrelease(t, srv, "create", "-release-tag", "v1.0.0", "-target", sha[:7], "-uploads", t.TempDir()); status != exitOK {
+		t.Fatalf("create exited with %d, want %d", status, exitOK)
+	}
+	if releases := srv.Releases("octo", "app"); len(releases) != 1 || releases[0].TargetCommitish != sha {
+		t.Errorf("releases = %+v, want one targeting %s", releases, sha)
+	}
+}
+
+func TestCreateUnknownTarget(t *testing.T) {
+	srv := releasetest.NewServer()
+	defer srv.Close()
+
+	if status := runGithubrelease(t, srv, "create", "-release-tag", "v1.0.0", "-target", "missing", "-uploads", t.TempDir()); status != exitValidation {
+		t.Errorf("create exited with %d, want %d", status, exitValidation)
+	}
+	if releases := srv.Releases("octo", "app"); len(releases) != 0 {
+		t.Errorf("releases = %+v, want none", releases)
+	}
+}
+
+func TestCreateCreateTag(t *testing.T) {
+	srv := releasetest.NewServer()
+	defer srv.Close()
+
+	status := runGithubrelease(t, srv, "create", "-release-tag", "v1.0.0", "-target", "main", "-create-tag", "-tag-message", "Release v1.0.0", "-uploads", t.TempDir())
+	if status != exitOK {
+		t.Fatalf("create exited with %d, want %d", status, exitOK)
+	}
+	tag, ok := srv.Ref("octo", "app", "refs/tags/v1.0.0")
+	main, _ := srv.Ref("octo", "app", "refs/heads/main")
+	if !ok || tag == main {
+		t.Errorf("refs/tags/v1.0.0 = %q, %v, want an annotated tag of main", tag, ok)
+	}
+}
+
+func TestCreatePartialUpload(t *testing.T) {
+	srv := releasetest.NewServer()
+	defer srv.Close()
+	assets := writeAssets(t, map[string]string{"app-linux.tar.gz": "linux", "app-darwin.tar.gz": "darwin"})
+	srv.Fail(releasetest.Failure{Method: "POST", Path: "/repos/*/*/releases/*/assets", Status: 422, Times: 1})
+
+	stateFile := filepath.Join(t.TempDir(), "upload.json")
+
+	status := runGithubrelease(t, srv, "create", "-release-tag", "v1.0.0", "-upload-concurrency", "1",
+		"-state-file", stateFile, "-asset", assets["app-linux.tar.gz"], "-asset", assets["app-darwin.tar.gz"])
+	if status != exitPartialUpload {
+		t.Fatalf("create exited with %d, want %d", status, exitPartialUpload)
+	}
+	// The state of the unfinished session is kept for -resume.
+	if _, err := os.Stat(stateFile); err != nil {
+		t.Errorf("upload state was not kept: %v", err)
+	}
+	if releases := srv.Releases("octo", "app"); len(releases) != 1 || len(releases[0].Assets) != 1 {
+		t.Errorf("releases = %+v, want one release with the asset that uploaded", releases)
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/url"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// errNoKeychain is returned by storeToken when there is no OS keychain to store the token in.
+var errNoKeychain = errors.New("no keychain to store the token in, install security on macOS or secret-tool on Linux, or set GITHUB_TOKEN instead of logging in")
+
+// keychainService is the service name that tokens are stored under in the OS keychain.
+const keychainService = "githubrelease"
+
+// credentialsHost returns the host that a token for the api URL is stored under.
+func credentialsHost(apiURL string) string {
+	u, err := url.Parse(apiURL)
+	if err != nil || u.Host == "" {
+		return apiURL
+	}
+	return strings.TrimPrefix(u.Host, "api.")
+}
+
+// keychainAvailable returns whether tokens can be stored in the OS keychain. The macOS keychain is
+// used through security and the Linux secret service through secret-tool.
+func keychainAvailable() bool {
+	switch runtime.GOOS {
+	case "darwin":
+		_, err := exec.LookPath("security")
+		return err == nil
+	case "linux":
+		_, err := exec.LookPath("secret-tool")
+		return err == nil
+	}
+	return false
+}
+
+// storeToken saves the token for the host in the OS keychain. The location it was stored in is
+// returned. The token is never written to a file in plain text, so without a keychain it is
+// refused and the user has to set GITHUB_TOKEN instead.
+func storeToken(host, token string) (string, error) {
+	if !keychainAvailable() {
+		return "", errNoKeychain
+	}
+	var cmd *exec.Cmd
+	if runtime.GOOS == "darwin" {
+		// A -w without a value makes security prompt for the password, so the token is read from
+		// stdin rather than being visible to other users in the process list. It asks for the
+		// password twice.
+		cmd = exec.Command("security", "add-generic-password", "-U", "-s", keychainService, "-a", host, "-w")
+		cmd.Stdin = strings.NewReader(token + "\n" + token + "\n")
+	} else {
+		cmd = exec.Command("secret-tool", "store", "--label=githubrelease "+host, "service", keychainService, "host", host)
+		cmd.Stdin = strings.NewReader(token)
+	}
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return "", fmt.Errorf("storing token in keychain: %v: %s", err, bytes.TrimSpace(out))
+	}
+	return "the keychain", nil
+}
+
+// loadToken returns the stored token for the host, or an empty string if there isn't one.
+func loadToken(host string) (string, error) {
+	if !keychainAvailable() {
+		return "", nil
+	}
+	var cmd *exec.Cmd
+	if runtime.GOOS == "darwin" {
+		cmd = exec.Command("security", "find-generic-password", "-s", keychainService, "-a", host, "-w")
+	} else {
+		cmd = exec.Command("secret-tool", "lookup", "service", keychainService, "host", host)
+	}
+	// Both tools exit with an error when there is no matching token.
+	out, err := cmd.Output()
+	if err != nil {
+		return "", nil
+	}
+	return strings.TrimSpace(string(out)), nil
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/imitablerabbit/githubrelease/pkg/release"
+)
+
+// remoteDigests finds the sha256 of the assets on a release for -skip-unchanged. GitHub reports
+// the digest of assets uploaded since mid 2025. For older assets the digests are read from the
+// integrity manifest of the release if it has one, and otherwise the asset is downloaded and
+// hashed.
+type remoteDigests struct {
+	client   *release.Client
+	all      []releaseAsset
+	manifest map[string]manifestedAsset
+}
+
+// digest returns the hex sha256 of the asset on the release.
+func (d *remoteDigests) digest(ctx context.Context, asset release.Asset) (string, error) {
+	name := asset.Name
+	if strings.HasPrefix(asset.Digest, "sha256:") {
+		return strings.TrimPrefix(asset.Digest, "sha256:"), nil
+	}
+	if d.manifest == nil {
+		d.manifest = map[string]manifestedAsset{}
+		if m, err := downloadReleaseManifest(ctx, d.client, d.all, releaseManifestName); err == nil {
+			for _, a := range m.Assets {
+				d.manifest[a.Name] = a
+			}
+		}
+	}
+	if entry, ok := d.manifest[name]; ok && name != releaseManifestName {
+		return entry.SHA256, nil
+	}
+	log.Printf("info: downloading %s to compare it with the local file", name)
+	body, _, err := d.client.DownloadAsset(ctx, asset.ID, 0)
+	if err != nil {
+		return "", fmt.Errorf("downloading %s: %v", name, err)
+	}
+	defer body.Close()
+	h, _ := release.NewHash("sha256")
+	if _, err := io.Copy(h, body); err != nil {
+		return "", fmt.Errorf("downloading %s: %v", name, err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// skipUnchangedAssets compares the assets with those already on the release with the same name.
+// Assets with the same size and sha256 are returned to be skipped, and the others on the release
+// are deleted so that they are replaced.
+func skipUnchangedAssets(ctx context.Context, c *release.Client, rel *release.Release, assets []release.AssetUpload) (map[string]bool, error) {
+	replaced, err := replacedAssets(ctx, c, rel, assets)
+	if err != nil || len(replaced) == 0 {
+		return nil, err
+	}
+	all, _, err := listDownloads(ctx, c, rel, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	local := map[string]release.AssetUpload{}
+	for _, asset := range assets {
+		local[asset.Name] = asset
+	}
+	digests := &remoteDigests{client: c, all: all}
+	skip := map[string]bool{}
+	var saved int64
+	for _, remote := range replaced {
+		name := remote.Name
+		unchanged, err := assetUnchanged(ctx, digests, local[name], remote)
+		if err != nil {
+			return nil, err
+		}
+		if unchanged {
+			log.Printf("info: skipping %s, it is unchanged on the release", name)
+			skip[name] = true
+			saved += remote.Size
+			continue
+		}
+		log.Printf("info: replacing %s, it has changed", name)
+		if err := c.DeleteAsset(withAuditNote(ctx, auditNote{action: "asset.replaced", tag: rel.TagName, asset: name}), remote.ID); err != nil {
+			return nil, fmt.Errorf("deleting existing asset %s: %v", name, err)
+		}
+	}
+	if len(skip) > 0 {
+		log.Printf("info: skipped %d unchanged asset(s), %s", len(skip), formatBytes(float64(saved)))
+	}
+	return skip, nil
+}
+
+// assetUnchanged reports whether the asset on the release is fully uploaded with the size and
+// sha256 of the local file. The sizes are compared first so that a changed asset is not hashed.
+func assetUnchanged(ctx context.Context, digests *remoteDigests, asset release.AssetUpload, remote release.Asset) (bool, error) {
+	info, err := os.Stat(asset.Path)
+	if err != nil {
+		return false, err
+	}
+	if remote.State != "uploaded" || remote.Size != info.Size() {
+		return false, nil
+	}
+	remoteDigest, err := digests.digest(ctx, remote)
+	if err != nil {
+		return false, err
+	}
+	localDigest, err := release.FileDigest(asset.Path, "sha256")
+	if err != nil {
+		return false, err
+	}
+	return strings.EqualFold(remoteDigest, localDigest), nil
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+)
+
+// runDelete deletes a release. The git tag is left in place.
+func runDelete(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("delete", flag.ContinueOnError)
+	cf := addClientFlags(fs)
+	cf.writesReleases = true
+	rf := addReleaseFlags(fs)
+	dryRun := addDryRunFlag(fs)
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	ctx, cancel := cf.withTimeout(ctx)
+	defer cancel()
+	client, err := cf.newClient(ctx)
+	if err != nil {
+		return err
+	}
+	rel, err := rf.getRelease(ctx, client)
+	if err != nil {
+		return err
+	}
+	if *dryRun {
+		return newPlan(client).request("DELETE", fmt.Sprintf("releases/%d", rel.ID), nil)
+	}
+	if err := client.DeleteRelease(withAuditNote(ctx, auditNote{tag: rel.TagName}), rel.ID); err != nil {
+		return err
+	}
+	log.Printf("info: deleted release %d for tag %s", rel.ID, rel.TagName)
+	return nil
+}
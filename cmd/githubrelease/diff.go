@@ -0,0 +1,357 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/imitablerabbit/githubrelease/pkg/release"
+)
+
+// releaseDiff is the comparison of two releases printed by the diff command.
+type releaseDiff struct {
+	From            string        `json:"from"`
+	To              string        `json:"to"`
+	CompareURL      string        `json:"compare_url,omitempty"`
+	Commits         int           `json:"commits"`
+	NewContributors []string      `json:"new_contributors"`
+	Assets          []assetChange `json:"assets"`
+	Body            []string      `json:"body_diff"`
+}
+
+// assetChange is an asset that was added, removed or changed between the releases. Assets are
+// matched by name with the version of each release taken out, so app_1.2.0.tar.gz in the old
+// release matches app_1.3.0.tar.gz in the new one.
+type assetChange struct {
+	Change  string `json:"change"`
+	OldName string `json:"old_name,omitempty"`
+	NewName string `json:"new_name,omitempty"`
+	OldSize int64  `json:"old_size,omitempty"`
+	NewSize int64  `json:"new_size,omitempty"`
+	OldHash string `json:"old_sha256,omitempty"`
+	NewHash string `json:"new_sha256,omitempty"`
+}
+
+// diffAsset is an asset of one of the releases being compared.
+type diffAsset struct {
+	id   int
+	name string
+	size int64
+	hash string
+}
+
+// runDiff compares two releases and prints the changes to their assets and body, the commits
+// between them and the contributors who made their first commit.
+func runDiff(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("diff", flag.ContinueOnError)
+	cf := addClientFlags(fs)
+	output := fs.String("output", "text", "Output format: text, markdown for an announcement, or json")
+	hash := fs.Bool("hash", false, "Download the assets that GitHub has no sha256 digest for, to compare their contents")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: githubrelease diff [flags] <old tag> <new tag>\n")
+		fs.PrintDefaults()
+	}
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() != 2 {
+		return withExitCode(exitValidation, fmt.Errorf("expected the tags of the two releases to compare, e.g. diff v1.2.0 v1.3.0"))
+	}
+	switch *output {
+	case "text", "markdown", "json":
+	default:
+		return withExitCode(exitValidation, fmt.Errorf("unsupported -output %q, expected text, markdown or json", *output))
+	}
+
+	ctx, cancel := cf.withTimeout(ctx)
+	defer cancel()
+	client, err := cf.newClient(ctx)
+	if err != nil {
+		return err
+	}
+	from, err := client.GetReleaseByTag(ctx, fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	to, err := client.GetReleaseByTag(ctx, fs.Arg(1))
+	if err != nil {
+		return err
+	}
+	d, err := diffReleases(ctx, client, from, to, *hash)
+	if err != nil {
+		return err
+	}
+	switch *output {
+	case "json":
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(d)
+	case "markdown":
+		fmt.Print(d.markdown())
+	default:
+		fmt.Print(d.text())
+	}
+	return nil
+}
+
+// diffReleases compares the releases. The commits are those in the to tag but not the from tag.
+func diffReleases(ctx context.Context, client *release.Client, from, to *release.Release, hash bool) (*releaseDiff, error) {
+	d := &releaseDiff{
+		From:            from.TagName,
+		To:              to.TagName,
+		NewContributors: []string{},
+		Assets:          []assetChange{},
+		Body:            diffLines(from.Body, to.Body),
+	}
+	if base, _, ok := strings.Cut(to.HTMLURL, "/releases/"); ok {
+		d.CompareURL = fmt.Sprintf("%s/compare/%s...%s", base, from.TagName, to.TagName)
+	}
+
+	commits, err := client.CompareCommits(ctx, from.TagName, to.TagName)
+	if err != nil {
+		return nil, err
+	}
+	d.Commits = len(commits)
+	authors := map[string]bool{}
+	for _, commit := range commits {
+		if commit.Author != nil && commit.Author.Login != "" {
+			authors[commit.Author.Login] = true
+		}
+	}
+	for login := range authors {
+		before, err := client.HasCommitsBy(ctx, login, from.TagName)
+		if err != nil {
+			return nil, err
+		}
+		if !before {
+			d.NewContributors = append(d.NewContributors, login)
+		}
+	}
+	sort.Strings(d.NewContributors)
+
+	oldAssets, err := diffAssets(ctx, client, from, hash)
+	if err != nil {
+		return nil, err
+	}
+	newAssets, err := diffAssets(ctx, client, to, hash)
+	if err != nil {
+		return nil, err
+	}
+	d.Assets = compareAssets(oldAssets, newAssets, tagVersion(from.TagName), tagVersion(to.TagName))
+	return d, nil
+}
+
+// diffAssets returns the assets of the release with their sha256 digests. GitHub records the
+// digest of newer uploads, the others are downloaded and hashed if hash is set.
+func diffAssets(ctx context.Context, client *release.Client, rel *release.Release, hash bool) ([]diffAsset, error) {
+	existing, err := client.ListReleaseAssets(ctx, rel.ID)
+	if err != nil {
+		return nil, err
+	}
+	var assets []diffAsset
+	for _, asset := range existing {
+		a := diffAsset{id: asset.ID, name: asset.Name, size: asset.Size, hash: strings.TrimPrefix(asset.Digest, "sha256:")}
+		if a.hash == "" && hash {
+			if a.hash, err = hashAsset(ctx, client, a.id); err != nil {
+				return nil, fmt.Errorf("hashing %s from %s: %v", asset.Name, rel.TagName, err)
+			}
+		}
+		assets = append(assets, a)
+	}
+	return assets, nil
+}
+
+// hashAsset downloads the asset and returns its sha256 digest.
+func hashAsset(ctx context.Context, client *release.Client, id int) (string, error) {
+	body, _, err := client.DownloadAsset(ctx, id, 0)
+	if err != nil {
+		return "", err
+	}
+	defer body.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, body); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// assetKey returns the name of the asset with the version taken out, so that the same asset can
+// be found in releases of different versions.
+func assetKey(name, version string) string {
+	version = strings.TrimPrefix(version, "v")
+	if version == "" {
+		return name
+	}
+	return strings.ReplaceAll(name, version, "{version}")
+}
+
+// compareAssets returns the assets that were removed, added or changed, in name order.
+func compareAssets(oldAssets, newAssets []diffAsset, oldVersion, newVersion string) []assetChange {
+	old := map[string]diffAsset{}
+	for _, a := range oldAssets {
+		old[assetKey(a.name, oldVersion)] = a
+	}
+	changes := []assetChange{}
+	seen := map[string]bool{}
+	for _, n := range newAssets {
+		key := assetKey(n.name, newVersion)
+		seen[key] = true
+		o, ok := old[key]
+		if !ok {
+			changes = append(changes, assetChange{Change: "added", NewName: n.name, NewSize: n.size, NewHash: n.hash})
+			continue
+		}
+		c := assetChange{Change: "changed", OldName: o.name, NewName: n.name, OldSize: o.size, NewSize: n.size, OldHash: o.hash, NewHash: n.hash}
+		if o.size == n.size && (o.hash == n.hash || o.hash == "" || n.hash == "") {
+			// Without both hashes an asset of the same size is assumed to be unchanged.
+			c.Change = "unchanged"
+		}
+		changes = append(changes, c)
+	}
+	for _, o := range oldAssets {
+		if !seen[assetKey(o.name, oldVersion)] {
+			changes = append(changes, assetChange{Change: "removed", OldName: o.name, OldSize: o.size, OldHash: o.hash})
+		}
+	}
+	sort.SliceStable(changes, func(i, j int) bool {
+		return changes[i].name() < changes[j].name()
+	})
+	return changes
+}
+
+// name returns the name of the asset in the newer release, or the older one if it was removed.
+func (c assetChange) name() string {
+	if c.NewName != "" {
+		return c.NewName
+	}
+	return c.OldName
+}
+
+// summary describes the change, e.g. "1.2 MiB -> 1.3 MiB (+102.4 KiB)".
+func (c assetChange) summary() string {
+	switch c.Change {
+	case "added":
+		return formatBytes(float64(c.NewSize))
+	case "removed":
+		return formatBytes(float64(c.OldSize))
+	}
+	s := fmt.Sprintf("%s -> %s", formatBytes(float64(c.OldSize)), formatBytes(float64(c.NewSize)))
+	if delta := c.NewSize - c.OldSize; delta > 0 {
+		s += fmt.Sprintf(" (+%s)", formatBytes(float64(delta)))
+	} else if delta < 0 {
+		s += fmt.Sprintf(" (-%s)", formatBytes(float64(-delta)))
+	}
+	if c.OldHash != "" && c.NewHash != "" && c.OldHash != c.NewHash {
+		s += fmt.Sprintf(", sha256 %s -> %s", c.OldHash[:12], c.NewHash[:12])
+	}
+	if c.OldName != c.NewName {
+		s = c.OldName + " -> " + c.NewName + ", " + s
+	}
+	return s
+}
+
+// diffLines returns a line diff of the two texts, with removed lines prefixed with "-", added
+// lines with "+" and unchanged lines with a space. Nothing is returned if they are the same.
+func diffLines(a, b string) []string {
+	if a == b {
+		return []string{}
+	}
+	x, y := strings.Split(a, "\n"), strings.Split(b, "\n")
+	// lcs[i][j] is the length of the longest common subsequence of x[i:] and y[j:].
+	lcs := make([][]int, len(x)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(y)+1)
+	}
+	for i := len(x) - 1; i >= 0; i-- {
+		for j := len(y) - 1; j >= 0; j-- {
+			if strings.TrimRight(x[i], "\r") == strings.TrimRight(y[j], "\r") {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+	lines := []string{}
+	i, j := 0, 0
+	for i < len(x) || j < len(y) {
+		switch {
+		case i < len(x) && j < len(y) && strings.TrimRight(x[i], "\r") == strings.TrimRight(y[j], "\r"):
+			lines = append(lines, " "+strings.TrimRight(x[i], "\r"))
+			i++
+			j++
+		case i < len(x) && (j == len(y) || lcs[i+1][j] >= lcs[i][j+1]):
+			lines = append(lines, "-"+strings.TrimRight(x[i], "\r"))
+			i++
+		default:
+			lines = append(lines, "+"+strings.TrimRight(y[j], "\r"))
+			j++
+		}
+	}
+	return lines
+}
+
+// text formats the comparison for the terminal.
+func (d *releaseDiff) text() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s...%s: %d commit(s)\n", d.From, d.To, d.Commits)
+	if d.CompareURL != "" {
+		fmt.Fprintf(&b, "%s\n", d.CompareURL)
+	}
+	if len(d.NewContributors) > 0 {
+		fmt.Fprintf(&b, "\nNew contributors: %s\n", strings.Join(d.NewContributors, ", "))
+	}
+	fmt.Fprintf(&b, "\nAssets:\n")
+	for _, c := range d.Assets {
+		if c.Change != "unchanged" {
+			fmt.Fprintf(&b, "  %-8s %s: %s\n", c.Change, c.name(), c.summary())
+		}
+	}
+	if len(d.Body) > 0 {
+		fmt.Fprintf(&b, "\nBody:\n")
+		for _, line := range d.Body {
+			fmt.Fprintf(&b, "  %s\n", line)
+		}
+	}
+	return b.String()
+}
+
+// markdown formats the comparison as Markdown for an announcement.
+func (d *releaseDiff) markdown() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "## Changes from %s to %s\n\n", d.From, d.To)
+	if d.CompareURL != "" {
+		fmt.Fprintf(&b, "%d commit(s): [%s...%s](%s)\n", d.Commits, d.From, d.To, d.CompareURL)
+	} else {
+		fmt.Fprintf(&b, "%d commit(s)\n", d.Commits)
+	}
+	if len(d.NewContributors) > 0 {
+		fmt.Fprintf(&b, "\n### New Contributors\n\n")
+		for _, login := range d.NewContributors {
+			fmt.Fprintf(&b, "* @%s\n", login)
+		}
+	}
+	changed := false
+	for _, c := range d.Assets {
+		if c.Change == "unchanged" {
+			continue
+		}
+		if !changed {
+			fmt.Fprintf(&b, "\n### Assets\n\n| Asset | Change | Details |\n|-------|--------|---------|\n")
+			changed = true
+		}
+		fmt.Fprintf(&b, "| `%s` | %s | %s |\n", c.name(), c.Change, strings.ReplaceAll(c.summary(), "|", "\\|"))
+	}
+	if len(d.Body) > 0 {
+		fmt.Fprintf(&b, "\n### Release notes\n\n```diff\n%s\n```\n", strings.Join(d.Body, "\n"))
+	}
+	return b.String()
+}
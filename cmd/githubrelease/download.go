@@ -0,0 +1,254 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/imitablerabbit/githubrelease/pkg/release"
+)
+
+// releaseAsset is an asset on a release that can be downloaded.
+type releaseAsset struct {
+	id          int
+	name        string
+	label       string
+	contentType string
+	size        int64
+}
+
+// listDownloads returns the assets on the release, keeping those that match the include and
+// exclude patterns.
+func listDownloads(ctx context.Context, client *release.Client, rel *release.Release, include, exclude []string) ([]releaseAsset, []releaseAsset, error) {
+	existing, err := client.ListReleaseAssets(ctx, rel.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+	var all []releaseAsset
+	var uploads []release.AssetUpload
+	for _, asset := range existing {
+		all = append(all, releaseAsset{id: asset.ID, name: asset.Name, label: asset.Label, contentType: asset.ContentType, size: asset.Size})
+		uploads = append(uploads, release.AssetUpload{Name: asset.Name})
+	}
+	// The upload filters match on the asset name, so they can be reused for downloads.
+	filtered, err := filterAssets(uploads, include, exclude)
+	if err != nil {
+		return nil, nil, err
+	}
+	keep := map[string]bool{}
+	for _, asset := range filtered {
+		keep[asset.Name] = true
+	}
+	var matched []releaseAsset
+	for _, asset := range all {
+		if keep[asset.name] {
+			matched = append(matched, asset)
+		}
+	}
+	return all, matched, nil
+}
+
+// downloadAsset downloads the asset into dir. The contents are written to a .part file which is
+// renamed once the download is complete. If resume is set and there is a .part file from an
+// earlier attempt the download continues from the end of it.
+func downloadAsset(ctx context.Context, client *release.Client, asset releaseAsset, dir string, resume bool) (string, error) {
+	dest := filepath.Join(dir, filepath.Base(asset.name))
+	part := dest + ".part"
+	var offset int64
+	if info, err := os.Stat(part); err == nil && resume {
+		offset = info.Size()
+	}
+	flags := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+	if offset > 0 {
+		flags = os.O_CREATE | os.O_WRONLY | os.O_APPEND
+	}
+	if offset > 0 && offset < asset.size {
+		log.Printf("info: resuming download of %s from %d of %d bytes", asset.name, offset, asset.size)
+	}
+
+	if offset < asset.size || asset.size == 0 {
+		f, err := os.OpenFile(part, flags, 0644)
+		if err != nil {
+			return "", err
+		}
+		body, resumed, err := client.DownloadAsset(ctx, asset.id, offset)
+		if err != nil {
+			f.Close()
+			return "", err
+		}
+		defer body.Close()
+		if offset > 0 && !resumed {
+			log.Printf("info: server does not support resuming, downloading %s from the start", asset.name)
+			if err := f.Truncate(0); err != nil {
+				f.Close()
+				return "", err
+			}
+		}
+		_, err = io.Copy(f, body)
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return "", fmt.Errorf("downloading %s: %v", asset.name, err)
+		}
+	}
+
+	info, err := os.Stat(part)
+	if err != nil {
+		return "", err
+	}
+	if info.Size() != asset.size {
+		return "", fmt.Errorf("downloaded %d bytes of %s, expected %d", info.Size(), asset.name, asset.size)
+	}
+	if err := os.Rename(part, dest); err != nil {
+		return "", err
+	}
+	return dest, nil
+}
+
+// downloadChecksums downloads the checksums file from the release and returns the digests by
+// asset name.
+func downloadChecksums(ctx context.Context, client *release.Client, all []releaseAsset, name string) (map[string]string, error) {
+	for _, asset := range all {
+		if asset.name != name {
+			continue
+		}
+		body, _, err := client.DownloadAsset(ctx, asset.id, 0)
+		if err != nil {
+			return nil, fmt.Errorf("downloading checksums file: %v", err)
+		}
+		defer body.Close()
+		var buf bytes.Buffer
+		if _, err := io.Copy(&buf, body); err != nil {
+			return nil, fmt.Errorf("downloading checksums file: %v", err)
+		}
+		return release.ReadChecksums(&buf)
+	}
+	return nil, fmt.Errorf("the release has no checksums file %s", name)
+}
+
+// verifyChecksum checks the downloaded file against its digest from the checksums file. With
+// sha2Only set a digest that is not SHA-2 is rejected rather than trusted.
+func verifyChecksum(path, name string, checksums map[string]string, sha2Only bool) error {
+	expected, ok := checksums[name]
+	if !ok {
+		log.Printf("warn: %s is not in the checksums file, not verifying it", name)
+		return nil
+	}
+	algorithm, err := release.DigestAlgorithm(expected)
+	if err != nil {
+		return err
+	}
+	if sha2Only && !release.IsSHA2(algorithm) {
+		return fmt.Errorf("the %s checksum of %s is not allowed with -fips, only sha256 and sha512 are", algorithm, name)
+	}
+	digest, err := release.FileDigest(path, algorithm)
+	if err != nil {
+		return err
+	}
+	if digest != expected {
+		return fmt.Errorf("%s checksum mismatch for %s: got %s, expected %s", algorithm, name, digest, expected)
+	}
+	log.Printf("info: verified %s checksum of %s", algorithm, name)
+	return nil
+}
+
+// runDownload downloads the assets of a release.
+func runDownload(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("download", flag.ContinueOnError)
+	cf := addClientFlags(fs)
+	rf := addReleaseFlags(fs)
+	dir := fs.String("dir", ".", "Directory to download the assets into")
+	var include, exclude stringsFlag
+	fs.Var(&include, "include", "Only download assets whose names match this glob pattern. Can be repeated")
+	fs.Var(&exclude, "exclude", "Do not download assets whose names match this glob pattern. Can be repeated")
+	concurrency := fs.Int("download-concurrency", 1, "Number of assets to download at the same time")
+	verify := fs.Bool("verify-checksums", false, "Verify the downloaded assets against the checksums file uploaded with the release")
+	checksumsFile := fs.String("checksums-file", "checksums.txt", "Name of the checksums file on the release")
+	resume := fs.Bool("resume", false, "Continue downloads that were interrupted instead of starting them again")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	ctx, cancel := cf.withTimeout(ctx)
+	defer cancel()
+	client, err := cf.newClient(ctx)
+	if err != nil {
+		return err
+	}
+	rel, err := rf.getRelease(ctx, client)
+	if err != nil {
+		return err
+	}
+	all, assets, err := listDownloads(ctx, client, rel, include, exclude)
+	if err != nil {
+		return err
+	}
+	var checksums map[string]string
+	if *verify {
+		if checksums, err = downloadChecksums(ctx, client, all, *checksumsFile); err != nil {
+			return err
+		}
+	}
+	if err := os.MkdirAll(*dir, 0755); err != nil {
+		return fmt.Errorf("creating download directory: %v", err)
+	}
+
+	workers := *concurrency
+	if workers < 1 {
+		workers = 1
+	}
+	errs := make([]error, len(assets))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				asset := assets[i]
+				path, err := downloadAsset(ctx, client, asset, *dir, *resume)
+				if err == nil && checksums != nil && asset.name != *checksumsFile {
+					if err = verifyChecksum(path, asset.name, checksums, cf.fips); err != nil {
+						os.Remove(path)
+					}
+				}
+				if err != nil {
+					log.Printf("warn: downloading an asset: %v", err)
+				} else {
+					log.Printf("info: downloaded %s", path)
+				}
+				errs[i] = err
+			}
+		}()
+	}
+	for i := range assets {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	failed := 0
+	for _, err := range errs {
+		if err != nil {
+			failed++
+		}
+	}
+	log.Printf("info: downloaded %d of %d asset(s)", len(assets)-failed, len(assets))
+	if failed > 0 {
+		log.Printf("error: %d asset(s) failed to download:", failed)
+		for i, err := range errs {
+			if err != nil {
+				log.Printf("error:   %s: %v", assets[i].name, err)
+			}
+		}
+		return fmt.Errorf("%d asset(s) failed to download", failed)
+	}
+	return nil
+}
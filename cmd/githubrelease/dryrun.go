@@ -0,0 +1,184 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/imitablerabbit/githubrelease/pkg/release"
+)
+
+// addDryRunFlag registers the -dry-run flag on the flag set.
+func addDryRunFlag(fs *flag.FlagSet) *bool {
+	// Everything is checked and the write requests are printed, but nothing is changed on GitHub.
+	return fs.Bool("dry-run", false, "Print the requests that would create, change or upload anything instead of sending them")
+}
+
+// plan prints the write requests that a command would send in dry-run mode. Read requests are
+// still sent so that the plan reflects the current state of the repository.
+type plan struct {
+	w      io.Writer
+	client *release.Client
+}
+
+// newPlan returns a plan that prints to stdout.
+func newPlan(client *release.Client) *plan {
+	return &plan{w: os.Stdout, client: client}
+}
+
+// request prints a request to the path under the repository with its JSON payload, if it has one.
+func (p *plan) request(method, path string, payload interface{}) error {
+	fmt.Fprintf(p.w, "%s %s/repos/%s/%s/%s\n", method, p.client.APIURL, p.client.User, p.client.Repo, path)
+	if payload == nil {
+		return nil
+	}
+	data, err := json.MarshalIndent(payload, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(p.w, "%s\n", data)
+	return nil
+}
+
+// createTag prints the requests that would create the tag, or nothing if it already exists. A
+// signed tag is not signed, the signature is shown as a placeholder at the end of the message.
+func (p *plan) createTag(ctx context.Context, tag, commitish string, opts release.CreateTagOptions) error {
+	exists, err := p.client.TagExists(ctx, tag)
+	if err != nil {
+		return fmt.Errorf("checking tag exists: %v", err)
+	}
+	if exists {
+		fmt.Fprintf(p.w, "tag %s already exists\n", tag)
+		return nil
+	}
+	sha, err := p.client.ResolveCommit(ctx, commitish)
+	if err != nil {
+		return err
+	}
+	message := opts.Message
+	if opts.Sign != nil {
+		message += "\n<gpg signature>"
+	}
+	ctr := &release.CreateTagRequest{Tag: tag, Message: message, Object: sha, Type: "commit", Tagger: opts.Tagger}
+	if err := p.request("POST", "git/tags", ctr); err != nil {
+		return err
+	}
+	return p.request("POST", "git/refs", &release.CreateRefRequest{Ref: "refs/tags/" + tag, SHA: "<sha of the new tag object>"})
+}
+
+// createRelease prints the requests that would create the release, or update the existing one
+// and replace its assets, and then upload the assets.
+func (p *plan) createRelease(ctx context.Context, existing *release.Release, req *release.CreateReleaseRequest, appendText string, assets []release.AssetUpload) error {
+	if existing == nil {
+		if appendText != "" {
+			req.Body = appendText
+		}
+		if err := p.request("POST", "releases", req); err != nil {
+			return err
+		}
+		// The upload URL is only known once the release has been created.
+		return p.uploads(&release.Release{UploadURL: "<upload_url>"}, assets)
+	}
+
+	if err := p.request("PATCH", fmt.Sprintf("releases/%d", existing.ID), updateRequest(existing, req, appendText)); err != nil {
+		return err
+	}
+	replaced, err := replacedAssets(ctx, p.client, existing, assets)
+	if err != nil {
+		return err
+	}
+	for _, asset := range replaced {
+		if err := p.request("DELETE", fmt.Sprintf("releases/assets/%d", asset.ID), nil); err != nil {
+			return err
+		}
+	}
+	return p.uploads(existing, assets)
+}
+
+// uploads prints the upload request for each asset with its size and content type.
+func (p *plan) uploads(rel *release.Release, assets []release.AssetUpload) error {
+	var total int64
+	for _, asset := range assets {
+		if isRemoteAsset(asset.Path) {
+			fmt.Fprintf(p.w, "POST %s\n  %s (streamed)\n", p.client.AssetUploadURL(rel, asset), displayURL(asset.Path))
+			continue
+		}
+		info, err := os.Stat(asset.Path)
+		if err != nil {
+			return err
+		}
+		contentType := asset.ContentType
+		if contentType == "" {
+			contentType = release.ContentType(asset.Path)
+		}
+		fmt.Fprintf(p.w, "POST %s\n  %s (%d bytes, %s)\n", p.client.AssetUploadURL(rel, asset), asset.Path, info.Size(), contentType)
+		total += info.Size()
+	}
+	fmt.Fprintf(p.w, "%d asset(s), %d bytes\n", len(assets), total)
+	return nil
+}
+
+// copies prints the upload of each asset of another release, which is downloaded first.
+func (p *plan) copies(rel *release.Release, assets []releaseAsset) {
+	var total int64
+	for _, asset := range assets {
+		upload := release.AssetUpload{Name: asset.name, Label: asset.label}
+		fmt.Fprintf(p.w, "POST %s\n  asset %d (%d bytes, %s)\n", p.client.AssetUploadURL(rel, upload), asset.id, asset.size, asset.contentType)
+		total += asset.size
+	}
+	fmt.Fprintf(p.w, "%d asset(s), %d bytes\n", len(assets), total)
+}
+
+// mirrors prints the copies of the assets and the release manifest to each mirror.
+func (p *plan) mirrors(mirrors []string, assets []release.AssetUpload) {
+	for _, mirror := range mirrors {
+		for _, asset := range assets {
+			fmt.Fprintf(p.w, "COPY %s %s\n", asset.Path, mirrorDest(mirror, asset.Name))
+		}
+		fmt.Fprintf(p.w, "COPY <%s> %s\n", mirrorManifestName, mirrorDest(mirror, mirrorManifestName))
+	}
+}
+
+// formulas prints the Homebrew formulas and Scoop manifests that would be written or committed.
+func (p *plan) formulas(configs []*formulaConfig) {
+	for _, config := range configs {
+		fc := config.withDefaults(p.client.User+"/"+p.client.Repo, "")
+		if fc.repo == "" {
+			fmt.Fprintf(p.w, "WRITE %s %s\n", fc.kind, fc.path)
+			continue
+		}
+		fmt.Fprintf(p.w, "PUT %s/repos/%s/contents/%s\n", p.client.APIURL, fc.repo, fc.path)
+	}
+}
+
+// packageRepos prints the uploads and commands that would publish the .deb and .rpm assets to the
+// package repositories.
+func (p *plan) packageRepos(repos []packageRepo, repo, tag string, assets []release.AssetUpload) error {
+	for _, asset := range assets {
+		for _, r := range repos {
+			if !r.matches(asset.Name) {
+				continue
+			}
+			target, err := r.expand(packageRepoData{Name: asset.Name, Path: asset.Path, Tag: tag, Version: tagVersion(tag), Repo: repo})
+			if err != nil {
+				return err
+			}
+			if r.command != nil {
+				fmt.Fprintf(p.w, "RUN %s\n", target)
+				continue
+			}
+			fmt.Fprintf(p.w, "%s %s <%s>\n", r.method, target, asset.Path)
+		}
+	}
+	return nil
+}
+
+// hooks prints the commands of the hooks that would be run for the event.
+func (p *plan) hooks(h hooks, event string) {
+	for _, command := range h[event] {
+		fmt.Fprintf(p.w, "RUN %s hook: %s\n", event, command)
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+
+	"github.com/imitablerabbit/githubrelease/pkg/release"
+)
+
+// runEdit changes the metadata of an existing release. Only the flags that are passed are changed.
+func runEdit(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("edit", flag.ContinueOnError)
+	cf := addClientFlags(fs)
+	cf.writesReleases = true
+	rf := addReleaseFlags(fs)
+	newTag := fs.String("new-tag", "", "Change the tag_name of the release")
+	targetCommitish := fs.String("target", "", "Change the commit/branch/tag that the release is based on")
+	name := fs.String("name", "", "Change the name of the release")
+	body := fs.String("body", "", "Replace the body of the release")
+	bodyFile := fs.String("body-file", "", "Replace the body of the release with the contents of this file, or stdin if it is -")
+	bodyAppend := fs.String("body-append", "", "Add this text to the end of the body of the release, e.g. for notes found after it was published")
+	bodyAppendFile := fs.String("body-append-file", "", "Add the contents of this file, or stdin if it is -, to the end of the body of the release")
+	draft := fs.Bool("draft", false, "Change whether the release is a draft")
+	prerelease := fs.Bool("prerelease", false, "Change whether the release is a pre-release")
+	makeLatest := addMakeLatestFlag(fs)
+	discussionCategory := fs.String("discussion-category", "", "Open a GitHub Discussion linked to the release in this existing discussion category")
+	dryRun := addDryRunFlag(fs)
+	output := addOutputFlag(fs)
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if err := readBodyFile(*bodyFile, body); err != nil {
+		return err
+	}
+	if err := readTextFile("body-append", *bodyAppendFile, bodyAppend); err != nil {
+		return err
+	}
+	if *body != "" && *bodyAppend != "" {
+		return withExitCode(exitValidation, fmt.Errorf("the body can either be replaced or appended to, not both"))
+	}
+	if err := checkOutputFormat(*output); err != nil {
+		return err
+	}
+	if err := checkMakeLatest(*makeLatest); err != nil {
+		return err
+	}
+
+	ctx, cancel := cf.withTimeout(ctx)
+	defer cancel()
+	client, err := cf.newClient(ctx)
+	if err != nil {
+		return err
+	}
+	rel, err := rf.getRelease(ctx, client)
+	if err != nil {
+		return err
+	}
+
+	set := flagsSet(fs)
+	req := &release.EditReleaseRequest{
+		TagName:         *newTag,
+		TargetCommitish: *targetCommitish,
+		Name:            *name,
+		Body:            *body,
+		MakeLatest:      *makeLatest,
+
+		DiscussionCategoryName: *discussionCategory,
+	}
+	if *bodyAppend != "" {
+		req.Body = release.AppendBody(rel.Body, *bodyAppend)
+	}
+	if set["draft"] {
+		req.Draft = draft
+	}
+	if set["prerelease"] {
+		req.PreRelease = prerelease
+	}
+	if *dryRun {
+		return newPlan(client).request("PATCH", fmt.Sprintf("releases/%d", rel.ID), req)
+	}
+	rel, err = client.EditRelease(ctx, rel.ID, req)
+	if err != nil {
+		return err
+	}
+	if *discussionCategory != "" && rel.DiscussionURL != "" {
+		log.Printf("info: release discussion is at %s", rel.DiscussionURL)
+	}
+	if *output == "json" {
+		return writeReleaseOutput(*output, rel, nil)
+	}
+	fmt.Println(rel.HTMLURL)
+	return nil
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// envPrefix is the prefix of the environment variables that can be used for any flag, e.g.
+// GITHUBRELEASE_RELEASE_TAG for -release-tag.
+const envPrefix = "GITHUBRELEASE_"
+
+// standardEnv are the environment variables set by GitHub Actions and other CI systems that are
+// used as fallbacks for flags. The GITHUBRELEASE_ variable for a flag takes precedence over these.
+var standardEnv = map[string]string{
+	"GITHUB_TOKEN":   "pat",
+	"GITHUB_API_URL": "api-url",
+}
+
+// envName returns the environment variable for the flag.
+func envName(flagName string) string {
+	return envPrefix + strings.ToUpper(strings.ReplaceAll(flagName, "-", "_"))
+}
+
+// applyEnv sets the flags that were not set on the command line from the environment. This keeps
+// secrets such as the pat out of process listings.
+func applyEnv(fs *flag.FlagSet) error {
+	values := map[string]string{}
+	for env, name := range standardEnv {
+		if v := os.Getenv(env); v != "" && fs.Lookup(name) != nil {
+			values[name] = v
+		}
+	}
+	// GITHUB_REPOSITORY is owner/repo.
+	if owner, repo, ok := strings.Cut(os.Getenv("GITHUB_REPOSITORY"), "/"); ok && fs.Lookup("user") != nil {
+		values["user"] = owner
+		values["repo"] = repo
+	}
+	fs.VisitAll(func(f *flag.Flag) {
+		if v, ok := os.LookupEnv(envName(f.Name)); ok {
+			values[f.Name] = v
+		}
+	})
+
+	set := flagsSet(fs)
+	for name, v := range values {
+		if set[name] {
+			continue
+		}
+		if err := fs.Set(name, v); err != nil {
+			return fmt.Errorf("invalid value %q for %s from the environment: %v", v, name, err)
+		}
+	}
+	return nil
+}
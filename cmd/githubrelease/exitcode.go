@@ -0,0 +1,95 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"strings"
+
+	"github.com/imitablerabbit/githubrelease/pkg/release"
+)
+
+// The exit codes of the tool, so that CI can tell the kind of failure apart. They are documented
+// in the readme and must not be renumbered.
+const (
+	exitOK            = 0
+	exitFailure       = 1
+	exitUsage         = 2
+	exitValidation    = 3
+	exitAuth          = 4
+	exitNotFound      = 5
+	exitTagConflict   = 6
+	exitPartialUpload = 7
+	exitNetwork       = 8
+)
+
+// exitError is an error with the exit code that the tool should exit with.
+type exitError struct {
+	code int
+	err  error
+}
+
+func (e *exitError) Error() string {
+	return e.err.Error()
+}
+
+func (e *exitError) Unwrap() error {
+	return e.err
+}
+
+// withExitCode returns the error with the exit code, or nil if err is nil. An error that already
+// has an exit code keeps it.
+func withExitCode(code int, err error) error {
+	var ee *exitError
+	if err == nil || errors.As(err, &ee) {
+		return err
+	}
+	return &exitError{code: code, err: err}
+}
+
+// networkErrors are parts of the messages of errors that mean GitHub could not be reached. The
+// library flattens errors into strings so the message is all there is to go on.
+var networkErrors = []string{
+	"dial tcp", "no such host", "connection refused", "connection reset", "i/o timeout",
+	"TLS handshake", "unexpected EOF", "proxyconnect", "network is unreachable",
+	"Client.Timeout exceeded", "context deadline exceeded",
+}
+
+// exitCode returns the exit code for the error. Errors without an exit code are classified by
+// the response status or network failure in their message.
+func exitCode(err error) int {
+	var ee *exitError
+	switch {
+	case err == nil:
+		return exitOK
+	case errors.Is(err, flag.ErrHelp):
+		return exitUsage
+	case errors.As(err, &ee):
+		return ee.code
+	}
+	switch {
+	case errors.Is(err, release.ErrUnauthorized):
+		return exitAuth
+	case errors.Is(err, release.ErrTagExists):
+		return exitTagConflict
+	case errors.Is(err, release.ErrNotFound):
+		return exitNotFound
+	}
+	// Errors that the commands flattened into strings are classified by their message.
+	msg := err.Error()
+	switch {
+	case strings.Contains(msg, "401 Unauthorized"), strings.Contains(msg, "Bad credentials"),
+		strings.Contains(msg, "token invalid or lacks repo scope"):
+		return exitAuth
+	case strings.Contains(msg, "already_exists"):
+		return exitTagConflict
+	case strings.Contains(msg, "404 Not Found"), strings.Contains(msg, "does not exist"),
+		strings.Contains(msg, "no release found"):
+		return exitNotFound
+	}
+	for _, network := range networkErrors {
+		if strings.Contains(msg, network) {
+			return exitNetwork
+		}
+	}
+	return exitFailure
+}
@@ -0,0 +1,417 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/imitablerabbit/githubrelease/pkg/release"
+)
+
+// clientFlags are the flags shared by every command for talking to the GitHub api.
+type clientFlags struct {
+	apiURL            string
+	pat               string
+	user              string
+	repos             stringsFlag
+	accept            string
+	apiVersion        string
+	rateWarnThreshold int
+	verbose           bool
+	checkAuth         bool
+	retries           int
+	retryBackoff      time.Duration
+	waitOnRateLimit   bool
+	appID             int64
+	appInstallationID int64
+	appPrivateKey     string
+	timeout           time.Duration
+	requestTimeout    time.Duration
+	uploadURL         string
+	caCert            string
+	clientCert        string
+	clientKey         string
+	insecure          bool
+	tlsMinVersion     string
+	tlsCipherSuites   string
+	fips              bool
+	proxy             string
+	rateLimit         bandwidthFlag
+	fileRateLimit     bandwidthFlag
+	provider          string
+	conns             release.TransportOptions
+	debugHTTP         string
+	otelEndpoint      string
+	auditLog          string
+
+	// command is the name of the command, which is recorded in the -audit-log.
+	command string
+
+	// writesReleases is set by the commands that create or change releases, so that -check-auth
+	// also checks that the token is allowed to.
+	writesReleases bool
+
+	// shared is the transport built from the flags, which every client and the copies made by
+	// forEachRepo share so that they reuse each other's connections.
+	shared *sharedTransport
+}
+
+// addClientFlags registers the GitHub api flags on the flag set.
+func addClientFlags(fs *flag.FlagSet) *clientFlags {
+	cf := &clientFlags{shared: &sharedTransport{}, command: fs.Name()}
+
+	// GitHub API URL
+	fs.StringVar(&cf.apiURL, "api-url", release.DefaultAPIURL, "Base URL for the GitHub API. A GitHub Enterprise Server URL without a path, e.g. https://ghe.example.com, has /api/v3 added")
+
+	// GitHub Enterprise Server can return an upload_url with a host that cannot be reached, such as
+	// an internal name behind a load balancer.
+	fs.StringVar(&cf.uploadURL, "upload-url", "", "Base URL to upload assets to instead of the host in the release upload_url, e.g. https://ghe.example.com/api/uploads")
+
+	// Enterprise servers often use a certificate signed by a private CA.
+	fs.StringVar(&cf.caCert, "ca-cert", "", "PEM file of CA certificates to trust in addition to the system ones")
+
+	// Mutual TLS for servers and proxies that require a client certificate.
+	fs.StringVar(&cf.clientCert, "client-cert", "", "PEM client certificate file for mutual TLS. Requires -client-key")
+	fs.StringVar(&cf.clientKey, "client-key", "", "PEM private key file for -client-cert")
+	fs.BoolVar(&cf.insecure, "insecure-skip-verify", false, "Do not verify the server certificate. This is insecure and should only be used for testing")
+
+	// Hardened and FIPS constrained environments require newer TLS and approved crypto.
+	fs.StringVar(&cf.tlsMinVersion, "tls-min-version", "", "Oldest TLS version to connect with, 1.2 or 1.3. Defaults to 1.2")
+	fs.StringVar(&cf.tlsCipherSuites, "tls-cipher-suites", "", "Comma separated TLS 1.2 cipher suites to offer, e.g. TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384. The TLS 1.3 suites cannot be limited")
+	fs.BoolVar(&cf.fips, "fips", false, "Only use crypto approved for FIPS 140: TLS 1.2 with ECDHE AES-GCM cipher suites, and sha256 or sha512 for checksums and signatures")
+
+	// HTTPS_PROXY, HTTP_PROXY and NO_PROXY are used by default.
+	fs.StringVar(&cf.proxy, "proxy", "", "URL of the proxy to send requests through, e.g. http://proxy.example.com:3128. Defaults to HTTPS_PROXY from the environment")
+
+	// Connections are reused across requests and uploads, these tune the pool.
+	defaults := release.DefaultTransportOptions
+	fs.IntVar(&cf.conns.MaxIdleConns, "max-idle-conns", defaults.MaxIdleConns, "Most idle connections to keep open across all hosts. 0 means no limit")
+	fs.IntVar(&cf.conns.MaxIdleConnsPerHost, "max-idle-conns-per-host", defaults.MaxIdleConnsPerHost, "Most idle connections to keep open to each host. Should be at least -upload-concurrency")
+	fs.IntVar(&cf.conns.MaxConnsPerHost, "max-conns-per-host", defaults.MaxConnsPerHost, "Most connections to each host, including those in use. 0 means no limit")
+	fs.DurationVar(&cf.conns.IdleConnTimeout, "idle-conn-timeout", defaults.IdleConnTimeout, "Close connections that have been idle for this long. 0 means never")
+	fs.Var(negatedBool{&cf.conns.DisableHTTP2}, "http2", "Use HTTP/2 when the server supports it, the default. -http2=false sends HTTP/1.1 only")
+	fs.Var(negatedBool{&cf.conns.DisableKeepAlives}, "keep-alives", "Reuse connections between requests, the default. -keep-alives=false opens a new connection for every request")
+
+	// Access token used for all interactions with the github api. The user will need to have access to the repo.
+	fs.StringVar(&cf.pat, "pat", "", "Github Personal Access Token that should be used for the releases")
+
+	// Authenticate as a GitHub App installation instead of with a personal access token.
+	fs.Int64Var(&cf.appID, "app-id", 0, "GitHub App id to authenticate as instead of using a personal access token")
+	fs.Int64Var(&cf.appInstallationID, "app-installation-id", 0, "GitHub App installation id. Defaults to the installation on the repository")
+	fs.StringVar(&cf.appPrivateKey, "app-private-key", "", "GitHub App private key PEM file, or the PEM encoded key itself")
+
+	// Repository user name name
+	fs.StringVar(&cf.user, "user", "imitablerabbit", "User namespace that the repository is located under")
+	fs.Var(&cf.repos, "repo", "Repository name exactly as it appears on GitHub, or owner/name. create accepts it more than once to release to several repos")
+
+	// Accept header sent with api requests. The raw/text/html variants of the GitHub media type change
+	// how the release body is represented in the responses.
+	fs.StringVar(&cf.accept, "accept", release.DefaultAccept, "Accept header to send with api requests, e.g. application/vnd.github.raw+json")
+	// The responses are pinned to a version of the api so that they do not change shape under us.
+	fs.StringVar(&cf.apiVersion, "api-version", release.DefaultAPIVersion, "GitHub api version to send as the X-GitHub-Api-Version header, or empty to send none, e.g. for an older GitHub Enterprise Server")
+
+	// Rate limit bookkeeping, a message is logged once the remaining requests fall below the threshold.
+	fs.IntVar(&cf.rateWarnThreshold, "rate-warn-threshold", 100, "Log the remaining rate limit at info level when it drops below this value")
+
+	// Log extra debug information, such as the rate limit status after every request.
+	fs.BoolVar(&cf.verbose, "verbose", false, "Log debug information")
+
+	// Diagnose failures in CI, where a debugger or proxy can't be attached.
+	fs.StringVar(&cf.debugHTTP, "debug-http", "", "Write every api request and response, with their headers, timings and bodies, to this file. Tokens are redacted")
+	// Change management audits need a record of every change, separate from the logs.
+	fs.StringVar(&cf.auditLog, "audit-log", "", "Append a JSON line for every release, asset and tag the command changes to this file, or send it to syslog with syslog, syslog://host:port or syslog+tcp://host:port")
+	fs.StringVar(&cf.otelEndpoint, "otel-endpoint", "", "OpenTelemetry OTLP/HTTP endpoint to send a span for every api call to, e.g. http://localhost:4318. Defaults to OTEL_EXPORTER_OTLP_ENDPOINT from the environment")
+
+	// Check that the token is valid before doing anything. This is always done in verbose mode.
+	fs.BoolVar(&cf.checkAuth, "check-auth", false, "Verify the personal access token before doing anything else")
+
+	// Transient failures such as 502s and connection resets are retried with exponential backoff.
+	fs.IntVar(&cf.retries, "retries", 0, "Number of times to retry a request after a network error or 5xx response")
+	fs.DurationVar(&cf.retryBackoff, "retry-backoff", time.Second, "Wait before the first retry, doubled for each retry after that")
+
+	// Bulk operations can hit the rate limit, wait for it to reset rather than failing halfway.
+	fs.BoolVar(&cf.waitOnRateLimit, "wait-on-rate-limit", false, "When a request is rejected by the rate limit, wait until it resets and try again")
+
+	// Stop hung connections from blocking forever. The request timeout includes reading the response
+	// body and sending the request body, so it needs to allow for the largest upload or download.
+	fs.DurationVar(&cf.timeout, "timeout", 0, "Give up on the whole command after this long, e.g. 10m. 0 means no limit")
+	fs.DurationVar(&cf.requestTimeout, "request-timeout", 0, "Give up on a single api request after this long, including its upload or download. 0 means no limit")
+
+	// Keep uploads and downloads from saturating a shared uplink.
+	fs.Var(&cf.rateLimit, "rate-limit", "Limit the combined bandwidth of all asset uploads and downloads, e.g. 10MB/s or 512KiB/s")
+	fs.Var(&cf.fileRateLimit, "file-rate-limit", "Limit the bandwidth of each asset upload or download, e.g. 2MB/s")
+
+	return cf
+}
+
+// newClient creates the api client from the flags, verifying the token first if requested.
+func (cf *clientFlags) newClient(ctx context.Context) (*release.Client, error) {
+	if cf.provider != "" && cf.provider != providerGitHub {
+		return nil, fmt.Errorf("-provider %s is only supported by create", cf.provider)
+	}
+	owner, repo, err := cf.repoName()
+	if err != nil {
+		return nil, err
+	}
+	client := release.NewClient(release.NormalizeAPIURL(cf.apiURL), owner, repo, cf.pat)
+	client.Accept = cf.accept
+	client.APIVersion = cf.apiVersion
+	if err := cf.configureClient(client); err != nil {
+		return nil, err
+	}
+	if cf.appID != 0 {
+		ts, err := cf.appTokenSource()
+		if err != nil {
+			return nil, err
+		}
+		ts.Owner, ts.Repo, ts.HTTPClient = owner, repo, client.HTTPClient
+		client.TokenSource = ts
+	}
+	if cf.checkAuth || client.Verbose {
+		verify := client.VerifyAuth
+		if cf.writesReleases {
+			verify = client.VerifyReleaseAccess
+		}
+		if err := verify(ctx); err != nil {
+			return nil, fmt.Errorf("verifying token: %v", err)
+		}
+	}
+	return client, nil
+}
+
+// configureClient applies the transport, retry, rate limit and token flags to the client.
+func (cf *clientFlags) configureClient(client *release.Client) error {
+	transport, err := cf.transport()
+	if err != nil {
+		return err
+	}
+	client.UploadURL = cf.uploadURL
+	if cf.rateLimit > 0 {
+		client.BandwidthLimit = release.NewBandwidthLimiter(int64(cf.rateLimit))
+	}
+	client.FileBandwidthLimit = int64(cf.fileRateLimit)
+	client.UserAgent = userAgent()
+	client.RateWarnThreshold = cf.rateWarnThreshold
+	client.Verbose = cf.verbose || debugLogging
+	client.Retries = cf.retries
+	client.RetryBackoff = cf.retryBackoff
+	client.WaitOnRateLimit = cf.waitOnRateLimit
+	client.HTTPClient = &http.Client{Transport: transport, Timeout: cf.requestTimeout}
+	if cf.appID == 0 && cf.pat == "" {
+		// Use the token from githubrelease login, if there is one.
+		token, err := loadToken(credentialsHost(cf.apiURL))
+		if err != nil {
+			return err
+		}
+		client.PAT = token
+	}
+	addSecret(client.PAT)
+	return nil
+}
+
+// repoName returns the owner and name of the repo. A -repo without an owner is under -user.
+func (cf *clientFlags) repoName() (string, string, error) {
+	switch len(cf.repos) {
+	case 0:
+		return cf.user, "", nil
+	case 1:
+		if owner, name, ok := strings.Cut(cf.repos[0], "/"); ok {
+			return owner, name, nil
+		}
+		return cf.user, cf.repos[0], nil
+	}
+	return "", "", fmt.Errorf("-repo can only be given once for this command")
+}
+
+// forEachRepo returns a copy of the flags for each -repo, so that a command can be run against
+// every one of them.
+func (cf *clientFlags) forEachRepo() []*clientFlags {
+	if len(cf.repos) <= 1 {
+		return []*clientFlags{cf}
+	}
+	all := make([]*clientFlags, len(cf.repos))
+	for i, repo := range cf.repos {
+		c := *cf
+		c.repos = stringsFlag{repo}
+		all[i] = &c
+	}
+	return all
+}
+
+// withTimeout returns a context that is cancelled once the -timeout has passed. The cancel
+// function must always be called.
+func (cf *clientFlags) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if cf.timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, cf.timeout)
+}
+
+// cacheFlags enable the on-disk response cache for the read only commands.
+type cacheFlags struct {
+	cache bool
+	dir   string
+}
+
+// addCacheFlags registers the response cache flags on the flag set.
+func addCacheFlags(fs *flag.FlagSet) *cacheFlags {
+	cache := &cacheFlags{}
+
+	// Polling scripts repeat the same requests, conditional requests for unchanged data are
+	// answered with 304 Not Modified which does not count against the rate limit.
+	fs.BoolVar(&cache.cache, "cache", false, "Cache responses on disk and send conditional requests, so unchanged data does not use the rate limit")
+	fs.StringVar(&cache.dir, "cache-dir", "", "Directory for the -cache responses, implies -cache. Defaults to githubrelease/http in the user cache directory")
+	return cache
+}
+
+// apply sets the response cache on the client if it is enabled.
+func (cache *cacheFlags) apply(client *release.Client) error {
+	if !cache.cache && cache.dir == "" {
+		return nil
+	}
+	dir := cache.dir
+	if dir == "" {
+		userDir, err := os.UserCacheDir()
+		if err != nil {
+			return fmt.Errorf("finding the cache directory, set -cache-dir: %v", err)
+		}
+		dir = filepath.Join(userDir, "githubrelease", "http")
+	}
+	rc, err := release.NewResponseCache(dir)
+	if err != nil {
+		return fmt.Errorf("creating response cache: %v", err)
+	}
+	client.Cache = rc
+	return nil
+}
+
+// releaseFlags select an existing release by its tag or id.
+type releaseFlags struct {
+	tag    string
+	id     int
+	latest bool
+}
+
+// addReleaseFlags registers the flags used to select an existing release on the flag set.
+func addReleaseFlags(fs *flag.FlagSet) *releaseFlags {
+	rf := &releaseFlags{}
+	fs.StringVar(&rf.tag, "release-tag", "", "The tag_name of the release. If there is no release for it, latest selects the latest release and a number the release with that id")
+	fs.IntVar(&rf.id, "id", 0, "The id of the release, used instead of release-tag")
+	fs.BoolVar(&rf.latest, "latest", false, "Use the latest published release, used instead of release-tag")
+	return rf
+}
+
+// getRelease fetches the release selected by the flags.
+func (rf *releaseFlags) getRelease(ctx context.Context, client *release.Client) (*release.Release, error) {
+	switch {
+	case rf.id != 0:
+		return client.GetRelease(ctx, rf.id)
+	case rf.tag != "":
+		return rf.getReleaseByTag(ctx, client)
+	case rf.latest:
+		return client.GetLatestRelease(ctx)
+	}
+	return nil, fmt.Errorf("one of -release-tag, -id or -latest is required")
+}
+
+// getReleaseByTag fetches the release for -release-tag. If there is no release for the tag, a
+// -release-tag of latest selects the latest published release and a number selects the release
+// with that id, so that one argument can select the release in a build matrix.
+func (rf *releaseFlags) getReleaseByTag(ctx context.Context, client *release.Client) (*release.Release, error) {
+	rel, err := client.FindReleaseByTag(ctx, rf.tag)
+	if err != nil || rel != nil {
+		return rel, err
+	}
+	if rf.tag == "latest" {
+		return client.GetLatestRelease(ctx)
+	}
+	if id, err := strconv.Atoi(rf.tag); err == nil && id > 0 {
+		return client.GetRelease(ctx, id)
+	}
+	return nil, fmt.Errorf("getting release for tag %s: no release found", rf.tag)
+}
+
+// appTokenSource creates the token source for the GitHub App. The private key can be given as a
+// path or as the PEM itself, which allows it to be passed in an environment variable.
+func (cf *clientFlags) appTokenSource() (*release.AppTokenSource, error) {
+	if cf.appPrivateKey == "" {
+		return nil, fmt.Errorf("-app-private-key is required with -app-id")
+	}
+	if cf.pat != "" {
+		log.Printf("info: authenticating as app %d, the pat is not used", cf.appID)
+	}
+	key := []byte(cf.appPrivateKey)
+	if !strings.Contains(cf.appPrivateKey, "-----BEGIN") {
+		var err error
+		if key, err = ioutil.ReadFile(cf.appPrivateKey); err != nil {
+			return nil, fmt.Errorf("reading app private key: %v", err)
+		}
+	}
+	ts, err := release.NewAppTokenSource(release.NormalizeAPIURL(cf.apiURL), cf.appID, cf.appInstallationID, key)
+	if err != nil {
+		return nil, fmt.Errorf("app private key: %v", err)
+	}
+	return ts, nil
+}
+
+// flagsSet returns the names of the flags that were explicitly set on the command line.
+func flagsSet(fs *flag.FlagSet) map[string]bool {
+	set := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+	return set
+}
+
+// addMakeLatestFlag registers the -make-latest flag on the flag set.
+func addMakeLatestFlag(fs *flag.FlagSet) *string {
+	// Hotfixes for older maintenance branches can be released without taking the Latest badge
+	// from the current stable release.
+	return fs.String("make-latest", "", "Whether the release is marked as the latest release: true, false or legacy to pick it by date and version. Defaults to true")
+}
+
+// checkMakeLatest returns an error if the -make-latest value is not supported.
+func checkMakeLatest(makeLatest string) error {
+	switch makeLatest {
+	case "", release.MakeLatestTrue, release.MakeLatestFalse, release.MakeLatestLegacy:
+		return nil
+	}
+	return withExitCode(exitValidation, fmt.Errorf("unsupported -make-latest %q, expected true, false or legacy", makeLatest))
+}
+
+// readBodyFile sets body to the contents of the -body-file path, or stdin if the path is -. Nothing
+// is changed if path is empty. It is an error to use both -body and -body-file.
+func readBodyFile(path string, body *string) error {
+	return readTextFile("body", path, body)
+}
+
+// readTextFile sets text to the contents of the -<name>-file path, or stdin if the path is -.
+// Nothing is changed if path is empty. It is an error to use both -<name> and -<name>-file.
+func readTextFile(name, path string, text *string) error {
+	if path == "" {
+		return nil
+	}
+	if *text != "" {
+		return withExitCode(exitValidation, fmt.Errorf("-%s and -%s-file cannot be used together", name, name))
+	}
+	var data []byte
+	var err error
+	if path == "-" {
+		data, err = ioutil.ReadAll(os.Stdin)
+	} else {
+		data, err = ioutil.ReadFile(path)
+	}
+	if err != nil {
+		return withExitCode(exitValidation, fmt.Errorf("reading %s file: %v", name, err))
+	}
+	*text = string(data)
+	return nil
+}
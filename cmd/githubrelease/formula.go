@@ -0,0 +1,480 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/imitablerabbit/githubrelease/pkg/release"
+)
+
+// formulaConfig is the homebrew: or scoop: section of the config file, which describes the
+// Homebrew formula or Scoop manifest that is updated once a release is created.
+type formulaConfig struct {
+	kind          string
+	repo          string
+	name          string
+	description   string
+	homepage      string
+	license       string
+	install       string
+	test          string
+	bin           []string
+	path          string
+	branch        string
+	token         string
+	commitMessage string
+}
+
+// formulaCommitData is the data for the commit-message template.
+type formulaCommitData struct {
+	Name    string
+	Tag     string
+	Version string
+}
+
+// formulaArchive is an archive of the release for an OS and architecture.
+type formulaArchive struct {
+	os     string
+	arch   string
+	url    string
+	sha256 string
+}
+
+// archiveExtensions are the extensions of the assets that can be installed by Homebrew and Scoop.
+var archiveExtensions = []string{".tar.gz", ".tgz", ".tar.xz", ".tar.bz2", ".zip"}
+
+// osAliases and archAliases map the OS and architecture names that are used in asset names to
+// the Go names. Names with separators in are replaced before the name is split into words.
+var (
+	platformReplacer = strings.NewReplacer("x86_64", "amd64", "x86-64", "amd64", "aarch64", "arm64")
+	osAliases        = map[string]string{"darwin": "darwin", "macos": "darwin", "mac": "darwin", "osx": "darwin", "linux": "linux", "windows": "windows", "win": "windows", "win64": "windows", "win32": "windows"}
+	archAliases      = map[string]string{"amd64": "amd64", "x64": "amd64", "64bit": "amd64", "arm64": "arm64", "386": "386", "i386": "386", "i686": "386", "x86": "386", "32bit": "386"}
+	wordPattern      = regexp.MustCompile(`[a-z0-9]+`)
+)
+
+// readFormulaConfig reads the homebrew: or scoop: section of the config file given by -config,
+// or the default config file.
+func readFormulaConfig(fs *flag.FlagSet, kind string) (*formulaConfig, error) {
+	path := fs.Lookup("config").Value.String()
+	if path == "" {
+		path = findConfigFile()
+	}
+	if path == "" {
+		return nil, fmt.Errorf("-%s needs a config file with a %s section", kind, kind)
+	}
+	config, err := readConfig(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading config %s: %v", path, err)
+	}
+	section, ok := config[kind].(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("config %s has no %s section", path, kind)
+	}
+	fc, err := parseFormulaConfig(kind, section)
+	if err != nil {
+		return nil, fmt.Errorf("config %s: %v", path, err)
+	}
+	return fc, nil
+}
+
+// parseFormulaConfig parses the homebrew or scoop section of the config file. The repo is the tap
+// or bucket to commit the file to, and the token can refer to environment variables as ${NAME}
+// like the notification URLs.
+func parseFormulaConfig(kind string, section map[string]interface{}) (*formulaConfig, error) {
+	fc := &formulaConfig{kind: kind}
+	repoKey := "tap"
+	if kind == "scoop" {
+		repoKey = "bucket"
+	}
+	for key, value := range section {
+		name := kind + "." + key
+		var err error
+		switch key {
+		case repoKey:
+			fc.repo, err = configString(name, value)
+		case "name":
+			fc.name, err = configString(name, value)
+		case "description":
+			fc.description, err = configString(name, value)
+		case "homepage":
+			fc.homepage, err = configString(name, value)
+		case "license":
+			fc.license, err = configString(name, value)
+		case "path":
+			fc.path, err = configString(name, value)
+		case "branch":
+			fc.branch, err = configString(name, value)
+		case "token":
+			fc.token, err = configString(name, value)
+		case "commit-message":
+			fc.commitMessage, err = configString(name, value)
+		case "install", "test":
+			if kind != "homebrew" {
+				return nil, fmt.Errorf("unknown %s key %s", kind, key)
+			}
+			if key == "install" {
+				fc.install, err = configString(name, value)
+			} else {
+				fc.test, err = configString(name, value)
+			}
+		case "bin":
+			if kind != "scoop" {
+				return nil, fmt.Errorf("unknown %s key %s", kind, key)
+			}
+			fc.bin, err = configValues(name, value)
+		default:
+			return nil, fmt.Errorf("unknown %s key %s", kind, key)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if fc.repo != "" && !strings.Contains(fc.repo, "/") {
+		return nil, fmt.Errorf("%s.%s must be owner/repo", kind, repoKey)
+	}
+	fc.token = os.ExpandEnv(fc.token)
+	addSecret(fc.token)
+	if _, err := template.New("commit-message").Funcs(templateFuncs).Parse(fc.commitMessage); err != nil {
+		return nil, fmt.Errorf("parsing %s.commit-message template: %v", kind, err)
+	}
+	return fc, nil
+}
+
+// withDefaults returns the config with the defaults for the repo filled in. The name defaults to
+// the repo name, and the homepage to the repo on GitHub.
+func (fc formulaConfig) withDefaults(repo, htmlURL string) *formulaConfig {
+	if fc.name == "" {
+		_, fc.name, _ = strings.Cut(repo, "/")
+	}
+	if fc.homepage == "" {
+		if i := strings.Index(htmlURL, "/releases/"); i >= 0 {
+			fc.homepage = htmlURL[:i]
+		}
+	}
+	switch fc.kind {
+	case "homebrew":
+		if fc.path == "" {
+			fc.path = "Formula/" + fc.name + ".rb"
+		}
+		if fc.install == "" {
+			fc.install = fmt.Sprintf("bin.install %q", fc.name)
+		}
+		if fc.commitMessage == "" {
+			fc.commitMessage = "Update {{.Name}} formula to {{.Version}}"
+		}
+	case "scoop":
+		if fc.path == "" {
+			fc.path = "bucket/" + fc.name + ".json"
+		}
+		if len(fc.bin) == 0 {
+			fc.bin = []string{fc.name + ".exe"}
+		}
+		if fc.commitMessage == "" {
+			fc.commitMessage = "Update {{.Name}} manifest to {{.Version}}"
+		}
+	}
+	return &fc
+}
+
+// assetPlatform returns the Go OS and architecture in the asset name, e.g. darwin and arm64 for
+// app_1.2.0_macOS_aarch64.tar.gz, or empty strings if the name does not have them.
+func assetPlatform(name string) (string, string) {
+	var goos, goarch string
+	for _, word := range wordPattern.FindAllString(platformReplacer.Replace(strings.ToLower(name)), -1) {
+		if v, ok := osAliases[word]; ok && goos == "" {
+			goos = v
+		}
+		if v, ok := archAliases[word]; ok && goarch == "" {
+			goarch = v
+		}
+	}
+	return goos, goarch
+}
+
+// isArchive reports whether the asset name has one of the archive extensions.
+func isArchive(name string) bool {
+	lower := strings.ToLower(name)
+	for _, ext := range archiveExtensions {
+		if strings.HasSuffix(lower, ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// formulaArchives returns the archives of the release with an OS and architecture in their name,
+// and the SHA-256 of each. The URLs are the download URLs of the published release, which are
+// the ones that keep working.
+func formulaArchives(rel *release.Release, assets []release.AssetUpload, results []assetResult) ([]formulaArchive, error) {
+	urls := map[string]string{}
+	for _, r := range results {
+		urls[r.Name] = r.BrowserDownloadURL
+	}
+	var archives []formulaArchive
+	for _, asset := range assets {
+		goos, goarch := assetPlatform(asset.Name)
+		if goos == "" || goarch == "" || !isArchive(asset.Name) && !(goos == "windows" && strings.HasSuffix(strings.ToLower(asset.Name), ".exe")) {
+			continue
+		}
+		u := urls[asset.Name]
+		if strings.Contains(rel.HTMLURL, "/releases/tag/") {
+			u = strings.Replace(rel.HTMLURL, "/releases/tag/", "/releases/download/", 1) + "/" + url.PathEscape(asset.Name)
+		}
+		digest, err := release.FileDigest(asset.Path, "sha256")
+		if err != nil {
+			return nil, err
+		}
+		archives = append(archives, formulaArchive{os: goos, arch: goarch, url: u, sha256: digest})
+	}
+	return archives, nil
+}
+
+// rubyString quotes the value as a Ruby double quoted string, escaping interpolation.
+func rubyString(s string) string {
+	return strings.ReplaceAll(strconv.Quote(s), "#", `\#`)
+}
+
+// formulaClass returns the Homebrew class name for the formula name, e.g. MyApp for my-app.
+func formulaClass(name string) string {
+	var b strings.Builder
+	for _, part := range strings.FieldsFunc(strings.ReplaceAll(name, "@", "AT"), func(r rune) bool {
+		return r == '-' || r == '_' || r == '.'
+	}) {
+		b.WriteString(strings.ToUpper(part[:1]) + part[1:])
+	}
+	return b.String()
+}
+
+// homebrewFormula returns the Homebrew formula for the version, with an archive for each of the
+// macOS and Linux architectures that there is one for.
+func homebrewFormula(fc *formulaConfig, version string, archives []formulaArchive) ([]byte, error) {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# This file was generated by githubrelease. DO NOT EDIT.\n")
+	fmt.Fprintf(&b, "class %s < Formula\n", formulaClass(fc.name))
+	if fc.description != "" {
+		fmt.Fprintf(&b, "  desc %s\n", rubyString(fc.description))
+	}
+	if fc.homepage != "" {
+		fmt.Fprintf(&b, "  homepage %s\n", rubyString(fc.homepage))
+	}
+	fmt.Fprintf(&b, "  version %s\n", rubyString(version))
+	if fc.license != "" {
+		fmt.Fprintf(&b, "  license %s\n", rubyString(fc.license))
+	}
+	found := false
+	for _, platform := range []struct{ os, block string }{{"darwin", "on_macos"}, {"linux", "on_linux"}} {
+		var arches []formulaArchive
+		for _, arch := range []string{"amd64", "arm64"} {
+			for _, a := range archives {
+				if a.os == platform.os && a.arch == arch {
+					arches = append(arches, a)
+					break
+				}
+			}
+		}
+		if len(arches) == 0 {
+			continue
+		}
+		found = true
+		fmt.Fprintf(&b, "\n  %s do\n", platform.block)
+		for _, a := range arches {
+			cpu := "intel"
+			if a.arch == "arm64" {
+				cpu = "arm"
+			}
+			fmt.Fprintf(&b, "    if Hardware::CPU.%s?\n", cpu)
+			fmt.Fprintf(&b, "      url %s\n", rubyString(a.url))
+			fmt.Fprintf(&b, "      sha256 %s\n", rubyString(a.sha256))
+			fmt.Fprintf(&b, "    end\n")
+		}
+		fmt.Fprintf(&b, "  end\n")
+	}
+	if !found {
+		return nil, fmt.Errorf("no macOS or Linux amd64 or arm64 archives in the release")
+	}
+	fmt.Fprintf(&b, "\n  def install\n%s  end\n", indentLines(fc.install, "    "))
+	if fc.test != "" {
+		fmt.Fprintf(&b, "\n  test do\n%s  end\n", indentLines(fc.test, "    "))
+	}
+	fmt.Fprintf(&b, "end\n")
+	return []byte(b.String()), nil
+}
+
+// indentLines indents each non-empty line of the text, which ends with a newline.
+func indentLines(text, indent string) string {
+	var b strings.Builder
+	for _, line := range strings.Split(strings.TrimRight(text, "\n"), "\n") {
+		if line != "" {
+			b.WriteString(indent + line)
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+// scoopArchitectures map the Go architectures to the Scoop ones.
+var scoopArchitectures = map[string]string{"amd64": "64bit", "386": "32bit", "arm64": "arm64"}
+
+// scoopManifest is a Scoop app manifest.
+type scoopManifest struct {
+	Version      string                       `json:"version"`
+	Description  string                       `json:"description,omitempty"`
+	Homepage     string                       `json:"homepage,omitempty"`
+	License      string                       `json:"license,omitempty"`
+	Architecture map[string]scoopArchitecture `json:"architecture"`
+	Bin          interface{}                  `json:"bin"`
+}
+
+// scoopArchitecture is the download of a Scoop app for an architecture.
+type scoopArchitecture struct {
+	URL  string `json:"url"`
+	Hash string `json:"hash"`
+}
+
+// scoopManifestJSON returns the Scoop manifest for the version, with an archive for each of the
+// Windows architectures that there is one for.
+func scoopManifestJSON(fc *formulaConfig, version string, archives []formulaArchive) ([]byte, error) {
+	m := scoopManifest{
+		Version:      strings.TrimPrefix(version, "v"),
+		Description:  fc.description,
+		Homepage:     fc.homepage,
+		License:      fc.license,
+		Architecture: map[string]scoopArchitecture{},
+		Bin:          fc.bin,
+	}
+	if len(fc.bin) == 1 {
+		m.Bin = fc.bin[0]
+	}
+	for _, a := range archives {
+		if arch, ok := scoopArchitectures[a.arch]; ok && a.os == "windows" {
+			m.Architecture[arch] = scoopArchitecture{URL: a.url, Hash: a.sha256}
+		}
+	}
+	if len(m.Architecture) == 0 {
+		return nil, fmt.Errorf("no Windows archives in the release")
+	}
+	var b bytes.Buffer
+	enc := json.NewEncoder(&b)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "    ")
+	if err := enc.Encode(m); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// render returns the formula or manifest for the release.
+func (fc *formulaConfig) render(rel *release.Release, archives []formulaArchive) ([]byte, error) {
+	version := tagVersion(rel.TagName)
+	if fc.kind == "scoop" {
+		return scoopManifestJSON(fc, version, archives)
+	}
+	return homebrewFormula(fc, strings.TrimPrefix(version, "v"), archives)
+}
+
+// readFormulaConfigs reads the sections of the formulas and manifests enabled by -homebrew and
+// -scoop, so that a mistake in the config is found before the release is created.
+func readFormulaConfigs(fs *flag.FlagSet, homebrew, scoop bool) ([]*formulaConfig, error) {
+	var configs []*formulaConfig
+	for _, kind := range []string{"homebrew", "scoop"} {
+		if kind == "homebrew" && !homebrew || kind == "scoop" && !scoop {
+			continue
+		}
+		fc, err := readFormulaConfig(fs, kind)
+		if err != nil {
+			return nil, err
+		}
+		configs = append(configs, fc)
+	}
+	return configs, nil
+}
+
+// updateFormulas writes the Homebrew formula and Scoop manifest for the release in the repo. They
+// are committed to the tap or bucket with the contents api if one is configured, and written to
+// their path under the current directory if not. Drafts and pre-releases are skipped, as their
+// archives can't be downloaded or shouldn't be installed by default.
+func updateFormulas(ctx context.Context, cf *clientFlags, repo string, configs []*formulaConfig, rel *release.Release, assets []release.AssetUpload, results []assetResult) error {
+	if rel.Draft || rel.PreRelease {
+		log.Printf("info: not updating the Homebrew formula or Scoop manifest for %s as it is a draft or pre-release", rel.TagName)
+		return nil
+	}
+	archives, err := formulaArchives(rel, assets, results)
+	if err != nil {
+		return err
+	}
+	for _, config := range configs {
+		fc := config.withDefaults(repo, rel.HTMLURL)
+		data, err := fc.render(rel, archives)
+		if err != nil {
+			return fmt.Errorf("writing %s for %s: %v", fc.kind, rel.TagName, err)
+		}
+		if fc.repo == "" {
+			if err := os.MkdirAll(filepath.Dir(fc.path), 0755); err != nil {
+				return err
+			}
+			if err := ioutil.WriteFile(fc.path, data, 0644); err != nil {
+				return err
+			}
+			log.Printf("info: wrote %s %s", fc.kind, fc.path)
+			continue
+		}
+		if err := fc.commit(ctx, cf, rel, data); err != nil {
+			return fmt.Errorf("updating %s: %v", fc.kind, err)
+		}
+	}
+	return nil
+}
+
+// commit commits the formula or manifest to the tap or bucket, unless it is already up to date.
+// The token in the config is used if there is one, as the tap is usually in another repo that
+// the release token can't write to.
+func (fc *formulaConfig) commit(ctx context.Context, cf *clientFlags, rel *release.Release, data []byte) error {
+	tcf := *cf
+	tcf.repos = stringsFlag{fc.repo}
+	if fc.token != "" {
+		tcf.pat, tcf.appID = fc.token, 0
+	}
+	client, err := tcf.newClient(ctx)
+	if err != nil {
+		return err
+	}
+	existing, err := client.GetFileContent(ctx, fc.path, fc.branch)
+	if err != nil {
+		return err
+	}
+	req := &release.UpdateFileRequest{Content: data, Branch: fc.branch}
+	if existing != nil {
+		current, err := existing.Decode()
+		if err == nil && bytes.Equal(current, data) {
+			log.Printf("info: %s %s in %s is already up to date", fc.kind, fc.path, fc.repo)
+			return nil
+		}
+		req.SHA = existing.SHA
+	}
+	tmpl, err := template.New("commit-message").Funcs(templateFuncs).Parse(fc.commitMessage)
+	if err != nil {
+		return fmt.Errorf("parsing %s.commit-message template: %v", fc.kind, err)
+	}
+	var message strings.Builder
+	if err := tmpl.Execute(&message, formulaCommitData{Name: fc.name, Tag: rel.TagName, Version: tagVersion(rel.TagName)}); err != nil {
+		return fmt.Errorf("executing %s.commit-message template: %v", fc.kind, err)
+	}
+	req.Message = message.String()
+	if err := client.UpdateFile(ctx, fc.path, req); err != nil {
+		return err
+	}
+	log.Printf("info: committed %s %s to %s", fc.kind, fc.path, fc.repo)
+	return nil
+}
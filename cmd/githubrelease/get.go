@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+
+	"github.com/imitablerabbit/githubrelease/pkg/release"
+)
+
+// runGet prints the full details of a release as json.
+func runGet(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("get", flag.ContinueOnError)
+	cf := addClientFlags(fs)
+	rf := addReleaseFlags(fs)
+	// A single GraphQL query returns the tag commit and reactions along with the assets.
+	graphQL := fs.Bool("graphql", false, "Fetch the release with the GraphQL api, adding the tag commit and reaction counts")
+	cache := addCacheFlags(fs)
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	ctx, cancel := cf.withTimeout(ctx)
+	defer cancel()
+	client, err := cf.newClient(ctx)
+	if err != nil {
+		return err
+	}
+	if err := cache.apply(client); err != nil {
+		return err
+	}
+	var rel *release.Release
+	if *graphQL {
+		rel, err = rf.getReleaseGraphQL(ctx, client)
+	} else {
+		rel, err = rf.getRelease(ctx, client)
+	}
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(rel, "", "    ")
+	if err != nil {
+		return fmt.Errorf("json marshal release: %v", err)
+	}
+	fmt.Println(string(data))
+	return nil
+}
+
+// getReleaseGraphQL fetches the release selected by the flags with the GraphQL api. GraphQL can
+// only look a release up by its tag, so -id and -latest find the tag with the REST api first.
+func (rf *releaseFlags) getReleaseGraphQL(ctx context.Context, client *release.Client) (*release.Release, error) {
+	tag := rf.tag
+	var found *release.Release
+	if tag == "" {
+		rel, err := rf.getRelease(ctx, client)
+		if err != nil {
+			return nil, err
+		}
+		tag, found = rel.TagName, rel
+	}
+	rel, err := client.GetReleaseByTagGraphQL(ctx, tag)
+	if err != nil || rel != nil {
+		return rel, err
+	}
+	if found != nil {
+		// Drafts are not returned by tag, so keep the release from the REST api.
+		return found, nil
+	}
+	return rf.getReleaseByTag(ctx, client)
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strings"
+)
+
+// conventionalCommitRegexp matches a conventional commit subject, e.g. feat(api)!: add something.
+// See https://www.conventionalcommits.org.
+var conventionalCommitRegexp = regexp.MustCompile(`^(\w+)(?:\(([^)]*)\))?(!)?: (.+)$`)
+
+// noteSection is a heading in the generated release notes and the commit types listed under it.
+type noteSection struct {
+	title string
+	types []string
+}
+
+// noteSections are the sections of the generated release notes in the order they are written.
+// Commits that are not conventional commits, or have any other type, are listed under Other Changes.
+var noteSections = []noteSection{
+	{title: "Features", types: []string{"feat"}},
+	{title: "Bug Fixes", types: []string{"fix"}},
+	{title: "Performance", types: []string{"perf"}},
+	{title: "Chores", types: []string{"chore", "build", "ci"}},
+}
+
+// sectionFor returns whether the commit type has its own section in the release notes.
+func sectionFor(commitType string) bool {
+	for _, section := range noteSections {
+		for _, t := range section.types {
+			if t == commitType {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// gitCommit is a commit from the git log.
+type gitCommit struct {
+	hash    string
+	subject string
+}
+
+// git runs git with the args in the current directory and returns the trimmed output.
+func git(args ...string) (string, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command("git", args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("git %s: %v: %s", strings.Join(args, " "), err, strings.TrimSpace(stderr.String()))
+	}
+	return strings.TrimSpace(stdout.String()), nil
+}
+
+// gitNotes generates Markdown release notes from the commits in the local git repository between
+// the previous tag and tag. If tag does not exist locally yet then HEAD is used instead. The
+// previous tag is found with git describe unless previousTag is given, and if there isn't one
+// the whole history is used. Tags with a path prefix, e.g. api/v1.2.0, are only compared with
+// tags that have the same prefix.
+func gitNotes(tag, previousTag string) (string, error) {
+	end := "HEAD"
+	if tag != "" {
+		if _, err := git("rev-parse", "--verify", "--quiet", tag+"^{commit}"); err == nil {
+			end = tag
+		}
+	}
+	if previousTag == "" {
+		// Only tags with the same path prefix, e.g. api/, belong to the same component. An error
+		// here means that there is no earlier tag.
+		args := []string{"describe", "--tags", "--abbrev=0"}
+		if i := strings.LastIndex(tag, "/"); i >= 0 {
+			args = append(args, "--match", tag[:i+1]+"*")
+		}
+		previousTag, _ = git(append(args, end+"^")...)
+	}
+	rev := end
+	if previousTag != "" {
+		rev = previousTag + ".." + end
+	}
+	out, err := git("log", "--no-merges", "--format=%h%x00%s", rev)
+	if err != nil {
+		return "", err
+	}
+	var commits []gitCommit
+	for _, line := range strings.Split(out, "\n") {
+		hash, subject, ok := strings.Cut(line, "\x00")
+		if ok {
+			commits = append(commits, gitCommit{hash: hash, subject: subject})
+		}
+	}
+	return renderNotes(commits, previousTag, end), nil
+}
+
+// renderNotes groups the commits by their conventional commit type and writes them as Markdown.
+// Breaking changes are also listed in their own section at the top.
+func renderNotes(commits []gitCommit, previousTag, end string) string {
+	grouped := map[string][]string{}
+	var breaking, other []string
+	for _, commit := range commits {
+		m := conventionalCommitRegexp.FindStringSubmatch(commit.subject)
+		if m == nil {
+			other = append(other, fmt.Sprintf("- %s (%s)", commit.subject, commit.hash))
+			continue
+		}
+		commitType, scope, bang, description := strings.ToLower(m[1]), m[2], m[3], m[4]
+		if scope != "" {
+			description = fmt.Sprintf("**%s:** %s", scope, description)
+		}
+		entry := fmt.Sprintf("- %s (%s)", description, commit.hash)
+		if bang != "" {
+			breaking = append(breaking, entry)
+		}
+		if sectionFor(commitType) {
+			grouped[commitType] = append(grouped[commitType], entry)
+		} else {
+			other = append(other, entry)
+		}
+	}
+
+	var b strings.Builder
+	writeSection := func(title string, entries []string) {
+		if len(entries) == 0 {
+			return
+		}
+		fmt.Fprintf(&b, "## %s\n\n%s\n\n", title, strings.Join(entries, "\n"))
+	}
+	writeSection("Breaking Changes", breaking)
+	for _, section := range noteSections {
+		var entries []string
+		for _, t := range section.types {
+			entries = append(entries, grouped[t]...)
+		}
+		writeSection(section.title, entries)
+	}
+	writeSection("Other Changes", other)
+	if previousTag != "" {
+		fmt.Fprintf(&b, "**Full Changelog**: %s...%s\n", previousTag, end)
+	}
+	return strings.TrimSpace(b.String())
+}
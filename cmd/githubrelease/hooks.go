@@ -0,0 +1,173 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/imitablerabbit/githubrelease/pkg/release"
+)
+
+// The lifecycle events that hooks run on, named after their section and key in the config file.
+const (
+	hookBeforeCreate = "before.create"
+	hookAfterUpload  = "after.upload"
+	hookAfterPublish = "after.publish"
+	hookOnFailure    = "on.failure"
+)
+
+// hookEvents are the events that can have hooks.
+var hookEvents = []string{hookBeforeCreate, hookAfterUpload, hookAfterPublish, hookOnFailure}
+
+// hooks are the shell commands to run for each lifecycle event, from the before:, after: and on:
+// sections of the config file.
+type hooks map[string][]string
+
+// hookRun is the release that the hooks are run for, which is passed to them in RELEASE_
+// environment variables.
+type hookRun struct {
+	command string
+	repo    string
+	rel     *release.Release
+	assets  []assetResult
+	err     error
+}
+
+// addHooksFlag registers the -hooks flag on the flag set.
+func addHooksFlag(fs *flag.FlagSet) *bool {
+	return fs.Bool("hooks", true, "Run the before, after and on failure hooks in the config file. -hooks=false skips them")
+}
+
+// loadHooks reads the hooks from the config file given by -config, or the default config file.
+// There are no hooks if they are turned off with -hooks=false or there is no config file.
+func loadHooks(fs *flag.FlagSet, enabled bool) (hooks, error) {
+	if !enabled {
+		return nil, nil
+	}
+	path := fs.Lookup("config").Value.String()
+	if path == "" {
+		path = findConfigFile()
+	}
+	if path == "" {
+		return nil, nil
+	}
+	config, err := readConfig(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading config %s: %v", path, err)
+	}
+	h, err := parseHooks(config)
+	if err != nil {
+		return nil, fmt.Errorf("config %s: %v", path, err)
+	}
+	return h, nil
+}
+
+// parseHooks parses the before, after and on sections of the config file. Each event has a
+// command or a list of commands.
+func parseHooks(config map[string]interface{}) (hooks, error) {
+	h := hooks{}
+	for _, section := range []string{"before", "after", "on"} {
+		value, ok := config[section]
+		if !ok {
+			continue
+		}
+		m, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("%s must be a section of hooks", section)
+		}
+		for key, value := range m {
+			event := section + "." + key
+			if !containsString(hookEvents, event) {
+				return nil, fmt.Errorf("unknown hook %s, expected one of %s", event, strings.Join(hookEvents, ", "))
+			}
+			commands, err := configValues(event, value)
+			if err != nil {
+				return nil, err
+			}
+			h[event] = commands
+		}
+	}
+	return h, nil
+}
+
+// environ returns the environment of the hooks, with the release metadata added.
+func (r hookRun) environ(event string) []string {
+	env := append(os.Environ(),
+		"RELEASE_EVENT="+event,
+		"RELEASE_COMMAND="+r.command,
+		"RELEASE_REPO="+r.repo,
+	)
+	if r.rel != nil {
+		env = append(env,
+			"RELEASE_TAG="+r.rel.TagName,
+			"RELEASE_VERSION="+strings.TrimPrefix(tagVersion(r.rel.TagName), "v"),
+			"RELEASE_NAME="+r.rel.Name,
+			"RELEASE_DRAFT="+strconv.FormatBool(r.rel.Draft),
+			"RELEASE_PRERELEASE="+strconv.FormatBool(r.rel.PreRelease),
+		)
+		if r.rel.ID != 0 {
+			env = append(env,
+				"RELEASE_ID="+strconv.Itoa(r.rel.ID),
+				"RELEASE_URL="+r.rel.HTMLURL,
+				"RELEASE_UPLOAD_URL="+r.rel.UploadURL,
+			)
+		}
+	}
+	var assets []string
+	for _, asset := range r.assets {
+		if asset.State != assetFailed {
+			assets = append(assets, asset.Path)
+		}
+	}
+	if len(assets) > 0 {
+		// One path per line, as paths can contain spaces.
+		env = append(env, "RELEASE_ASSETS="+strings.Join(assets, "\n"))
+	}
+	if r.err != nil {
+		env = append(env, "RELEASE_ERROR="+r.err.Error())
+	}
+	return env
+}
+
+// run runs the commands of the event in turn with sh, stopping at the first one that fails. Their
+// output goes to stderr so that it ends up in the logs.
+func (h hooks) run(ctx context.Context, event string, r hookRun) error {
+	for _, command := range h[event] {
+		log.Printf("info: running %s hook: %s", event, command)
+		cmd := exec.CommandContext(ctx, "sh", "-c", command)
+		cmd.Env = r.environ(event)
+		cmd.Stdout = os.Stderr
+		cmd.Stderr = os.Stderr
+		if err := cmd.Run(); err != nil {
+			return fmt.Errorf("%s hook %q: %v", event, command, err)
+		}
+	}
+	return nil
+}
+
+// failed runs the on.failure hooks for the error. A failing hook is only logged, and the hooks get
+// their own context so that they still run when the command was cancelled or timed out.
+func (h hooks) failed(r hookRun) {
+	if len(h[hookOnFailure]) == 0 {
+		return
+	}
+	if err := h.run(context.Background(), hookOnFailure, r); err != nil {
+		log.Printf("warn: %v", err)
+	}
+}
+
+// runFailureHooks reads the hooks and runs the on.failure hooks for the error, for commands that
+// failed before their hooks were loaded.
+func runFailureHooks(fs *flag.FlagSet, enabled bool, r hookRun) {
+	h, err := loadHooks(fs, enabled)
+	if err != nil {
+		log.Printf("warn: not running %s hooks: %v", hookOnFailure, err)
+		return
+	}
+	h.failed(r)
+}
@@ -0,0 +1,249 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// manifestAccept are the manifest media types that are asked for when resolving an image. An image
+// index or manifest list is preferred, so that the digest covers every platform of the image.
+var manifestAccept = strings.Join([]string{
+	"application/vnd.oci.image.index.v1+json",
+	"application/vnd.docker.distribution.manifest.list.v2+json",
+	"application/vnd.oci.image.manifest.v1+json",
+	"application/vnd.docker.distribution.manifest.v2+json",
+}, ", ")
+
+// imageRef is a container image reference split into its parts, e.g. ghcr.io, org/app and v1.2.3
+// for ghcr.io/org/app:v1.2.3.
+type imageRef struct {
+	registry   string
+	repository string
+	tag        string
+	digest     string
+}
+
+// parseImageRef parses the image reference. Images without a registry are on Docker Hub, and
+// Docker Hub images without an owner are under library/, like docker pull.
+func parseImageRef(ref string) (*imageRef, error) {
+	r := &imageRef{}
+	name := ref
+	if i := strings.Index(name, "@"); i >= 0 {
+		name, r.digest = name[:i], name[i+1:]
+		if !strings.HasPrefix(r.digest, "sha256:") {
+			return nil, fmt.Errorf("invalid image %s: unsupported digest %s", ref, r.digest)
+		}
+	}
+	if i := strings.LastIndex(name, ":"); i > strings.LastIndex(name, "/") {
+		name, r.tag = name[:i], name[i+1:]
+	}
+	if r.tag == "" && r.digest == "" {
+		r.tag = "latest"
+	}
+	r.registry, r.repository = "docker.io", name
+	if first, rest, ok := strings.Cut(name, "/"); ok && (strings.ContainsAny(first, ".:") || first == "localhost") {
+		r.registry, r.repository = first, rest
+	}
+	if r.registry == "docker.io" && !strings.Contains(r.repository, "/") {
+		r.repository = "library/" + r.repository
+	}
+	if r.repository == "" || strings.ToLower(r.repository) != r.repository {
+		return nil, fmt.Errorf("invalid image %s: the repository must be lowercase", ref)
+	}
+	return r, nil
+}
+
+// name returns the image without its tag or digest, as it was written.
+func (r *imageRef) name() string {
+	if r.registry == "docker.io" {
+		return strings.TrimPrefix(r.repository, "library/")
+	}
+	return r.registry + "/" + r.repository
+}
+
+// manifestURL returns the URL of the manifest of the image in the registry api. Docker Hub serves
+// its api from another host, and registries on localhost are assumed to be plain http like
+// docker does.
+func (r *imageRef) manifestURL() string {
+	host, scheme := r.registry, "https"
+	if host == "docker.io" {
+		host = "registry-1.docker.io"
+	}
+	if strings.HasPrefix(host, "localhost") || strings.HasPrefix(host, "127.0.0.1") {
+		scheme = "http"
+	}
+	reference := r.tag
+	if r.digest != "" {
+		reference = r.digest
+	}
+	return fmt.Sprintf("%s://%s/v2/%s/manifests/%s", scheme, host, r.repository, reference)
+}
+
+// registryAuth are the credentials for container registries. GitHub's own registry accepts the
+// release token, so it is used for ghcr.io if no username is given.
+type registryAuth struct {
+	username string
+	password string
+	ghToken  string
+}
+
+// credentials returns the username and password for the registry, or empty strings to pull
+// anonymously.
+func (a *registryAuth) credentials(registry string) (string, string) {
+	if a.username != "" {
+		return a.username, a.password
+	}
+	if registry == "ghcr.io" && a.ghToken != "" {
+		return "githubrelease", a.ghToken
+	}
+	return "", ""
+}
+
+// resolveImage returns the digest of the image's manifest. The registry is asked for the manifest
+// anonymously or with basic auth first, and a bearer token is fetched if it answers with a
+// token challenge, as Docker Hub and ghcr.io do.
+func resolveImage(ctx context.Context, client *http.Client, auth *registryAuth, r *imageRef) (string, error) {
+	username, password := auth.credentials(r.registry)
+	resp, err := getManifest(ctx, client, r.manifestURL(), func(request *http.Request) {
+		if username != "" {
+			request.SetBasicAuth(username, password)
+		}
+	})
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode == http.StatusUnauthorized {
+		challenge := resp.Header.Get("WWW-Authenticate")
+		resp.Body.Close()
+		token, err := registryToken(ctx, client, challenge, r.repository, username, password)
+		if err != nil {
+			return "", err
+		}
+		resp, err = getManifest(ctx, client, r.manifestURL(), func(request *http.Request) {
+			request.Header.Set("Authorization", "Bearer "+token)
+		})
+		if err != nil {
+			return "", err
+		}
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		data, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 4096))
+		return "", fmt.Errorf("non 200 response: %s: %s", resp.Status, data)
+	}
+	// The digest is the sha256 of the manifest, which some registries do not send in a header.
+	h := sha256.New()
+	if _, err := io.Copy(h, resp.Body); err != nil {
+		return "", fmt.Errorf("reading manifest: %v", err)
+	}
+	digest := "sha256:" + hex.EncodeToString(h.Sum(nil))
+	if header := resp.Header.Get("Docker-Content-Digest"); header != "" && header != digest {
+		return "", fmt.Errorf("manifest digest %s does not match the Docker-Content-Digest %s", digest, header)
+	}
+	return digest, nil
+}
+
+// getManifest sends the request for the manifest, with the authorization added by auth.
+func getManifest(ctx context.Context, client *http.Client, u string, auth func(*http.Request)) (*http.Response, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, fmt.Errorf("creating request: %v", err)
+	}
+	request.Header.Set("Accept", manifestAccept)
+	request.Header.Set("User-Agent", userAgent())
+	auth(request)
+	resp, err := client.Do(request)
+	if err != nil {
+		return nil, fmt.Errorf("sending request: %v", err)
+	}
+	return resp, nil
+}
+
+// registryToken fetches a bearer token to pull the repository from the token server in the
+// WWW-Authenticate challenge, e.g. Bearer realm="https://ghcr.io/token",service="ghcr.io".
+func registryToken(ctx context.Context, client *http.Client, challenge, repository, username, password string) (string, error) {
+	scheme, params, _ := strings.Cut(challenge, " ")
+	if !strings.EqualFold(scheme, "Bearer") {
+		return "", fmt.Errorf("registry needs credentials")
+	}
+	values := map[string]string{}
+	for _, param := range strings.Split(params, ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(param), "=")
+		values[key] = strings.Trim(value, `"`)
+	}
+	if values["realm"] == "" {
+		return "", fmt.Errorf("registry token challenge has no realm: %s", challenge)
+	}
+	query := url.Values{"scope": {"repository:" + repository + ":pull"}}
+	if values["service"] != "" {
+		query.Set("service", values["service"])
+	}
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, values["realm"]+"?"+query.Encode(), nil)
+	if err != nil {
+		return "", fmt.Errorf("creating token request: %v", err)
+	}
+	request.Header.Set("User-Agent", userAgent())
+	if username != "" {
+		request.SetBasicAuth(username, password)
+	}
+	resp, err := client.Do(request)
+	if err != nil {
+		return "", fmt.Errorf("sending token request: %v", err)
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("reading token response: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("getting registry token: %s: %s", resp.Status, data)
+	}
+	token := struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}{}
+	if err := json.Unmarshal(data, &token); err != nil {
+		return "", fmt.Errorf("unmarshaling token response: %v", err)
+	}
+	if token.Token == "" {
+		token.Token = token.AccessToken
+	}
+	addSecret(token.Token)
+	return token.Token, nil
+}
+
+// imageNotes resolves each of the images to its digest and returns the release notes section that
+// lists them pinned by digest, so that they can be deployed by digest.
+func imageNotes(ctx context.Context, cf *clientFlags, auth *registryAuth, images []string) (string, error) {
+	transport, err := cf.transport()
+	if err != nil {
+		return "", err
+	}
+	client := &http.Client{Transport: transport}
+	var b strings.Builder
+	b.WriteString("## Container images\n\n")
+	b.WriteString("| Image | Pinned by digest |\n")
+	b.WriteString("|-------|------------------|\n")
+	for _, image := range images {
+		r, err := parseImageRef(image)
+		if err != nil {
+			return "", err
+		}
+		digest, err := resolveImage(ctx, client, auth, r)
+		if err != nil {
+			return "", fmt.Errorf("resolving image %s: %v", image, err)
+		}
+		log.Printf("info: resolved image %s to %s", image, digest)
+		fmt.Fprintf(&b, "| `%s` | `%s@%s` |\n", image, r.name(), digest)
+	}
+	return strings.TrimSuffix(b.String(), "\n"), nil
+}
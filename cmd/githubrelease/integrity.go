@@ -0,0 +1,395 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/imitablerabbit/githubrelease/pkg/release"
+)
+
+// releaseManifestName is the name of the uploaded integrity manifest, which verify looks for.
+const releaseManifestName = "release-manifest.json"
+
+// manifestVersion is the version of the integrity manifest format.
+const manifestVersion = 1
+
+// The outcomes of verifying an asset against the integrity manifest.
+const (
+	verifyOK       = "ok"
+	verifyMismatch = "mismatch"
+	verifyMissing  = "missing"
+	verifyUnlisted = "unlisted"
+	verifyErrored  = "error"
+)
+
+// releaseManifest is the integrity manifest uploaded with the assets. It records what each asset
+// should be and how it was built, so that a download can be checked and the build reproduced.
+type releaseManifest struct {
+	Version     int               `json:"version"`
+	GeneratedAt string            `json:"generated_at"`
+	Source      *manifestSource   `json:"source,omitempty"`
+	Builder     manifestBuilder   `json:"builder"`
+	Scan        *manifestScan     `json:"scan,omitempty"`
+	Assets      []manifestedAsset `json:"assets"`
+}
+
+// manifestScan is the malware scan of the assets with -scan.
+type manifestScan struct {
+	Scanner   string `json:"scanner"`
+	ScannedAt string `json:"scanned_at"`
+}
+
+// manifestSource is the repository and commit that the assets were built from.
+type manifestSource struct {
+	Repository string `json:"repository"`
+	Commit     string `json:"commit"`
+	Ref        string `json:"ref,omitempty"`
+}
+
+// manifestBuilder describes the machine that the manifest was generated on.
+type manifestBuilder struct {
+	OS            string `json:"os"`
+	Arch          string `json:"arch"`
+	Githubrelease string `json:"githubrelease"`
+	CI            string `json:"ci,omitempty"`
+	RunnerImage   string `json:"runner_image,omitempty"`
+	RunURL        string `json:"run_url,omitempty"`
+}
+
+// manifestedAsset is an asset in the integrity manifest.
+type manifestedAsset struct {
+	Name      string `json:"name"`
+	Size      int64  `json:"size"`
+	SHA256    string `json:"sha256"`
+	BuildTime string `json:"build_time"`
+
+	// Scan is the result of the malware scan, if the asset was scanned.
+	Scan *assetScan `json:"scan,omitempty"`
+}
+
+// manifestBuilderEnv returns the builder of the manifest. In GitHub Actions it names the runner
+// image and links the workflow run.
+func manifestBuilderEnv() manifestBuilder {
+	b := manifestBuilder{OS: runtime.GOOS, Arch: runtime.GOARCH, Githubrelease: version}
+	if os.Getenv("GITHUB_ACTIONS") == "true" {
+		b.CI = "github-actions"
+		if image := os.Getenv("ImageOS"); image != "" {
+			b.RunnerImage = image + " " + os.Getenv("ImageVersion")
+		}
+		server := os.Getenv("GITHUB_SERVER_URL")
+		if server == "" {
+			server = "https://github.com"
+		}
+		b.RunURL = fmt.Sprintf("%s/%s/actions/runs/%s/attempts/%s", server, os.Getenv("GITHUB_REPOSITORY"),
+			os.Getenv("GITHUB_RUN_ID"), os.Getenv("GITHUB_RUN_ATTEMPT"))
+	} else if os.Getenv("CI") != "" {
+		b.CI = "unknown"
+	}
+	return b
+}
+
+// buildTime returns the build timestamp of the file. Reproducible builds pin it with
+// SOURCE_DATE_EPOCH, otherwise it is the modification time of the file.
+func buildTime(info os.FileInfo) (time.Time, error) {
+	if epoch := os.Getenv("SOURCE_DATE_EPOCH"); epoch != "" {
+		seconds, err := strconv.ParseInt(epoch, 10, 64)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid SOURCE_DATE_EPOCH %q: %v", epoch, err)
+		}
+		return time.Unix(seconds, 0), nil
+	}
+	return info.ModTime(), nil
+}
+
+// newReleaseManifest returns the integrity manifest of the assets, with the results of the scan if
+// they were scanned. The source is left out with a warning if it cannot be found, as the manifest
+// is still useful for checking the downloads.
+func newReleaseManifest(assets []release.AssetUpload, scans *scanReport, now time.Time) (*releaseManifest, error) {
+	m := &releaseManifest{
+		Version:     manifestVersion,
+		GeneratedAt: now.UTC().Format(time.RFC3339),
+		Builder:     manifestBuilderEnv(),
+		Assets:      []manifestedAsset{},
+	}
+	if scans != nil {
+		m.Scan = &manifestScan{Scanner: scans.Scanner, ScannedAt: scans.ScannedAt.UTC().Format(time.RFC3339)}
+	}
+	if source, err := findProvenanceSource(); err != nil {
+		log.Printf("warn: leaving the source out of %s: %v", releaseManifestName, err)
+	} else {
+		m.Source = &manifestSource{Repository: source.repo, Commit: source.commit, Ref: source.ref}
+	}
+	for _, asset := range assets {
+		info, err := os.Stat(asset.Path)
+		if err != nil {
+			return nil, err
+		}
+		built, err := buildTime(info)
+		if err != nil {
+			return nil, err
+		}
+		digest, err := release.FileDigest(asset.Path, "sha256")
+		if err != nil {
+			return nil, err
+		}
+		entry := manifestedAsset{
+			Name:      asset.Name,
+			Size:      info.Size(),
+			SHA256:    digest,
+			BuildTime: built.UTC().Format(time.RFC3339),
+		}
+		if scan, ok := scans.asset(asset.Name); ok {
+			entry.Scan = &scan
+		}
+		m.Assets = append(m.Assets, entry)
+	}
+	return m, nil
+}
+
+// generateReleaseManifest writes the integrity manifest of the assets to a temporary directory and
+// returns it as an asset to upload alongside the others. The caller should remove the returned
+// directory.
+func generateReleaseManifest(assets []release.AssetUpload, scans *scanReport) (release.AssetUpload, string, error) {
+	m, err := newReleaseManifest(assets, scans, time.Now())
+	if err != nil {
+		return release.AssetUpload{}, "", fmt.Errorf("generating %s: %v", releaseManifestName, err)
+	}
+	b, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return release.AssetUpload{}, "", err
+	}
+	dir, err := ioutil.TempDir("", "githubrelease-manifest")
+	if err != nil {
+		return release.AssetUpload{}, "", err
+	}
+	path := filepath.Join(dir, releaseManifestName)
+	if err := ioutil.WriteFile(path, append(b, '\n'), 0644); err != nil {
+		os.RemoveAll(dir)
+		return release.AssetUpload{}, "", err
+	}
+	return release.AssetUpload{Path: path, Name: releaseManifestName, ContentType: "application/json"}, dir, nil
+}
+
+// verifyResult is the outcome of verifying an asset against the integrity manifest.
+type verifyResult struct {
+	Name    string `json:"name"`
+	Status  string `json:"status"`
+	Message string `json:"message,omitempty"`
+}
+
+// verifyReport is the report written by the verify command.
+type verifyReport struct {
+	OK     bool            `json:"ok"`
+	Tag    string          `json:"tag"`
+	Source *manifestSource `json:"source,omitempty"`
+	Assets []verifyResult  `json:"assets"`
+}
+
+// add records the outcome for an asset. The report fails on anything but ok, or an asset that
+// is on the release without being in the manifest, which is only a warning.
+func (r *verifyReport) add(name, status, format string, v ...interface{}) {
+	r.Assets = append(r.Assets, verifyResult{Name: name, Status: status, Message: fmt.Sprintf(format, v...)})
+	if status != verifyOK && status != verifyUnlisted {
+		r.OK = false
+	}
+}
+
+// downloadReleaseManifest downloads and parses the integrity manifest of the release.
+func downloadReleaseManifest(ctx context.Context, client *release.Client, all []releaseAsset, name string) (*releaseManifest, error) {
+	for _, asset := range all {
+		if asset.name != name {
+			continue
+		}
+		body, _, err := client.DownloadAsset(ctx, asset.id, 0)
+		if err != nil {
+			return nil, fmt.Errorf("downloading %s: %v", name, err)
+		}
+		defer body.Close()
+		var buf bytes.Buffer
+		if _, err := io.Copy(&buf, body); err != nil {
+			return nil, fmt.Errorf("downloading %s: %v", name, err)
+		}
+		m := &releaseManifest{}
+		if err := json.Unmarshal(buf.Bytes(), m); err != nil {
+			return nil, fmt.Errorf("parsing %s: %v", name, err)
+		}
+		if m.Version != manifestVersion {
+			return nil, fmt.Errorf("unsupported %s version %d", name, m.Version)
+		}
+		return m, nil
+	}
+	return nil, fmt.Errorf("the release has no integrity manifest %s, upload one with -release-manifest", name)
+}
+
+// verifyAsset downloads the asset and checks its size and sha256 against the manifest. The
+// download is hashed as it arrives, and is only kept if dir is set.
+func verifyAsset(ctx context.Context, client *release.Client, asset releaseAsset, expected manifestedAsset, dir string) (string, string, error) {
+	if asset.size != expected.Size {
+		return verifyMismatch, fmt.Sprintf("the release has %d bytes, the manifest %d", asset.size, expected.Size), nil
+	}
+	body, _, err := client.DownloadAsset(ctx, asset.id, 0)
+	if err != nil {
+		return "", "", err
+	}
+	defer body.Close()
+	h := sha256.New()
+	var w io.Writer = h
+	var f *os.File
+	if dir != "" {
+		if f, err = os.Create(filepath.Join(dir, filepath.Base(asset.name))); err != nil {
+			return "", "", err
+		}
+		defer f.Close()
+		w = io.MultiWriter(h, f)
+	}
+	n, err := io.Copy(w, body)
+	if err != nil {
+		return "", "", fmt.Errorf("downloading %s: %v", asset.name, err)
+	}
+	if f != nil {
+		if err := f.Close(); err != nil {
+			return "", "", err
+		}
+	}
+	digest := hex.EncodeToString(h.Sum(nil))
+	if n == expected.Size && digest == expected.SHA256 {
+		return verifyOK, fmt.Sprintf("%d bytes, sha256 %s", n, digest), nil
+	}
+	// A download that doesn't match is not kept, like download -verify-checksums.
+	if f != nil {
+		os.Remove(f.Name())
+	}
+	if n != expected.Size {
+		return verifyMismatch, fmt.Sprintf("downloaded %d bytes, the manifest has %d", n, expected.Size), nil
+	}
+	return verifyMismatch, fmt.Sprintf("sha256 %s, the manifest has %s", digest, expected.SHA256), nil
+}
+
+// runVerify downloads the assets of a release and checks them against its integrity manifest.
+func runVerify(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("verify", flag.ContinueOnError)
+	cf := addClientFlags(fs)
+	rf := addReleaseFlags(fs)
+	manifestName := fs.String("manifest-name", releaseManifestName, "Name of the integrity manifest on the release")
+	dir := fs.String("dir", "", "Keep the verified downloads in this directory. By default they are only hashed")
+	var include, exclude stringsFlag
+	fs.Var(&include, "include", "Only verify assets whose names match this glob pattern. Can be repeated")
+	fs.Var(&exclude, "exclude", "Do not verify assets whose names match this glob pattern. Can be repeated")
+	output := addOutputFlag(fs)
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if err := checkOutputFormat(*output); err != nil {
+		return err
+	}
+
+	ctx, cancel := cf.withTimeout(ctx)
+	defer cancel()
+	client, err := cf.newClient(ctx)
+	if err != nil {
+		return err
+	}
+	rel, err := rf.getRelease(ctx, client)
+	if err != nil {
+		return err
+	}
+	all, assets, err := listDownloads(ctx, client, rel, include, exclude)
+	if err != nil {
+		return err
+	}
+	m, err := downloadReleaseManifest(ctx, client, all, *manifestName)
+	if err != nil {
+		return withExitCode(exitNotFound, err)
+	}
+	if *dir != "" {
+		if err := os.MkdirAll(*dir, 0755); err != nil {
+			return fmt.Errorf("creating download directory: %v", err)
+		}
+	}
+
+	report := &verifyReport{OK: true, Tag: rel.TagName, Source: m.Source}
+	onRelease := map[string]releaseAsset{}
+	for _, asset := range all {
+		onRelease[asset.name] = asset
+	}
+	// The filters apply to the manifest too, so that a missing asset that wasn't asked for is
+	// not reported.
+	listed := map[string]bool{*manifestName: true}
+	names := make([]release.AssetUpload, 0, len(m.Assets))
+	for _, expected := range m.Assets {
+		listed[expected.Name] = true
+		names = append(names, release.AssetUpload{Name: expected.Name})
+	}
+	names, err = filterAssets(names, include, exclude)
+	if err != nil {
+		return err
+	}
+	selected := map[string]bool{}
+	for _, asset := range names {
+		selected[asset.Name] = true
+	}
+	for _, expected := range m.Assets {
+		if !selected[expected.Name] {
+			continue
+		}
+		asset, ok := onRelease[expected.Name]
+		if !ok {
+			report.add(expected.Name, verifyMissing, "in the manifest but not on the release")
+			continue
+		}
+		status, message, err := verifyAsset(ctx, client, asset, expected, *dir)
+		if err != nil {
+			report.add(expected.Name, verifyErrored, "%v", err)
+			continue
+		}
+		report.add(expected.Name, status, "%s", message)
+	}
+	// Signatures made after the manifest are expected to be missing from it, so these only warn.
+	for _, asset := range assets {
+		if !listed[asset.name] {
+			report.add(asset.name, verifyUnlisted, "on the release but not in the manifest")
+		}
+	}
+	if err := writeVerifyReport(*output, report); err != nil {
+		return err
+	}
+	if !report.OK {
+		return fmt.Errorf("release %s does not match its integrity manifest", rel.TagName)
+	}
+	return nil
+}
+
+// writeVerifyReport writes the report to stdout as a table or as JSON.
+func writeVerifyReport(format string, report *verifyReport) error {
+	if format == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(report); err != nil {
+			return fmt.Errorf("writing json output: %v", err)
+		}
+		return nil
+	}
+	if report.Source != nil {
+		fmt.Printf("Built from %s at %s\n", report.Source.Repository, report.Source.Commit)
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "STATUS\tASSET\tMESSAGE")
+	for _, a := range report.Assets {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", a.Status, a.Name, a.Message)
+	}
+	return w.Flush()
+}
@@ -0,0 +1,254 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/imitablerabbit/githubrelease/pkg/release"
+)
+
+// prompter asks the questions of -interactive on the terminal. The questions go to stderr so that
+// stdout is left for the output of the command.
+type prompter struct {
+	in  *bufio.Reader
+	out io.Writer
+}
+
+// newPrompter returns a prompter on the terminal, or an error if stdin is not a terminal.
+func newPrompter() (*prompter, error) {
+	if !isTerminal(os.Stdin) {
+		return nil, fmt.Errorf("-interactive needs a terminal")
+	}
+	return &prompter{in: bufio.NewReader(os.Stdin), out: os.Stderr}, nil
+}
+
+// ask prints the question with its default and returns the answer, or the default if the answer
+// is empty.
+func (p *prompter) ask(question, def string) (string, error) {
+	if def != "" {
+		fmt.Fprintf(p.out, "%s [%s]: ", question, def)
+	} else {
+		fmt.Fprintf(p.out, "%s: ", question)
+	}
+	line, err := p.in.ReadString('\n')
+	if err != nil && (err != io.EOF || line == "") {
+		return "", fmt.Errorf("reading answer: %v", err)
+	}
+	if answer := strings.TrimSpace(line); answer != "" {
+		return answer, nil
+	}
+	return def, nil
+}
+
+// confirm asks a yes or no question and returns the answer, or the default if the answer is empty.
+func (p *prompter) confirm(question string, def bool) (bool, error) {
+	choices := "y/N"
+	if def {
+		choices = "Y/n"
+	}
+	for {
+		answer, err := p.ask(question+" ("+choices+")", "")
+		if err != nil {
+			return false, err
+		}
+		switch strings.ToLower(answer) {
+		case "":
+			return def, nil
+		case "y", "yes":
+			return true, nil
+		case "n", "no":
+			return false, nil
+		}
+		fmt.Fprintf(p.out, "Please answer y or n.\n")
+	}
+}
+
+// edit opens the text in $VISUAL or $EDITOR, or vi if neither is set, and returns the edited text.
+func (p *prompter) edit(text string) (string, error) {
+	editor := os.Getenv("VISUAL")
+	if editor == "" {
+		editor = os.Getenv("EDITOR")
+	}
+	if editor == "" {
+		editor = "vi"
+	}
+	f, err := ioutil.TempFile("", "githubrelease-notes-*.md")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.WriteString(text); err != nil {
+		f.Close()
+		return "", err
+	}
+	if err := f.Close(); err != nil {
+		return "", err
+	}
+	// The editor is run with sh so that EDITOR can have arguments, e.g. "code --wait".
+	cmd := exec.Command("sh", "-c", editor+` "$1"`, "sh", f.Name())
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stderr, os.Stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("running %s: %v", editor, err)
+	}
+	data, err := ioutil.ReadFile(f.Name())
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// promptRelease asks for the tag, name, notes and draft and pre-release state of the release,
+// with the flags as the defaults. The tag defaults to the next patch version, or the -bump.
+func (f *createFlags) promptRelease(ctx context.Context, cf *clientFlags, p *prompter) error {
+	tag := f.tag
+	if tag == "" {
+		bump := f.bump
+		if bump == "" {
+			bump = "patch"
+		}
+		client, err := cf.forEachRepo()[0].newClient(ctx)
+		if err != nil {
+			return err
+		}
+		if tag, err = nextTag(ctx, client, bump, f.targetCommitish, f.tagPrefix); err != nil {
+			return err
+		}
+	}
+	var err error
+	for f.tag = ""; f.tag == ""; {
+		if f.tag, err = p.ask("Tag", tag); err != nil {
+			return err
+		}
+	}
+	f.bump = ""
+	if f.name, err = p.ask("Name", f.name); err != nil {
+		return err
+	}
+
+	if f.generateNotes || f.generateNotesFromGit || f.generateNotesFromPRs || f.milestone != "" {
+		fmt.Fprintf(p.out, "The generated notes are added after the body.\n")
+	}
+	edit, err := p.confirm("Edit the body in your editor?", f.body == "")
+	if err != nil {
+		return err
+	}
+	if edit {
+		if f.body, err = p.edit(f.body); err != nil {
+			return err
+		}
+	}
+
+	if f.draft, err = p.confirm("Create as a draft?", f.draft); err != nil {
+		return err
+	}
+	prerelease := f.prerelease || f.autoPrerelease && detectPrerelease(f.tag, false)
+	if f.prerelease, err = p.confirm("Mark as a pre-release?", prerelease); err != nil {
+		return err
+	}
+	// The answer is final, so the tag isn't checked for a pre-release suffix again.
+	f.autoPrerelease = false
+	return nil
+}
+
+// selectAssets lists the assets and lets them be toggled by number until the selection is
+// accepted, returning the selected ones.
+func selectAssets(p *prompter, assets []release.AssetUpload) ([]release.AssetUpload, error) {
+	selected := make([]bool, len(assets))
+	for i := range selected {
+		selected[i] = true
+	}
+	for len(assets) > 0 {
+		fmt.Fprintf(p.out, "\nAssets:\n")
+		for i, asset := range assets {
+			mark := " "
+			if selected[i] {
+				mark = "x"
+			}
+			fmt.Fprintf(p.out, "  [%s] %2d  %s\n", mark, i+1, asset.Name)
+		}
+		answer, err := p.ask("Numbers to toggle, e.g. 2,4-6, a for all, n for none, or enter to accept", "")
+		if err != nil {
+			return nil, err
+		}
+		switch answer {
+		case "":
+			var chosen []release.AssetUpload
+			for i, asset := range assets {
+				if selected[i] {
+					chosen = append(chosen, asset)
+				}
+			}
+			return chosen, nil
+		case "a", "n":
+			for i := range selected {
+				selected[i] = answer == "a"
+			}
+			continue
+		}
+		numbers, err := parseSelection(answer, len(assets))
+		if err != nil {
+			fmt.Fprintf(p.out, "%v\n", err)
+			continue
+		}
+		for _, n := range numbers {
+			selected[n-1] = !selected[n-1]
+		}
+	}
+	return nil, nil
+}
+
+// parseSelection parses a comma separated list of numbers and ranges from 1 to max.
+func parseSelection(s string, max int) ([]int, error) {
+	var numbers []int
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		from, to, isRange := strings.Cut(part, "-")
+		if !isRange {
+			to = from
+		}
+		start, err1 := strconv.Atoi(strings.TrimSpace(from))
+		end, err2 := strconv.Atoi(strings.TrimSpace(to))
+		if err1 != nil || err2 != nil || start < 1 || end > max || start > end {
+			return nil, fmt.Errorf("%q is not a number or range from 1 to %d", part, max)
+		}
+		for n := start; n <= end; n++ {
+			numbers = append(numbers, n)
+		}
+	}
+	return numbers, nil
+}
+
+// confirmRelease prints a summary of the release and asks whether to create it.
+func (f *createFlags) confirmRelease(cf *clientFlags, p *prompter, assets []release.AssetUpload) (bool, error) {
+	repos := make([]string, 0, len(cf.repos))
+	for _, rcf := range cf.forEachRepo() {
+		owner, repo, _ := rcf.repoName()
+		repos = append(repos, owner+"/"+repo)
+	}
+	tag := f.tag
+	if !strings.HasPrefix(tag, f.tagPrefix) {
+		tag = f.tagPrefix + tag
+	}
+	fmt.Fprintf(p.out, "\nRelease %s in %s\n", tag, strings.Join(repos, ", "))
+	if f.name != "" {
+		fmt.Fprintf(p.out, "  Name:        %s\n", f.name)
+	}
+	fmt.Fprintf(p.out, "  Target:      %s\n", f.targetCommitish)
+	fmt.Fprintf(p.out, "  Draft:       %t\n", f.draft)
+	fmt.Fprintf(p.out, "  Pre-release: %t\n", f.prerelease)
+	if f.body != "" {
+		fmt.Fprintf(p.out, "  Body:        %d line(s)\n", len(strings.Split(f.body, "\n")))
+	}
+	fmt.Fprintf(p.out, "  Assets:      %d\n", len(assets))
+	if *f.dryRun {
+		return p.confirm("Print the requests?", true)
+	}
+	return p.confirm("Create the release?", false)
+}
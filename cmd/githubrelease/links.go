@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+
+	"github.com/imitablerabbit/githubrelease/pkg/release"
+)
+
+// shieldsURL is the base URL of the badges generated by the links command.
+const shieldsURL = "https://img.shields.io"
+
+// runLinks prints the links to the assets of a release that always download the asset from the
+// latest release, for install instructions in a README, and optionally badges for the version and
+// download counts.
+func runLinks(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("links", flag.ContinueOnError)
+	cf := addClientFlags(fs)
+	rf := addReleaseFlags(fs)
+	var include, exclude stringsFlag
+	fs.Var(&include, "include", "Only link the assets whose names match this glob pattern. Can be repeated")
+	fs.Var(&exclude, "exclude", "Do not link the assets whose names match this glob pattern. Can be repeated")
+	markdown := fs.Bool("markdown", false, "Print the links as a Markdown list")
+	badges := fs.Bool("badges", false, "Also print shields.io badges in Markdown for the latest version and the download counts")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if rf.tag == "" && rf.id == 0 {
+		rf.latest = true
+	}
+
+	ctx, cancel := cf.withTimeout(ctx)
+	defer cancel()
+	client, err := cf.newClient(ctx)
+	if err != nil {
+		return err
+	}
+	rel, err := rf.getRelease(ctx, client)
+	if err != nil {
+		return err
+	}
+	repoURL, _, ok := strings.Cut(rel.HTMLURL, "/releases/")
+	if !ok {
+		return fmt.Errorf("unexpected html_url %q of release %d", rel.HTMLURL, rel.ID)
+	}
+	_, assets, err := listDownloads(ctx, client, rel, include, exclude)
+	if err != nil {
+		return err
+	}
+
+	version := strings.TrimPrefix(tagVersion(rel.TagName), "v")
+	for _, asset := range assets {
+		// The latest URL only keeps working across releases if the asset has the same name in
+		// each of them.
+		if version != "" && strings.Contains(asset.name, version) {
+			log.Printf("warn: %s contains the version %s, its link will break with the next release", asset.name, version)
+		}
+		link := repoURL + "/releases/latest/download/" + url.PathEscape(asset.name)
+		if *markdown {
+			fmt.Printf("- [%s](%s)\n", asset.name, link)
+		} else {
+			fmt.Println(link)
+		}
+	}
+	if *badges {
+		printBadges(client, rel, repoURL, assets)
+	}
+	return nil
+}
+
+// printBadges prints the Markdown of shields.io badges for the latest version of the repo, its
+// total downloads and the downloads of each asset of the release. shields.io only knows about
+// repositories on github.com.
+func printBadges(client *release.Client, rel *release.Release, repoURL string, assets []releaseAsset) {
+	if u, err := url.Parse(repoURL); err != nil || u.Host != "github.com" {
+		log.Printf("warn: %s is not on github.com, shields.io cannot show badges for it", repoURL)
+	}
+	repo := url.PathEscape(client.User) + "/" + url.PathEscape(client.Repo)
+	fmt.Println()
+	fmt.Printf("[![Release](%s/github/v/release/%s)](%s/releases/latest)\n", shieldsURL, repo, repoURL)
+	fmt.Printf("[![Downloads](%s/github/downloads/%s/total)](%s/releases)\n", shieldsURL, repo, repoURL)
+	for _, asset := range assets {
+		fmt.Printf("[![%s](%s/github/downloads/%s/latest/%s?label=%s)](%s/releases/latest/download/%s)\n",
+			asset.name, shieldsURL, repo, url.PathEscape(asset.name), url.QueryEscape(asset.name), repoURL, url.PathEscape(asset.name))
+	}
+}
@@ -0,0 +1,296 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"text/template"
+	"time"
+
+	"github.com/imitablerabbit/githubrelease/pkg/release"
+)
+
+// listFilter selects the releases to list.
+type listFilter struct {
+	prerelease *bool
+	draft      *bool
+	tagPattern string
+	since      time.Time
+}
+
+// match reports whether the release passes the filter.
+func (lf *listFilter) match(r release.Release) (bool, error) {
+	if lf.prerelease != nil && r.PreRelease != *lf.prerelease {
+		return false, nil
+	}
+	if lf.draft != nil && r.Draft != *lf.draft {
+		return false, nil
+	}
+	if lf.tagPattern != "" {
+		match, err := filepath.Match(lf.tagPattern, r.TagName)
+		if err != nil {
+			return false, fmt.Errorf("invalid -tag-pattern %s: %v", lf.tagPattern, err)
+		}
+		if !match {
+			return false, nil
+		}
+	}
+	if !lf.since.IsZero() {
+		if r.CreatedAt.Before(lf.since) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// parseSince parses the -since value, which is either a date, a timestamp or a duration before now
+// such as 720h.
+func parseSince(since string, now time.Time) (time.Time, error) {
+	if since == "" {
+		return time.Time{}, nil
+	}
+	if d, err := time.ParseDuration(since); err == nil {
+		return now.Add(-d), nil
+	}
+	for _, layout := range []string{time.RFC3339, "2006-01-02"} {
+		if t, err := time.Parse(layout, since); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid -since %q, expected a date such as 2024-01-31, a timestamp or a duration such as 720h", since)
+}
+
+// sortReleases sorts the releases by the field, newest or highest first unless ascending is set.
+// Tags are compared as SemVer versions when both are, and as strings otherwise.
+func sortReleases(releases []release.Release, field string, ascending bool) error {
+	var less func(a, b release.Release) bool
+	switch field {
+	case "created":
+		less = func(a, b release.Release) bool { return a.CreatedAt.Before(b.CreatedAt) }
+	case "published":
+		less = func(a, b release.Release) bool { return a.PublishedAt.Before(b.PublishedAt) }
+	case "name":
+		less = func(a, b release.Release) bool { return a.Name < b.Name }
+	case "tag":
+		less = func(a, b release.Release) bool {
+			va, okA := parseSemver(tagVersion(a.TagName))
+			vb, okB := parseSemver(tagVersion(b.TagName))
+			if okA && okB {
+				return va.less(vb)
+			}
+			return a.TagName < b.TagName
+		}
+	default:
+		return fmt.Errorf("unsupported -sort %q, expected created, published, tag or name", field)
+	}
+	sort.SliceStable(releases, func(i, j int) bool {
+		if ascending {
+			return less(releases[i], releases[j])
+		}
+		return less(releases[j], releases[i])
+	})
+	return nil
+}
+
+// runList prints the releases in the repository, newest first, or in every repository of the
+// organization with -org. Every page is fetched unless -page is given.
+func runList(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("list", flag.ContinueOnError)
+	cf := addClientFlags(fs)
+	page := fs.Int("page", 1, "Only list this page of releases, rather than every page")
+	perPage := fs.Int("per-page", 30, "The number of releases per page with -page, up to 100")
+	limit := fs.Int("limit", 0, "The maximum number of releases to list. 0 lists all of them")
+	prerelease := fs.Bool("prerelease", false, "Only list pre-releases, or only full releases with -prerelease=false")
+	draft := fs.Bool("draft", false, "Only list drafts, or only published releases with -draft=false")
+	tagPattern := fs.String("tag-pattern", "", "Only list releases whose tag matches this glob pattern, e.g. v1.*")
+	since := fs.String("since", "", "Only list releases created since this date, e.g. 2024-01-31, or duration, e.g. 720h")
+	sortBy := fs.String("sort", "created", "Sort the releases by created, published, tag or name")
+	ascending := fs.Bool("ascending", false, "Sort oldest or lowest first")
+	output := fs.String("output", "table", "Output format: table, json, or template to format each release with -template")
+	tmplText := fs.String("template", "", "Go template for each release with -output template, e.g. '{{.TagName}} {{.HTMLURL}}'")
+	// Each GraphQL query returns a page of releases with all of their assets, so repos with
+	// hundreds of releases need far fewer requests.
+	graphQL := fs.Bool("graphql", false, "List the releases with the GraphQL api, adding the tag commit and reaction counts")
+	cache := addCacheFlags(fs)
+	of := addOrgFlags(fs)
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if err := of.check(cf); err != nil {
+		return err
+	}
+
+	set := flagsSet(fs)
+	filter := &listFilter{tagPattern: *tagPattern}
+	if set["prerelease"] {
+		filter.prerelease = prerelease
+	}
+	if set["draft"] {
+		filter.draft = draft
+	}
+	if *graphQL && set["page"] {
+		return withExitCode(exitValidation, fmt.Errorf("-page cannot be used with -graphql"))
+	}
+	var err error
+	if filter.since, err = parseSince(*since, time.Now()); err != nil {
+		return withExitCode(exitValidation, err)
+	}
+	var tmpl *template.Template
+	switch *output {
+	case "table", "json":
+	case "template":
+		if *tmplText == "" {
+			return withExitCode(exitValidation, fmt.Errorf("-output template requires -template"))
+		}
+		if tmpl, err = template.New("list").Funcs(templateFuncs).Parse(*tmplText); err != nil {
+			return withExitCode(exitValidation, fmt.Errorf("parsing -template: %v", err))
+		}
+	default:
+		return withExitCode(exitValidation, fmt.Errorf("unsupported -output %q, expected table, json or template", *output))
+	}
+
+	ctx, cancel := cf.withTimeout(ctx)
+	defer cancel()
+	// GitHub returns the newest releases first, so paging can stop at the limit when that is
+	// also the order they are listed in.
+	stopAtLimit := *limit > 0 && *sortBy == "created" && !*ascending
+	list := func(ctx context.Context, client *release.Client) ([]release.Release, error) {
+		if err := cache.apply(client); err != nil {
+			return nil, err
+		}
+		var releases []release.Release
+		collect := func(r release.Release) (bool, error) {
+			match, err := filter.match(r)
+			if err != nil {
+				return false, err
+			}
+			if match {
+				releases = append(releases, r)
+			}
+			return !stopAtLimit || len(releases) < *limit, nil
+		}
+		if set["page"] {
+			pageReleases, err := client.ListReleases(ctx, *page, *perPage)
+			if err != nil {
+				return nil, err
+			}
+			for _, r := range pageReleases {
+				if _, err := collect(r); err != nil {
+					return nil, err
+				}
+			}
+		} else if *graphQL {
+			if err := client.WalkReleasesGraphQL(ctx, collect); err != nil {
+				return nil, err
+			}
+		} else if err := client.WalkReleases(ctx, collect); err != nil {
+			return nil, err
+		}
+		if err := sortReleases(releases, *sortBy, *ascending); err != nil {
+			return nil, withExitCode(exitValidation, err)
+		}
+		if *limit > 0 && len(releases) > *limit {
+			releases = releases[:*limit]
+		}
+		return releases, nil
+	}
+
+	// With -org the releases of each repo are listed together, with the limit applying to each.
+	if of.org != "" {
+		var mu sync.Mutex
+		var listed []repoRelease
+		err := of.forEach(ctx, cf, func(ctx context.Context, repo string, client *release.Client) error {
+			releases, err := list(ctx, client)
+			mu.Lock()
+			defer mu.Unlock()
+			for _, r := range releases {
+				listed = append(listed, repoRelease{Repo: repo, Release: r})
+			}
+			return err
+		})
+		sort.SliceStable(listed, func(i, j int) bool { return listed[i].Repo < listed[j].Repo })
+		if writeErr := writeReleaseList(*output, tmpl, listed, true); writeErr != nil {
+			return writeErr
+		}
+		return err
+	}
+	client, err := cf.newClient(ctx)
+	if err != nil {
+		return err
+	}
+	releases, err := list(ctx, client)
+	if err != nil {
+		return err
+	}
+	listed := make([]repoRelease, len(releases))
+	for i, r := range releases {
+		listed[i] = repoRelease{Release: r}
+	}
+	return writeReleaseList(*output, tmpl, listed, false)
+}
+
+// repoRelease is a listed release with the repo that it is in, which is only set with -org.
+type repoRelease struct {
+	Repo string `json:"repo,omitempty"`
+	release.Release
+}
+
+// MarshalJSON encodes the release with its repo first. Without it the MarshalJSON of the embedded
+// release would be used and the repo left out.
+func (r repoRelease) MarshalJSON() ([]byte, error) {
+	data, err := json.Marshal(r.Release)
+	if err != nil || r.Repo == "" {
+		return data, err
+	}
+	repo, err := json.Marshal(r.Repo)
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(`{"repo":`+string(repo)+`,`), data[1:]...), nil
+}
+
+// writeReleaseList writes the releases to stdout in the output format, with a column for their
+// repo in a table of the releases of several repos.
+func writeReleaseList(output string, tmpl *template.Template, releases []repoRelease, withRepo bool) error {
+	switch output {
+	case "json":
+		if releases == nil {
+			releases = []repoRelease{}
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(releases)
+	case "template":
+		for _, r := range releases {
+			var b strings.Builder
+			if err := tmpl.Execute(&b, r); err != nil {
+				return fmt.Errorf("executing -template: %v", err)
+			}
+			fmt.Println(b.String())
+		}
+		return nil
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	if withRepo {
+		fmt.Fprint(w, "REPO\t")
+	}
+	fmt.Fprintln(w, "ID\tTAG\tNAME\tDRAFT\tPRERELEASE\tPUBLISHED")
+	for _, r := range releases {
+		if withRepo {
+			fmt.Fprintf(w, "%s\t", r.Repo)
+		}
+		published := ""
+		if !r.PublishedAt.IsZero() {
+			published = r.PublishedAt.Format(time.RFC3339)
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\t%t\t%t\t%s\n", r.ID, r.TagName, r.Name, r.Draft, r.PreRelease, published)
+	}
+	return w.Flush()
+}
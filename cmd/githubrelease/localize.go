@@ -0,0 +1,158 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/imitablerabbit/githubrelease/pkg/release"
+)
+
+// The ways that the -localized-notes can be added to the release.
+const (
+	localizedSections = "sections"
+	localizedAssets   = "assets"
+)
+
+// languagePattern matches a language tag such as en, ja or pt-BR.
+var languagePattern = regexp.MustCompile(`^[A-Za-z]{2,3}([-_][A-Za-z0-9]{2,8})*$`)
+
+// languageNames are the names of common languages in the language itself, which their notes are
+// headed with. Other languages are headed with their tag.
+var languageNames = map[string]string{
+	"de":    "Deutsch",
+	"en":    "English",
+	"es":    "Español",
+	"fr":    "Français",
+	"it":    "Italiano",
+	"ja":    "日本語",
+	"ko":    "한국어",
+	"nl":    "Nederlands",
+	"pl":    "Polski",
+	"pt":    "Português",
+	"pt-br": "Português (Brasil)",
+	"ru":    "Русский",
+	"tr":    "Türkçe",
+	"uk":    "Українська",
+	"zh":    "中文",
+	"zh-cn": "简体中文",
+	"zh-tw": "繁體中文",
+}
+
+// localizedNote is the notes template of the release in one language.
+type localizedNote struct {
+	lang string
+	path string
+	text string
+}
+
+// languageName returns the name that the notes in the language are headed with.
+func languageName(lang string) string {
+	if name, ok := languageNames[strings.ToLower(strings.ReplaceAll(lang, "_", "-"))]; ok {
+		return name
+	}
+	return lang
+}
+
+// readLocalizedNotes reads the notes templates of -localized-notes, which are given as lang=path or
+// as a glob pattern of files named with their language before the extension, e.g. notes.*.md for
+// notes.en.md and notes.ja.md. The notes in the primary language are returned first and the rest
+// in order of language.
+func readLocalizedNotes(values []string, primary string) ([]localizedNote, error) {
+	var notes []localizedNote
+	seen := map[string]string{}
+	for _, value := range values {
+		var paths, langs []string
+		if lang, path, ok := strings.Cut(value, "="); ok && languagePattern.MatchString(lang) {
+			paths, langs = []string{path}, []string{lang}
+		} else {
+			matches, err := filepath.Glob(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid -localized-notes pattern %s: %v", value, err)
+			}
+			if len(matches) == 0 {
+				return nil, fmt.Errorf("-localized-notes %s matches no files", value)
+			}
+			for _, path := range matches {
+				base := filepath.Base(path)
+				lang := strings.TrimPrefix(filepath.Ext(strings.TrimSuffix(base, filepath.Ext(base))), ".")
+				if !languagePattern.MatchString(lang) {
+					return nil, fmt.Errorf("cannot tell the language of %s, name it like notes.en.md or give it as lang=path", path)
+				}
+				paths, langs = append(paths, path), append(langs, lang)
+			}
+		}
+		for i, path := range paths {
+			key := strings.ToLower(langs[i])
+			if other, ok := seen[key]; ok {
+				return nil, fmt.Errorf("-localized-notes has %s and %s for language %s", other, path, langs[i])
+			}
+			seen[key] = path
+			data, err := ioutil.ReadFile(path)
+			if err != nil {
+				return nil, fmt.Errorf("reading localized notes: %v", err)
+			}
+			notes = append(notes, localizedNote{lang: langs[i], path: path, text: string(data)})
+		}
+	}
+	if _, ok := seen[strings.ToLower(primary)]; !ok {
+		return nil, fmt.Errorf("-localized-notes has no notes for the primary language %s, set -primary-language", primary)
+	}
+	sort.SliceStable(notes, func(i, j int) bool {
+		iPrimary, jPrimary := strings.EqualFold(notes[i].lang, primary), strings.EqualFold(notes[j].lang, primary)
+		if iPrimary != jPrimary {
+			return iPrimary
+		}
+		return strings.ToLower(notes[i].lang) < strings.ToLower(notes[j].lang)
+	})
+	return notes, nil
+}
+
+// localizedBody executes the notes templates and adds them to the body. With sections the notes of
+// every language are added under a heading with its name. With assets only the notes in the
+// primary language are added, and the rest are written to RELEASE_NOTES.<lang>.md files to be
+// uploaded with the release, which the body lists. The cleanup function removes the files.
+func localizedBody(body string, notes []localizedNote, as string, data *templateData) (string, []release.AssetUpload, func(), error) {
+	cleanup := func() {}
+	rendered := make([]string, len(notes))
+	for i, note := range notes {
+		text, err := executeTemplate("localized-notes "+note.path, note.text, data)
+		if err != nil {
+			return "", nil, cleanup, err
+		}
+		rendered[i] = strings.TrimSpace(text)
+	}
+	if as == localizedSections {
+		for i, note := range notes {
+			body = joinBody(body, fmt.Sprintf("## %s\n\n%s", languageName(note.lang), rendered[i]))
+		}
+		return body, nil, cleanup, nil
+	}
+
+	body = joinBody(body, rendered[0])
+	if len(notes) == 1 {
+		return body, nil, cleanup, nil
+	}
+	dir, err := ioutil.TempDir("", "githubrelease-notes")
+	if err != nil {
+		return "", nil, cleanup, err
+	}
+	cleanup = func() { os.RemoveAll(dir) }
+	var assets []release.AssetUpload
+	var listed []string
+	for i, note := range notes[1:] {
+		name := fmt.Sprintf("RELEASE_NOTES.%s.md", note.lang)
+		path := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(path, []byte(rendered[i+1]+"\n"), 0644); err != nil {
+			return "", nil, cleanup, err
+		}
+		assets = append(assets, release.AssetUpload{Path: path, Name: name, Label: languageName(note.lang), ContentType: "text/markdown"})
+		listed = append(listed, fmt.Sprintf("%s (`%s`)", languageName(note.lang), name))
+	}
+	body = joinBody(body, "Release notes in other languages are attached to the release: "+strings.Join(listed, ", ")+".")
+	return body, assets, cleanup, nil
+}
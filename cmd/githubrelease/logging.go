@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// logLevels are the values accepted by -log-level, in order of increasing severity. Log lines
+// are written with one of these as a prefix, e.g. log.Printf("warn: ..."), and lines without a
+// known prefix are treated as info.
+var logLevels = map[string]slog.Level{
+	"debug": slog.LevelDebug,
+	"info":  slog.LevelInfo,
+	"warn":  slog.LevelWarn,
+	"error": slog.LevelError,
+}
+
+// debugLogging is set when debug messages are logged, which also turns on the client's debug
+// logging.
+var debugLogging bool
+
+// logFlags are the flags that control the log output of every command.
+type logFlags struct {
+	level  string
+	format string
+}
+
+// addLogFlags registers the logging flags on the flag set.
+func addLogFlags(fs *flag.FlagSet) *logFlags {
+	lf := &logFlags{}
+	fs.StringVar(&lf.level, "log-level", "info", "Only log messages at or above this level: debug, info, warn or error. -verbose sets it to debug")
+	fs.StringVar(&lf.format, "log-format", "text", "Format of the log output, text or json with one object per line")
+	return lf
+}
+
+// setup installs the leveled, redacting log writer for the flags. -verbose lowers the level to
+// debug unless -log-level was given as well.
+func (lf *logFlags) setup(fs *flag.FlagSet) error {
+	level, ok := logLevels[lf.level]
+	if !ok {
+		return fmt.Errorf("unsupported -log-level %q, expected debug, info, warn or error", lf.level)
+	}
+	if verbose := fs.Lookup("verbose"); verbose != nil && verbose.Value.String() == "true" && !flagsSet(fs)["log-level"] {
+		level = slog.LevelDebug
+	}
+	debugLogging = level <= slog.LevelDebug
+	w := &logWriter{out: os.Stderr, level: level}
+	switch lf.format {
+	case "text":
+	case "json":
+		w.json = slog.New(slog.NewJSONHandler(os.Stderr, &slog.HandlerOptions{Level: level}))
+	default:
+		return fmt.Errorf("unsupported -log-format %q, expected text or json", lf.format)
+	}
+	log.SetFlags(0)
+	log.SetOutput(w)
+	return nil
+}
+
+// logWriter is the output of the standard logger. It drops lines below the level, removes any
+// secrets and writes the rest as text or JSON.
+type logWriter struct {
+	mu    sync.Mutex
+	out   io.Writer
+	level slog.Level
+	json  *slog.Logger
+}
+
+func (w *logWriter) Write(p []byte) (int, error) {
+	level, msg := parseLogLine(strings.TrimSuffix(string(p), "\n"))
+	if level < w.level {
+		return len(p), nil
+	}
+	msg = redact(msg)
+	if w.json != nil {
+		w.json.Log(context.Background(), level, msg)
+		return len(p), nil
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	_, err := fmt.Fprintf(w.out, "%s %s: %s\n", time.Now().Format("2006/01/02 15:04:05"), strings.ToLower(level.String()), msg)
+	return len(p), err
+}
+
+// parseLogLine splits the level prefix from the log line.
+func parseLogLine(line string) (slog.Level, string) {
+	if i := strings.Index(line, ": "); i > 0 {
+		if level, ok := logLevels[line[:i]]; ok {
+			return level, line[i+2:]
+		}
+	}
+	return slog.LevelInfo, line
+}
+
+var (
+	secretsMu sync.Mutex
+	secrets   []string
+)
+
+// addSecret makes sure that the value is never logged, such as the personal access token.
+func addSecret(secret string) {
+	if len(secret) < 4 {
+		return
+	}
+	secretsMu.Lock()
+	defer secretsMu.Unlock()
+	secrets = append(secrets, secret)
+}
+
+// secretPatterns match secrets that can end up in URLs, headers and response bodies even if
+// they were never given to addSecret, such as installation tokens and signed download URLs.
+// The groups of each match are kept and the rest is replaced.
+var secretPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`(?i)(authorization:\s*)[^\r\n]+`),
+	regexp.MustCompile(`()\b(?:gh[pousr]_[A-Za-z0-9]{20,}|github_pat_[A-Za-z0-9_]{20,})`),
+	regexp.MustCompile(`(?i)([?&](?:access_token|token|client_secret|sig|signature|x-amz-signature|x-amz-credential|x-amz-security-token)=)[^&\s"]+`),
+	regexp.MustCompile(`(?i)("(?:token|access_token|refresh_token|client_secret|password)"\s*:\s*")[^"]*`),
+	regexp.MustCompile(`(://[^/\s:@]+:)[^/\s@]+(@)`),
+}
+
+// redact replaces the secrets in the log message.
+func redact(msg string) string {
+	secretsMu.Lock()
+	for _, secret := range secrets {
+		msg = strings.ReplaceAll(msg, secret, "[REDACTED]")
+	}
+	secretsMu.Unlock()
+	for _, re := range secretPatterns {
+		msg = re.ReplaceAllString(msg, "${1}[REDACTED]${2}")
+	}
+	return msg
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/imitablerabbit/githubrelease/pkg/release"
+)
+
+// runLogin gets a token with the OAuth device flow and stores it so that it is used when -pat is
+// not passed.
+func runLogin(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("login", flag.ContinueOnError)
+	apiURL := fs.String("api-url", release.DefaultAPIURL, "Base URL for the GitHub API")
+	clientID := fs.String("client-id", "", "Client id of the OAuth app to log in with, which must have device flow enabled")
+	scopes := fs.String("scopes", "repo", "Comma separated OAuth scopes to request")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if *clientID == "" {
+		return fmt.Errorf("-client-id is required")
+	}
+	if !keychainAvailable() {
+		// Fail before the user has gone through the device flow for a token that can't be kept.
+		return errNoKeychain
+	}
+
+	webURL, err := release.WebURL(*apiURL)
+	if err != nil {
+		return fmt.Errorf("invalid api url: %v", err)
+	}
+	flow := &release.DeviceFlow{
+		BaseURL:  webURL,
+		ClientID: *clientID,
+		Scopes:   strings.Split(*scopes, ","),
+	}
+	code, err := flow.RequestCode(ctx)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Open %s and enter the code %s\n", code.VerificationURI, code.UserCode)
+
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(code.ExpiresIn)*time.Second)
+	defer cancel()
+	token, err := flow.PollToken(ctx, code)
+	if err != nil {
+		return err
+	}
+	addSecret(token)
+	host := credentialsHost(*apiURL)
+	location, err := storeToken(host, token)
+	if err != nil {
+		return err
+	}
+	log.Printf("info: logged in to %s, token stored in %s", host, location)
+	return nil
+}
@@ -0,0 +1,19 @@
+package main
+
+import (
+	"path/filepath"
+	"runtime"
+)
+
+// windowsMaxPath is the length from which Windows rejects paths unless they are absolute with
+// the \\?\ prefix. Go adds the prefix to long absolute paths itself, but not to relative ones.
+const windowsMaxPath = 248
+
+// longPath makes a long relative path absolute on Windows, so that files deep in a build tree can
+// still be opened. Other paths are returned unchanged.
+func longPath(path string) (string, error) {
+	if runtime.GOOS != "windows" || len(path) < windowsMaxPath || filepath.IsAbs(path) {
+		return path, nil
+	}
+	return filepath.Abs(path)
+}
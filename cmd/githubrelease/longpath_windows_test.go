@@ -0,0 +1,97 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLongPath(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// dir is a relative path two characters shorter than windowsMaxPath.
+	dir := strings.Repeat(`a\`, windowsMaxPath/2-4) + "builds"
+	if len(dir) != windowsMaxPath-2 {
+		t.Fatalf("test dir is %d characters, want %d", len(dir), windowsMaxPath-2)
+	}
+
+	tests := []struct {
+		name string
+		path string
+		want string
+	}{
+		{"short relative", `dist\app.zip`, `dist\app.zip`},
+		{"relative just under the limit", dir + `\`, dir + `\`},
+		{"relative at the limit", dir + `\a`, filepath.Join(wd, dir, "a")},
+		{"long relative", dir + `\dist\app.zip`, filepath.Join(wd, dir, `dist\app.zip`)},
+		{"long drive absolute", `C:\` + dir + `\app.zip`, `C:\` + dir + `\app.zip`},
+		{"long extended length", `\\?\C:\` + dir + `\app.zip`, `\\?\C:\` + dir + `\app.zip`},
+		{"long UNC", `\\server\share\` + dir + `\app.zip`, `\\server\share\` + dir + `\app.zip`},
+		{"long extended length UNC", `\\?\UNC\server\share\` + dir + `\app.zip`, `\\?\UNC\server\share\` + dir + `\app.zip`},
+	}
+	for _, test := range tests {
+		got, err := longPath(test.path)
+		if err != nil {
+			t.Errorf("%s: longPath: %v", test.name, err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("%s: longPath(%q) = %q, want %q", test.name, test.path, got, test.want)
+		}
+	}
+}
+
+func TestGlobRootWindows(t *testing.T) {
+	tests := []struct {
+		pattern string
+		want    string
+	}{
+		{`*.zip`, `.`},
+		{`dist\*.zip`, `dist`},
+		{`dist/**/*.zip`, `dist`},
+		{`\*.zip`, `\`},
+		{`C:\*.zip`, `C:\`},
+		{`C:/*.zip`, `C:\`},
+		{`C:\build\dist\*.zip`, `C:\build\dist`},
+		{`C:*.zip`, `C:`},
+		{`C:dist\*.zip`, `C:dist`},
+		{`\\server\share\*.zip`, `\\server\share\`},
+		{`\\server\share\dist\**\*.zip`, `\\server\share\dist`},
+		{`\\?\C:\*.zip`, `\\?\C:\`},
+		{`\\?\C:\dist\*.zip`, `\\?\C:\dist`},
+	}
+	for _, test := range tests {
+		if got := globRoot(test.pattern); got != test.want {
+			t.Errorf("globRoot(%q) = %q, want %q", test.pattern, got, test.want)
+		}
+	}
+}
+
+func TestExpandAssetPatternVolume(t *testing.T) {
+	dir, err := ioutil.TempDir("", "githubrelease")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if filepath.VolumeName(dir) == "" {
+		t.Skipf("temp dir %s has no volume", dir)
+	}
+	for _, name := range []string{"app.zip", "app.txt"} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The pattern starts with the drive letter or UNC volume of the temp dir.
+	assets, err := expandAssetPattern(filepath.Join(dir, "*.zip"))
+	if err != nil {
+		t.Fatalf("expandAssetPattern: %v", err)
+	}
+	if len(assets) != 1 || assets[0].Name != "app.zip" || assets[0].Path != filepath.Join(dir, "app.zip") {
+		t.Errorf("expandAssetPattern matched %+v, want only app.zip", assets)
+	}
+}
@@ -0,0 +1,107 @@
+// Command githubrelease creates and manages GitHub releases and their assets.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"runtime"
+	"strings"
+	"syscall"
+)
+
+// version is the build version of the tool. It is set at build time using
+// -ldflags "-X main.version=v0.0.1" and defaults to dev for local builds.
+var version = "dev"
+
+// userAgent is the User-Agent header value sent with every request to the GitHub api.
+func userAgent() string {
+	return "githubrelease/" + version
+}
+
+// command is a subcommand of the tool. Each command parses its own flags from args. The context
+// is cancelled when the tool is interrupted.
+type command struct {
+	name        string
+	description string
+	run         func(ctx context.Context, args []string) error
+}
+
+var commands = []command{
+	{"create", "Create a release and upload its assets", runCreate},
+	{"check", "Validate a release with the create flags before creating it", runCheck},
+	{"list", "List the releases in the repo", runList},
+	{"get", "Print the details of a release", runGet},
+	{"edit", "Change the metadata of an existing release", runEdit},
+	{"delete", "Delete a release", runDelete},
+	{"yank", "Mark a bad release with a warning instead of deleting it", runYank},
+	{"publish", "Publish a draft release", runPublish},
+	{"promote", "Turn a pre-release into a full release for a new tag", runPromote},
+	{"clone", "Copy a release and its assets to another repo", runClone},
+	{"backfill", "Create releases for the tags that do not have one", runBackfill},
+	{"links", "Print links to the assets of the latest release and README badges", runLinks},
+	{"stats", "Sum the download counts of the release assets", runStats},
+	{"watch", "Poll for new tags and create a release for each one", runWatch},
+	{"upload", "Upload assets to an existing release", runUpload},
+	{"download", "Download the assets of a release", runDownload},
+	{"verify", "Check the assets of a release against its integrity manifest", runVerify},
+	{"diff", "Compare the assets, notes and commits of two releases", runDiff},
+	{"announce", "Write a release as feed entries and a blog post", runAnnounce},
+	{"prune", "Delete old releases according to retention rules", runPrune},
+	{"next", "Print the next SemVer tag for a major, minor or patch bump", runNext},
+	{"login", "Log in with a browser and store the token for later commands", runLogin},
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage: githubrelease <command> [flags]\n\nCommands:\n")
+	for _, cmd := range commands {
+		fmt.Fprintf(os.Stderr, "  %-10s %s\n", cmd.name, cmd.description)
+	}
+	fmt.Fprintf(os.Stderr, "\nRun githubrelease <command> -h for the flags of a command. If no command is given\n")
+	fmt.Fprintf(os.Stderr, "then create is used, so the flags can be passed directly.\n")
+}
+
+func main() {
+	args := os.Args[1:]
+	if len(args) > 0 {
+		switch args[0] {
+		case "-version", "--version", "version":
+			fmt.Printf("githubrelease %s (%s)\n", version, runtime.Version())
+			os.Exit(0)
+		case "-h", "-help", "--help", "help":
+			usage()
+			os.Exit(0)
+		}
+	}
+
+	// Keep supporting the original flag only invocation by defaulting to create.
+	name := "create"
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		name, args = args[0], args[1:]
+	}
+	for _, cmd := range commands {
+		if cmd.name != name {
+			continue
+		}
+		// In-flight requests are cancelled on SIGINT or SIGTERM so that the command can clean up.
+		// A second signal exits immediately as signal.NotifyContext stops catching them.
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		err := cmd.run(ctx, args)
+		stop()
+		finishTracing(name, err)
+		if err != nil {
+			if !errors.Is(err, flag.ErrHelp) {
+				log.Printf("error: %s: %v\n", name, err)
+			}
+			os.Exit(exitCode(err))
+		}
+		return
+	}
+	fmt.Fprintf(os.Stderr, "unknown command %q\n\n", name)
+	usage()
+	os.Exit(2)
+}
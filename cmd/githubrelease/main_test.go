@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/imitablerabbit/githubrelease/pkg/releasetest"
+)
+
+func TestMain(m *testing.M) {
+	// The commands and the client log every step, which would bury the test output.
+	log.SetOutput(ioutil.Discard)
+	os.Exit(m.Run())
+}
+
+// runGithubrelease runs the command against the fake GitHub api as the octo/app repo, and returns
+// its exit status as main would exit with it. No upload state is kept, so that the tests never
+// write into the source tree; a test can pass its own -state-file to override it.
+func runGithubrelease(t *testing.T, srv *releasetest.Server, name string, args ...string) int {
+	t.Helper()
+	args = append([]string{"-api-url", srv.URL, "-pat", releasetest.Token, "-user", "octo", "-repo", "app", "-log-level", "error", "-state-file", ""}, args...)
+	for _, c := range commands {
+		if c.name != name {
+			continue
+		}
+		err := c.run(context.Background(), args)
+		if err != nil {
+			t.Logf("%s: %v", name, err)
+		}
+		return exitCode(err)
+	}
+	t.Fatalf("unknown command %s", name)
+	return 0
+}
+
+// writeAssets writes files with the names and contents to a temporary directory and returns
+// their paths.
+func writeAssets(t *testing.T, files map[string]string) map[string]string {
+	t.Helper()
+	dir := t.TempDir()
+	paths := map[string]string{}
+	for name, content := range files {
+		paths[name] = filepath.Join(dir, name)
+		if err := ioutil.WriteFile(paths[name], []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return paths
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"unicode"
+
+	"github.com/imitablerabbit/githubrelease/pkg/release"
+)
+
+// readManifest reads the list of assets to upload from a manifest file. The manifest can either
+// be a JSON array of AssetUpload objects, or a text file with one asset per line in the form:
+//
+//	path [name [label]]
+//
+// where the fields are separated by runs of spaces or tabs and the label is the rest of the line,
+// which can contain spaces. Blank lines and lines starting with # are ignored. Every listed file
+// must exist.
+func readManifest(manifestPath string) ([]release.AssetUpload, error) {
+	data, err := ioutil.ReadFile(manifestPath)
+	if err != nil {
+		return nil, fmt.Errorf("reading manifest: %v", err)
+	}
+
+	var assets []release.AssetUpload
+	if strings.HasPrefix(strings.TrimSpace(string(data)), "[") {
+		if err := json.Unmarshal(data, &assets); err != nil {
+			return nil, fmt.Errorf("unmarshaling json manifest: %v", err)
+		}
+	} else {
+		for i, line := range strings.Split(string(data), "\n") {
+			line = strings.TrimSpace(line)
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			// The path and name are separated by any run of spaces or tabs, and the label is the
+			// rest of the line.
+			path, rest := cutField(line)
+			name, label := cutField(rest)
+			asset := release.AssetUpload{Path: path, Name: name, Label: label}
+			if asset.Path == "" {
+				return nil, fmt.Errorf("manifest line %d: missing path", i+1)
+			}
+			assets = append(assets, asset)
+		}
+	}
+
+	// Validate everything up front so that a typo does not leave a release half uploaded.
+	for i, asset := range assets {
+		info, err := os.Stat(asset.Path)
+		if err != nil {
+			return nil, fmt.Errorf("manifest asset %s: %v", asset.Path, err)
+		}
+		if info.IsDir() {
+			return nil, fmt.Errorf("manifest asset %s: is a directory", asset.Path)
+		}
+		if asset.Name == "" {
+			assets[i].Name = info.Name()
+		}
+	}
+	return assets, nil
+}
+
+// cutField splits the first whitespace separated field off s and returns it with the rest of s,
+// trimmed.
+func cutField(s string) (string, string) {
+	s = strings.TrimSpace(s)
+	if i := strings.IndexFunc(s, unicode.IsSpace); i >= 0 {
+		return s[:i], strings.TrimSpace(s[i:])
+	}
+	return s, ""
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+
+	"github.com/imitablerabbit/githubrelease/pkg/release"
+)
+
+// assetMetadata is an entry in the -asset-metadata file. It applies to the assets whose names
+// match the pattern, giving them a label and content type and placing them in the upload order.
+type assetMetadata struct {
+	Pattern     string `json:"pattern"`
+	Label       string `json:"label"`
+	ContentType string `json:"content_type"`
+	Order       int    `json:"order"`
+}
+
+// readAssetMetadata reads the -asset-metadata file, a JSON array of entries with a pattern.
+func readAssetMetadata(path string) ([]assetMetadata, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading asset metadata: %v", err)
+	}
+	var metadata []assetMetadata
+	if err := json.Unmarshal(data, &metadata); err != nil {
+		return nil, fmt.Errorf("unmarshaling asset metadata %s: %v", path, err)
+	}
+	for i, m := range metadata {
+		if m.Pattern == "" {
+			return nil, fmt.Errorf("asset metadata %s: entry %d has no pattern", path, i+1)
+		}
+		if _, err := filepath.Match(m.Pattern, ""); err != nil {
+			return nil, fmt.Errorf("asset metadata %s: invalid pattern %s: %v", path, m.Pattern, err)
+		}
+	}
+	return metadata, nil
+}
+
+// applyAssetMetadata gives each asset the label and content type of the first entry that matches
+// its name, unless it already has them from a manifest or -asset flag, and sorts the assets by
+// the order of their entries. Assets without an entry have order 0, and assets with the same
+// order keep the order they were found in.
+func applyAssetMetadata(assets []release.AssetUpload, metadata []assetMetadata) []release.AssetUpload {
+	orders := make(map[string]int, len(assets))
+	for i := range assets {
+		asset := &assets[i]
+		for _, m := range metadata {
+			if match, _ := filepath.Match(m.Pattern, asset.Name); !match {
+				continue
+			}
+			if asset.Label == "" {
+				asset.Label = m.Label
+			}
+			if asset.ContentType == "" {
+				asset.ContentType = m.ContentType
+			}
+			orders[asset.Name] = m.Order
+			break
+		}
+	}
+	sort.SliceStable(assets, func(i, j int) bool {
+		return orders[assets[i].Name] < orders[assets[j].Name]
+	})
+	return assets
+}
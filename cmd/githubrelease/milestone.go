@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/imitablerabbit/githubrelease/pkg/release"
+)
+
+// findMilestone looks up the milestone for -milestone by its title.
+func findMilestone(ctx context.Context, client *release.Client, title string) (*release.Milestone, error) {
+	milestone, err := client.FindMilestone(ctx, title)
+	if err != nil {
+		return nil, err
+	}
+	if milestone == nil {
+		return nil, fmt.Errorf("milestone %q does not exist in %s/%s", title, client.User, client.Repo)
+	}
+	if milestone.OpenIssues > 0 {
+		log.Printf("warn: milestone %s still has %d open issue(s)", title, milestone.OpenIssues)
+	}
+	return milestone, nil
+}
+
+// milestoneNotes writes the closed pull requests and issues in the milestone as Markdown, in the
+// same style as the notes generated from git.
+func milestoneNotes(ctx context.Context, client *release.Client, milestone *release.Milestone) (string, error) {
+	issues, err := client.ListMilestoneIssues(ctx, milestone.Number, "closed")
+	if err != nil {
+		return "", err
+	}
+	var pulls, fixed []string
+	for _, issue := range issues {
+		entry := fmt.Sprintf("* %s by @%s in #%d", issue.Title, issue.User.Login, issue.Number)
+		if issue.PullRequest != nil {
+			pulls = append(pulls, entry)
+		} else {
+			fixed = append(fixed, entry)
+		}
+	}
+
+	var b strings.Builder
+	for _, section := range []struct {
+		title   string
+		entries []string
+	}{{"Pull Requests", pulls}, {"Closed Issues", fixed}} {
+		if len(section.entries) > 0 {
+			fmt.Fprintf(&b, "## %s\n\n%s\n\n", section.title, strings.Join(section.entries, "\n"))
+		}
+	}
+	fmt.Fprintf(&b, "**Milestone**: [%s](%s)\n", milestone.Title, milestone.HTMLURL)
+	return b.String(), nil
+}
+
+// closeMilestone closes the milestone once its release has been published.
+func closeMilestone(ctx context.Context, client *release.Client, milestone *release.Milestone) error {
+	if milestone.State == "closed" {
+		log.Printf("info: milestone %s is already closed", milestone.Title)
+		return nil
+	}
+	if _, err := client.CloseMilestone(ctx, milestone.Number); err != nil {
+		return err
+	}
+	log.Printf("info: closed milestone %s", milestone.Title)
+	return nil
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/imitablerabbit/githubrelease/pkg/release"
+)
+
+// mirrorManifestName is the name of the release metadata that is mirrored with the assets.
+const mirrorManifestName = "release.json"
+
+// mirrorBackend copies files to object storage.
+type mirrorBackend interface {
+	// copy uploads the file at path to the object at dest, a URL in the backend's scheme.
+	copy(path, dest, contentType string) error
+}
+
+// newMirrorBackend returns the backend for the scheme of the -mirror URL: s3:// for Amazon S3 and
+// S3 compatible storage, gs:// for Google Cloud Storage or az:// for Azure Blob Storage.
+func newMirrorBackend(url string) (mirrorBackend, error) {
+	scheme, _, _ := strings.Cut(url, "://")
+	switch scheme {
+	case "s3":
+		return s3Mirror{}, nil
+	case "gs":
+		return gcsMirror{}, nil
+	case "az":
+		return azureMirror{}, nil
+	}
+	return nil, fmt.Errorf("unsupported -mirror %q, expected an s3://, gs:// or az:// URL", url)
+}
+
+// s3Mirror copies files to S3 with the aws CLI, which finds the credentials, region and any
+// AWS_ENDPOINT_URL for S3 compatible storage itself.
+type s3Mirror struct{}
+
+func (s3Mirror) copy(path, dest, contentType string) error {
+	return runCommand("aws", "s3", "cp", "--only-show-errors", "--content-type", contentType, path, dest)
+}
+
+// gcsMirror copies files to Google Cloud Storage with the gcloud CLI.
+type gcsMirror struct{}
+
+func (gcsMirror) copy(path, dest, contentType string) error {
+	return runCommand("gcloud", "storage", "cp", "--content-type="+contentType, path, dest)
+}
+
+// azureMirror copies files to Azure Blob Storage with the az CLI. The URL is
+// az://account/container/path, and az finds the credentials from the AZURE_STORAGE_* variables
+// or the logged in account.
+type azureMirror struct{}
+
+func (azureMirror) copy(path, dest, contentType string) error {
+	parts := strings.SplitN(strings.TrimPrefix(dest, "az://"), "/", 3)
+	if len(parts) < 3 || parts[0] == "" || parts[1] == "" {
+		return fmt.Errorf("invalid azure mirror %s, expected az://account/container/path", dest)
+	}
+	return runCommand("az", "storage", "blob", "upload", "--only-show-errors", "--overwrite",
+		"--account-name", parts[0], "--container-name", parts[1], "--name", parts[2],
+		"--file", path, "--content-type", contentType)
+}
+
+// mirrorManifest is the release metadata that is mirrored with the assets, so that the copy can
+// be used without GitHub.
+type mirrorManifest struct {
+	Repo        string              `json:"repo"`
+	Tag         string              `json:"tag"`
+	Name        string              `json:"name"`
+	Body        string              `json:"body"`
+	Draft       bool                `json:"draft"`
+	PreRelease  bool                `json:"prerelease"`
+	HTMLURL     string              `json:"html_url"`
+	PublishedAt string              `json:"published_at,omitempty"`
+	Assets      []mirrorAssetRecord `json:"assets"`
+}
+
+// mirrorAssetRecord is an asset in the mirror manifest.
+type mirrorAssetRecord struct {
+	Name        string `json:"name"`
+	Size        int64  `json:"size"`
+	SHA256      string `json:"sha256"`
+	ContentType string `json:"content_type"`
+	GitHubURL   string `json:"github_url,omitempty"`
+}
+
+// mirrorDest returns the URL of the named object under the mirror URL.
+func mirrorDest(mirror, name string) string {
+	return strings.TrimSuffix(mirror, "/") + "/" + name
+}
+
+// mirrorContentType returns the content type of the asset.
+func mirrorContentType(asset release.AssetUpload) string {
+	if asset.ContentType != "" {
+		return asset.ContentType
+	}
+	return release.ContentType(asset.Path)
+}
+
+// newMirrorManifest returns the manifest of the release and its assets. The GitHub download URL
+// of each asset is taken from the upload results.
+func newMirrorManifest(repo string, rel *release.Release, assets []release.AssetUpload, results []assetResult) (*mirrorManifest, error) {
+	urls := map[string]string{}
+	for _, r := range results {
+		urls[r.Name] = r.BrowserDownloadURL
+	}
+	m := &mirrorManifest{
+		Repo:       repo,
+		Tag:        rel.TagName,
+		Name:       rel.Name,
+		Body:       rel.Body,
+		Draft:      rel.Draft,
+		PreRelease: rel.PreRelease,
+		HTMLURL:    rel.HTMLURL,
+		Assets:     []mirrorAssetRecord{},
+	}
+	if !rel.PublishedAt.IsZero() {
+		m.PublishedAt = rel.PublishedAt.Format(time.RFC3339)
+	}
+	for _, asset := range assets {
+		info, err := os.Stat(asset.Path)
+		if err != nil {
+			return nil, err
+		}
+		digest, err := release.FileDigest(asset.Path, "sha256")
+		if err != nil {
+			return nil, err
+		}
+		m.Assets = append(m.Assets, mirrorAssetRecord{
+			Name:        asset.Name,
+			Size:        info.Size(),
+			SHA256:      digest,
+			ContentType: mirrorContentType(asset),
+			GitHubURL:   urls[asset.Name],
+		})
+	}
+	return m, nil
+}
+
+// mirrorRelease copies the assets and then the release manifest to each of the mirrors. The
+// manifest is copied last so that its presence means the copy is complete. Every mirror is
+// attempted and an error listing the failed ones is returned.
+func mirrorRelease(repo string, mirrors []string, rel *release.Release, assets []release.AssetUpload, results []assetResult) error {
+	manifest, err := newMirrorManifest(repo, rel, assets, results)
+	if err != nil {
+		return fmt.Errorf("writing mirror manifest: %v", err)
+	}
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	dir, err := ioutil.TempDir("", "githubrelease-mirror")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+	manifestPath := filepath.Join(dir, mirrorManifestName)
+	if err := ioutil.WriteFile(manifestPath, append(data, '\n'), 0644); err != nil {
+		return err
+	}
+
+	var failed []string
+	for _, mirror := range mirrors {
+		if err := mirrorAssets(mirror, assets, manifestPath); err != nil {
+			log.Printf("error: mirroring release to %s: %v", mirror, err)
+			failed = append(failed, mirror)
+			continue
+		}
+		log.Printf("info: mirrored %d asset(s) to %s", len(assets), mirror)
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("mirroring release failed for %d mirror(s): %s", len(failed), strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+// mirrorAssets copies the assets and the manifest to the mirror.
+func mirrorAssets(mirror string, assets []release.AssetUpload, manifestPath string) error {
+	backend, err := newMirrorBackend(mirror)
+	if err != nil {
+		return err
+	}
+	for _, asset := range assets {
+		if err := backend.copy(asset.Path, mirrorDest(mirror, asset.Name), mirrorContentType(asset)); err != nil {
+			return fmt.Errorf("copying %s: %v", asset.Name, err)
+		}
+	}
+	return backend.copy(manifestPath, mirrorDest(mirror, mirrorManifestName), "application/json")
+}
+
+// checkMirrors returns an error if any of the -mirror URLs is not supported.
+func checkMirrors(mirrors []string) error {
+	for _, mirror := range mirrors {
+		if _, err := newMirrorBackend(mirror); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/imitablerabbit/githubrelease/pkg/release"
+)
+
+// runNext prints the next SemVer tag after the latest release tag in the repository, so that
+// pipelines can compute the version without a separate script.
+func runNext(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("next", flag.ContinueOnError)
+	cf := addClientFlags(fs)
+	bump := fs.String("bump", "patch", "Which part of the version to increment: major, minor, patch, or auto to pick it from the conventional commits since the latest tag")
+	target := fs.String("target", "master", "The commit/branch that the next release will be based on, used by -bump auto")
+	prefix := fs.String("tag-prefix", "", "Only consider tags that start with this prefix, e.g. api/ for api/v1.2.0, and add it to the next tag")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	ctx, cancel := cf.withTimeout(ctx)
+	defer cancel()
+	client, err := cf.newClient(ctx)
+	if err != nil {
+		return err
+	}
+	tag, err := nextTag(ctx, client, *bump, *target, *prefix)
+	if err != nil {
+		return err
+	}
+	fmt.Println(tag)
+	return nil
+}
+
+// nextTag returns the tag after the latest SemVer tag with the prefix in the repository for the
+// bump. The v of the latest tag is kept. Without any SemVer tags the bump is applied to v0.0.0,
+// with auto giving v0.1.0.
+func nextTag(ctx context.Context, client *release.Client, bump, target, prefix string) (string, error) {
+	tags, err := client.ListAllTags(ctx)
+	if err != nil {
+		return "", err
+	}
+	latestTag, latest, found := latestSemverTag(tags, prefix)
+	v := "v"
+	if found && !strings.HasPrefix(strings.TrimPrefix(latestTag, prefix), "v") {
+		v = ""
+	}
+	if bump == "auto" {
+		if !found {
+			bump = "minor"
+		} else {
+			commits, err := client.CompareCommits(ctx, latestTag, target)
+			if err != nil {
+				return "", err
+			}
+			messages := make([]string, len(commits))
+			for i, commit := range commits {
+				messages[i] = commit.Commit.Message
+			}
+			bump = conventionalBump(messages)
+			log.Printf("info: %d commit(s) since %s, bumping %s", len(commits), latestTag, bump)
+		}
+	}
+	next, err := latest.bump(bump)
+	if err != nil {
+		return "", err
+	}
+	if found {
+		log.Printf("info: latest tag is %s, next is %s%s%s", latestTag, prefix, v, next)
+	}
+	return prefix + v + next.String(), nil
+}
@@ -0,0 +1,267 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/imitablerabbit/githubrelease/pkg/release"
+)
+
+// defaultNotifyMessage is the message template used by notifications without their own.
+const defaultNotifyMessage = `{{if .Success}}{{.Repo}} {{.Tag}} has been released: {{.URL}}
+{{- range .Assets}}
+• {{.Name}}: {{.URL}}{{end}}{{else}}Release of {{.Repo}} {{.Tag}} failed: {{.Error}}{{end}}`
+
+// discordMessageLimit is the longest message content that Discord accepts.
+const discordMessageLimit = 2000
+
+// notifier is a notification from the notifications: section of the config file, which is sent
+// after a release succeeds or fails.
+type notifier struct {
+	kind    string
+	url     string
+	on      string
+	message *template.Template
+}
+
+// notifyData is the data for the message template, and the payload of generic webhooks.
+type notifyData struct {
+	Event      string        `json:"event"`
+	Success    bool          `json:"success"`
+	Error      string        `json:"error,omitempty"`
+	Repo       string        `json:"repo"`
+	Tag        string        `json:"tag"`
+	Name       string        `json:"name"`
+	URL        string        `json:"url"`
+	Draft      bool          `json:"draft"`
+	PreRelease bool          `json:"prerelease"`
+	Assets     []notifyAsset `json:"assets"`
+	Message    string        `json:"message"`
+}
+
+// notifyAsset is an asset of the release in a notification.
+type notifyAsset struct {
+	Name string `json:"name"`
+	URL  string `json:"url"`
+}
+
+// addNotifyFlag registers the -notify flag on the flag set.
+func addNotifyFlag(fs *flag.FlagSet) *bool {
+	// Notifications are configured in the notifications: section of the config file, this turns
+	// them off for a single run such as a test release.
+	return fs.Bool("notify", true, "Send the notifications in the config file once the release succeeds or fails. -notify=false skips them")
+}
+
+// readNotifiers reads the notifications: section of the config file given by -config, or the
+// default config file. There are no notifications without a config file.
+func readNotifiers(fs *flag.FlagSet) ([]notifier, error) {
+	path := fs.Lookup("config").Value.String()
+	if path == "" {
+		path = findConfigFile()
+	}
+	if path == "" {
+		return nil, nil
+	}
+	config, err := readConfig(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading config %s: %v", path, err)
+	}
+	section, ok := config["notifications"]
+	if !ok {
+		return nil, nil
+	}
+	notifiers, err := parseNotifiers(section)
+	if err != nil {
+		return nil, fmt.Errorf("config %s: %v", path, err)
+	}
+	return notifiers, nil
+}
+
+// parseNotifiers parses the notifications list. Each notification has a type of slack, discord,
+// teams or webhook and a url, which can refer to environment variables as ${NAME} so that it
+// stays out of the config file.
+func parseNotifiers(value interface{}) ([]notifier, error) {
+	items, ok := value.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("notifications must be a list")
+	}
+	var notifiers []notifier
+	for i, item := range items {
+		m, ok := item.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("notifications[%d] must have a type and url", i)
+		}
+		n := notifier{on: "always"}
+		message := defaultNotifyMessage
+		for key, value := range m {
+			name := fmt.Sprintf("notifications[%d].%s", i, key)
+			var err error
+			switch key {
+			case "type":
+				n.kind, err = configString(name, value)
+			case "url":
+				n.url, err = configString(name, value)
+			case "on":
+				n.on, err = configString(name, value)
+			case "message":
+				message, err = configString(name, value)
+			default:
+				err = fmt.Errorf("unknown notification key %s", key)
+			}
+			if err != nil {
+				return nil, err
+			}
+		}
+		switch n.kind {
+		case "slack", "discord", "teams", "webhook":
+		default:
+			return nil, fmt.Errorf("notifications[%d].type must be slack, discord, teams or webhook", i)
+		}
+		switch n.on {
+		case "always", "success", "failure":
+		default:
+			return nil, fmt.Errorf("notifications[%d].on must be always, success or failure", i)
+		}
+		n.url = os.ExpandEnv(n.url)
+		if n.url == "" {
+			return nil, fmt.Errorf("notifications[%d].url is required", i)
+		}
+		addSecret(n.url)
+		tmpl, err := template.New("message").Funcs(templateFuncs).Parse(message)
+		if err != nil {
+			return nil, fmt.Errorf("parsing notifications[%d].message template: %v", i, err)
+		}
+		n.message = tmpl
+		notifiers = append(notifiers, n)
+	}
+	return notifiers, nil
+}
+
+// payload returns the JSON body of the notification for the data.
+func (n *notifier) payload(data notifyData) (interface{}, error) {
+	var b strings.Builder
+	if err := n.message.Execute(&b, data); err != nil {
+		return nil, fmt.Errorf("executing message template: %v", err)
+	}
+	message := b.String()
+	switch n.kind {
+	case "slack":
+		return map[string]string{"text": message}, nil
+	case "discord":
+		if len(message) > discordMessageLimit {
+			message = message[:discordMessageLimit-3] + "..."
+		}
+		return map[string]string{"content": message}, nil
+	case "teams":
+		// Teams workflow webhooks take an Adaptive Card.
+		return map[string]interface{}{
+			"type": "message",
+			"attachments": []interface{}{map[string]interface{}{
+				"contentType": "application/vnd.microsoft.card.adaptive",
+				"content": map[string]interface{}{
+					"$schema": "http://adaptivecards.io/schemas/adaptive-card.json",
+					"type":    "AdaptiveCard",
+					"version": "1.4",
+					"body":    []interface{}{map[string]interface{}{"type": "TextBlock", "text": message, "wrap": true}},
+				},
+			}},
+		}, nil
+	}
+	data.Message = message
+	return data, nil
+}
+
+// send posts the notification for the data.
+func (n *notifier) send(ctx context.Context, client *http.Client, data notifyData) error {
+	payload, err := n.payload(data)
+	if err != nil {
+		return err
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, n.url, strings.NewReader(string(body)))
+	if err != nil {
+		return fmt.Errorf("creating request: %v", err)
+	}
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("User-Agent", userAgent())
+	resp, err := client.Do(request)
+	if err != nil {
+		return fmt.Errorf("sending request: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		respData, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("non 2xx response: %s: %s", resp.Status, respData)
+	}
+	return nil
+}
+
+// notify sends the notifications in the config file for the outcome of the release. A failure to
+// notify is logged and does not fail the release. The notifications are sent with their own
+// deadline, so that a release that timed out is still reported.
+func notify(fs *flag.FlagSet, cf *clientFlags, data notifyData) {
+	notifiers, err := readNotifiers(fs)
+	if err != nil {
+		log.Printf("warn: not sending notifications: %v", err)
+		return
+	}
+	if len(notifiers) == 0 {
+		return
+	}
+	transport, err := cf.transport()
+	if err != nil {
+		log.Printf("warn: not sending notifications: %v", err)
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	client := &http.Client{Transport: transport}
+	for _, n := range notifiers {
+		if n.on == "success" && !data.Success || n.on == "failure" && data.Success {
+			continue
+		}
+		if err := n.send(ctx, client, data); err != nil {
+			log.Printf("warn: sending %s notification: %v", n.kind, err)
+			continue
+		}
+		log.Printf("info: sent %s notification", n.kind)
+	}
+}
+
+// newNotifyData returns the notification data for the release, or for the failure to release the
+// tag if err is set. The assets are the ones on the release, or the uploads if the release was
+// fetched before they were added.
+func newNotifyData(event, repo, tag string, rel *release.Release, uploads []release.AssetUpload, err error) notifyData {
+	data := notifyData{Event: event, Success: err == nil, Repo: repo, Tag: tag, Assets: []notifyAsset{}}
+	if err != nil {
+		data.Error = err.Error()
+	}
+	if rel == nil {
+		return data
+	}
+	data.Tag, data.Name, data.URL = rel.TagName, rel.Name, rel.HTMLURL
+	data.Draft, data.PreRelease = rel.Draft, rel.PreRelease
+	for _, asset := range rel.Assets {
+		data.Assets = append(data.Assets, notifyAsset{Name: asset.Name, URL: asset.BrowserDownloadURL})
+	}
+	if len(data.Assets) == 0 && err == nil && strings.Contains(rel.HTMLURL, "/releases/tag/") {
+		// GitHub serves the assets of a published release under /releases/download/<tag>/.
+		base := strings.Replace(rel.HTMLURL, "/releases/tag/", "/releases/download/", 1)
+		for _, upload := range uploads {
+			data.Assets = append(data.Assets, notifyAsset{Name: upload.Name, URL: base + "/" + upload.Name})
+		}
+	}
+	return data
+}
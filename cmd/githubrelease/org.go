@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/imitablerabbit/githubrelease/pkg/release"
+)
+
+// orgFlags select the repositories of an organization that list, prune and stats run against
+// with -org.
+type orgFlags struct {
+	org             string
+	topics          stringsFlag
+	repoPattern     string
+	includeArchived bool
+	includeForks    bool
+	concurrency     int
+}
+
+// addOrgFlags registers the -org flags on the flag set.
+func addOrgFlags(fs *flag.FlagSet) *orgFlags {
+	of := &orgFlags{}
+	fs.StringVar(&of.org, "org", "", "Run against every repository in this organization instead of -repo")
+	fs.Var(&of.topics, "org-topic", "With -org, only the repositories with this topic. Can be repeated to require several")
+	fs.StringVar(&of.repoPattern, "org-repo-pattern", "", "With -org, only the repositories whose names match this glob pattern, e.g. service-*")
+	fs.BoolVar(&of.includeArchived, "org-include-archived", false, "With -org, include archived repositories")
+	fs.BoolVar(&of.includeForks, "org-include-forks", false, "With -org, include forks")
+	fs.IntVar(&of.concurrency, "org-concurrency", 4, "With -org, the number of repositories to run against at the same time")
+	return of
+}
+
+// check returns an error if the -org flags cannot be used together.
+func (of *orgFlags) check(cf *clientFlags) error {
+	if of.org == "" {
+		return nil
+	}
+	if len(cf.repos) > 0 {
+		return withExitCode(exitValidation, fmt.Errorf("-org cannot be used with -repo"))
+	}
+	if of.repoPattern != "" {
+		if _, err := filepath.Match(of.repoPattern, ""); err != nil {
+			return withExitCode(exitValidation, fmt.Errorf("invalid -org-repo-pattern %s: %v", of.repoPattern, err))
+		}
+	}
+	if of.concurrency < 1 {
+		return withExitCode(exitValidation, fmt.Errorf("-org-concurrency must be at least 1"))
+	}
+	return nil
+}
+
+// match reports whether the repository passes the filters.
+func (of *orgFlags) match(repo release.Repository) bool {
+	if repo.Archived && !of.includeArchived || repo.Fork && !of.includeForks {
+		return false
+	}
+	if of.repoPattern != "" {
+		if match, _ := filepath.Match(of.repoPattern, repo.Name); !match {
+			return false
+		}
+	}
+	for _, topic := range of.topics {
+		found := false
+		for _, t := range repo.Topics {
+			if strings.EqualFold(t, topic) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// repos lists the repositories of the organization that pass the filters, sorted by name, as a
+// copy of the client flags for each one.
+func (of *orgFlags) repos(ctx context.Context, cf *clientFlags) ([]*clientFlags, error) {
+	ocf := *cf
+	ocf.user = of.org
+	client, err := ocf.newClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+	all, err := client.ListOrgRepos(ctx, of.org)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, repo := range all {
+		if of.match(repo) {
+			names = append(names, repo.FullName)
+		}
+	}
+	sort.Strings(names)
+	log.Printf("info: %d of the %d repositories in %s match", len(names), len(all), of.org)
+	ocf.repos = names
+	if len(names) == 0 {
+		return nil, nil
+	}
+	return ocf.forEachRepo(), nil
+}
+
+// forEach runs fn against each repository of the organization, -org-concurrency at a time. Every
+// repository is attempted even if some fail, and an error naming those that failed is returned.
+// fn is given the full name of the repository and its client.
+func (of *orgFlags) forEach(ctx context.Context, cf *clientFlags, fn func(ctx context.Context, repo string, client *release.Client) error) error {
+	repos, err := of.repos(ctx, cf)
+	if err != nil {
+		return err
+	}
+	var mu sync.Mutex
+	var failed []string
+	jobs := make(chan *clientFlags)
+	var wg sync.WaitGroup
+	for w := 0; w < of.concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for rcf := range jobs {
+				repo := rcf.repos[0]
+				client, err := rcf.newClient(ctx)
+				if err == nil {
+					err = fn(ctx, repo, client)
+				}
+				if err != nil {
+					log.Printf("error: %s: %v", repo, err)
+					mu.Lock()
+					failed = append(failed, repo)
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+	for _, rcf := range repos {
+		if ctx.Err() != nil {
+			break
+		}
+		jobs <- rcf
+	}
+	close(jobs)
+	wg.Wait()
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if len(failed) > 0 {
+		sort.Strings(failed)
+		return fmt.Errorf("failed in %d of %d repo(s): %s", len(failed), len(repos), strings.Join(failed, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/imitablerabbit/githubrelease/pkg/release"
+)
+
+// The states of an asset in the upload results.
+const (
+	assetUploaded = "uploaded"
+	assetFailed   = "failed"
+	assetSkipped  = "skipped"
+	assetDeleted  = "deleted"
+)
+
+// assetResult is the outcome of uploading a single asset.
+type assetResult struct {
+	Name               string `json:"name"`
+	Path               string `json:"path"`
+	State              string `json:"state"`
+	Error              string `json:"error,omitempty"`
+	ID                 int    `json:"id,omitempty"`
+	Size               int64  `json:"size,omitempty"`
+	BrowserDownloadURL string `json:"browser_download_url,omitempty"`
+
+	// Repos are the outcomes of publishing the asset to the package repositories, with
+	// -publish-packages.
+	Repos []repoResult `json:"repos,omitempty"`
+}
+
+// set records the outcome of the upload.
+func (r *assetResult) set(uploaded *release.Asset, err error) {
+	if err != nil {
+		r.State, r.Error = assetFailed, err.Error()
+		return
+	}
+	r.State = assetUploaded
+	if uploaded != nil {
+		r.ID, r.Size, r.BrowserDownloadURL = uploaded.ID, uploaded.Size, uploaded.BrowserDownloadURL
+	}
+}
+
+// releaseOutput is the JSON document written to stdout by -output json.
+type releaseOutput struct {
+	ID         int           `json:"id"`
+	TagName    string        `json:"tag_name"`
+	Name       string        `json:"name"`
+	HTMLURL    string        `json:"html_url"`
+	UploadURL  string        `json:"upload_url"`
+	Draft      bool          `json:"draft"`
+	PreRelease bool          `json:"prerelease"`
+	Assets     []assetResult `json:"assets"`
+
+	DiscussionURL string `json:"discussion_url,omitempty"`
+}
+
+// addOutputFlag registers the -output flag on the flag set.
+func addOutputFlag(fs *flag.FlagSet) *string {
+	// Logs always go to stderr, so stdout only has the result document in json mode.
+	return fs.String("output", "text", "Output format, text or json. json writes the release and asset upload results to stdout")
+}
+
+// checkOutputFormat returns an error if the -output format is not supported.
+func checkOutputFormat(format string) error {
+	switch format {
+	case "text", "json":
+		return nil
+	}
+	return withExitCode(exitValidation, fmt.Errorf("unsupported -output %q, expected text or json", format))
+}
+
+// writeReleaseOutput writes the release and upload results to stdout as JSON if the output format
+// is json. Nothing is written for text output, which is only logged. In GitHub Actions they are
+// also written as step outputs and a step summary, whatever the format.
+func writeReleaseOutput(format string, rel *release.Release, results []assetResult) error {
+	if err := writeActionsOutput(rel, results); err != nil {
+		return err
+	}
+	if format != "json" {
+		return nil
+	}
+	return writeJSON(newReleaseOutput(rel, results))
+}
+
+// newReleaseOutput returns the JSON document of the release and upload results.
+func newReleaseOutput(rel *release.Release, results []assetResult) releaseOutput {
+	if results == nil {
+		results = []assetResult{}
+	}
+	return releaseOutput{
+		ID:         rel.ID,
+		TagName:    rel.TagName,
+		Name:       rel.Name,
+		HTMLURL:    rel.HTMLURL,
+		UploadURL:  rel.UploadURL,
+		Draft:      rel.Draft,
+		PreRelease: rel.PreRelease,
+		Assets:     results,
+
+		DiscussionURL: rel.DiscussionURL,
+	}
+}
+
+// writeJSON writes the document to stdout as indented JSON.
+func writeJSON(out interface{}) error {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(out); err != nil {
+		return fmt.Errorf("writing json output: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,386 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"github.com/imitablerabbit/githubrelease/pkg/release"
+)
+
+// defaultPackageName is the name template of the archives, without the extension.
+const defaultPackageName = "{{.ProjectName}}_{{.Version}}_{{.Os}}_{{.Arch}}"
+
+// packageConfig is the package: section of the config file, which describes the archives that
+// -package builds before the assets are uploaded.
+type packageConfig struct {
+	project string
+	name    string
+	format  string
+	files   []string
+	wrap    bool
+	targets []packageTarget
+}
+
+// packageTarget is an OS and architecture to build an archive for, with the files that are only
+// in its archive. The format defaults to the format of the package section.
+type packageTarget struct {
+	os     string
+	arch   string
+	format string
+	files  []string
+}
+
+// packageData is the data for the archive name template.
+type packageData struct {
+	ProjectName string
+	Tag         string
+	Version     string
+	Os          string
+	Arch        string
+}
+
+// packageFile is a file to add to an archive under the name.
+type packageFile struct {
+	path string
+	name string
+	info os.FileInfo
+}
+
+// readPackageConfig reads the package: section of the config file given by -config, or the
+// default config file.
+func readPackageConfig(fs *flag.FlagSet) (*packageConfig, error) {
+	path := fs.Lookup("config").Value.String()
+	if path == "" {
+		path = findConfigFile()
+	}
+	if path == "" {
+		return nil, fmt.Errorf("-package needs a config file with a package section")
+	}
+	config, err := readConfig(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading config %s: %v", path, err)
+	}
+	section, ok := config["package"].(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("config %s has no package section", path)
+	}
+	pc, err := parsePackageConfig(section)
+	if err != nil {
+		return nil, fmt.Errorf("config %s: %v", path, err)
+	}
+	return pc, nil
+}
+
+// parsePackageConfig parses the package section of the config file.
+func parsePackageConfig(section map[string]interface{}) (*packageConfig, error) {
+	pc := &packageConfig{name: defaultPackageName, format: "tar.gz"}
+	for key, value := range section {
+		var err error
+		switch key {
+		case "project":
+			pc.project, err = configString("package.project", value)
+		case "name":
+			pc.name, err = configString("package.name", value)
+		case "format":
+			pc.format, err = configString("package.format", value)
+		case "files":
+			pc.files, err = configValues("package.files", value)
+		case "wrap-in-directory":
+			var wrap string
+			if wrap, err = configString("package.wrap-in-directory", value); err == nil {
+				pc.wrap = wrap == "true"
+			}
+		case "targets":
+			pc.targets, err = parsePackageTargets(value)
+		default:
+			return nil, fmt.Errorf("unknown package key %s", key)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(pc.targets) == 0 {
+		return nil, fmt.Errorf("package.targets must list at least one os and arch")
+	}
+	for _, t := range append([]packageTarget{{format: pc.format}}, pc.targets...) {
+		if t.format != "" && t.format != "tar.gz" && t.format != "zip" {
+			return nil, fmt.Errorf("unsupported package format %q, expected tar.gz or zip", t.format)
+		}
+	}
+	return pc, nil
+}
+
+// parsePackageTargets parses the package.targets list.
+func parsePackageTargets(value interface{}) ([]packageTarget, error) {
+	items, ok := value.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("package.targets must be a list")
+	}
+	var targets []packageTarget
+	for i, item := range items {
+		m, ok := item.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("package.targets[%d] must have an os and arch", i)
+		}
+		var t packageTarget
+		for key, value := range m {
+			name := fmt.Sprintf("package.targets[%d].%s", i, key)
+			var err error
+			switch key {
+			case "os":
+				t.os, err = configString(name, value)
+			case "arch":
+				t.arch, err = configString(name, value)
+			case "format":
+				t.format, err = configString(name, value)
+			case "files":
+				t.files, err = configValues(name, value)
+			default:
+				err = fmt.Errorf("unknown package target key %s", key)
+			}
+			if err != nil {
+				return nil, err
+			}
+		}
+		if t.os == "" || t.arch == "" {
+			return nil, fmt.Errorf("package.targets[%d] must have an os and arch", i)
+		}
+		targets = append(targets, t)
+	}
+	return targets, nil
+}
+
+// configString returns the config value, which must be a single value.
+func configString(key string, value interface{}) (string, error) {
+	s, ok := value.(string)
+	if !ok {
+		return "", fmt.Errorf("%s must be a single value", key)
+	}
+	return s, nil
+}
+
+// packageTag returns the tag that the archives built by -package are named after. The archives
+// have to be built before the release is created, so with -bump the next tag is worked out up
+// front in the first repo, and every repo is released with it.
+func packageTag(ctx context.Context, cf *clientFlags, f *createFlags) (string, error) {
+	if f.bump == "" {
+		if strings.HasPrefix(f.tag, f.tagPrefix) {
+			return f.tag, nil
+		}
+		return f.tagPrefix + f.tag, nil
+	}
+	client, err := cf.forEachRepo()[0].newClient(ctx)
+	if err != nil {
+		return "", err
+	}
+	tag, err := nextTag(ctx, client, f.bump, f.targetCommitish, f.tagPrefix)
+	if err != nil {
+		return "", err
+	}
+	f.tag, f.bump = tag, ""
+	return tag, nil
+}
+
+// buildPackages builds an archive for each target in the package section of the config file into
+// a temporary directory and returns them as assets to upload. The caller should remove the
+// returned directory.
+func (uf *uploadFlags) buildPackages() ([]release.AssetUpload, string, error) {
+	pc, err := readPackageConfig(uf.flags)
+	if err != nil {
+		return nil, "", err
+	}
+	if pc.project == "" {
+		pc.project = uf.projectName
+	}
+	tmpl, err := template.New("package.name").Funcs(templateFuncs).Option("missingkey=error").Parse(pc.name)
+	if err != nil {
+		return nil, "", fmt.Errorf("parsing package.name template: %v", err)
+	}
+	dir, err := ioutil.TempDir("", "githubrelease-packages")
+	if err != nil {
+		return nil, "", err
+	}
+	var archives []release.AssetUpload
+	for _, t := range pc.targets {
+		var name strings.Builder
+		data := packageData{
+			ProjectName: pc.project,
+			Tag:         uf.packageTag,
+			Version:     strings.TrimPrefix(tagVersion(uf.packageTag), "v"),
+			Os:          t.os,
+			Arch:        t.arch,
+		}
+		if err := tmpl.Execute(&name, data); err != nil {
+			os.RemoveAll(dir)
+			return nil, "", fmt.Errorf("executing package.name template: %v", err)
+		}
+		format := t.format
+		if format == "" {
+			format = pc.format
+		}
+		archive, err := buildPackage(dir, name.String(), format, pc.wrap, append(append([]string{}, pc.files...), t.files...))
+		if err != nil {
+			os.RemoveAll(dir)
+			return nil, "", fmt.Errorf("packaging %s/%s: %v", t.os, t.arch, err)
+		}
+		archives = append(archives, archive)
+	}
+	return archives, dir, nil
+}
+
+// buildPackage writes the archive of the files to dir. Files are added by their base name, or by
+// the name given as pattern#name, and directories keep their structure below the directory name.
+// With wrap every file is put in a directory named after the archive.
+func buildPackage(dir, name, format string, wrap bool, patterns []string) (release.AssetUpload, error) {
+	files, err := packageFiles(patterns)
+	if err != nil {
+		return release.AssetUpload{}, err
+	}
+	if len(files) == 0 {
+		return release.AssetUpload{}, fmt.Errorf("there are no files to package")
+	}
+	seen := map[string]bool{}
+	for i := range files {
+		if wrap {
+			files[i].name = name + "/" + files[i].name
+		}
+		if seen[files[i].name] {
+			return release.AssetUpload{}, fmt.Errorf("%s is added to %s more than once", files[i].name, name)
+		}
+		seen[files[i].name] = true
+	}
+
+	archive := release.AssetUpload{Name: name + "." + format}
+	archive.Path = filepath.Join(dir, archive.Name)
+	out, err := os.Create(archive.Path)
+	if err != nil {
+		return archive, err
+	}
+	if format == "zip" {
+		err = writeZip(out, files)
+	} else {
+		err = writeTarGz(out, files)
+	}
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return archive, fmt.Errorf("writing %s: %v", archive.Name, err)
+	}
+	log.Printf("info: packaged %d file(s) into %s", len(files), archive.Name)
+	return archive, nil
+}
+
+// packageFiles returns the files matched by the patterns, which are the same as -asset values
+// without the label.
+func packageFiles(patterns []string) ([]packageFile, error) {
+	var files []packageFile
+	for _, value := range patterns {
+		pattern, rename, _ := parseAssetFlag(value)
+		if info, err := os.Stat(pattern); err == nil && info.IsDir() {
+			base := rename
+			if base == "" {
+				base = info.Name()
+			}
+			err := filepath.WalkDir(pattern, func(p string, d fs.DirEntry, err error) error {
+				if err != nil || d.IsDir() {
+					return err
+				}
+				rel, err := filepath.Rel(pattern, p)
+				if err != nil {
+					return err
+				}
+				info, err := d.Info()
+				if err != nil {
+					return err
+				}
+				files = append(files, packageFile{path: p, name: path.Join(base, filepath.ToSlash(rel)), info: info})
+				return nil
+			})
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+		assets, err := expandAssetFlag(value)
+		if err != nil {
+			return nil, err
+		}
+		for _, asset := range assets {
+			info, err := os.Stat(asset.Path)
+			if err != nil {
+				return nil, err
+			}
+			files = append(files, packageFile{path: asset.Path, name: asset.Name, info: info})
+		}
+	}
+	return files, nil
+}
+
+// writeTarGz writes the files to w as a gzip compressed tar archive, keeping their modes.
+func writeTarGz(w io.Writer, files []packageFile) error {
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	for _, file := range files {
+		header, err := tar.FileInfoHeader(file.info, "")
+		if err != nil {
+			return err
+		}
+		header.Name = file.name
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+		if err := copyFile(tw, file.path); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+// writeZip writes the files to w as a zip archive, keeping their modes.
+func writeZip(w io.Writer, files []packageFile) error {
+	zw := zip.NewWriter(w)
+	for _, file := range files {
+		header, err := zip.FileInfoHeader(file.info)
+		if err != nil {
+			return err
+		}
+		header.Name = file.name
+		header.Method = zip.Deflate
+		fw, err := zw.CreateHeader(header)
+		if err != nil {
+			return err
+		}
+		if err := copyFile(fw, file.path); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+// copyFile copies the contents of the file at path to w.
+func copyFile(w io.Writer, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(w, f)
+	return err
+}
@@ -0,0 +1,268 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// The states of the publication of an asset to a package repository.
+const (
+	repoPublished = "published"
+	repoFailed    = "failed"
+)
+
+// packageRepoContentTypes are the content types of the packages that can be published, by the
+// type of the repository.
+var packageRepoContentTypes = map[string]string{
+	"deb": "application/vnd.debian.binary-package",
+	"rpm": "application/x-rpm",
+}
+
+// packageRepo is an apt or yum repository from the package-repos: section of the config file,
+// which the .deb or .rpm assets are published to once they are uploaded. A package is either
+// uploaded to the url, or passed to the command which adds it to the repository.
+type packageRepo struct {
+	name     string
+	kind     string
+	url      *template.Template
+	method   string
+	username string
+	password string
+	token    string
+	command  *template.Template
+}
+
+// packageRepoData is the data for the url and command templates of a package repository.
+type packageRepoData struct {
+	Name    string
+	Path    string
+	Tag     string
+	Version string
+	Repo    string
+}
+
+// repoResult is the outcome of publishing an asset to a package repository.
+type repoResult struct {
+	Repo  string `json:"repo"`
+	State string `json:"state"`
+	Error string `json:"error,omitempty"`
+}
+
+// readPackageRepos reads the package-repos: section of the config file given by -config, or the
+// default config file.
+func readPackageRepos(fs *flag.FlagSet) ([]packageRepo, error) {
+	path := fs.Lookup("config").Value.String()
+	if path == "" {
+		path = findConfigFile()
+	}
+	if path == "" {
+		return nil, fmt.Errorf("-publish-packages needs a config file with a package-repos section")
+	}
+	config, err := readConfig(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading config %s: %v", path, err)
+	}
+	section, ok := config["package-repos"]
+	if !ok {
+		return nil, fmt.Errorf("config %s has no package-repos section", path)
+	}
+	repos, err := parsePackageRepos(section)
+	if err != nil {
+		return nil, fmt.Errorf("config %s: %v", path, err)
+	}
+	return repos, nil
+}
+
+// parsePackageRepos parses the package-repos list. Each repository has a type of deb or rpm and
+// either a url or a command. The credentials can refer to environment variables as ${NAME}.
+func parsePackageRepos(value interface{}) ([]packageRepo, error) {
+	items, ok := value.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("package-repos must be a list")
+	}
+	var repos []packageRepo
+	for i, item := range items {
+		m, ok := item.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("package-repos[%d] must have a type and a url or command", i)
+		}
+		r := packageRepo{method: http.MethodPut}
+		var url, command string
+		for key, value := range m {
+			name := fmt.Sprintf("package-repos[%d].%s", i, key)
+			var err error
+			switch key {
+			case "name":
+				r.name, err = configString(name, value)
+			case "type":
+				r.kind, err = configString(name, value)
+			case "url":
+				url, err = configString(name, value)
+			case "method":
+				r.method, err = configString(name, value)
+			case "username":
+				r.username, err = configString(name, value)
+			case "password":
+				r.password, err = configString(name, value)
+			case "token":
+				r.token, err = configString(name, value)
+			case "command":
+				command, err = configString(name, value)
+			default:
+				err = fmt.Errorf("unknown package repo key %s", key)
+			}
+			if err != nil {
+				return nil, err
+			}
+		}
+		if _, ok := packageRepoContentTypes[r.kind]; !ok {
+			return nil, fmt.Errorf("package-repos[%d].type must be deb or rpm", i)
+		}
+		if (url == "") == (command == "") {
+			return nil, fmt.Errorf("package-repos[%d] must have either a url or a command", i)
+		}
+		r.method = strings.ToUpper(r.method)
+		if r.method != http.MethodPut && r.method != http.MethodPost {
+			return nil, fmt.Errorf("package-repos[%d].method must be PUT or POST", i)
+		}
+		if r.name == "" {
+			r.name = fmt.Sprintf("%s repo %d", r.kind, i+1)
+		}
+		r.username, r.password, r.token = os.ExpandEnv(r.username), os.ExpandEnv(r.password), os.ExpandEnv(r.token)
+		addSecret(r.password)
+		addSecret(r.token)
+		var err error
+		if url != "" {
+			r.url, err = template.New("url").Funcs(templateFuncs).Option("missingkey=error").Parse(url)
+		} else {
+			r.command, err = template.New("command").Funcs(templateFuncs).Option("missingkey=error").Parse(command)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("parsing package-repos[%d] template: %v", i, err)
+		}
+		repos = append(repos, r)
+	}
+	return repos, nil
+}
+
+// matches reports whether the asset is a package for the repository.
+func (r *packageRepo) matches(name string) bool {
+	return strings.EqualFold(filepath.Ext(name), "."+r.kind)
+}
+
+// expand executes the url or command template of the repository for the package.
+func (r *packageRepo) expand(data packageRepoData) (string, error) {
+	tmpl := r.url
+	if tmpl == nil {
+		tmpl = r.command
+	}
+	var b strings.Builder
+	if err := tmpl.Execute(&b, data); err != nil {
+		return "", fmt.Errorf("executing %s template: %v", tmpl.Name(), err)
+	}
+	return b.String(), nil
+}
+
+// publish publishes the package to the repository, by uploading it to the url or running the
+// command. The command gets the package in PACKAGE_PATH and PACKAGE_NAME as well as through the
+// template, so that it doesn't have to quote the path itself.
+func (r *packageRepo) publish(ctx context.Context, client *http.Client, data packageRepoData) error {
+	target, err := r.expand(data)
+	if err != nil {
+		return err
+	}
+	if r.command != nil {
+		log.Printf("info: running %s", target)
+		cmd := exec.CommandContext(ctx, "sh", "-c", target)
+		cmd.Env = append(os.Environ(), "PACKAGE_PATH="+data.Path, "PACKAGE_NAME="+data.Name, "RELEASE_TAG="+data.Tag)
+		cmd.Stdout = os.Stderr
+		cmd.Stderr = os.Stderr
+		if err := cmd.Run(); err != nil {
+			return fmt.Errorf("running command: %v", err)
+		}
+		return nil
+	}
+	f, err := os.Open(data.Path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	request, err := http.NewRequestWithContext(ctx, r.method, target, f)
+	if err != nil {
+		return fmt.Errorf("creating request: %v", err)
+	}
+	request.ContentLength = info.Size()
+	request.Header.Set("Content-Type", packageRepoContentTypes[r.kind])
+	request.Header.Set("User-Agent", userAgent())
+	switch {
+	case r.token != "":
+		request.Header.Set("Authorization", "Bearer "+r.token)
+	case r.username != "":
+		request.SetBasicAuth(r.username, r.password)
+	}
+	resp, err := client.Do(request)
+	if err != nil {
+		return fmt.Errorf("sending request: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		respData, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("non 2xx response: %s: %s", resp.Status, respData)
+	}
+	return nil
+}
+
+// publishPackages publishes the .deb and .rpm assets that were uploaded to the package
+// repositories for their type, and records the outcome of each in the results. Every repository
+// is attempted, and an error listing the failed ones is returned.
+func publishPackages(ctx context.Context, cf *clientFlags, repos []packageRepo, repo, tag string, results []assetResult) error {
+	transport, err := cf.transport()
+	if err != nil {
+		return err
+	}
+	client := &http.Client{Transport: transport}
+	var failed []string
+	for i := range results {
+		result := &results[i]
+		if result.State == assetFailed {
+			continue
+		}
+		data := packageRepoData{Name: result.Name, Path: result.Path, Tag: tag, Version: tagVersion(tag), Repo: repo}
+		for _, r := range repos {
+			if !r.matches(result.Name) {
+				continue
+			}
+			status := repoResult{Repo: r.name, State: repoPublished}
+			// Each package gets its own deadline, as a repository can take a while to index it.
+			pctx, cancel := context.WithTimeout(ctx, 10*time.Minute)
+			err := r.publish(pctx, client, data)
+			cancel()
+			if err != nil {
+				log.Printf("error: publishing %s to %s: %v", result.Name, r.name, err)
+				status.State, status.Error = repoFailed, err.Error()
+				failed = append(failed, result.Name+" to "+r.name)
+			} else {
+				log.Printf("info: published %s to %s", result.Name, r.name)
+			}
+			result.Repos = append(result.Repos, status)
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("publishing packages failed for %d package(s): %s", len(failed), strings.Join(failed, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,392 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/imitablerabbit/githubrelease/pkg/release"
+)
+
+// policyInput is the release that the policy is checked against before it is created. It is the
+// input document of a rego policy.
+type policyInput struct {
+	Repo       string        `json:"repo"`
+	Tag        string        `json:"tag"`
+	Version    string        `json:"version"`
+	Target     string        `json:"target"`
+	Commit     string        `json:"commit"`
+	Name       string        `json:"name"`
+	Body       string        `json:"body"`
+	Draft      bool          `json:"draft"`
+	PreRelease bool          `json:"prerelease"`
+	Assets     []policyAsset `json:"assets"`
+
+	// Branches are the protected branches that contain the commit, which are only looked up for
+	// rules that need them.
+	Branches []string `json:"branches"`
+}
+
+// policyAsset is an asset of the release in the policy input. The size of an asset streamed from
+// a URL is not known before it is uploaded and is -1.
+type policyAsset struct {
+	Name string `json:"name"`
+	Size int64  `json:"size"`
+}
+
+// policyViolation is a rule that the release breaks.
+type policyViolation struct {
+	rule    string
+	message string
+}
+
+// builtinPolicy is a policy file of the built-in rules.
+type builtinPolicy struct {
+	changelog       string
+	signedAssets    []string
+	protectedBranch bool
+	branches        []string
+	sizes           []assetSizeRule
+}
+
+// assetSizeRule is the expected size of the assets matching a pattern. Zero is no limit.
+type assetSizeRule struct {
+	pattern string
+	min     int64
+	max     int64
+}
+
+// signatureSuffixes are the suffixes of the files that sign an asset.
+var signatureSuffixes = []string{".sig", ".asc", ".sigstore", ".sigstore.json", ".bundle", ".pem"}
+
+// checkPolicy checks the release against the policy file, which is a YAML file of built-in rules
+// or a rego policy if it ends in .rego. Each violation is logged and an error is returned if
+// there are any, so that the release is not created.
+func checkPolicy(ctx context.Context, client *release.Client, path string, input *policyInput, assets []release.AssetUpload) error {
+	for _, asset := range assets {
+		size := int64(-1)
+		if !isRemoteAsset(asset.Path) {
+			info, err := os.Stat(asset.Path)
+			if err != nil {
+				return err
+			}
+			size = info.Size()
+		}
+		input.Assets = append(input.Assets, policyAsset{Name: asset.Name, Size: size})
+	}
+	// An existing tag is released as it is, otherwise the tag will be created at the target.
+	ref := input.Tag
+	exists, err := client.TagExists(ctx, ref)
+	if err != nil {
+		return fmt.Errorf("checking policy: %v", err)
+	}
+	if !exists {
+		ref = input.Target
+	}
+	commit, err := client.ResolveCommit(ctx, ref)
+	if err != nil {
+		return fmt.Errorf("checking policy: %v", err)
+	}
+	input.Commit = commit
+
+	var violations []policyViolation
+	if strings.HasSuffix(path, ".rego") {
+		if input.Branches, err = protectedBranchesWith(ctx, client, commit, nil, true); err != nil {
+			return fmt.Errorf("checking policy: %v", err)
+		}
+		violations, err = checkRegoPolicy(path, input)
+	} else {
+		var p *builtinPolicy
+		if p, err = readBuiltinPolicy(path); err == nil {
+			violations, err = p.check(ctx, client, input)
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("checking policy %s: %v", path, err)
+	}
+	if len(violations) == 0 {
+		log.Printf("info: release %s passes policy %s", input.Tag, path)
+		return nil
+	}
+	for _, v := range violations {
+		log.Printf("error: policy violation: %s: %s", v.rule, v.message)
+	}
+	return withExitCode(exitValidation, fmt.Errorf("release %s breaks %d rule(s) of policy %s", input.Tag, len(violations), path))
+}
+
+// readBuiltinPolicy reads a policy file of built-in rules:
+//
+//	changelog: CHANGELOG.md
+//	signed-assets: true
+//	protected-branch: true
+//	branches: [main, release/*]
+//	asset-sizes:
+//	  "*.tar.gz": 1MiB-500MiB
+func readBuiltinPolicy(path string) (*builtinPolicy, error) {
+	config, err := readConfig(path)
+	if err != nil {
+		return nil, err
+	}
+	p := &builtinPolicy{}
+	for key, value := range config {
+		if key == "asset-sizes" {
+			sizes, ok := value.(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("asset-sizes must be a mapping of pattern to min-max size")
+			}
+			for pattern, limits := range sizes {
+				rule, err := parseAssetSizeRule(pattern, limits)
+				if err != nil {
+					return nil, err
+				}
+				p.sizes = append(p.sizes, rule)
+			}
+			sort.Slice(p.sizes, func(i, j int) bool { return p.sizes[i].pattern < p.sizes[j].pattern })
+			continue
+		}
+		values, err := configValues(key, value)
+		if err != nil {
+			return nil, err
+		}
+		switch key {
+		case "changelog":
+			p.changelog = strings.Join(values, "")
+		case "signed-assets":
+			// true requires every asset to be signed, otherwise only the assets matching the
+			// patterns are.
+			switch strings.Join(values, ",") {
+			case "true":
+				p.signedAssets = []string{"*"}
+			case "false":
+			default:
+				p.signedAssets = values
+			}
+		case "protected-branch":
+			p.protectedBranch = strings.Join(values, "") == "true"
+		case "branches":
+			p.branches = values
+		default:
+			return nil, fmt.Errorf("unknown rule %s", key)
+		}
+	}
+	for _, pattern := range append(append([]string{}, p.signedAssets...), p.branches...) {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid pattern %s: %v", pattern, err)
+		}
+	}
+	return p, nil
+}
+
+// parseAssetSizeRule parses the expected size of the assets matching the pattern, given as
+// min-max, min- or -max, e.g. 1MiB-500MiB.
+func parseAssetSizeRule(pattern string, value interface{}) (assetSizeRule, error) {
+	rule := assetSizeRule{pattern: pattern}
+	if _, err := filepath.Match(pattern, ""); err != nil {
+		return rule, fmt.Errorf("invalid pattern %s: %v", pattern, err)
+	}
+	limits, _ := value.(string)
+	min, max, ok := strings.Cut(limits, "-")
+	if !ok || strings.TrimSpace(min) == "" && strings.TrimSpace(max) == "" {
+		return rule, fmt.Errorf("invalid size %q for %s, expected min-max, e.g. 1MiB-500MiB", limits, pattern)
+	}
+	for _, limit := range []struct {
+		value string
+		size  *int64
+	}{{min, &rule.min}, {max, &rule.max}} {
+		if strings.TrimSpace(limit.value) == "" {
+			continue
+		}
+		size, err := parseBandwidth(limit.value)
+		if err != nil || strings.HasSuffix(strings.TrimSpace(limit.value), "/s") {
+			return rule, fmt.Errorf("invalid size %q for %s, expected a size such as 1MiB", limit.value, pattern)
+		}
+		*limit.size = size
+	}
+	return rule, nil
+}
+
+// check returns the rules of the policy that the release breaks.
+func (p *builtinPolicy) check(ctx context.Context, client *release.Client, input *policyInput) ([]policyViolation, error) {
+	var violations []policyViolation
+	if p.changelog != "" {
+		ok, err := hasChangelogSection(p.changelog, input.Version)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			violations = append(violations, policyViolation{"changelog", fmt.Sprintf("%s has no section for %s", p.changelog, input.Version)})
+		}
+	}
+
+	names := map[string]bool{}
+	for _, asset := range input.Assets {
+		names[asset.Name] = true
+	}
+	for _, asset := range input.Assets {
+		if len(p.signedAssets) > 0 && !isSignature(asset.Name) && matchAny(p.signedAssets, asset.Name) && !hasSignature(names, asset.Name) {
+			violations = append(violations, policyViolation{"signed-assets", fmt.Sprintf("%s has no signature, such as %s.sig", asset.Name, asset.Name)})
+		}
+		for _, rule := range p.sizes {
+			if match, _ := filepath.Match(rule.pattern, asset.Name); !match {
+				continue
+			}
+			if asset.Size < 0 {
+				log.Printf("warn: policy: the size of %s is not known before it is streamed, not checking it", asset.Name)
+				continue
+			}
+			if rule.min > 0 && asset.Size < rule.min || rule.max > 0 && asset.Size > rule.max {
+				violations = append(violations, policyViolation{"asset-sizes", fmt.Sprintf("%s is %s, expected %s", asset.Name, formatBytes(float64(asset.Size)), rule.describe())})
+			}
+		}
+	}
+
+	if p.protectedBranch || len(p.branches) > 0 {
+		branches, err := protectedBranchesWith(ctx, client, input.Commit, p.branches, p.protectedBranch)
+		if err != nil {
+			return nil, err
+		}
+		if len(branches) == 0 {
+			rule, kind := "branches", "a branch matching "+strings.Join(p.branches, ", ")
+			if p.protectedBranch {
+				rule, kind = "protected-branch", "a protected branch"
+				if len(p.branches) > 0 {
+					kind += " matching " + strings.Join(p.branches, ", ")
+				}
+			}
+			violations = append(violations, policyViolation{rule, fmt.Sprintf("%s (%s) is not on %s", input.Target, shortSHA(input.Commit), kind)})
+		}
+	}
+	return violations, nil
+}
+
+// describe returns the expected size of the rule for a violation message.
+func (r assetSizeRule) describe() string {
+	switch {
+	case r.min == 0:
+		return "at most " + formatBytes(float64(r.max))
+	case r.max == 0:
+		return "at least " + formatBytes(float64(r.min))
+	}
+	return fmt.Sprintf("%s to %s", formatBytes(float64(r.min)), formatBytes(float64(r.max)))
+}
+
+// hasChangelogSection reports whether the changelog has a heading with the version, such as
+// "## [1.2.3] - 2024-01-31".
+func hasChangelogSection(path, version string) (bool, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return false, err
+	}
+	_, ok := changelogSection(string(data), version)
+	return ok, nil
+}
+
+// isSignature reports whether the asset is the signature of another asset.
+func isSignature(name string) bool {
+	for _, suffix := range signatureSuffixes {
+		if strings.HasSuffix(name, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// hasSignature reports whether one of the assets signs the asset with the name.
+func hasSignature(names map[string]bool, name string) bool {
+	for _, suffix := range signatureSuffixes {
+		if names[name+suffix] {
+			return true
+		}
+	}
+	return false
+}
+
+// matchAny reports whether the name matches any of the glob patterns.
+func matchAny(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if match, _ := filepath.Match(pattern, name); match {
+			return true
+		}
+	}
+	return false
+}
+
+// protectedBranchesWith returns the branches that contain the commit, out of the protected
+// branches if protected is true, and only those matching the patterns if any are given.
+func protectedBranchesWith(ctx context.Context, client *release.Client, commit string, patterns []string, protected bool) ([]string, error) {
+	branches, err := client.ListBranches(ctx, protected)
+	if err != nil {
+		return nil, err
+	}
+	found := []string{}
+	for _, branch := range branches {
+		if len(patterns) > 0 && !matchAny(patterns, branch.Name) {
+			continue
+		}
+		ok, err := client.IsAncestor(ctx, commit, branch.Name)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			found = append(found, branch.Name)
+		}
+	}
+	return found, nil
+}
+
+// shortSHA returns the first 7 characters of the commit SHA.
+func shortSHA(sha string) string {
+	if len(sha) > 7 {
+		return sha[:7]
+	}
+	return sha
+}
+
+// checkRegoPolicy evaluates the rego policy with opa. The policy is in the githubrelease package
+// and each message in its deny set is a violation.
+func checkRegoPolicy(path string, input *policyInput) ([]policyViolation, error) {
+	data, err := json.Marshal(input)
+	if err != nil {
+		return nil, err
+	}
+	var stdout bytes.Buffer
+	cmd := exec.Command("opa", "eval", "--format", "json", "--stdin-input", "--data", path, "data.githubrelease.deny")
+	cmd.Stdin = bytes.NewReader(data)
+	cmd.Stdout = &stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("running opa: %v", err)
+	}
+	var result struct {
+		Result []struct {
+			Expressions []struct {
+				Value []interface{} `json:"value"`
+			} `json:"expressions"`
+		} `json:"result"`
+	}
+	if err := json.Unmarshal(stdout.Bytes(), &result); err != nil {
+		return nil, fmt.Errorf("parsing opa output: %v", err)
+	}
+	var violations []policyViolation
+	for _, r := range result.Result {
+		for _, expression := range r.Expressions {
+			for _, value := range expression.Value {
+				message, ok := value.(string)
+				if !ok {
+					b, _ := json.Marshal(value)
+					message = string(b)
+				}
+				violations = append(violations, policyViolation{"deny", message})
+			}
+		}
+	}
+	return violations, nil
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/imitablerabbit/githubrelease/pkg/release"
+)
+
+// prNoteSections are the sections of the pull request release notes and the labels that put a
+// pull request in them. A pull request is listed in the first section that it has a label for,
+// and under Other Changes if it has none of them.
+var prNoteSections = []struct {
+	title  string
+	labels []string
+}{
+	{"Breaking Changes", []string{"breaking-change", "breaking"}},
+	{"Features", []string{"enhancement", "feature"}},
+	{"Bug Fixes", []string{"bug"}},
+}
+
+// defaultPRNotesTemplate renders the pull request release notes in the same style as the notes
+// generated from git.
+const defaultPRNotesTemplate = `{{range .Sections}}## {{.Title}}
+
+{{range .PullRequests}}* {{.Title}} by @{{.User.Login}} in #{{.Number}}
+{{end}}
+{{end}}{{if .NewContributors}}## New Contributors
+
+{{range .NewContributors}}* @{{.Login}} made their first contribution in #{{.PullRequest.Number}}
+{{end}}
+{{end}}{{if .PreviousTag}}**Full Changelog**: {{.PreviousTag}}...{{.Tag}}
+{{end}}`
+
+// prNoteSection is a section of the pull request release notes.
+type prNoteSection struct {
+	Title        string
+	PullRequests []release.PullRequest
+}
+
+// prContributor is an author whose first merged pull request is in the release.
+type prContributor struct {
+	Login       string
+	PullRequest release.PullRequest
+}
+
+// prNotesData is the data that the pull request notes template is executed with.
+type prNotesData struct {
+	Tag             string
+	PreviousTag     string
+	Sections        []prNoteSection
+	PullRequests    []release.PullRequest
+	Contributors    []string
+	NewContributors []prContributor
+}
+
+// prNotes generates Markdown release notes from the pull requests merged between the previous tag
+// and the tag, or target if the tag does not exist yet. The previous tag is the SemVer tag with
+// the same prefix before the tag unless previousTag is given. The notes are rendered with the
+// template in templatePath, or defaultPRNotesTemplate if it is empty.
+func prNotes(ctx context.Context, client *release.Client, tag, previousTag, target, templatePath string) (string, error) {
+	text := defaultPRNotesTemplate
+	if templatePath != "" {
+		data, err := ioutil.ReadFile(templatePath)
+		if err != nil {
+			return "", fmt.Errorf("reading notes template: %v", err)
+		}
+		text = string(data)
+	}
+	tmpl, err := template.New("notes").Funcs(templateFuncs).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("parsing notes template: %v", err)
+	}
+
+	if previousTag == "" {
+		tags, err := client.ListAllTags(ctx)
+		if err != nil {
+			return "", err
+		}
+		previousTag = previousSemverTag(tags, tag)
+	}
+	if previousTag == "" {
+		return "", fmt.Errorf("there is no tag before %s, use -previous-tag", tag)
+	}
+	head := target
+	if exists, err := client.TagExists(ctx, tag); err != nil {
+		return "", err
+	} else if exists {
+		head = tag
+	}
+	pulls, err := mergedPullRequests(ctx, client, previousTag, head)
+	if err != nil {
+		return "", err
+	}
+	data := &prNotesData{Tag: tag, PreviousTag: previousTag, PullRequests: pulls}
+	data.Sections = groupPullRequests(pulls)
+	if data.Contributors, data.NewContributors, err = contributors(ctx, client, pulls); err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	if err := tmpl.Execute(&b, data); err != nil {
+		return "", fmt.Errorf("executing notes template: %v", err)
+	}
+	return strings.TrimSpace(b.String()), nil
+}
+
+// previousSemverTag returns the highest SemVer tag with the same prefix as tag that is lower than
+// it, or "" if there is none. Pre-releases are skipped unless tag is a pre-release itself.
+func previousSemverTag(tags []release.RepoTag, tag string) string {
+	prefix := strings.TrimSuffix(tag, tagVersion(tag))
+	current, ok := parseSemver(tagVersion(tag))
+	if !ok {
+		return ""
+	}
+	var previousTag string
+	var previous semver
+	for _, t := range tags {
+		if !strings.HasPrefix(t.Name, prefix) || strings.Contains(strings.TrimPrefix(t.Name, prefix), "/") {
+			continue
+		}
+		v, ok := parseSemver(strings.TrimPrefix(t.Name, prefix))
+		if !ok || !v.less(current) || (v.PreRelease != "" && current.PreRelease == "") {
+			continue
+		}
+		if previousTag == "" || previous.less(v) {
+			previousTag, previous = t.Name, v
+		}
+	}
+	return previousTag
+}
+
+// mergedPullRequests returns the pull requests that merged the commits between base and head,
+// oldest first.
+func mergedPullRequests(ctx context.Context, client *release.Client, base, head string) ([]release.PullRequest, error) {
+	commits, err := client.CompareCommits(ctx, base, head)
+	if err != nil {
+		return nil, err
+	}
+	if len(commits) >= 250 {
+		log.Printf("warn: GitHub only compares 250 commits, pull requests before them are missing from the notes")
+	}
+	seen := map[int]bool{}
+	var pulls []release.PullRequest
+	for _, commit := range commits {
+		commitPulls, err := client.ListCommitPullRequests(ctx, commit.SHA)
+		if err != nil {
+			return nil, err
+		}
+		for _, pr := range commitPulls {
+			if pr.MergedAt == "" || seen[pr.Number] {
+				continue
+			}
+			seen[pr.Number] = true
+			pulls = append(pulls, pr)
+		}
+	}
+	return pulls, nil
+}
+
+// groupPullRequests puts each pull request in the section for its labels.
+func groupPullRequests(pulls []release.PullRequest) []prNoteSection {
+	grouped := make([][]release.PullRequest, len(prNoteSections)+1)
+	for _, pr := range pulls {
+		i := sectionForLabels(pr)
+		grouped[i] = append(grouped[i], pr)
+	}
+	var sections []prNoteSection
+	for i, prs := range grouped {
+		if len(prs) == 0 {
+			continue
+		}
+		title := "Other Changes"
+		if i < len(prNoteSections) {
+			title = prNoteSections[i].title
+		}
+		sections = append(sections, prNoteSection{Title: title, PullRequests: prs})
+	}
+	return sections
+}
+
+// sectionForLabels returns the index of the section in prNoteSections for the pull request, or
+// len(prNoteSections) for Other Changes.
+func sectionForLabels(pr release.PullRequest) int {
+	for i, section := range prNoteSections {
+		for _, label := range section.labels {
+			if pr.HasLabel(label) {
+				return i
+			}
+		}
+	}
+	return len(prNoteSections)
+}
+
+// contributors returns the sorted authors of the pull requests, and the authors whose first
+// merged pull requests are all in the release.
+func contributors(ctx context.Context, client *release.Client, pulls []release.PullRequest) ([]string, []prContributor, error) {
+	counts := map[string]int{}
+	first := map[string]release.PullRequest{}
+	for _, pr := range pulls {
+		login := pr.User.Login
+		if login == "" || strings.HasSuffix(login, "[bot]") {
+			continue
+		}
+		if counts[login] == 0 {
+			first[login] = pr
+		}
+		counts[login]++
+	}
+	var logins []string
+	for login := range counts {
+		logins = append(logins, login)
+	}
+	sort.Strings(logins)
+
+	var newContributors []prContributor
+	for _, login := range logins {
+		merged, err := client.CountMergedPullRequests(ctx, login)
+		if err != nil {
+			return nil, nil, err
+		}
+		if merged <= counts[login] {
+			newContributors = append(newContributors, prContributor{Login: login, PullRequest: first[login]})
+		}
+	}
+	return logins, newContributors, nil
+}
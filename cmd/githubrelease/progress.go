@@ -0,0 +1,202 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/imitablerabbit/githubrelease/pkg/release"
+)
+
+// progressInterval is how often the progress bars are redrawn on a terminal.
+const progressInterval = 200 * time.Millisecond
+
+// progressLogStep is the percentage between the progress lines logged when stderr is not a
+// terminal, such as in CI logs where redrawing a bar would add a line for every update.
+const progressLogStep = 25
+
+// transfer is the progress of a single asset upload.
+type transfer struct {
+	name   string
+	sent   int64
+	total  int64
+	start  time.Time
+	logged int
+}
+
+// speed returns the average transfer speed in bytes per second.
+func (t *transfer) speed(now time.Time) float64 {
+	elapsed := now.Sub(t.start).Seconds()
+	if elapsed <= 0 {
+		return 0
+	}
+	return float64(t.sent) / elapsed
+}
+
+// percent returns how much of the file has been sent.
+func (t *transfer) percent() int {
+	if t.total <= 0 {
+		return 100
+	}
+	return int(t.sent * 100 / t.total)
+}
+
+// String formats the transfer as bytes sent, percentage, speed and ETA.
+func (t *transfer) String() string {
+	now := time.Now()
+	speed := t.speed(now)
+	eta := "-"
+	if speed > 0 && t.sent < t.total {
+		eta = time.Duration(float64(t.total-t.sent) / speed * float64(time.Second)).Round(time.Second).String()
+	}
+	return fmt.Sprintf("%3d%% %s/%s %s/s ETA %s", t.percent(), formatBytes(float64(t.sent)),
+		formatBytes(float64(t.total)), formatBytes(speed), eta)
+}
+
+// progress reports the progress of the asset uploads. On a terminal a bar is drawn for each
+// upload in progress and redrawn as it changes, otherwise a line is logged every
+// progressLogStep percent.
+type progress struct {
+	mu        sync.Mutex
+	w         io.Writer
+	log       io.Writer
+	tty       bool
+	transfers []*transfer
+	drawn     int
+	lastDraw  time.Time
+}
+
+// newProgress returns a progress reporter that writes to stderr. While it is drawing bars on
+// a terminal the log output goes through it, so that log lines are printed above the bars
+// instead of over them. stop must be called once the uploads are finished.
+func newProgress() *progress {
+	p := &progress{w: os.Stderr, log: log.Writer(), tty: isTerminal(os.Stderr)}
+	if p.tty {
+		log.SetOutput(p)
+	}
+	return p
+}
+
+// isTerminal reports whether the file is a terminal rather than a pipe or a regular file.
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// update records the bytes sent for the asset. It is used as the client's UploadProgress. The
+// bar for the asset is removed once the whole file has been sent.
+func (p *progress) update(asset release.AssetUpload, sent, total int64) {
+	p.mu.Lock()
+	t := p.transfer(asset.Name)
+	if sent < t.sent {
+		// The upload is being retried from the start.
+		t.start, t.logged = time.Now(), 0
+	}
+	t.sent, t.total = sent, total
+	done := sent >= total
+	if done {
+		p.remove(t)
+	}
+	if p.tty {
+		if done || time.Since(p.lastDraw) >= progressInterval {
+			p.clear()
+			p.draw()
+		}
+		p.mu.Unlock()
+		return
+	}
+	var line string
+	if step := t.percent() / progressLogStep * progressLogStep; step > t.logged && !done {
+		t.logged = step
+		line = t.String()
+	}
+	p.mu.Unlock()
+	if line != "" {
+		log.Printf("info: uploading %s: %s", asset.Name, line)
+	}
+}
+
+// stop clears the bars and restores the log output.
+func (p *progress) stop() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.tty {
+		p.clear()
+		log.SetOutput(p.log)
+	}
+	p.transfers = nil
+}
+
+// Write prints log output above the bars.
+func (p *progress) Write(b []byte) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.clear()
+	n, err := p.log.Write(b)
+	p.draw()
+	return n, err
+}
+
+// transfer returns the transfer for the asset, adding it if this is its first update.
+// p.mu must be held.
+func (p *progress) transfer(name string) *transfer {
+	for _, t := range p.transfers {
+		if t.name == name {
+			return t
+		}
+	}
+	t := &transfer{name: name, start: time.Now()}
+	p.transfers = append(p.transfers, t)
+	return t
+}
+
+// remove drops the transfer from the bars. p.mu must be held.
+func (p *progress) remove(t *transfer) {
+	for i := range p.transfers {
+		if p.transfers[i] == t {
+			p.transfers = append(p.transfers[:i], p.transfers[i+1:]...)
+			return
+		}
+	}
+}
+
+// clear erases the bars that were drawn. p.mu must be held.
+func (p *progress) clear() {
+	if p.drawn > 0 {
+		fmt.Fprintf(p.w, "\033[%dA\033[J", p.drawn)
+		p.drawn = 0
+	}
+}
+
+// draw writes a bar for each upload in progress. p.mu must be held.
+func (p *progress) draw() {
+	if !p.tty {
+		return
+	}
+	const width = 20
+	for _, t := range p.transfers {
+		filled := t.percent() * width / 100
+		bar := strings.Repeat("=", filled) + strings.Repeat(" ", width-filled)
+		fmt.Fprintf(p.w, "%-30.30s [%s] %s\n", t.name, bar, t)
+	}
+	p.drawn = len(p.transfers)
+	p.lastDraw = time.Now()
+}
+
+// formatBytes formats a number of bytes with a binary unit, e.g. 12.3 MiB.
+func formatBytes(n float64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%.0f B", n)
+	}
+	exp := 0
+	for n >= unit*unit && exp < 4 {
+		n /= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", n/unit, "KMGTP"[exp])
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/imitablerabbit/githubrelease/pkg/release"
+)
+
+// promoteFlags are the flags of the promote command.
+type promoteFlags struct {
+	retag      bool
+	deleteRC   bool
+	name       string
+	makeLatest *string
+	dryRun     *bool
+}
+
+// runPromote turns a pre-release into a full release, either by copying its notes and assets to a
+// new release for the stable tag or by moving the pre-release itself to the stable tag.
+func runPromote(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("promote", flag.ContinueOnError)
+	cf := addClientFlags(fs)
+	cf.writesReleases = true
+	f := &promoteFlags{}
+	fs.BoolVar(&f.retag, "retag", false, "Move the pre-release to the new tag instead of copying it to a new release")
+	fs.BoolVar(&f.deleteRC, "delete-rc", false, "Delete the pre-release once it has been copied. The git tag is left in place")
+	fs.StringVar(&f.name, "name", "", "The name of the full release. Defaults to the name of the pre-release with its tag replaced by the new tag")
+	f.makeLatest = addMakeLatestFlag(fs)
+	f.dryRun = addDryRunFlag(fs)
+	notifyFlag := addNotifyFlag(fs)
+	hooksFlag := addHooksFlag(fs)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: githubrelease promote [flags] <pre-release tag> <new tag>\n")
+		fs.PrintDefaults()
+	}
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() != 2 {
+		return withExitCode(exitValidation, fmt.Errorf("expected the tag of the pre-release and the new tag, e.g. promote v1.3.0-rc.2 v1.3.0"))
+	}
+	if err := checkMakeLatest(*f.makeLatest); err != nil {
+		return err
+	}
+	if f.retag && f.deleteRC {
+		return withExitCode(exitValidation, fmt.Errorf("-delete-rc cannot be used with -retag, which moves the pre-release itself"))
+	}
+
+	ctx, cancel := cf.withTimeout(ctx)
+	defer cancel()
+	client, err := cf.newClient(ctx)
+	if err != nil {
+		return err
+	}
+	rc, err := client.GetReleaseByTag(ctx, fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	tag := fs.Arg(1)
+	if existing, err := client.FindReleaseByTag(ctx, tag); err != nil {
+		return err
+	} else if existing != nil {
+		return withExitCode(exitTagConflict, fmt.Errorf("release %d already exists for tag %s", existing.ID, tag))
+	}
+	if !rc.PreRelease {
+		log.Printf("warn: release %s is not a pre-release, promoting it anyway", rc.TagName)
+	}
+	hks, err := loadHooks(fs, *hooksFlag)
+	if err != nil {
+		return err
+	}
+
+	repo := client.User + "/" + client.Repo
+	rel, err := f.promote(ctx, client, rc, tag, hks)
+	if err == nil && !*f.dryRun {
+		err = hks.run(ctx, hookAfterPublish, hookRun{command: "promote", repo: repo, rel: rel})
+	}
+	if *f.dryRun {
+		return err
+	}
+	if err != nil {
+		hks.failed(hookRun{command: "promote", repo: repo, rel: rel, err: err})
+	}
+	if *notifyFlag {
+		notify(fs, cf, newNotifyData("promote", repo, tag, rel, nil, err))
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Println(rel.HTMLURL)
+	return nil
+}
+
+// promotedName returns the name of the full release, the name of the pre-release with its tag
+// replaced by the new one, e.g. "v1.3.0-rc.2" to "v1.3.0".
+func (f *promoteFlags) promotedName(rc *release.Release, tag string) string {
+	switch {
+	case f.name != "":
+		return f.name
+	case rc.Name == "":
+		return ""
+	case strings.Contains(rc.Name, rc.TagName):
+		return strings.Replace(rc.Name, rc.TagName, tag, -1)
+	}
+	return tag
+}
+
+// promote creates the full release for the tag from the pre-release, at the commit that the
+// pre-release is tagged at. In dry-run mode the requests are printed and the returned release is
+// the pre-release.
+func (f *promoteFlags) promote(ctx context.Context, client *release.Client, rc *release.Release, tag string, hks hooks) (*release.Release, error) {
+	commit, err := client.ResolveCommit(ctx, rc.TagName)
+	if err != nil {
+		return rc, fmt.Errorf("resolving %s: %v", rc.TagName, err)
+	}
+	name := f.promotedName(rc, tag)
+
+	if f.retag {
+		prerelease, draft := false, false
+		erq := &release.EditReleaseRequest{TagName: tag, TargetCommitish: commit, Name: name, PreRelease: &prerelease, Draft: &draft, MakeLatest: *f.makeLatest}
+		if *f.dryRun {
+			p := newPlan(client)
+			if err := p.request("PATCH", fmt.Sprintf("releases/%d", rc.ID), erq); err != nil {
+				return rc, err
+			}
+			p.hooks(hks, hookAfterPublish)
+			return rc, nil
+		}
+		rel, err := client.EditRelease(ctx, rc.ID, erq)
+		if err != nil {
+			return rc, err
+		}
+		log.Printf("info: moved release %d from %s to %s", rel.ID, rc.TagName, rel.TagName)
+		return rel, nil
+	}
+
+	all, _, err := listDownloads(ctx, client, rc, nil, nil)
+	if err != nil {
+		return rc, err
+	}
+	crr := &release.CreateReleaseRequest{
+		TagName:         tag,
+		TargetCommitish: commit,
+		Name:            name,
+		Body:            rc.Body,
+		MakeLatest:      *f.makeLatest,
+	}
+	if *f.dryRun {
+		p := newPlan(client)
+		if err := p.request("POST", "releases", crr); err != nil {
+			return rc, err
+		}
+		p.copies(&release.Release{UploadURL: "<upload_url>"}, all)
+		if f.deleteRC {
+			if err := p.request("DELETE", fmt.Sprintf("releases/%d", rc.ID), nil); err != nil {
+				return rc, err
+			}
+		}
+		p.hooks(hks, hookAfterPublish)
+		return rc, nil
+	}
+
+	rel, err := client.CreateRelease(ctx, crr)
+	if err != nil {
+		return rc, err
+	}
+	log.Printf("info: created release %d for %s from %s", rel.ID, rel.TagName, rc.TagName)
+	if err := copyAssets(ctx, client, rel, all); err != nil {
+		return rel, err
+	}
+	if f.deleteRC {
+		if err := client.DeleteRelease(withAuditNote(ctx, auditNote{tag: rc.TagName}), rc.ID); err != nil {
+			return rel, fmt.Errorf("deleting pre-release %s: %v", rc.TagName, err)
+		}
+		log.Printf("info: deleted release %d for tag %s", rc.ID, rc.TagName)
+	}
+	return rel, nil
+}
+
+// copyAssets downloads each of the assets and uploads it to the release with the same name,
+// label and content type. The downloads go to a temporary directory that is removed afterwards.
+func copyAssets(ctx context.Context, client *release.Client, rel *release.Release, assets []releaseAsset) error {
+	dir, err := ioutil.TempDir("", "githubrelease-promote")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+	for _, asset := range assets {
+		path := filepath.Join(dir, filepath.Base(asset.name))
+		if err := downloadTo(ctx, client, asset, path); err != nil {
+			return fmt.Errorf("copying %s: %v", asset.name, err)
+		}
+		upload := release.AssetUpload{Path: path, Name: asset.name, Label: asset.label, ContentType: asset.contentType}
+		if _, err := client.UploadAsset(ctx, rel, upload); err != nil {
+			return fmt.Errorf("copying %s: %v", asset.name, err)
+		}
+		os.Remove(path)
+		log.Printf("info: copied %s", asset.name)
+	}
+	return nil
+}
+
+// downloadTo downloads the asset to the path.
+func downloadTo(ctx context.Context, client *release.Client, asset releaseAsset, path string) error {
+	body, _, err := client.DownloadAsset(ctx, asset.id, 0)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(f, body)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/imitablerabbit/githubrelease/pkg/release"
+)
+
+// provenanceFileName is the name of the uploaded provenance, which SLSA verifiers look for.
+const provenanceFileName = "provenance.intoto.jsonl"
+
+// The build types of the provenance. Runs in GitHub Actions use the Actions workflow build type,
+// anything else is described by the source it was built from.
+const (
+	actionsBuildType = "https://actions.github.io/buildtypes/workflow/v1"
+	localBuildType   = "https://github.com/imitablerabbit/githubrelease/buildtypes/local/v1"
+)
+
+// provenanceSource is the source repository and commit that the release was built from.
+type provenanceSource struct {
+	repo   string
+	commit string
+	ref    string
+}
+
+// uri returns the source as a git URI, e.g. git+https://github.com/owner/repo@refs/tags/v1.0.0.
+func (s provenanceSource) uri() string {
+	uri := "git+" + s.repo
+	if s.ref != "" {
+		uri += "@" + s.ref
+	}
+	return uri
+}
+
+// findProvenanceSource returns the source from the GitHub Actions environment, or from the local
+// git repository when not running in Actions.
+func findProvenanceSource() (provenanceSource, error) {
+	if os.Getenv("GITHUB_ACTIONS") == "true" {
+		server := os.Getenv("GITHUB_SERVER_URL")
+		if server == "" {
+			server = "https://github.com"
+		}
+		return provenanceSource{
+			repo:   server + "/" + os.Getenv("GITHUB_REPOSITORY"),
+			commit: os.Getenv("GITHUB_SHA"),
+			ref:    os.Getenv("GITHUB_REF"),
+		}, nil
+	}
+	commit, err := git("rev-parse", "HEAD")
+	if err != nil {
+		return provenanceSource{}, err
+	}
+	repo, err := git("config", "--get", "remote.origin.url")
+	if err != nil {
+		return provenanceSource{}, fmt.Errorf("the source repository is the git remote origin: %v", err)
+	}
+	ref, _ := git("symbolic-ref", "--quiet", "HEAD")
+	return provenanceSource{repo: repo, commit: commit, ref: ref}, nil
+}
+
+// provenanceBuilderID returns the builder id, which is the workflow in GitHub Actions. Elsewhere
+// there is no trustworthy builder to name, so it has to be given.
+func provenanceBuilderID(builderID string) (string, error) {
+	if builderID != "" {
+		return builderID, nil
+	}
+	if workflow := os.Getenv("GITHUB_WORKFLOW_REF"); os.Getenv("GITHUB_ACTIONS") == "true" && workflow != "" {
+		server := os.Getenv("GITHUB_SERVER_URL")
+		if server == "" {
+			server = "https://github.com"
+		}
+		return server + "/" + workflow, nil
+	}
+	return "", fmt.Errorf("-provenance-builder-id is required outside of GitHub Actions")
+}
+
+// provenanceStatement returns a SLSA v1 provenance statement for the assets, with the sha256 of
+// each asset as a subject.
+func provenanceStatement(assets []release.AssetUpload, builderID string, source provenanceSource, now time.Time) (map[string]interface{}, error) {
+	subjects := []map[string]interface{}{}
+	for _, asset := range assets {
+		digest, err := release.FileDigest(asset.Path, "sha256")
+		if err != nil {
+			return nil, err
+		}
+		subjects = append(subjects, map[string]interface{}{
+			"name":   asset.Name,
+			"digest": map[string]string{"sha256": digest},
+		})
+	}
+
+	buildType := localBuildType
+	external := map[string]interface{}{"source": source.uri()}
+	metadata := map[string]interface{}{"finishedOn": now.UTC().Format(time.RFC3339)}
+	if os.Getenv("GITHUB_ACTIONS") == "true" {
+		buildType = actionsBuildType
+		workflowPath := os.Getenv("GITHUB_WORKFLOW_REF")
+		if i := strings.Index(workflowPath, "@"); i >= 0 {
+			workflowPath = workflowPath[:i]
+		}
+		workflowPath = strings.TrimPrefix(workflowPath, os.Getenv("GITHUB_REPOSITORY")+"/")
+		external = map[string]interface{}{
+			"workflow": map[string]string{"ref": source.ref, "repository": source.repo, "path": workflowPath},
+		}
+		metadata["invocationId"] = fmt.Sprintf("%s/actions/runs/%s/attempts/%s", source.repo,
+			os.Getenv("GITHUB_RUN_ID"), os.Getenv("GITHUB_RUN_ATTEMPT"))
+	}
+
+	return map[string]interface{}{
+		"_type":         "https://in-toto.io/Statement/v1",
+		"subject":       subjects,
+		"predicateType": "https://slsa.dev/provenance/v1",
+		"predicate": map[string]interface{}{
+			"buildDefinition": map[string]interface{}{
+				"buildType":          buildType,
+				"externalParameters": external,
+				"resolvedDependencies": []map[string]interface{}{{
+					"uri":    source.uri(),
+					"digest": map[string]string{"gitCommit": source.commit},
+				}},
+			},
+			"runDetails": map[string]interface{}{
+				"builder": map[string]interface{}{
+					"id":      builderID,
+					"version": map[string]string{"githubrelease": version},
+				},
+				"metadata": metadata,
+			},
+		},
+	}, nil
+}
+
+// generateProvenance writes the provenance of the assets to a temporary directory and returns it
+// as an asset to upload alongside the others, with its cosign signature if sign is set. The
+// caller should remove the returned directory.
+func generateProvenance(assets []release.AssetUpload, builderID string, sign bool, signKey string) ([]release.AssetUpload, string, error) {
+	builderID, err := provenanceBuilderID(builderID)
+	if err != nil {
+		return nil, "", err
+	}
+	source, err := findProvenanceSource()
+	if err != nil {
+		return nil, "", err
+	}
+	statement, err := provenanceStatement(assets, builderID, source, time.Now())
+	if err != nil {
+		return nil, "", err
+	}
+	// JSON Lines allows several statements in the file, each has to be on a single line.
+	b, err := json.Marshal(statement)
+	if err != nil {
+		return nil, "", err
+	}
+
+	dir, err := ioutil.TempDir("", "githubrelease-provenance")
+	if err != nil {
+		return nil, "", err
+	}
+	path := filepath.Join(dir, provenanceFileName)
+	if err := ioutil.WriteFile(path, append(b, '\n'), 0644); err != nil {
+		os.RemoveAll(dir)
+		return nil, "", err
+	}
+	provenance := []release.AssetUpload{{Path: path, Name: provenanceFileName, ContentType: "application/vnd.in-toto+json"}}
+	if sign {
+		signatures, err := (&cosignSigner{key: signKey}).sign(provenance[0], dir)
+		if err != nil {
+			os.RemoveAll(dir)
+			return nil, "", fmt.Errorf("signing provenance: %v", err)
+		}
+		provenance = append(provenance, signatures...)
+	}
+	return provenance, dir, nil
+}
@@ -0,0 +1,260 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/imitablerabbit/githubrelease/pkg/release"
+)
+
+// The forges that create can release to with -provider.
+const (
+	providerGitHub = "github"
+	providerGitea  = "gitea"
+	providerGitLab = "gitlab"
+)
+
+// gitlabDefaultURL is the api URL for -provider gitlab when -api-url is not given.
+const gitlabDefaultURL = "https://gitlab.com"
+
+// addProviderFlag registers the -provider flag on the flag set of the create command.
+func addProviderFlag(fs *flag.FlagSet, cf *clientFlags) {
+	// Gitea and GitLab only support creating a release and uploading its assets. -api-url is the
+	// URL of the instance, e.g. https://gitea.example.com.
+	fs.StringVar(&cf.provider, "provider", providerGitHub, "Forge to create the release on: github, gitea or gitlab. gitea and gitlab need -api-url set to the instance")
+}
+
+// newProvider creates the client for the -provider. The *release.Client is the one the provider
+// is built on, for the settings shared by every provider.
+func (cf *clientFlags) newProvider(ctx context.Context) (release.ReleaseProvider, *release.Client, error) {
+	if cf.provider == providerGitHub {
+		client, err := cf.newClient(ctx)
+		return client, client, err
+	}
+	owner, repo, err := cf.repoName()
+	if err != nil {
+		return nil, nil, err
+	}
+	if cf.appID != 0 {
+		return nil, nil, fmt.Errorf("-app-id can only be used with -provider github")
+	}
+	apiURL := cf.apiURL
+	var provider release.ReleaseProvider
+	var client *release.Client
+	switch cf.provider {
+	case providerGitea:
+		if apiURL == release.DefaultAPIURL {
+			return nil, nil, fmt.Errorf("-provider gitea needs -api-url set to the Gitea instance")
+		}
+		gitea := release.NewGiteaClient(apiURL, owner, repo, cf.pat)
+		provider, client = gitea, gitea.Client
+	case providerGitLab:
+		if apiURL == release.DefaultAPIURL {
+			apiURL = gitlabDefaultURL
+		}
+		gitlab := release.NewGitLabClient(apiURL, owner, repo, cf.pat)
+		provider, client = gitlab, gitlab.Client
+	default:
+		return nil, nil, fmt.Errorf("unsupported -provider %q, expected github, gitea or gitlab", cf.provider)
+	}
+	if cf.accept != release.DefaultAccept {
+		client.Accept = cf.accept
+	}
+	if err := cf.configureClient(client); err != nil {
+		return nil, nil, err
+	}
+	return provider, client, nil
+}
+
+// checkProvider returns an error if the create flags use anything that the -provider does not
+// support. Everything is supported on GitHub.
+func checkProvider(cf *clientFlags, uf *uploadFlags, f *createFlags) error {
+	switch cf.provider {
+	case providerGitHub:
+		return nil
+	case providerGitea, providerGitLab:
+	default:
+		return fmt.Errorf("unsupported -provider %q, expected github, gitea or gitlab", cf.provider)
+	}
+	if len(cf.repos) > 1 {
+		return fmt.Errorf("-repo can only be given once with -provider %s", cf.provider)
+	}
+	unsupported := []struct {
+		name string
+		set  bool
+	}{
+		{"bump", f.bump != ""},
+		{"create-tag", f.createTag},
+		{"generate-notes", f.generateNotes},
+		{"generate-notes-from-prs", f.generateNotesFromPRs},
+		{"milestone", f.milestone != ""},
+		{"discussion-category", f.discussionCategory != ""},
+		{"make-latest", *f.makeLatest != ""},
+		{"publish-after-upload", f.publishAfterUpload},
+		{"update-existing", f.updateExisting},
+		{"mirror", len(f.mirrors) > 0},
+		{"image", len(f.images) > 0},
+		{"homebrew", f.homebrew},
+		{"scoop", f.scoop},
+		{"publish-packages", uf.publishPkgs},
+		{"resume", uf.resume},
+		{"state-dir", uf.stateDir != ""},
+	}
+	if cf.provider == providerGitLab {
+		unsupported = append(unsupported, []struct {
+			name string
+			set  bool
+		}{{"draft", f.draft}, {"prerelease", f.prerelease || f.autoPrerelease}}...)
+	}
+	var names []string
+	for _, u := range unsupported {
+		if u.set {
+			names = append(names, "-"+u.name)
+		}
+	}
+	if len(names) > 0 {
+		return fmt.Errorf("%s cannot be used with -provider %s", strings.Join(names, ", "), cf.provider)
+	}
+	return nil
+}
+
+// createOnProvider creates the release on a Gitea or GitLab provider and uploads the assets to it
+// one at a time. The release is nil for a dry run.
+func (f *createFlags) createOnProvider(ctx context.Context, cf *clientFlags, uf *uploadFlags, assets []release.AssetUpload) (*release.Release, error) {
+	provider, client, err := cf.newProvider(ctx)
+	if err != nil {
+		return nil, err
+	}
+	tag := f.tag
+	if !strings.HasPrefix(tag, f.tagPrefix) {
+		tag = f.tagPrefix + tag
+	}
+	name, body := f.name, f.body
+	data := newTemplateData(ctx, client, tag, f.targetCommitish)
+	data.Component = f.component
+	if name, err = executeTemplate("name", name, data); err != nil {
+		return nil, err
+	}
+	if body, err = executeTemplate("body", body, data); err != nil {
+		return nil, err
+	}
+	if len(f.localized) > 0 {
+		var notesAssets []release.AssetUpload
+		var cleanup func()
+		body, notesAssets, cleanup, err = localizedBody(body, f.localized, f.localizedNotesAs, data)
+		defer cleanup()
+		if err != nil {
+			return nil, err
+		}
+		assets = append(append([]release.AssetUpload{}, assets...), notesAssets...)
+	}
+	if f.changelog != "" {
+		notes, err := readChangelogSection(f.changelog, releaseVersion(tag))
+		if err != nil {
+			return nil, withExitCode(exitValidation, err)
+		}
+		body = joinBody(body, notes)
+	}
+	if f.generateNotesFromGit {
+		notes, err := gitNotes(tag, f.previousTag)
+		if err != nil {
+			return nil, fmt.Errorf("generating release notes: %v", err)
+		}
+		body = joinBody(body, notes)
+	}
+	if len(uf.sboms) > 0 {
+		body = joinBody(body, sbomNotes(uf.sboms))
+	}
+	if len(uf.splits) > 0 {
+		body = joinBody(body, splitNotes(uf.splits))
+	}
+	isPrerelease := f.prerelease
+	if f.autoPrerelease {
+		isPrerelease = detectPrerelease(tag, isPrerelease)
+	}
+	req := &release.CreateReleaseRequest{
+		TagName:         tag,
+		TargetCommitish: f.targetCommitish,
+		Name:            name,
+		Body:            body,
+		Draft:           f.draft,
+		PreRelease:      isPrerelease,
+	}
+
+	existing, err := provider.FindReleaseByTag(ctx, tag)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil {
+		return nil, withExitCode(exitTagConflict, fmt.Errorf("a release already exists for tag %s on %s", tag, cf.provider))
+	}
+	if *f.dryRun {
+		fmt.Printf("create %s release in %s/%s at %s\n", cf.provider, client.User, client.Repo, client.APIURL)
+		payload, err := json.MarshalIndent(req, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		fmt.Printf("%s\n", payload)
+		for _, asset := range assets {
+			fmt.Printf("upload %s as %s\n", asset.Path, asset.Name)
+		}
+		return nil, nil
+	}
+
+	rel, err := provider.CreateRelease(ctx, req)
+	if err != nil {
+		return nil, fmt.Errorf("creating release: %v", err)
+	}
+	log.Printf("info: created %s release for tag %s", cf.provider, rel.TagName)
+	results, err := uploadToProvider(ctx, provider, rel, assets, uf)
+	if outputErr := writeReleaseOutput(*f.output, rel, results); outputErr != nil {
+		return rel, outputErr
+	}
+	return rel, err
+}
+
+// uploadToProvider uploads the assets to the release one at a time, attempting every asset unless
+// fail-fast is set. The result of every asset is returned in the same order as the assets.
+func uploadToProvider(ctx context.Context, provider release.ReleaseProvider, rel *release.Release, assets []release.AssetUpload, uf *uploadFlags) ([]assetResult, error) {
+	results := make([]assetResult, len(assets))
+	for i, asset := range assets {
+		results[i] = assetResult{Name: asset.Name, Path: asset.Path, State: assetSkipped}
+	}
+	uploaded, failed := 0, 0
+	for i, asset := range assets {
+		if ctx.Err() != nil {
+			log.Printf("error: aborting remaining uploads: %v", ctx.Err())
+			return results, ctx.Err()
+		}
+		if uf.failFast && failed > 0 {
+			log.Printf("error: aborting remaining uploads because of -fail-fast")
+			break
+		}
+		uploadCtx, cancel := ctx, context.CancelFunc(func() {})
+		if uf.uploadTimeout > 0 {
+			uploadCtx, cancel = context.WithTimeout(ctx, uf.uploadTimeout)
+		}
+		up, err := provider.UploadAsset(uploadCtx, rel, asset)
+		cancel()
+		if err != nil {
+			log.Printf("warn: uploading an asset: %v", err)
+			failed++
+		} else {
+			uploaded++
+		}
+		results[i].set(up, err)
+	}
+	log.Printf("info: uploaded %d of %d asset(s)", uploaded, len(assets))
+	if failed > 0 {
+		if !uf.failPartial {
+			log.Printf("warn: the release is missing %d asset(s), not failing because of -fail-on-partial-upload=false", failed)
+			return results, nil
+		}
+		return results, withExitCode(exitPartialUpload, fmt.Errorf("%d asset(s) failed to upload", failed))
+	}
+	return results, nil
+}
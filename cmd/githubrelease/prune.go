@@ -0,0 +1,205 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/imitablerabbit/githubrelease/pkg/release"
+)
+
+// pruneRules decide which releases are deleted by prune.
+type pruneRules struct {
+	keepLast        int
+	keepDays        int
+	prereleasesOnly bool
+	draftsOnly      bool
+	tagPattern      string
+}
+
+// candidate returns whether the release is covered by the rules at all. Releases that are not
+// candidates are never deleted.
+func (pr *pruneRules) candidate(r release.Release) (bool, error) {
+	if pr.tagPattern != "" {
+		match, err := filepath.Match(pr.tagPattern, r.TagName)
+		if err != nil {
+			return false, fmt.Errorf("invalid -tag-pattern %s: %v", pr.tagPattern, err)
+		}
+		if !match {
+			return false, nil
+		}
+	}
+	if pr.prereleasesOnly || pr.draftsOnly {
+		return pr.prereleasesOnly && r.PreRelease || pr.draftsOnly && r.Draft, nil
+	}
+	return true, nil
+}
+
+// expired returns the candidate releases that the retention rules do not keep. The newest
+// keepLast releases are kept, as are any created in the last keepDays days.
+func (pr *pruneRules) expired(releases []release.Release, now time.Time) ([]release.Release, error) {
+	var candidates []release.Release
+	for _, r := range releases {
+		ok, err := pr.candidate(r)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			continue
+		}
+		candidates = append(candidates, r)
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].CreatedAt.After(candidates[j].CreatedAt)
+	})
+
+	cutoff := now.AddDate(0, 0, -pr.keepDays)
+	var expired []release.Release
+	for i, c := range candidates {
+		if i < pr.keepLast || pr.keepDays > 0 && c.CreatedAt.After(cutoff) {
+			continue
+		}
+		expired = append(expired, c)
+	}
+	return expired, nil
+}
+
+// runPrune deletes old releases according to the retention rules, in the repo or in every repo
+// of the organization with -org.
+func runPrune(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("prune", flag.ContinueOnError)
+	cf := addClientFlags(fs)
+	cf.writesReleases = true
+	pr := &pruneRules{}
+	fs.IntVar(&pr.keepLast, "keep-last", 0, "Keep the newest N matching releases")
+	fs.IntVar(&pr.keepDays, "keep-days", 0, "Keep matching releases created in the last N days")
+	fs.BoolVar(&pr.prereleasesOnly, "prereleases-only", false, "Only delete pre-releases")
+	fs.BoolVar(&pr.draftsOnly, "drafts-only", false, "Only delete drafts")
+	fs.StringVar(&pr.tagPattern, "tag-pattern", "", "Only delete releases whose tag matches this glob pattern, e.g. nightly-*")
+	deleteTags := fs.Bool("delete-tags", false, "Also delete the git tags of the deleted releases")
+	dryRun := addDryRunFlag(fs)
+	of := addOrgFlags(fs)
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if err := of.check(cf); err != nil {
+		return err
+	}
+	// Without a retention rule every matching release would be deleted, make sure that is
+	// what was asked for.
+	set := flagsSet(fs)
+	if !set["keep-last"] && !set["keep-days"] {
+		return fmt.Errorf("at least one of -keep-last or -keep-days is required, use -keep-last 0 to delete every matching release")
+	}
+
+	ctx, cancel := cf.withTimeout(ctx)
+	defer cancel()
+	if of.org != "" {
+		return pruneOrg(ctx, of, cf, pr, *deleteTags, *dryRun)
+	}
+	client, err := cf.newClient(ctx)
+	if err != nil {
+		return err
+	}
+	_, err = pr.prune(ctx, client, *deleteTags, *dryRun)
+	return err
+}
+
+// pruneResult is the outcome of pruning a repo, for the report of prune -org.
+type pruneResult struct {
+	Repo     string `json:"repo"`
+	Releases int    `json:"releases"`
+	Deleted  int    `json:"deleted"`
+	Error    string `json:"error,omitempty"`
+}
+
+// prune deletes the releases in the repo of the client that the retention rules do not keep,
+// and their tags with deleteTags. In dry-run mode the requests are printed instead.
+func (pr *pruneRules) prune(ctx context.Context, client *release.Client, deleteTags, dryRun bool) (pruneResult, error) {
+	result := pruneResult{Repo: client.User + "/" + client.Repo}
+	releases, err := client.ListAllReleases(ctx)
+	if err != nil {
+		return result, err
+	}
+	result.Releases = len(releases)
+	expired, err := pr.expired(releases, time.Now())
+	if err != nil {
+		return result, err
+	}
+	log.Printf("info: %d of %d release(s) in %s will be deleted", len(expired), len(releases), result.Repo)
+
+	p := newPlan(client)
+	for _, r := range expired {
+		if dryRun {
+			if err := p.request("DELETE", fmt.Sprintf("releases/%d", r.ID), nil); err != nil {
+				return result, err
+			}
+			if deleteTags {
+				if err := p.request("DELETE", "git/refs/tags/"+r.TagName, nil); err != nil {
+					return result, err
+				}
+			}
+			continue
+		}
+		// Deleting a release also deletes its assets.
+		if err := client.DeleteRelease(withAuditNote(ctx, auditNote{tag: r.TagName}), r.ID); err != nil {
+			return result, fmt.Errorf("deleting release %s: %v", r.TagName, err)
+		}
+		result.Deleted++
+		log.Printf("info: deleted release %d for tag %s created at %s", r.ID, r.TagName, r.CreatedAt.Format(time.RFC3339))
+		if deleteTags {
+			if err := client.DeleteTag(ctx, r.TagName); err != nil {
+				return result, fmt.Errorf("deleting tag %s: %v", r.TagName, err)
+			}
+			log.Printf("info: deleted tag %s", r.TagName)
+		}
+	}
+	return result, nil
+}
+
+// pruneOrg prunes every repo of the organization and prints a report of the releases deleted in
+// each of them.
+func pruneOrg(ctx context.Context, of *orgFlags, cf *clientFlags, pr *pruneRules, deleteTags, dryRun bool) error {
+	if dryRun {
+		// The plans of the repos are printed one after the other rather than mixed together.
+		serial := *of
+		serial.concurrency = 1
+		of = &serial
+	}
+	var mu sync.Mutex
+	var results []pruneResult
+	err := of.forEach(ctx, cf, func(ctx context.Context, repo string, client *release.Client) error {
+		result, err := pr.prune(ctx, client, deleteTags, dryRun)
+		if err != nil {
+			result.Error = err.Error()
+		}
+		mu.Lock()
+		results = append(results, result)
+		mu.Unlock()
+		return err
+	})
+	if dryRun {
+		return err
+	}
+	sort.Slice(results, func(i, j int) bool { return results[i].Repo < results[j].Repo })
+	var releases, deleted int
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "REPO\tRELEASES\tDELETED\tERROR")
+	for _, r := range results {
+		fmt.Fprintf(w, "%s\t%d\t%d\t%s\n", r.Repo, r.Releases, r.Deleted, r.Error)
+		releases += r.Releases
+		deleted += r.Deleted
+	}
+	fmt.Fprintf(w, "TOTAL\t%d\t%d\t\n", releases, deleted)
+	if flushErr := w.Flush(); flushErr != nil {
+		return flushErr
+	}
+	return err
+}
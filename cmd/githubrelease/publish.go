@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+
+	"github.com/imitablerabbit/githubrelease/pkg/release"
+)
+
+// runPublish publishes a draft release.
+func runPublish(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("publish", flag.ContinueOnError)
+	cf := addClientFlags(fs)
+	cf.writesReleases = true
+	rf := addReleaseFlags(fs)
+	makeLatest := addMakeLatestFlag(fs)
+	dryRun := addDryRunFlag(fs)
+	notifyFlag := addNotifyFlag(fs)
+	hooksFlag := addHooksFlag(fs)
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if err := checkMakeLatest(*makeLatest); err != nil {
+		return err
+	}
+
+	ctx, cancel := cf.withTimeout(ctx)
+	defer cancel()
+	client, err := cf.newClient(ctx)
+	if err != nil {
+		return err
+	}
+	rel, err := rf.getRelease(ctx, client)
+	if err != nil {
+		return err
+	}
+	if !rel.Draft {
+		return fmt.Errorf("release %d for tag %s is already published", rel.ID, rel.TagName)
+	}
+	hks, err := loadHooks(fs, *hooksFlag)
+	if err != nil {
+		return err
+	}
+	if *dryRun {
+		draft := false
+		p := newPlan(client)
+		if err := p.request("PATCH", fmt.Sprintf("releases/%d", rel.ID), &release.EditReleaseRequest{Draft: &draft, MakeLatest: *makeLatest}); err != nil {
+			return err
+		}
+		p.hooks(hks, hookAfterPublish)
+		return nil
+	}
+	published, err := publishRelease(ctx, client, rel, *makeLatest)
+	if err == nil {
+		rel = published
+		err = hks.run(ctx, hookAfterPublish, hookRun{command: "publish", repo: client.User + "/" + client.Repo, rel: rel})
+	}
+	if err != nil {
+		hks.failed(hookRun{command: "publish", repo: client.User + "/" + client.Repo, rel: rel, err: err})
+	}
+	if *notifyFlag {
+		notify(fs, cf, newNotifyData("publish", client.User+"/"+client.Repo, rel.TagName, rel, nil, err))
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Println(rel.HTMLURL)
+	return nil
+}
@@ -0,0 +1,266 @@
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/imitablerabbit/githubrelease/pkg/release"
+)
+
+// remoteAsset is an asset given as an http or https URL, which is streamed from its origin to the
+// upload instead of being read from disk. The size and sha256 of what was streamed are kept to
+// check the upload against, as there is no file to check it with.
+type remoteAsset struct {
+	expected string
+	size     int64
+	sha256   string
+}
+
+// remoteAssets are the remote assets of the command by URL.
+var (
+	remoteAssetsMu sync.Mutex
+	remoteAssets   = map[string]*remoteAsset{}
+)
+
+// isRemoteAsset reports whether the asset path is a URL rather than a file.
+func isRemoteAsset(path string) bool {
+	return strings.HasPrefix(path, "https://") || strings.HasPrefix(path, "http://")
+}
+
+// displayURL returns the URL of a remote asset for logging, without the password and query, which
+// can hold the credentials of a presigned URL.
+func displayURL(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "<invalid url>"
+	}
+	if u.RawQuery != "" {
+		u.RawQuery = "..."
+	}
+	return u.Redacted()
+}
+
+// expandRemoteAsset returns the asset for a URL, named after the last element of its path.
+func expandRemoteAsset(rawURL string) ([]release.AssetUpload, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	name := path.Base(u.Path)
+	if name == "." || name == "/" {
+		return nil, fmt.Errorf("cannot name an asset after %s, give the name as url#name", displayURL(rawURL))
+	}
+	return []release.AssetUpload{{Path: rawURL, Name: name}}, nil
+}
+
+// prepareRemoteAssets records the remote assets along with their expected sha256 from
+// -asset-sha256. The flags that need the assets on disk cannot be used with remote assets.
+func (uf *uploadFlags) prepareRemoteAssets(assets []release.AssetUpload) error {
+	expected := map[string]string{}
+	for _, value := range uf.assetSHA256 {
+		name, digest, ok := strings.Cut(value, "=")
+		digest = strings.TrimPrefix(digest, "sha256:")
+		if _, err := hex.DecodeString(digest); !ok || err != nil || len(digest) != 64 {
+			return fmt.Errorf("invalid -asset-sha256 %q, expected name=sha256", value)
+		}
+		expected[name] = strings.ToLower(digest)
+	}
+	remoteAssetsMu.Lock()
+	defer remoteAssetsMu.Unlock()
+	var remote []release.AssetUpload
+	for _, asset := range assets {
+		if !isRemoteAsset(asset.Path) {
+			continue
+		}
+		remote = append(remote, asset)
+		remoteAssets[asset.Path] = &remoteAsset{expected: expected[asset.Name]}
+		delete(expected, asset.Name)
+	}
+	for name := range expected {
+		return fmt.Errorf("-asset-sha256 is for %s, which is not a remote asset", name)
+	}
+	return checkRemoteFeatures(remote, []flagUse{
+		{"compress", uf.compress != "" && uf.compress != compressNone},
+		{"recompress", uf.recompress},
+		{"checksums", uf.checksums != ""},
+		{"sign", uf.sign != ""},
+		{"provenance", uf.provenance},
+		{"release-manifest", uf.relManifest},
+		{"skip-unchanged", uf.skipUnchanged},
+		{"resume", uf.resume},
+		{"state-dir", uf.stateDir != ""},
+		{"publish-packages", uf.publishPkgs},
+	})
+}
+
+// flagUse is a flag and whether it was used, for rejecting flags that do not work together.
+type flagUse struct {
+	name string
+	set  bool
+}
+
+// checkRemoteFeatures returns an error if there are remote assets and any of the flags, which need
+// the assets on disk, are used.
+func checkRemoteFeatures(remote []release.AssetUpload, flags []flagUse) error {
+	if len(remote) == 0 {
+		return nil
+	}
+	var used []string
+	for _, f := range flags {
+		if f.set {
+			used = append(used, "-"+f.name)
+		}
+	}
+	if len(used) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%s cannot be used with assets streamed from a URL such as %s, download them first", strings.Join(used, ", "), displayURL(remote[0].Path))
+}
+
+// remoteAssetsIn returns the assets that are streamed from a URL.
+func remoteAssetsIn(assets []release.AssetUpload) []release.AssetUpload {
+	var remote []release.AssetUpload
+	for _, asset := range assets {
+		if isRemoteAsset(asset.Path) {
+			remote = append(remote, asset)
+		}
+	}
+	return remote
+}
+
+// assetSize returns the size of the asset, which for a remote asset is the size that was streamed
+// to the release.
+func assetSize(asset release.AssetUpload) (int64, error) {
+	if !isRemoteAsset(asset.Path) {
+		info, err := os.Stat(asset.Path)
+		if err != nil {
+			return 0, err
+		}
+		return info.Size(), nil
+	}
+	remote := streamedAsset(asset.Path)
+	if remote == nil || remote.sha256 == "" {
+		return 0, fmt.Errorf("%s has not been streamed from %s", asset.Name, displayURL(asset.Path))
+	}
+	return remote.size, nil
+}
+
+// streamedAsset returns the remote asset with the URL, or nil if it has not been prepared.
+func streamedAsset(rawURL string) *remoteAsset {
+	remoteAssetsMu.Lock()
+	defer remoteAssetsMu.Unlock()
+	return remoteAssets[rawURL]
+}
+
+// uploadRemoteAsset streams the asset from its URL to the release. The origin must send the
+// Content-Length, which GitHub needs before the upload starts. The sha256 of the stream is checked
+// once it has all been read, and the upload is failed before it completes if it does not match.
+func uploadRemoteAsset(ctx context.Context, c *release.Client, rel *release.Release, asset release.AssetUpload) (*release.Asset, error) {
+	httpClient := c.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	get := func() (*http.Response, error) {
+		request, err := http.NewRequestWithContext(ctx, http.MethodGet, asset.Path, nil)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := httpClient.Do(request)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+			return nil, fmt.Errorf("non 200 response: %s", resp.Status)
+		}
+		return resp, nil
+	}
+	log.Printf("info: streaming %s from %s", asset.Name, displayURL(asset.Path))
+	resp, err := get()
+	if err != nil {
+		return nil, fmt.Errorf("downloading %s: %v", asset.Name, err)
+	}
+	if resp.ContentLength < 0 {
+		resp.Body.Close()
+		return nil, fmt.Errorf("downloading %s: the response has no Content-Length, which is needed to stream it to GitHub", asset.Name)
+	}
+	if asset.ContentType == "" {
+		if contentType := resp.Header.Get("Content-Type"); contentType != "" && contentType != "application/octet-stream" {
+			asset.ContentType = contentType
+		} else {
+			asset.ContentType = release.ContentType(asset.Name)
+		}
+	}
+
+	remote := streamedAsset(asset.Path)
+	if remote == nil {
+		remote = &remoteAsset{}
+	}
+	size := resp.ContentLength
+	first := resp
+	open := func() (io.ReadCloser, error) {
+		resp := first
+		if first != nil {
+			first = nil
+		} else {
+			var err error
+			if resp, err = get(); err != nil {
+				return nil, err
+			}
+		}
+		if resp.ContentLength != size {
+			resp.Body.Close()
+			return nil, fmt.Errorf("%s changed size from %d to %d bytes between attempts", asset.Name, size, resp.ContentLength)
+		}
+		h, _ := release.NewHash("sha256")
+		return &verifyingReader{ReadCloser: resp.Body, name: asset.Name, hash: h, size: size, remote: remote}, nil
+	}
+	uploaded, err := c.UploadAssetStream(ctx, rel, asset, size, open)
+	if first != nil {
+		first.Body.Close()
+	}
+	return uploaded, err
+}
+
+// verifyingReader hashes a remote asset as it is streamed. Once it has all been read the size and
+// sha256 are checked, and an error is returned instead of io.EOF if they do not match so that the
+// upload is not completed.
+type verifyingReader struct {
+	io.ReadCloser
+	name   string
+	hash   hash.Hash
+	n      int64
+	size   int64
+	remote *remoteAsset
+}
+
+func (r *verifyingReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.hash.Write(p[:n])
+	r.n += int64(n)
+	if err != io.EOF {
+		return n, err
+	}
+	if r.n != r.size {
+		return n, fmt.Errorf("%s is %d bytes, the origin said it would be %d", r.name, r.n, r.size)
+	}
+	digest := hex.EncodeToString(r.hash.Sum(nil))
+	if r.remote.expected != "" && digest != r.remote.expected {
+		return n, fmt.Errorf("sha256 of %s is %s, expected %s", r.name, digest, r.remote.expected)
+	}
+	remoteAssetsMu.Lock()
+	r.remote.size, r.remote.sha256 = r.n, digest
+	remoteAssetsMu.Unlock()
+	log.Printf("debug: streamed %s, %d bytes with sha256 %s", r.name, r.n, digest)
+	return n, err
+}
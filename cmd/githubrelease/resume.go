@@ -0,0 +1,284 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/imitablerabbit/githubrelease/pkg/release"
+)
+
+// uploadState is the state file of an upload session. It records every asset that has been
+// uploaded so that an interrupted session can be continued with -resume instead of starting
+// again from the first asset.
+type uploadState struct {
+	mu   sync.Mutex
+	path string
+
+	Repo      string                      `json:"repo,omitempty"`
+	ReleaseID int                         `json:"release_id"`
+	Tag       string                      `json:"tag"`
+	Assets    map[string]uploadStateAsset `json:"assets"`
+}
+
+// uploadStateAsset is an asset that was uploaded completely.
+type uploadStateAsset struct {
+	Path   string `json:"path"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+	ID     int    `json:"id"`
+}
+
+// loadUploadState reads the state file for the release. With resume set the state of a previous
+// session is loaded, which must be for the same release. Otherwise a new session is started and
+// any old state is overwritten. nil is returned if path is empty.
+func loadUploadState(path string, rel *release.Release, resume bool) (*uploadState, error) {
+	if path == "" {
+		if resume {
+			return nil, fmt.Errorf("-resume requires a -state-file")
+		}
+		return nil, nil
+	}
+	state := &uploadState{path: path, ReleaseID: rel.ID, Tag: rel.TagName, Assets: map[string]uploadStateAsset{}}
+	if !resume {
+		return state, nil
+	}
+	old, err := readUploadState(path)
+	if err != nil {
+		return nil, err
+	}
+	if old == nil {
+		log.Printf("warn: there is no upload state in %s to resume, uploading every asset", path)
+		return state, nil
+	}
+	state = old
+	if state.ReleaseID != rel.ID {
+		return nil, fmt.Errorf("upload state %s is for release %d (%s), not release %d (%s)", path, state.ReleaseID, state.Tag, rel.ID, rel.TagName)
+	}
+	if state.Assets == nil {
+		state.Assets = map[string]uploadStateAsset{}
+	}
+	log.Printf("info: resuming upload session for %s with %d asset(s) already uploaded", rel.TagName, len(state.Assets))
+	return state, nil
+}
+
+// journalPath returns the path of the journal of the release for the tag in -state-dir. It is
+// named after the repo and tag rather than the release id, so that create can find the release
+// of a run that crashed before it is known.
+func journalPath(dir, owner, repo, tag string) string {
+	name := strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '.' || r == '-' {
+			return r
+		}
+		return '_'
+	}, owner+"_"+repo+"_"+tag)
+	return filepath.Join(dir, name+".json")
+}
+
+// openUploadState returns the state of the upload session to the release and whether it resumes
+// an earlier one. With -state-dir the release has a journal of its own, and a journal left by a
+// session that did not finish is resumed without -resume. A journal of an older release for the
+// same tag, which has since been deleted, is started again. The state is saved straight away so
+// that the release can be found if the session crashes before any asset is uploaded.
+func (uf *uploadFlags) openUploadState(c *release.Client, rel *release.Release) (*uploadState, bool, error) {
+	path, resume := uf.stateFile, uf.resume
+	if uf.stateDir != "" {
+		if err := os.MkdirAll(uf.stateDir, 0o755); err != nil {
+			return nil, false, fmt.Errorf("creating -state-dir: %v", err)
+		}
+		path = journalPath(uf.stateDir, c.User, c.Repo, rel.TagName)
+		if old, err := readUploadState(path); err != nil {
+			return nil, false, err
+		} else if old != nil && old.ReleaseID != rel.ID {
+			log.Printf("warn: the journal %s is for release %d, which is no longer the release for %s, starting a new one", path, old.ReleaseID, rel.TagName)
+		} else if old != nil {
+			resume = true
+		}
+	}
+	state, err := loadUploadState(path, rel, resume)
+	if err != nil || state == nil {
+		return state, resume, err
+	}
+	state.Repo = c.User + "/" + c.Repo
+	state.mu.Lock()
+	defer state.mu.Unlock()
+	return state, resume, state.save()
+}
+
+// readUploadState reads the state file at path, or returns nil if there is none.
+func readUploadState(path string) (*uploadState, error) {
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading upload state: %v", err)
+	}
+	state := &uploadState{path: path}
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, fmt.Errorf("parsing upload state %s: %v", path, err)
+	}
+	return state, nil
+}
+
+// journaledRelease returns the release in the journal for the tag in -state-dir, if a session
+// that did not finish left one and the release still exists. create continues with it instead
+// of failing because the release already exists.
+func (uf *uploadFlags) journaledRelease(ctx context.Context, c *release.Client, tag string) (*release.Release, error) {
+	if uf.stateDir == "" {
+		return nil, nil
+	}
+	state, err := readUploadState(journalPath(uf.stateDir, c.User, c.Repo, tag))
+	if err != nil || state == nil {
+		return nil, err
+	}
+	rel, err := c.GetRelease(ctx, state.ReleaseID)
+	if errors.Is(err, release.ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if rel.TagName != tag {
+		return nil, nil
+	}
+	log.Printf("info: continuing release %d for %s from the journal of a session that did not finish", rel.ID, tag)
+	return rel, nil
+}
+
+// record adds the uploaded asset to the state and saves it, so that it is skipped if the session
+// has to be resumed. A state file that cannot be written is only logged, as the upload itself
+// succeeded.
+func (s *uploadState) record(asset release.AssetUpload, uploaded *release.Asset) {
+	if s == nil {
+		return
+	}
+	var entry uploadStateAsset
+	if remote := streamedAsset(asset.Path); remote != nil {
+		entry = uploadStateAsset{Path: displayURL(asset.Path), Size: remote.size, SHA256: remote.sha256}
+	} else {
+		info, err := os.Stat(asset.Path)
+		if err != nil {
+			log.Printf("warn: recording %s in the upload state: %v", asset.Name, err)
+			return
+		}
+		digest, err := release.FileDigest(asset.Path, "sha256")
+		if err != nil {
+			log.Printf("warn: recording %s in the upload state: %v", asset.Name, err)
+			return
+		}
+		entry = uploadStateAsset{Path: asset.Path, Size: info.Size(), SHA256: digest}
+	}
+	if uploaded != nil {
+		entry.ID = uploaded.ID
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Assets[asset.Name] = entry
+	if err := s.save(); err != nil {
+		log.Printf("warn: %v", err)
+	}
+}
+
+// save writes the state file. s.mu must be held.
+func (s *uploadState) save() error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return fmt.Errorf("writing upload state: %v", err)
+	}
+	// Write to a temporary file first so that an interrupted write never corrupts the state.
+	tmp := s.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0o644); err != nil {
+		return fmt.Errorf("writing upload state: %v", err)
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		return fmt.Errorf("writing upload state: %v", err)
+	}
+	return nil
+}
+
+// finish removes the state file once every asset has been uploaded.
+func (s *uploadState) finish() {
+	if s == nil {
+		return
+	}
+	if err := os.Remove(s.path); err != nil && !os.IsNotExist(err) {
+		log.Printf("warn: removing upload state: %v", err)
+	}
+}
+
+// resumeAssets compares the assets with the state of the previous session and the assets on the
+// release. Assets that were uploaded completely, still match the local file and are intact on the
+// release are skipped. Any other asset already on the release is a partial or corrupted upload,
+// or the file has changed since, so it is deleted to be uploaded again.
+func (s *uploadState) resumeAssets(ctx context.Context, c *release.Client, rel *release.Release, assets []release.AssetUpload) (map[string]bool, error) {
+	existing, err := replacedAssets(ctx, c, rel, assets)
+	if err != nil {
+		return nil, err
+	}
+	remote := map[string]*release.Asset{}
+	for i := range existing {
+		remote[existing[i].Name] = &existing[i]
+	}
+
+	skip := map[string]bool{}
+	for _, asset := range assets {
+		r := remote[asset.Name]
+		if r == nil {
+			continue
+		}
+		problem, err := s.resumeProblem(asset, r)
+		if err != nil {
+			return nil, err
+		}
+		if problem == "" {
+			log.Printf("info: skipping %s, it was uploaded by the previous session", asset.Name)
+			skip[asset.Name] = true
+			continue
+		}
+		log.Printf("warn: %s on the release %s, uploading it again", asset.Name, problem)
+		if err := c.DeleteAsset(withAuditNote(ctx, auditNote{action: "asset.replaced", tag: rel.TagName, asset: asset.Name}), r.ID); err != nil {
+			return nil, fmt.Errorf("deleting asset %s: %v", asset.Name, err)
+		}
+	}
+	return skip, nil
+}
+
+// resumeProblem describes why the asset on the release cannot be kept, or returns an empty string
+// if it can.
+func (s *uploadState) resumeProblem(asset release.AssetUpload, remote *release.Asset) (string, error) {
+	recorded, ok := s.Assets[asset.Name]
+	if !ok {
+		return "was not uploaded completely", nil
+	}
+	if problem, err := uploadProblem(asset, remote); err != nil || problem != "" {
+		return "is " + problem, err
+	}
+	info, err := os.Stat(asset.Path)
+	if err != nil {
+		return "", err
+	}
+	if info.Size() != recorded.Size {
+		return "is from a different version of the file", nil
+	}
+	digest, err := release.FileDigest(asset.Path, "sha256")
+	if err != nil {
+		return "", err
+	}
+	if digest != recorded.SHA256 {
+		return "is from a different version of the file", nil
+	}
+	// Newer GitHub versions return the digest of the asset, which catches corruption that does
+	// not change the size.
+	if strings.HasPrefix(remote.Digest, "sha256:") && strings.TrimPrefix(remote.Digest, "sha256:") != digest {
+		return "does not match the sha256 of the file", nil
+	}
+	return "", nil
+}
@@ -0,0 +1,272 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/imitablerabbit/githubrelease/pkg/release"
+)
+
+// The media types of the SBOM formats, see https://spdx.dev and https://cyclonedx.org.
+const (
+	spdxContentType      = "application/spdx+json"
+	cyclonedxContentType = "application/vnd.cyclonedx+json"
+)
+
+// sbomFileNames are the names of the generated SBOM assets.
+var sbomFileNames = map[string]string{
+	"spdx":      "sbom.spdx.json",
+	"cyclonedx": "sbom.cdx.json",
+}
+
+// goModule is a module from go list -m -json.
+type goModule struct {
+	Path    string
+	Version string
+	Main    bool
+	Replace *goModule
+}
+
+// purl returns the package URL of the module, which SBOM tools use to identify it.
+func (m goModule) purl() string {
+	if m.Version == "" {
+		return "pkg:golang/" + m.Path
+	}
+	return "pkg:golang/" + m.Path + "@" + m.Version
+}
+
+// goModules lists the main module in dir and every module in its build list. Replaced modules are
+// reported as their replacement, unless it is a local directory without a version.
+func goModules(dir string) ([]goModule, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command("go", "list", "-m", "-json", "all")
+	cmd.Dir = dir
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("go list -m -json all: %v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	var modules []goModule
+	dec := json.NewDecoder(&stdout)
+	for {
+		var m goModule
+		if err := dec.Decode(&m); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("reading go list output: %v", err)
+		}
+		if m.Replace != nil && m.Replace.Version != "" {
+			m.Path, m.Version = m.Replace.Path, m.Replace.Version
+		}
+		modules = append(modules, m)
+	}
+	if len(modules) == 0 || !modules[0].Main {
+		return nil, fmt.Errorf("no Go module found in %s", dir)
+	}
+	return modules, nil
+}
+
+// generateSBOM writes an SBOM of the Go module in moduleDir in the format, spdx or cyclonedx, to a
+// temporary directory and returns it as an asset to upload alongside the others. The caller
+// should remove the returned directory.
+func generateSBOM(format, moduleDir string) (release.AssetUpload, string, error) {
+	name, ok := sbomFileNames[format]
+	if !ok {
+		return release.AssetUpload{}, "", fmt.Errorf("unsupported -sbom %q, expected spdx or cyclonedx", format)
+	}
+	modules, err := goModules(moduleDir)
+	if err != nil {
+		return release.AssetUpload{}, "", err
+	}
+	var doc interface{}
+	contentType := spdxContentType
+	if format == "cyclonedx" {
+		doc, contentType = cyclonedxBOM(modules, time.Now()), cyclonedxContentType
+	} else {
+		doc = spdxDocument(modules, time.Now())
+	}
+	b, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return release.AssetUpload{}, "", err
+	}
+
+	dir, err := ioutil.TempDir("", "githubrelease-sbom")
+	if err != nil {
+		return release.AssetUpload{}, "", err
+	}
+	path := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(path, append(b, '\n'), 0644); err != nil {
+		os.RemoveAll(dir)
+		return release.AssetUpload{}, "", err
+	}
+	return release.AssetUpload{Path: path, Name: name, ContentType: contentType}, dir, nil
+}
+
+// sbomFileAsset returns the pre-built SBOM file as an asset, with the media type of its format.
+// JSON documents are identified by their contents, anything else by the extension.
+func sbomFileAsset(path string) (release.AssetUpload, error) {
+	asset := release.AssetUpload{Path: path, Name: filepath.Base(path)}
+	if _, err := os.Stat(path); err != nil {
+		return asset, fmt.Errorf("invalid -sbom-file: %v", err)
+	}
+	name := strings.ToLower(asset.Name)
+	switch {
+	case strings.HasSuffix(name, ".json"):
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			return asset, fmt.Errorf("reading -sbom-file: %v", err)
+		}
+		var doc struct {
+			SPDXVersion string `json:"spdxVersion"`
+			BOMFormat   string `json:"bomFormat"`
+		}
+		if err := json.Unmarshal(b, &doc); err != nil {
+			return asset, fmt.Errorf("reading -sbom-file %s: %v", path, err)
+		}
+		switch {
+		case doc.SPDXVersion != "":
+			asset.ContentType = spdxContentType
+		case doc.BOMFormat == "CycloneDX":
+			asset.ContentType = cyclonedxContentType
+		default:
+			return asset, fmt.Errorf("-sbom-file %s is not an SPDX or CycloneDX document", path)
+		}
+	case strings.HasSuffix(name, ".spdx"):
+		asset.ContentType = "text/spdx"
+	case strings.HasSuffix(name, ".xml"):
+		asset.ContentType = "application/vnd.cyclonedx+xml"
+	default:
+		return asset, fmt.Errorf("-sbom-file %s is not an SPDX or CycloneDX document, expected a .json, .spdx or .xml file", path)
+	}
+	return asset, nil
+}
+
+// sbomFormatName returns the name of the SBOM format for the notes.
+func sbomFormatName(contentType string) string {
+	if strings.Contains(contentType, "cyclonedx") {
+		return "CycloneDX"
+	}
+	return "SPDX"
+}
+
+// sbomNotes returns the release notes section that lists the SBOM assets.
+func sbomNotes(sboms []release.AssetUpload) string {
+	var b strings.Builder
+	b.WriteString("## Software Bill of Materials\n\n")
+	for _, sbom := range sboms {
+		fmt.Fprintf(&b, "- `%s` (%s)\n", sbom.Name, sbomFormatName(sbom.ContentType))
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+// newUUID returns a random version 4 UUID.
+func newUUID() string {
+	var u [16]byte
+	rand.Read(u[:])
+	u[6] = u[6]&0x0f | 0x40
+	u[8] = u[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", u[0:4], u[4:6], u[6:8], u[8:10], u[10:])
+}
+
+// spdxID returns an SPDX element id for the module. Ids may only contain letters, numbers, . and -.
+func spdxID(m goModule) string {
+	id := strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '.' || r == '-' {
+			return r
+		}
+		return '-'
+	}, m.Path+"-"+m.Version)
+	return "SPDXRef-Package-" + strings.TrimSuffix(id, "-")
+}
+
+// spdxDocument returns an SPDX 2.3 document describing the main module, which depends on every
+// other module.
+func spdxDocument(modules []goModule, now time.Time) map[string]interface{} {
+	main := modules[0]
+	var packages []map[string]interface{}
+	relationships := []map[string]string{{
+		"spdxElementId":      "SPDXRef-DOCUMENT",
+		"relationshipType":   "DESCRIBES",
+		"relatedSpdxElement": spdxID(main),
+	}}
+	for i, m := range modules {
+		pkg := map[string]interface{}{
+			"name":             m.Path,
+			"SPDXID":           spdxID(m),
+			"downloadLocation": "NOASSERTION",
+			"filesAnalyzed":    false,
+			"externalRefs": []map[string]string{{
+				"referenceCategory": "PACKAGE-MANAGER",
+				"referenceType":     "purl",
+				"referenceLocator":  m.purl(),
+			}},
+		}
+		if m.Version != "" {
+			pkg["versionInfo"] = m.Version
+		}
+		packages = append(packages, pkg)
+		if i > 0 {
+			relationships = append(relationships, map[string]string{
+				"spdxElementId":      spdxID(main),
+				"relationshipType":   "DEPENDS_ON",
+				"relatedSpdxElement": spdxID(m),
+			})
+		}
+	}
+	return map[string]interface{}{
+		"spdxVersion":       "SPDX-2.3",
+		"dataLicense":       "CC0-1.0",
+		"SPDXID":            "SPDXRef-DOCUMENT",
+		"name":              main.Path,
+		"documentNamespace": "https://spdx.org/spdxdocs/" + main.Path + "-" + newUUID(),
+		"creationInfo": map[string]interface{}{
+			"created":  now.UTC().Format(time.RFC3339),
+			"creators": []string{"Tool: githubrelease-" + version},
+		},
+		"packages":      packages,
+		"relationships": relationships,
+	}
+}
+
+// cyclonedxBOM returns a CycloneDX 1.5 BOM with the main module as its subject, which depends on
+// every other module.
+func cyclonedxBOM(modules []goModule, now time.Time) map[string]interface{} {
+	component := func(m goModule, kind string) map[string]interface{} {
+		c := map[string]interface{}{"type": kind, "bom-ref": m.purl(), "name": m.Path, "purl": m.purl()}
+		if m.Version != "" {
+			c["version"] = m.Version
+		}
+		return c
+	}
+	main := modules[0]
+	components := []map[string]interface{}{}
+	dependsOn := []string{}
+	for _, m := range modules[1:] {
+		components = append(components, component(m, "library"))
+		dependsOn = append(dependsOn, m.purl())
+	}
+	return map[string]interface{}{
+		"bomFormat":    "CycloneDX",
+		"specVersion":  "1.5",
+		"serialNumber": "urn:uuid:" + newUUID(),
+		"version":      1,
+		"metadata": map[string]interface{}{
+			"timestamp": now.UTC().Format(time.RFC3339),
+			"tools": map[string]interface{}{
+				"components": []map[string]string{{"type": "application", "name": "githubrelease", "version": version}},
+			},
+			"component": component(main, "application"),
+		},
+		"components":   components,
+		"dependencies": []map[string]interface{}{{"ref": main.purl(), "dependsOn": dependsOn}},
+	}
+}
@@ -0,0 +1,275 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/imitablerabbit/githubrelease/pkg/release"
+)
+
+// The scanners of -scan.
+const (
+	scanClamd   = "clamd"
+	scanCommand = "command"
+)
+
+// The results of scanning an asset.
+const (
+	scanClean    = "clean"
+	scanInfected = "infected"
+)
+
+// clamdSockets are where clamd listens by default on Debian, Fedora and Homebrew, which are tried
+// in order if -scan-clamd is not given.
+var clamdSockets = []string{
+	"/var/run/clamav/clamd.ctl",
+	"/run/clamd.scan/clamd.sock",
+	"/opt/homebrew/var/run/clamav/clamd.sock",
+	"/usr/local/var/run/clamav/clamd.sock",
+}
+
+// clamdTimeout is the longest that clamd may take to scan a single asset.
+const clamdTimeout = 10 * time.Minute
+
+// clamdChunkSize is the size of the chunks that the assets are streamed to clamd in.
+const clamdChunkSize = 64 << 10
+
+// assetScan is the outcome of scanning an asset.
+type assetScan struct {
+	Result string `json:"result"`
+
+	// Detection is what the scanner found in an infected asset, e.g. the signature name.
+	Detection string `json:"detection,omitempty"`
+}
+
+// scanReport is the outcome of scanning the assets, which is recorded in the integrity manifest.
+type scanReport struct {
+	Scanner   string
+	ScannedAt time.Time
+	Assets    map[string]assetScan
+}
+
+// asset returns the result of scanning the asset, if it was scanned.
+func (r *scanReport) asset(name string) (assetScan, bool) {
+	if r == nil {
+		return assetScan{}, false
+	}
+	scan, ok := r.Assets[name]
+	return scan, ok
+}
+
+// scanner scans a file for malware, returning what it found in an infected file.
+type scanner interface {
+	name() string
+	scan(path string) (infected bool, detection string, err error)
+}
+
+// newScanner returns the scanner for -scan.
+func (uf *uploadFlags) newScanner() (scanner, error) {
+	switch uf.scan {
+	case scanClamd:
+		address := uf.scanClamd
+		if address == "" {
+			for _, socket := range clamdSockets {
+				if _, err := os.Stat(socket); err == nil {
+					address = socket
+					break
+				}
+			}
+			if address == "" {
+				return nil, fmt.Errorf("cannot find the clamd socket, set -scan-clamd to its path or host:port")
+			}
+		}
+		return &clamdScanner{address: address}, nil
+	case scanCommand:
+		if uf.scanCommand == "" {
+			return nil, fmt.Errorf("-scan command requires -scan-command")
+		}
+		return &commandScanner{command: uf.scanCommand}, nil
+	}
+	return nil, fmt.Errorf("unsupported -scan %q, expected clamd or command", uf.scan)
+}
+
+// scanAssets scans every asset and returns an error listing those that are infected, which stops
+// the release. Assets streamed from a URL never touch the disk, so they cannot be scanned.
+func (uf *uploadFlags) scanAssets(assets []release.AssetUpload) (*scanReport, error) {
+	s, err := uf.newScanner()
+	if err != nil {
+		return nil, err
+	}
+	report := &scanReport{Scanner: s.name(), ScannedAt: time.Now(), Assets: map[string]assetScan{}}
+	var infected []string
+	for _, asset := range assets {
+		if isRemoteAsset(asset.Path) {
+			log.Printf("warn: not scanning %s as it is streamed from %s", asset.Name, displayURL(asset.Path))
+			continue
+		}
+		found, detection, err := s.scan(asset.Path)
+		if err != nil {
+			return nil, fmt.Errorf("scanning %s: %v", asset.Name, err)
+		}
+		if found {
+			log.Printf("error: %s found in %s", detection, asset.Name)
+			report.Assets[asset.Name] = assetScan{Result: scanInfected, Detection: detection}
+			infected = append(infected, fmt.Sprintf("%s (%s)", asset.Name, detection))
+			continue
+		}
+		report.Assets[asset.Name] = assetScan{Result: scanClean}
+	}
+	if len(infected) > 0 {
+		return report, withExitCode(exitValidation, fmt.Errorf("%s found malware in %d of the assets: %s", report.Scanner, len(infected), strings.Join(infected, ", ")))
+	}
+	log.Printf("info: %s found nothing in %d assets", report.Scanner, len(report.Assets))
+	return report, nil
+}
+
+// clamdScanner streams the files to the ClamAV daemon at a unix socket path or a host:port.
+type clamdScanner struct {
+	address string
+	version string
+}
+
+func (c *clamdScanner) dial() (net.Conn, error) {
+	network, address := "unix", c.address
+	if strings.HasPrefix(address, "tcp://") {
+		network, address = "tcp", strings.TrimPrefix(address, "tcp://")
+	} else if !strings.Contains(address, "/") {
+		network = "tcp"
+	}
+	conn, err := net.DialTimeout(network, address, 10*time.Second)
+	if err != nil {
+		return nil, fmt.Errorf("connecting to clamd: %v", err)
+	}
+	conn.SetDeadline(time.Now().Add(clamdTimeout))
+	return conn, nil
+}
+
+// command sends the command to clamd, with the body written by send if it is not nil, and returns
+// the reply.
+func (c *clamdScanner) command(command string, send func(io.Writer) error) (string, error) {
+	conn, err := c.dial()
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+	// The z prefix has clamd reply with a null terminated line.
+	if _, err := io.WriteString(conn, "z"+command+"\x00"); err != nil {
+		return "", err
+	}
+	if send != nil {
+		if err := send(conn); err != nil {
+			return "", err
+		}
+	}
+	reply, err := ioutil.ReadAll(conn)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(reply), "\x00\n"), nil
+}
+
+// name returns the version of ClamAV with its signature database, e.g. ClamAV 1.2.1/27100.
+func (c *clamdScanner) name() string {
+	if c.version == "" {
+		c.version = "clamd"
+		// The reply is the version, the database version and the database date.
+		if reply, err := c.command("VERSION", nil); err == nil && reply != "" {
+			parts := strings.SplitN(reply, "/", 3)
+			c.version = parts[0]
+			if len(parts) > 1 {
+				c.version += "/" + parts[1]
+			}
+		}
+	}
+	return c.version
+}
+
+func (c *clamdScanner) scan(path string) (bool, string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return false, "", err
+	}
+	defer f.Close()
+	reply, err := c.command("INSTREAM", func(w io.Writer) error {
+		buf := make([]byte, clamdChunkSize)
+		size := make([]byte, 4)
+		for {
+			n, err := f.Read(buf)
+			if n > 0 {
+				binary.BigEndian.PutUint32(size, uint32(n))
+				if _, err := w.Write(size); err != nil {
+					return err
+				}
+				if _, err := w.Write(buf[:n]); err != nil {
+					return err
+				}
+			}
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			if err != nil {
+				return err
+			}
+		}
+		// A chunk of length zero ends the stream.
+		_, err := w.Write([]byte{0, 0, 0, 0})
+		return err
+	})
+	if err != nil {
+		return false, "", fmt.Errorf("clamd: %v", err)
+	}
+	// The reply is "stream: OK", "stream: <signature> FOUND" or "<message> ERROR".
+	result := strings.TrimPrefix(reply, "stream: ")
+	switch {
+	case result == "OK":
+		return false, "", nil
+	case strings.HasSuffix(result, " FOUND"):
+		return true, strings.TrimSuffix(result, " FOUND"), nil
+	case strings.Contains(result, "size limit exceeded"):
+		return false, "", fmt.Errorf("clamd: the asset is larger than its StreamMaxLength, raise it in clamd.conf")
+	}
+	return false, "", fmt.Errorf("clamd: %s", result)
+}
+
+// commandScanner runs a command with the path of each file as its last argument. As with
+// clamscan, exit status 0 means the file is clean and 1 that it is infected, with what was found
+// in the output. Any other status is an error.
+type commandScanner struct {
+	command string
+}
+
+func (c *commandScanner) name() string {
+	return c.command
+}
+
+func (c *commandScanner) scan(path string) (bool, string, error) {
+	var out bytes.Buffer
+	cmd := exec.Command("sh", "-c", c.command+` "$1"`, "sh", path)
+	cmd.Stdout, cmd.Stderr = &out, &out
+	err := cmd.Run()
+	var exitErr *exec.ExitError
+	switch {
+	case err == nil:
+		return false, "", nil
+	case errors.As(err, &exitErr) && exitErr.ExitCode() == 1:
+		detection := strings.TrimSpace(out.String())
+		if lines := strings.Split(detection, "\n"); len(lines) > 1 {
+			detection = strings.TrimSpace(lines[0])
+		}
+		if detection == "" {
+			detection = "malware"
+		}
+		return true, strings.TrimSuffix(strings.TrimPrefix(detection, path+": "), " FOUND"), nil
+	}
+	return false, "", fmt.Errorf("%s: %v: %s", c.command, err, strings.TrimSpace(out.String()))
+}
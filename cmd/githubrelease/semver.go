@@ -0,0 +1,169 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/imitablerabbit/githubrelease/pkg/release"
+)
+
+// semverRegexp matches a SemVer 2.0.0 version, see https://semver.org. The leading v that is
+// commonly used in tags is stripped before matching.
+var semverRegexp = regexp.MustCompile(`^(0|[1-9]\d*)\.(0|[1-9]\d*)\.(0|[1-9]\d*)` +
+	`(?:-((?:0|[1-9]\d*|\d*[a-zA-Z-][0-9a-zA-Z-]*)(?:\.(?:0|[1-9]\d*|\d*[a-zA-Z-][0-9a-zA-Z-]*))*))?` +
+	`(?:\+([0-9a-zA-Z-]+(?:\.[0-9a-zA-Z-]+)*))?$`)
+
+// semver is a parsed SemVer version.
+type semver struct {
+	Major      int
+	Minor      int
+	Patch      int
+	PreRelease string
+	Build      string
+}
+
+// parseSemver parses the tag as a SemVer version, with or without a leading v. false is returned
+// if the tag is not a valid SemVer version.
+func parseSemver(tag string) (semver, bool) {
+	m := semverRegexp.FindStringSubmatch(strings.TrimPrefix(tag, "v"))
+	if m == nil {
+		return semver{}, false
+	}
+	major, _ := strconv.Atoi(m[1])
+	minor, _ := strconv.Atoi(m[2])
+	patch, _ := strconv.Atoi(m[3])
+	return semver{
+		Major:      major,
+		Minor:      minor,
+		Patch:      patch,
+		PreRelease: m[4],
+		Build:      m[5],
+	}, true
+}
+
+// tagVersion returns the version part of a tag with a path prefix, e.g. v1.2.0 for api/v1.2.0.
+func tagVersion(tag string) string {
+	return tag[strings.LastIndex(tag, "/")+1:]
+}
+
+// releaseVersion returns the version of a tag without its path prefix or v, e.g. 1.2.0 for
+// api/v1.2.0, which is how versions are written in a changelog. A tag that is only a v is kept.
+func releaseVersion(tag string) string {
+	version := strings.TrimPrefix(tagVersion(tag), "v")
+	if version == "" {
+		return tag
+	}
+	return version
+}
+
+// detectPrerelease works out whether the release should be a pre-release from its tag. An explicit
+// prerelease always wins, otherwise the release is a pre-release if the tag has a SemVer
+// pre-release suffix or a major version of 0. Tags that are not SemVer are left as they are.
+func detectPrerelease(tag string, prerelease bool) bool {
+	if prerelease {
+		log.Printf("info: auto-prerelease: --prerelease set, marking %s as a pre-release", tag)
+		return true
+	}
+	v, ok := parseSemver(tagVersion(tag))
+	if !ok {
+		log.Printf("info: auto-prerelease: %s is not a SemVer version, leaving pre-release unset", tag)
+		return false
+	}
+	if v.PreRelease != "" {
+		log.Printf("info: auto-prerelease: %s has pre-release suffix %q, marking as a pre-release", tag, v.PreRelease)
+		return true
+	}
+	// SemVer versions below 1.0.0 are for initial development, where anything may change.
+	if v.Major == 0 {
+		log.Printf("info: auto-prerelease: %s has major version 0, marking as a pre-release", tag)
+		return true
+	}
+	log.Printf("info: auto-prerelease: %s has no pre-release suffix, marking as a full release", tag)
+	return false
+}
+
+// String formats the version without a leading v.
+func (v semver) String() string {
+	s := fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+	if v.PreRelease != "" {
+		s += "-" + v.PreRelease
+	}
+	if v.Build != "" {
+		s += "+" + v.Build
+	}
+	return s
+}
+
+// less reports whether v has a lower precedence than other. Build metadata is ignored and
+// pre-release identifiers are compared as strings, which is enough to order release tags.
+func (v semver) less(other semver) bool {
+	if v.Major != other.Major {
+		return v.Major < other.Major
+	}
+	if v.Minor != other.Minor {
+		return v.Minor < other.Minor
+	}
+	if v.Patch != other.Patch {
+		return v.Patch < other.Patch
+	}
+	if v.PreRelease == "" || other.PreRelease == "" {
+		return v.PreRelease != "" && other.PreRelease == ""
+	}
+	return v.PreRelease < other.PreRelease
+}
+
+// bump returns the next version for the bump, which is major, minor or patch. Any pre-release and
+// build metadata is dropped.
+func (v semver) bump(kind string) (semver, error) {
+	switch kind {
+	case "major":
+		return semver{Major: v.Major + 1}, nil
+	case "minor":
+		return semver{Major: v.Major, Minor: v.Minor + 1}, nil
+	case "patch":
+		return semver{Major: v.Major, Minor: v.Minor, Patch: v.Patch + 1}, nil
+	}
+	return semver{}, fmt.Errorf("unsupported bump %q, expected major, minor, patch or auto", kind)
+}
+
+// latestSemverTag returns the tag with the highest SemVer version after the prefix, ignoring
+// pre-releases and tags that do not start with the prefix or are not SemVer versions. false is
+// returned if there is no such tag.
+func latestSemverTag(tags []release.RepoTag, prefix string) (string, semver, bool) {
+	var latestTag string
+	var latest semver
+	found := false
+	for _, tag := range tags {
+		if !strings.HasPrefix(tag.Name, prefix) {
+			continue
+		}
+		v, ok := parseSemver(strings.TrimPrefix(tag.Name, prefix))
+		if !ok || v.PreRelease != "" {
+			continue
+		}
+		if !found || latest.less(v) {
+			latestTag, latest, found = tag.Name, v, true
+		}
+	}
+	return latestTag, latest, found
+}
+
+// conventionalBump returns the bump that the commit messages call for under conventional
+// commits: major for a breaking change, minor for a feature and patch otherwise.
+func conventionalBump(messages []string) string {
+	bump := "patch"
+	for _, message := range messages {
+		subject, body, _ := strings.Cut(message, "\n")
+		m := conventionalCommitRegexp.FindStringSubmatch(strings.TrimSpace(subject))
+		if (m != nil && m[3] != "") || strings.Contains(body, "BREAKING CHANGE:") || strings.Contains(body, "BREAKING-CHANGE:") {
+			return "major"
+		}
+		if m != nil && strings.ToLower(m[1]) == "feat" {
+			bump = "minor"
+		}
+	}
+	return bump
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/imitablerabbit/githubrelease/pkg/release"
+)
+
+// signer creates detached signatures for release assets.
+type signer interface {
+	// sign signs the asset and writes the signature files into dir, returning them as assets
+	// to be uploaded with the release.
+	sign(asset release.AssetUpload, dir string) ([]release.AssetUpload, error)
+}
+
+// newSigner returns the signer for the signing method, gpg or cosign. With sha2 set gpg signs
+// with a SHA-2 digest, cosign always does.
+func newSigner(method, key string, sha2 bool) (signer, error) {
+	switch method {
+	case "gpg":
+		return &gpgSigner{key: key, sha2: sha2}, nil
+	case "cosign":
+		return &cosignSigner{key: key}, nil
+	}
+	return nil, fmt.Errorf("unsupported signing method %q, expected gpg or cosign", method)
+}
+
+// gpgSigner creates binary detached signatures with gpg. The default key is used unless key is set.
+type gpgSigner struct {
+	key string
+
+	// sha2 makes gpg sign with a SHA-2 digest instead of its preference, which can be SHA-1 for
+	// old keys.
+	sha2 bool
+}
+
+// gpgDigestArgs returns the gpg arguments that select a SHA-2 digest if sha2 is set.
+func gpgDigestArgs(sha2 bool) []string {
+	if !sha2 {
+		return nil
+	}
+	return []string{"--digest-algo", "SHA256"}
+}
+
+func (g *gpgSigner) sign(asset release.AssetUpload, dir string) ([]release.AssetUpload, error) {
+	sigName := asset.Name + ".sig"
+	sigPath := filepath.Join(dir, sigName)
+	args := []string{"--batch", "--yes", "--detach-sign", "--output", sigPath}
+	args = append(args, gpgDigestArgs(g.sha2)...)
+	if g.key != "" {
+		args = append(args, "--local-user", g.key)
+	}
+	args = append(args, asset.Path)
+	if err := runCommand("gpg", args...); err != nil {
+		return nil, err
+	}
+	return []release.AssetUpload{{Path: sigPath, Name: sigName, ContentType: "application/pgp-signature"}}, nil
+}
+
+// cosignSigner signs blobs with cosign. Without a key cosign keyless signing is used, which also
+// produces a certificate that is uploaded alongside the signature.
+type cosignSigner struct {
+	key string
+}
+
+func (c *cosignSigner) sign(asset release.AssetUpload, dir string) ([]release.AssetUpload, error) {
+	sigName := asset.Name + ".sig"
+	sigPath := filepath.Join(dir, sigName)
+	args := []string{"sign-blob", "--yes", "--output-signature", sigPath}
+	signatures := []release.AssetUpload{{Path: sigPath, Name: sigName, ContentType: "text/plain; charset=utf-8"}}
+	if c.key != "" {
+		args = append(args, "--key", c.key)
+	} else {
+		certName := asset.Name + ".pem"
+		certPath := filepath.Join(dir, certName)
+		args = append(args, "--output-certificate", certPath)
+		signatures = append(signatures, release.AssetUpload{Path: certPath, Name: certName, ContentType: "application/x-pem-file"})
+	}
+	args = append(args, asset.Path)
+	if err := runCommand("cosign", args...); err != nil {
+		return nil, err
+	}
+	return signatures, nil
+}
+
+// gpgTagSigner returns a signer for git tags that creates ASCII armored signatures with gpg, using
+// the default key unless key is set and a SHA-2 digest if sha2 is set.
+func gpgTagSigner(key string, sha2 bool) release.TagSigner {
+	return func(payload []byte) (string, error) {
+		args := []string{"--batch", "--armor", "--detach-sign"}
+		args = append(args, gpgDigestArgs(sha2)...)
+		if key != "" {
+			args = append(args, "--local-user", key)
+		}
+		log.Printf("info: running gpg %s", strings.Join(args, " "))
+		var stdout bytes.Buffer
+		cmd := exec.Command("gpg", args...)
+		cmd.Stdin = bytes.NewReader(payload)
+		cmd.Stdout = &stdout
+		cmd.Stderr = os.Stderr
+		if err := cmd.Run(); err != nil {
+			return "", fmt.Errorf("running gpg: %v", err)
+		}
+		return stdout.String(), nil
+	}
+}
+
+// runCommand runs the command with its output going to stderr so that it ends up in the logs.
+func runCommand(name string, args ...string) error {
+	log.Printf("info: running %s %s", name, strings.Join(args, " "))
+	cmd := exec.Command(name, args...)
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("running %s: %v", name, err)
+	}
+	return nil
+}
+
+// signAssets signs each of the assets and returns the signatures as assets to upload. The
+// signatures are written into a temporary directory which the caller should remove.
+func signAssets(s signer, assets []release.AssetUpload) ([]release.AssetUpload, string, error) {
+	dir, err := ioutil.TempDir("", "githubrelease-signatures")
+	if err != nil {
+		return nil, "", err
+	}
+	var signatures []release.AssetUpload
+	for _, asset := range assets {
+		sigs, err := s.sign(asset, dir)
+		if err != nil {
+			os.RemoveAll(dir)
+			return nil, "", fmt.Errorf("signing %s: %v", asset.Name, err)
+		}
+		signatures = append(signatures, sigs...)
+	}
+	return signatures, dir, nil
+}
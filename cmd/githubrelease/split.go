@@ -0,0 +1,163 @@
+package main
+
+import (
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/imitablerabbit/githubrelease/pkg/release"
+)
+
+// defaultSplitSize is the size of the parts of a split asset, a little under the largest asset
+// that GitHub accepts.
+const defaultSplitSize = "2000MiB"
+
+// splitAsset is an asset that was too large to upload in one piece and is uploaded in parts.
+type splitAsset struct {
+	name   string
+	size   int64
+	sha256 string
+	parts  []splitPart
+}
+
+// splitPart is one of the parts of a split asset.
+type splitPart struct {
+	name   string
+	size   int64
+	sha256 string
+}
+
+// checkAssetSizes returns an error for the first asset that is larger than GitHub accepts, so that
+// it fails before the release is created rather than with a 422 from the upload.
+func checkAssetSizes(assets []release.AssetUpload) error {
+	for _, asset := range assets {
+		if isRemoteAsset(asset.Path) {
+			continue
+		}
+		info, err := os.Stat(asset.Path)
+		if err != nil {
+			return err
+		}
+		if info.Size() > release.MaxAssetSize {
+			return fmt.Errorf("%s is %s, GitHub only accepts assets up to %s, use -split-large-assets to upload it in parts",
+				asset.Name, formatBytes(float64(info.Size())), formatBytes(release.MaxAssetSize))
+		}
+	}
+	return nil
+}
+
+// parseSplitSize parses -split-size, which must leave room for at least one byte in each part and
+// be no larger than GitHub accepts.
+func parseSplitSize(value string) (int64, error) {
+	size, err := parseBandwidth(value)
+	if err != nil || strings.HasSuffix(strings.TrimSpace(value), "/s") {
+		return 0, fmt.Errorf("invalid -split-size %q, expected a size such as 1GiB", value)
+	}
+	if size <= 0 || size > release.MaxAssetSize {
+		return 0, fmt.Errorf("-split-size must be more than 0 and at most %s", formatBytes(release.MaxAssetSize))
+	}
+	return size, nil
+}
+
+// splitAssets splits the assets larger than size into numbered parts of at most size bytes, e.g.
+// app.iso.001 and app.iso.002, which replace them in the returned list. The parts are written to a
+// temporary directory, which the caller should remove. The split assets are returned with the
+// sha256 of each part and of the whole file, for the release notes.
+func splitAssets(assets []release.AssetUpload, size int64) ([]release.AssetUpload, []splitAsset, string, error) {
+	var out []release.AssetUpload
+	var splits []splitAsset
+	dir := ""
+	for _, asset := range assets {
+		if isRemoteAsset(asset.Path) {
+			out = append(out, asset)
+			continue
+		}
+		info, err := os.Stat(asset.Path)
+		if err != nil {
+			return nil, nil, dir, err
+		}
+		if info.Size() <= size {
+			out = append(out, asset)
+			continue
+		}
+		if dir == "" {
+			if dir, err = ioutil.TempDir("", "githubrelease-split"); err != nil {
+				return nil, nil, "", err
+			}
+		}
+		parts, split, err := splitFile(asset, info.Size(), size, dir)
+		if err != nil {
+			return nil, nil, dir, fmt.Errorf("splitting %s: %v", asset.Name, err)
+		}
+		log.Printf("info: split %s into %d parts of up to %s", asset.Name, len(parts), formatBytes(float64(size)))
+		out = append(out, parts...)
+		splits = append(splits, split)
+	}
+	return out, splits, dir, nil
+}
+
+// splitFile copies the asset into parts in dir, hashing each part and the whole file as it goes.
+func splitFile(asset release.AssetUpload, total, size int64, dir string) ([]release.AssetUpload, splitAsset, error) {
+	split := splitAsset{name: asset.Name, size: total}
+	in, err := os.Open(asset.Path)
+	if err != nil {
+		return nil, split, err
+	}
+	defer in.Close()
+	whole, _ := release.NewHash("sha256")
+	count := int((total + size - 1) / size)
+	var parts []release.AssetUpload
+	for i := 1; i <= count; i++ {
+		name := fmt.Sprintf("%s.%03d", asset.Name, i)
+		path := filepath.Join(dir, name)
+		part, err := os.Create(path)
+		if err != nil {
+			return nil, split, err
+		}
+		h, _ := release.NewHash("sha256")
+		n, err := io.Copy(io.MultiWriter(part, h, whole), io.LimitReader(in, size))
+		if closeErr := part.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return nil, split, err
+		}
+		upload := release.AssetUpload{Path: path, Name: name, ContentType: "application/octet-stream"}
+		if asset.Label != "" {
+			upload.Label = fmt.Sprintf("%s (part %d of %d)", asset.Label, i, count)
+		}
+		parts = append(parts, upload)
+		split.parts = append(split.parts, splitPart{name: name, size: n, sha256: hex.EncodeToString(h.Sum(nil))})
+	}
+	split.sha256 = hex.EncodeToString(whole.Sum(nil))
+	return parts, split, nil
+}
+
+// splitNotes returns the release notes section that explains how to join the split assets, with
+// the size and sha256 of every part.
+func splitNotes(splits []splitAsset) string {
+	var b strings.Builder
+	b.WriteString("## Split assets\n\n")
+	b.WriteString("These files are too large for a single release asset, so they are uploaded in parts. ")
+	b.WriteString("Download all of the parts of a file and join them in order.\n")
+	for _, split := range splits {
+		names := make([]string, len(split.parts))
+		for i, part := range split.parts {
+			names[i] = part.name
+		}
+		fmt.Fprintf(&b, "\n### %s\n\n", split.name)
+		fmt.Fprintf(&b, "%s, sha256 `%s`.\n\n", formatBytes(float64(split.size)), split.sha256)
+		fmt.Fprintf(&b, "```sh\ncat %s > %s\necho \"%s  %s\" | sha256sum -c -\n```\n\n", strings.Join(names, " "), split.name, split.sha256, split.name)
+		fmt.Fprintf(&b, "On Windows:\n\n```bat\ncopy /b %s %s\n```\n\n", strings.Join(names, "+"), split.name)
+		b.WriteString("| Part | Size | SHA-256 |\n|---|---:|---|\n")
+		for _, part := range split.parts {
+			fmt.Fprintf(&b, "| `%s` | %s | `%s` |\n", part.name, formatBytes(float64(part.size)), part.sha256)
+		}
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
@@ -0,0 +1,290 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/imitablerabbit/githubrelease/pkg/release"
+)
+
+// The groups that the stats command can sum the downloads by.
+const (
+	statsByAsset    = "asset"
+	statsByRelease  = "release"
+	statsByPlatform = "platform"
+	statsByWindow   = "window"
+	statsByRepo     = "repo"
+)
+
+// statsRow is the downloads of one group of assets.
+type statsRow struct {
+	Key       string `json:"key"`
+	Downloads int64  `json:"downloads"`
+	Assets    int    `json:"assets"`
+	Releases  int    `json:"releases"`
+
+	releases map[string]bool
+}
+
+// platformPattern names the assets that match a glob pattern as a platform, from -platform.
+type platformPattern struct {
+	name    string
+	pattern string
+}
+
+// statsFlags are the flags of the stats command.
+type statsFlags struct {
+	by         string
+	window     string
+	platforms  []platformPattern
+	tagPattern string
+	since      time.Time
+	include    []string
+	exclude    []string
+}
+
+// runStats sums the download counts of the assets of the published releases, by asset, release,
+// platform, the period the release was published in or repo. With -org the releases of every
+// repository in the organization are counted.
+func runStats(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("stats", flag.ContinueOnError)
+	cf := addClientFlags(fs)
+	f := &statsFlags{}
+	fs.StringVar(&f.by, "by", statsByAsset, "Sum the downloads by asset, release, platform, window or repo. Assets of different releases are summed together when their names only differ by the version")
+	fs.StringVar(&f.window, "window", "month", "The period to sum the downloads of the releases published in with -by window: day, week, month or year")
+	var platforms, include, exclude stringsFlag
+	fs.Var(&platforms, "platform", "A platform for -by platform as name=pattern, e.g. 'macOS=*darwin*', matched against the asset name in order. Can be repeated. Defaults to the OS and architecture in the asset name")
+	fs.StringVar(&f.tagPattern, "tag-pattern", "", "Only count releases whose tag matches this glob pattern, e.g. v1.*")
+	since := fs.String("since", "", "Only count releases published since this date, e.g. 2024-01-31, or duration, e.g. 720h")
+	fs.Var(&include, "include", "Only count assets whose names match this glob pattern. Can be repeated")
+	fs.Var(&exclude, "exclude", "Do not count assets whose names match this glob pattern. Can be repeated")
+	output := fs.String("output", "table", "Output format: table, csv or json")
+	of := addOrgFlags(fs)
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if err := of.check(cf); err != nil {
+		return err
+	}
+	switch f.by {
+	case statsByAsset, statsByRelease, statsByPlatform, statsByWindow, statsByRepo:
+	default:
+		return withExitCode(exitValidation, fmt.Errorf("unsupported -by %q, expected asset, release, platform, window or repo", f.by))
+	}
+	switch f.window {
+	case "day", "week", "month", "year":
+	default:
+		return withExitCode(exitValidation, fmt.Errorf("unsupported -window %q, expected day, week, month or year", f.window))
+	}
+	switch *output {
+	case "table", "csv", "json":
+	default:
+		return withExitCode(exitValidation, fmt.Errorf("unsupported -output %q, expected table, csv or json", *output))
+	}
+	for _, platform := range platforms {
+		name, pattern, ok := strings.Cut(platform, "=")
+		if !ok || name == "" || pattern == "" {
+			return withExitCode(exitValidation, fmt.Errorf("invalid -platform %q, expected name=pattern", platform))
+		}
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return withExitCode(exitValidation, fmt.Errorf("invalid -platform pattern %s: %v", pattern, err))
+		}
+		f.platforms = append(f.platforms, platformPattern{name: name, pattern: pattern})
+	}
+	f.include, f.exclude = include, exclude
+	var err error
+	if f.since, err = parseSince(*since, time.Now()); err != nil {
+		return withExitCode(exitValidation, err)
+	}
+
+	ctx, cancel := cf.withTimeout(ctx)
+	defer cancel()
+	rows := map[string]*statsRow{}
+	if of.org != "" {
+		// The downloads of every repo are summed together, so the same asset name in two repos
+		// is one row unless they are grouped by repo.
+		var mu sync.Mutex
+		err := of.forEach(ctx, cf, func(ctx context.Context, repo string, client *release.Client) error {
+			releases, err := client.ListAllReleases(ctx)
+			if err != nil {
+				return err
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			for _, r := range releases {
+				if err := f.add(rows, repo, r); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if writeErr := writeStats(f.sortRows(rows), *output); writeErr != nil {
+			return writeErr
+		}
+		return err
+	}
+	client, err := cf.newClient(ctx)
+	if err != nil {
+		return err
+	}
+	repo := client.User + "/" + client.Repo
+	err = client.WalkReleases(ctx, func(r release.Release) (bool, error) {
+		return true, f.add(rows, repo, r)
+	})
+	if err != nil {
+		return err
+	}
+	return writeStats(f.sortRows(rows), *output)
+}
+
+// add sums the downloads of the assets of the release in the repo into the rows. Drafts are
+// skipped as their assets cannot be downloaded.
+func (f *statsFlags) add(rows map[string]*statsRow, repo string, r release.Release) error {
+	if r.Draft {
+		return nil
+	}
+	if f.tagPattern != "" {
+		match, err := filepath.Match(f.tagPattern, r.TagName)
+		if err != nil {
+			return withExitCode(exitValidation, fmt.Errorf("invalid -tag-pattern %s: %v", f.tagPattern, err))
+		}
+		if !match {
+			return nil
+		}
+	}
+	published := r.PublishedAt
+	if !f.since.IsZero() && published.Before(f.since) {
+		return nil
+	}
+	uploads := make([]release.AssetUpload, 0, len(r.Assets))
+	counts := map[string]int64{}
+	for _, asset := range r.Assets {
+		uploads = append(uploads, release.AssetUpload{Name: asset.Name})
+		counts[asset.Name] = int64(asset.DownloadCount)
+	}
+	filtered, err := filterAssets(uploads, f.include, f.exclude)
+	if err != nil {
+		return err
+	}
+	version := strings.TrimPrefix(tagVersion(r.TagName), "v")
+	for _, asset := range filtered {
+		var key string
+		switch f.by {
+		case statsByAsset:
+			key = asset.Name
+			if version != "" {
+				key = strings.ReplaceAll(key, version, "{version}")
+			}
+		case statsByRelease:
+			key = r.TagName
+		case statsByPlatform:
+			key = f.platform(asset.Name)
+		case statsByWindow:
+			key = f.windowKey(published)
+		case statsByRepo:
+			key = repo
+		}
+		row := rows[key]
+		if row == nil {
+			row = &statsRow{Key: key, releases: map[string]bool{}}
+			rows[key] = row
+		}
+		row.Downloads += counts[asset.Name]
+		row.Assets++
+		row.releases[repo+"@"+r.TagName] = true
+		row.Releases = len(row.releases)
+	}
+	return nil
+}
+
+// platform returns the platform of the asset, from the first -platform pattern that matches its
+// name, or from the OS and architecture in the name if no patterns are given.
+func (f *statsFlags) platform(name string) string {
+	if len(f.platforms) > 0 {
+		for _, p := range f.platforms {
+			if match, _ := filepath.Match(p.pattern, name); match {
+				return p.name
+			}
+		}
+		return "other"
+	}
+	goos, goarch := assetPlatform(name)
+	switch {
+	case goos == "":
+		return "other"
+	case goarch == "":
+		return goos
+	}
+	return goos + "/" + goarch
+}
+
+// windowKey returns the period that the time is in, in a form that sorts in time order.
+func (f *statsFlags) windowKey(t time.Time) string {
+	if t.IsZero() {
+		return "unpublished"
+	}
+	t = t.UTC()
+	switch f.window {
+	case "day":
+		return t.Format("2006-01-02")
+	case "week":
+		year, week := t.ISOWeek()
+		return fmt.Sprintf("%d-W%02d", year, week)
+	case "year":
+		return t.Format("2006")
+	}
+	return t.Format("2006-01")
+}
+
+// sortRows returns the rows with the most downloads first, or in time order for -by window.
+func (f *statsFlags) sortRows(rows map[string]*statsRow) []*statsRow {
+	sorted := make([]*statsRow, 0, len(rows))
+	for _, row := range rows {
+		sorted = append(sorted, row)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if f.by != statsByWindow && sorted[i].Downloads != sorted[j].Downloads {
+			return sorted[i].Downloads > sorted[j].Downloads
+		}
+		return sorted[i].Key < sorted[j].Key
+	})
+	return sorted
+}
+
+// writeStats writes the rows to stdout in the output format.
+func writeStats(rows []*statsRow, output string) error {
+	switch output {
+	case "json":
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(rows)
+	case "csv":
+		w := csv.NewWriter(os.Stdout)
+		w.Write([]string{"key", "downloads", "assets", "releases"})
+		for _, row := range rows {
+			w.Write([]string{row.Key, strconv.FormatInt(row.Downloads, 10), strconv.Itoa(row.Assets), strconv.Itoa(row.Releases)})
+		}
+		w.Flush()
+		return w.Error()
+	}
+	var total int64
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "KEY\tDOWNLOADS\tASSETS\tRELEASES")
+	for _, row := range rows {
+		fmt.Fprintf(w, "%s\t%d\t%d\t%d\n", row.Key, row.Downloads, row.Assets, row.Releases)
+		total += row.Downloads
+	}
+	fmt.Fprintf(w, "TOTAL\t%d\t\t\n", total)
+	return w.Flush()
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/imitablerabbit/githubrelease/pkg/release"
+)
+
+// resolveTarget checks that -target is a branch, tag or commit in the repo and returns the
+// target_commitish to create the release with. GitHub only accepts a branch or a full SHA, so a
+// tag or short SHA is sent as the full SHA of its commit. If the tag already exists GitHub
+// ignores the target, so it is not checked and the tag is released as it is. With
+// -require-checks the checks on the commit that is released must have passed.
+func (f *createFlags) resolveTarget(ctx context.Context, client *release.Client, tag string) (string, error) {
+	exists, err := client.TagExists(ctx, tag)
+	if err != nil {
+		return "", err
+	}
+	if exists {
+		if f.requireChecks {
+			commit, err := client.ResolveCommit(ctx, tag)
+			if err != nil {
+				return "", err
+			}
+			if err := requirePassedChecks(ctx, client, tag, commit); err != nil {
+				return "", err
+			}
+		}
+		return f.targetCommitish, nil
+	}
+
+	target, err := client.ResolveTarget(ctx, f.targetCommitish)
+	if errors.Is(err, release.ErrNotFound) {
+		return "", withExitCode(exitValidation, fmt.Errorf("-target %s is not a branch, tag or commit in %s/%s", f.targetCommitish, client.User, client.Repo))
+	}
+	if err != nil {
+		return "", err
+	}
+	if f.requireChecks {
+		if err := requirePassedChecks(ctx, client, f.targetCommitish, target.SHA); err != nil {
+			return "", err
+		}
+	}
+	if target.Kind == release.TargetBranch {
+		return f.targetCommitish, nil
+	}
+	if target.SHA != f.targetCommitish {
+		log.Printf("info: resolved -target %s %s to commit %s", target.Kind, f.targetCommitish, target.SHA)
+	}
+	return target.SHA, nil
+}
+
+// requirePassedChecks returns an error listing the checks of the commit that have not passed, or
+// saying that it has none.
+func requirePassedChecks(ctx context.Context, client *release.Client, ref, commit string) error {
+	checks, err := client.ListCommitChecks(ctx, commit)
+	if err != nil {
+		return err
+	}
+	if len(checks) == 0 {
+		return withExitCode(exitValidation, fmt.Errorf("%s (%s) has no checks, -require-checks needs them to have passed", ref, shortSHA(commit)))
+	}
+	var failed []string
+	for _, check := range checks {
+		if check.Passed() {
+			continue
+		}
+		state := check.Conclusion
+		if state == "" {
+			state = strings.ReplaceAll(check.Status, "_", " ")
+		}
+		failed = append(failed, fmt.Sprintf("%s (%s)", check.Name, state))
+	}
+	if len(failed) > 0 {
+		return withExitCode(exitValidation, fmt.Errorf("%d of the %d checks on %s (%s) have not passed: %s", len(failed), len(checks), ref, shortSHA(commit), strings.Join(failed, ", ")))
+	}
+	log.Printf("info: all %d checks on %s (%s) have passed", len(checks), ref, shortSHA(commit))
+	return nil
+}
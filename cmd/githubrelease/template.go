@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/imitablerabbit/githubrelease/pkg/release"
+)
+
+// templateData is the data that the name and body templates are executed with.
+type templateData struct {
+	// Tag is the release tag and Version is the tag without any path prefix, such as api/, or
+	// leading v.
+	Tag     string
+	Version string
+
+	// Component is the name of the config file component being released, if any.
+	Component string
+
+	// Major, Minor, Patch and PreRelease are set if the tag is a SemVer version.
+	Major      int
+	Minor      int
+	Patch      int
+	PreRelease string
+
+	// Date is the current date as YYYY-MM-DD.
+	Date string
+
+	// Repo is owner/repo, Owner and RepoName are its parts.
+	Repo     string
+	Owner    string
+	RepoName string
+
+	// Target is the commitish that the release is created from.
+	Target string
+
+	ctx    context.Context
+	client *release.Client
+	commit string
+}
+
+// newTemplateData returns the template data for a release of tag at target.
+func newTemplateData(ctx context.Context, client *release.Client, tag, target string) *templateData {
+	d := &templateData{
+		Tag:      tag,
+		Version:  strings.TrimPrefix(tagVersion(tag), "v"),
+		Date:     time.Now().Format("2006-01-02"),
+		Repo:     client.User + "/" + client.Repo,
+		Owner:    client.User,
+		RepoName: client.Repo,
+		Target:   target,
+		ctx:      ctx,
+		client:   client,
+	}
+	if v, ok := parseSemver(tagVersion(tag)); ok {
+		d.Major, d.Minor, d.Patch, d.PreRelease = v.Major, v.Minor, v.Patch, v.PreRelease
+	}
+	return d
+}
+
+// Commit returns the commit SHA that the target points to. It is only looked up if a template
+// uses it.
+func (d *templateData) Commit() (string, error) {
+	if d.commit == "" {
+		sha, err := d.client.ResolveCommit(d.ctx, d.Target)
+		if err != nil {
+			return "", err
+		}
+		d.commit = sha
+	}
+	return d.commit, nil
+}
+
+// ShortCommit returns the first 7 characters of Commit.
+func (d *templateData) ShortCommit() (string, error) {
+	sha, err := d.Commit()
+	if len(sha) > 7 {
+		sha = sha[:7]
+	}
+	return sha, err
+}
+
+// templateFuncs are the helper functions available in templates, named after their sprig
+// equivalents.
+var templateFuncs = template.FuncMap{
+	"upper":      strings.ToUpper,
+	"lower":      strings.ToLower,
+	"title":      strings.Title,
+	"trim":       strings.TrimSpace,
+	"trimPrefix": func(prefix, s string) string { return strings.TrimPrefix(s, prefix) },
+	"trimSuffix": func(suffix, s string) string { return strings.TrimSuffix(s, suffix) },
+	"replace":    func(old, new, s string) string { return strings.ReplaceAll(s, old, new) },
+	"contains":   func(substr, s string) bool { return strings.Contains(s, substr) },
+	"hasPrefix":  func(prefix, s string) bool { return strings.HasPrefix(s, prefix) },
+	"hasSuffix":  func(suffix, s string) bool { return strings.HasSuffix(s, suffix) },
+	"split":      func(sep, s string) []string { return strings.Split(s, sep) },
+	"join":       func(sep string, s []string) string { return strings.Join(s, sep) },
+	"default": func(def string, value interface{}) interface{} {
+		if value == nil || value == "" {
+			return def
+		}
+		return value
+	},
+	"env": os.Getenv,
+	"now": func(layout string) string { return time.Now().Format(layout) },
+}
+
+// executeTemplate executes the text as a template with the data. The name is used in errors.
+func executeTemplate(name, text string, data *templateData) (string, error) {
+	if !strings.Contains(text, "{{") {
+		return text, nil
+	}
+	tmpl, err := template.New(name).Funcs(templateFuncs).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("parsing %s template: %v", name, err)
+	}
+	var b strings.Builder
+	if err := tmpl.Execute(&b, data); err != nil {
+		return "", fmt.Errorf("executing %s template: %v", name, err)
+	}
+	return b.String(), nil
+}
@@ -0,0 +1,481 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptrace"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// debugBodyLimit is the most of each request and response body written to the -debug-http file.
+const debugBodyLimit = 64 << 10
+
+// sensitiveHeaders are replaced in the -debug-http file whatever their value. GitLab takes the
+// token in PRIVATE-TOKEN rather than Authorization.
+var sensitiveHeaders = map[string]bool{
+	"Authorization":       true,
+	"Proxy-Authorization": true,
+	"Cookie":              true,
+	"Set-Cookie":          true,
+	"Private-Token":       true,
+}
+
+// processStart is when the command started, the start of the span of the whole command.
+var processStart = time.Now()
+
+var (
+	tracingMu sync.Mutex
+	// httpDumps are the open -debug-http files by path, shared by the transports of a command.
+	httpDumps = map[string]*httpDump{}
+	// tracer collects the spans of the command when an OpenTelemetry endpoint is configured.
+	tracer *spanExporter
+)
+
+// traceTransport wraps the transport with a tracingTransport if -debug-http or an OpenTelemetry
+// endpoint is set, and returns it as it is otherwise.
+func (cf *clientFlags) traceTransport(transport http.RoundTripper) (http.RoundTripper, error) {
+	endpoint := otelEndpoint(cf.otelEndpoint)
+	if cf.debugHTTP == "" && endpoint == "" {
+		return transport, nil
+	}
+	tracingMu.Lock()
+	defer tracingMu.Unlock()
+	t := &tracingTransport{next: transport}
+	if cf.debugHTTP != "" {
+		dump, ok := httpDumps[cf.debugHTTP]
+		if !ok {
+			f, err := os.OpenFile(cf.debugHTTP, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+			if err != nil {
+				return nil, fmt.Errorf("opening -debug-http file: %v", err)
+			}
+			dump = &httpDump{w: f}
+			httpDumps[cf.debugHTTP] = dump
+			log.Printf("warn: -debug-http is set, requests and responses are written to %s", cf.debugHTTP)
+		}
+		t.dump = dump
+	}
+	if endpoint != "" {
+		if tracer == nil {
+			tracer = newSpanExporter(endpoint)
+		}
+		t.spans = tracer
+	}
+	return t, nil
+}
+
+// otelEndpoint returns the url to send spans to, from -otel-endpoint or the standard
+// OTEL_EXPORTER_OTLP_TRACES_ENDPOINT and OTEL_EXPORTER_OTLP_ENDPOINT environment variables. The
+// traces endpoint is used as it is while /v1/traces is added to the others.
+func otelEndpoint(flagValue string) string {
+	if flagValue != "" {
+		return strings.TrimSuffix(flagValue, "/") + "/v1/traces"
+	}
+	if endpoint := os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT"); endpoint != "" {
+		return endpoint
+	}
+	if endpoint := os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT"); endpoint != "" {
+		return strings.TrimSuffix(endpoint, "/") + "/v1/traces"
+	}
+	return ""
+}
+
+// tracingTransport writes every request and response to the -debug-http file and records a span
+// for each of them.
+type tracingTransport struct {
+	next  http.RoundTripper
+	dump  *httpDump
+	spans *spanExporter
+}
+
+// requestTimings are the times of the stages of a request, recorded by an httptrace.ClientTrace.
+type requestTimings struct {
+	mu                        sync.Mutex
+	dnsStart, dnsDone         time.Time
+	connectStart, connectDone time.Time
+	tlsStart, tlsDone         time.Time
+	firstByte                 time.Time
+	reused                    bool
+}
+
+func (rt *requestTimings) clientTrace() *httptrace.ClientTrace {
+	set := func(t *time.Time) func() {
+		return func() {
+			rt.mu.Lock()
+			defer rt.mu.Unlock()
+			if t.IsZero() {
+				*t = time.Now()
+			}
+		}
+	}
+	return &httptrace.ClientTrace{
+		DNSStart:             func(httptrace.DNSStartInfo) { set(&rt.dnsStart)() },
+		DNSDone:              func(httptrace.DNSDoneInfo) { set(&rt.dnsDone)() },
+		ConnectStart:         func(string, string) { set(&rt.connectStart)() },
+		ConnectDone:          func(string, string, error) { set(&rt.connectDone)() },
+		TLSHandshakeStart:    set(&rt.tlsStart),
+		TLSHandshakeDone:     func(tls.ConnectionState, error) { set(&rt.tlsDone)() },
+		GotFirstResponseByte: set(&rt.firstByte),
+		GotConn: func(info httptrace.GotConnInfo) {
+			rt.mu.Lock()
+			defer rt.mu.Unlock()
+			rt.reused = info.Reused
+		},
+	}
+}
+
+// summary describes the timings relative to the start of the request, e.g.
+// "dns 3ms, connect 12ms, tls 40ms, first byte 210ms".
+func (rt *requestTimings) summary(start time.Time) string {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	var parts []string
+	if rt.reused {
+		parts = append(parts, "reused connection")
+	}
+	add := func(name string, from, to time.Time) {
+		if !from.IsZero() && !to.IsZero() {
+			parts = append(parts, fmt.Sprintf("%s %s", name, to.Sub(from).Round(time.Millisecond)))
+		}
+	}
+	add("dns", rt.dnsStart, rt.dnsDone)
+	add("connect", rt.connectStart, rt.connectDone)
+	add("tls", rt.tlsStart, rt.tlsDone)
+	add("first byte", start, rt.firstByte)
+	return strings.Join(parts, ", ")
+}
+
+func (t *tracingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	timings := &requestTimings{}
+	traced := req.WithContext(httptrace.WithClientTrace(req.Context(), timings.clientTrace()))
+
+	var reqBody []byte
+	if t.dump != nil && isTextual(req.Header.Get("Content-Type")) && req.GetBody != nil && req.ContentLength <= debugBodyLimit {
+		if body, err := req.GetBody(); err == nil {
+			reqBody, _ = io.ReadAll(body)
+			body.Close()
+		}
+	}
+
+	start := time.Now()
+	resp, err := t.next.RoundTrip(traced)
+	end := time.Now()
+
+	var respBody []byte
+	truncated := false
+	if t.dump != nil && err == nil && isTextual(resp.Header.Get("Content-Type")) {
+		respBody, truncated, resp.Body = peekBody(resp.Body)
+	}
+	if t.dump != nil {
+		t.dump.write(req, reqBody, resp, respBody, truncated, err, start, end.Sub(start), timings.summary(start))
+	}
+	if t.spans != nil {
+		t.spans.record(req, resp, err, start, end)
+	}
+	return resp, err
+}
+
+// peekBody reads up to debugBodyLimit of the body and returns it along with a body that reads
+// the whole of the original again.
+func peekBody(body io.ReadCloser) ([]byte, bool, io.ReadCloser) {
+	buf, err := io.ReadAll(io.LimitReader(body, debugBodyLimit+1))
+	rest := io.MultiReader(bytes.NewReader(buf), body)
+	if err != nil {
+		rest = io.MultiReader(bytes.NewReader(buf), errReader{err})
+	}
+	truncated := len(buf) > debugBodyLimit
+	if truncated {
+		buf = buf[:debugBodyLimit]
+	}
+	return buf, truncated, struct {
+		io.Reader
+		io.Closer
+	}{rest, body}
+}
+
+// errReader returns its error from every read.
+type errReader struct {
+	err error
+}
+
+func (r errReader) Read([]byte) (int, error) {
+	return 0, r.err
+}
+
+// isTextual reports whether the content type is JSON, XML or text, whose bodies are written to
+// the -debug-http file. Asset uploads and downloads are left out.
+func isTextual(contentType string) bool {
+	contentType = strings.ToLower(contentType)
+	return strings.Contains(contentType, "json") || strings.Contains(contentType, "xml") ||
+		strings.HasPrefix(contentType, "text/") || strings.Contains(contentType, "x-www-form-urlencoded")
+}
+
+// httpDump is the -debug-http file.
+type httpDump struct {
+	mu    sync.Mutex
+	w     io.Writer
+	count int
+}
+
+// write appends the request and its response, or the error, to the file. Sensitive headers are
+// replaced and the whole entry is redacted like the log output.
+func (d *httpDump) write(req *http.Request, reqBody []byte, resp *http.Response, respBody []byte, truncated bool, err error, start time.Time, elapsed time.Duration, timings string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.count++
+	var b strings.Builder
+	fmt.Fprintf(&b, "=== #%d %s %s %s\n", d.count, start.UTC().Format(time.RFC3339Nano), req.Method, req.URL)
+	writeHeaders(&b, "> ", req.Header)
+	if len(reqBody) > 0 {
+		fmt.Fprintf(&b, ">\n%s\n", reqBody)
+	} else if req.ContentLength > 0 {
+		fmt.Fprintf(&b, ">\n(%d byte body not shown)\n", req.ContentLength)
+	}
+	if timings != "" {
+		timings = ", " + timings
+	}
+	if err != nil {
+		fmt.Fprintf(&b, "! error after %s%s: %v\n\n", elapsed.Round(time.Millisecond), timings, err)
+	} else {
+		fmt.Fprintf(&b, "< %s %s (%s%s)\n", resp.Proto, resp.Status, elapsed.Round(time.Millisecond), timings)
+		writeHeaders(&b, "< ", resp.Header)
+		if len(respBody) > 0 {
+			fmt.Fprintf(&b, "<\n%s\n", respBody)
+			if truncated {
+				fmt.Fprintf(&b, "(truncated at %d bytes)\n", debugBodyLimit)
+			}
+		} else if resp.ContentLength > 0 {
+			fmt.Fprintf(&b, "<\n(%d byte body not shown)\n", resp.ContentLength)
+		}
+		b.WriteString("\n")
+	}
+	if _, err := io.WriteString(d.w, redact(b.String())); err != nil {
+		log.Printf("warn: writing -debug-http file: %v", err)
+	}
+}
+
+// writeHeaders writes the headers one per line, sorted, with the prefix.
+func writeHeaders(b *strings.Builder, prefix string, header http.Header) {
+	names := make([]string, 0, len(header))
+	for name := range header {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		for _, value := range header[name] {
+			if sensitiveHeaders[http.CanonicalHeaderKey(name)] {
+				value = "[REDACTED]"
+			}
+			fmt.Fprintf(b, "%s%s: %s\n", prefix, name, value)
+		}
+	}
+}
+
+// span is a finished OpenTelemetry span, in the OTLP/HTTP JSON encoding.
+type span struct {
+	TraceID      string          `json:"traceId"`
+	SpanID       string          `json:"spanId"`
+	ParentSpanID string          `json:"parentSpanId,omitempty"`
+	Name         string          `json:"name"`
+	Kind         int             `json:"kind"`
+	Start        string          `json:"startTimeUnixNano"`
+	End          string          `json:"endTimeUnixNano"`
+	Attributes   []spanAttribute `json:"attributes,omitempty"`
+	Status       spanStatus      `json:"status"`
+}
+
+// The span kinds and status codes of OTLP.
+const (
+	spanKindInternal = 1
+	spanKindClient   = 3
+
+	spanStatusUnset = 0
+	spanStatusError = 2
+)
+
+type spanAttribute struct {
+	Key   string    `json:"key"`
+	Value spanValue `json:"value"`
+}
+
+type spanValue struct {
+	String *string `json:"stringValue,omitempty"`
+	Int    *string `json:"intValue,omitempty"`
+}
+
+type spanStatus struct {
+	Code    int    `json:"code,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+func stringAttribute(key, value string) spanAttribute {
+	return spanAttribute{Key: key, Value: spanValue{String: &value}}
+}
+
+func intAttribute(key string, value int64) spanAttribute {
+	s := strconv.FormatInt(value, 10)
+	return spanAttribute{Key: key, Value: spanValue{Int: &s}}
+}
+
+// spanExporter collects a span for every api call and sends them to the OTLP/HTTP endpoint, as
+// children of a span for the whole command, when the command finishes. The trace continues the
+// one in the TRACEPARENT environment variable if a CI system sets it.
+type spanExporter struct {
+	mu       sync.Mutex
+	endpoint string
+	traceID  string
+	parentID string
+	rootID   string
+	spans    []span
+}
+
+func newSpanExporter(endpoint string) *spanExporter {
+	e := &spanExporter{endpoint: endpoint, traceID: randomHex(16), rootID: randomHex(8)}
+	// traceparent is version-traceid-parentid-flags.
+	if parts := strings.Split(os.Getenv("TRACEPARENT"), "-"); len(parts) == 4 && len(parts[1]) == 32 && len(parts[2]) == 16 {
+		e.traceID, e.parentID = parts[1], parts[2]
+	}
+	return e
+}
+
+// randomHex returns n random bytes in hex.
+func randomHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func unixNano(t time.Time) string {
+	return strconv.FormatInt(t.UnixNano(), 10)
+}
+
+// record adds the span of a request, named after its method as the HTTP semantic conventions
+// recommend.
+func (e *spanExporter) record(req *http.Request, resp *http.Response, err error, start, end time.Time) {
+	s := span{
+		TraceID:      e.traceID,
+		SpanID:       randomHex(8),
+		ParentSpanID: e.rootID,
+		Name:         req.Method,
+		Kind:         spanKindClient,
+		Start:        unixNano(start),
+		End:          unixNano(end),
+		Attributes: []spanAttribute{
+			stringAttribute("http.request.method", req.Method),
+			stringAttribute("url.full", redact(req.URL.String())),
+			stringAttribute("server.address", req.URL.Hostname()),
+		},
+	}
+	switch {
+	case err != nil:
+		s.Status = spanStatus{Code: spanStatusError, Message: redact(err.Error())}
+		s.Attributes = append(s.Attributes, stringAttribute("error.type", fmt.Sprintf("%T", err)))
+	default:
+		s.Attributes = append(s.Attributes, intAttribute("http.response.status_code", int64(resp.StatusCode)))
+		if resp.StatusCode >= 400 {
+			s.Status = spanStatus{Code: spanStatusError}
+			s.Attributes = append(s.Attributes, stringAttribute("error.type", strconv.Itoa(resp.StatusCode)))
+		}
+		if id := resp.Header.Get("X-GitHub-Request-Id"); id != "" {
+			s.Attributes = append(s.Attributes, stringAttribute("github.request_id", id))
+		}
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.spans = append(e.spans, s)
+}
+
+// finishTracing sends the spans of the command, if an OpenTelemetry endpoint is configured. A
+// failure to send them is logged and does not fail the command.
+func finishTracing(command string, cmdErr error) {
+	tracingMu.Lock()
+	e := tracer
+	tracingMu.Unlock()
+	if e == nil {
+		return
+	}
+	if err := e.export(command, cmdErr); err != nil {
+		log.Printf("warn: sending spans to %s: %v", e.endpoint, err)
+	}
+}
+
+// export sends the spans and the span of the whole command in one OTLP/HTTP JSON request. The
+// OTEL_EXPORTER_OTLP_HEADERS and OTEL_SERVICE_NAME environment variables are used like the
+// OpenTelemetry SDKs do.
+func (e *spanExporter) export(command string, cmdErr error) error {
+	root := span{
+		TraceID:      e.traceID,
+		SpanID:       e.rootID,
+		ParentSpanID: e.parentID,
+		Name:         "githubrelease " + command,
+		Kind:         spanKindInternal,
+		Start:        unixNano(processStart),
+		End:          unixNano(time.Now()),
+		Attributes:   []spanAttribute{stringAttribute("githubrelease.command", command)},
+		Status:       spanStatus{Code: spanStatusUnset},
+	}
+	if cmdErr != nil {
+		root.Status = spanStatus{Code: spanStatusError, Message: redact(cmdErr.Error())}
+	}
+	e.mu.Lock()
+	spans := append([]span{root}, e.spans...)
+	e.mu.Unlock()
+
+	service := os.Getenv("OTEL_SERVICE_NAME")
+	if service == "" {
+		service = "githubrelease"
+	}
+	payload := map[string]interface{}{
+		"resourceSpans": []interface{}{map[string]interface{}{
+			"resource": map[string]interface{}{
+				"attributes": []spanAttribute{
+					stringAttribute("service.name", service),
+					stringAttribute("service.version", version),
+				},
+			},
+			"scopeSpans": []interface{}{map[string]interface{}{
+				"scope": map[string]string{"name": "githubrelease", "version": version},
+				"spans": spans,
+			}},
+		}},
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "POST", e.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", userAgent())
+	for _, header := range strings.Split(os.Getenv("OTEL_EXPORTER_OTLP_HEADERS"), ",") {
+		if name, value, ok := strings.Cut(header, "="); ok {
+			req.Header.Set(strings.TrimSpace(name), strings.TrimSpace(value))
+		}
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	log.Printf("debug: sent %d spans to %s", len(spans), e.endpoint)
+	return nil
+}
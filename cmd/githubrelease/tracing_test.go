@@ -0,0 +1,42 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestDebugHTTPRedactsTokens(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Set-Cookie", "session=response-secret")
+		w.Write([]byte("{}"))
+	}))
+	defer srv.Close()
+
+	var out bytes.Buffer
+	transport := &tracingTransport{next: http.DefaultTransport, dump: &httpDump{w: &out}}
+	for _, header := range []string{"Authorization", "PRIVATE-TOKEN", "Private-Token"} {
+		req, err := http.NewRequest(http.MethodGet, srv.URL+"/api/v4/projects/1/releases", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// The header is set without canonicalizing it, as it could be sent by any client.
+		req.Header[header] = []string{"glpat-request-secret"}
+		resp, err := transport.RoundTrip(req)
+		if err != nil {
+			t.Fatalf("RoundTrip: %v", err)
+		}
+		resp.Body.Close()
+
+		dump := out.String()
+		out.Reset()
+		if strings.Contains(dump, "request-secret") || strings.Contains(dump, "response-secret") {
+			t.Errorf("-debug-http output with %s has a token in it:\n%s", header, dump)
+		}
+		if !strings.Contains(dump, "> "+header+": [REDACTED]\n") {
+			t.Errorf("-debug-http output does not have %s as [REDACTED]:\n%s", header, dump)
+		}
+	}
+}
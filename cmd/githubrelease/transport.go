@@ -0,0 +1,173 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+
+	"github.com/imitablerabbit/githubrelease/pkg/release"
+)
+
+// sharedTransport is the transport of a command, which is built once.
+type sharedTransport struct {
+	once      sync.Once
+	transport http.RoundTripper
+	err       error
+}
+
+// negatedBool is a boolean flag that sets the opposite of its value, for a flag that is on by
+// default and an option that turns it off, such as -http2 and DisableHTTP2.
+type negatedBool struct {
+	disable *bool
+}
+
+func (b negatedBool) String() string {
+	if b.disable == nil {
+		return "true"
+	}
+	return strconv.FormatBool(!*b.disable)
+}
+
+func (b negatedBool) Set(value string) error {
+	enabled, err := strconv.ParseBool(value)
+	if err != nil {
+		return err
+	}
+	*b.disable = !enabled
+	return nil
+}
+
+func (b negatedBool) IsBoolFlag() bool {
+	return true
+}
+
+// transport returns the transport used for every request of the command. It is built once and
+// shared, so that the clients for several repos, notifications and uploads reuse the same
+// connections.
+func (cf *clientFlags) transport() (http.RoundTripper, error) {
+	if cf.shared == nil {
+		return cf.buildTransport()
+	}
+	cf.shared.once.Do(func() {
+		cf.shared.transport, cf.shared.err = cf.buildTransport()
+	})
+	return cf.shared.transport, cf.shared.err
+}
+
+// buildTransport returns the transport of the flags, traced if -debug-http or -otel-endpoint is
+// set and audited if -audit-log is set.
+func (cf *clientFlags) buildTransport() (http.RoundTripper, error) {
+	transport, err := cf.newTransport()
+	if err != nil {
+		return nil, err
+	}
+	traced, err := cf.traceTransport(transport)
+	if err != nil {
+		return nil, err
+	}
+	return cf.auditTransport(traced)
+}
+
+// newTransport returns a transport configured with the connection, TLS and proxy flags. The proxy
+// environment variables are used unless -proxy is given.
+func (cf *clientFlags) newTransport() (*http.Transport, error) {
+	opts, err := cf.transportOptions()
+	if err != nil {
+		return nil, err
+	}
+	transport := release.NewTransport(opts)
+	if cf.proxy != "" {
+		proxyURL, err := url.Parse(cf.proxy)
+		if err != nil || proxyURL.Host == "" {
+			return nil, fmt.Errorf("invalid -proxy %q", cf.proxy)
+		}
+		transport.Proxy = http.ProxyURL(proxyURL)
+	}
+
+	config := transport.TLSClientConfig
+	if cf.caCert != "" {
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		pem, err := ioutil.ReadFile(cf.caCert)
+		if err != nil {
+			return nil, fmt.Errorf("reading CA certificates: %v", err)
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", cf.caCert)
+		}
+		config.RootCAs = pool
+	}
+	if cf.clientCert != "" || cf.clientKey != "" {
+		if cf.clientCert == "" || cf.clientKey == "" {
+			return nil, fmt.Errorf("-client-cert and -client-key must be used together")
+		}
+		cert, err := tls.LoadX509KeyPair(cf.clientCert, cf.clientKey)
+		if err != nil {
+			return nil, fmt.Errorf("loading client certificate: %v", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	if cf.insecure {
+		log.Printf("warn: ********************************************************************")
+		log.Printf("warn: -insecure-skip-verify is set, server certificates are NOT verified.")
+		log.Printf("warn: The token and release assets can be intercepted. Use -ca-cert instead.")
+		log.Printf("warn: ********************************************************************")
+		config.InsecureSkipVerify = true
+	}
+	return transport, nil
+}
+
+// transportOptions returns the connection options with the TLS versions and cipher suites of the
+// -tls-min-version, -tls-cipher-suites and -fips flags.
+func (cf *clientFlags) transportOptions() (release.TransportOptions, error) {
+	opts := cf.conns
+	if cf.fips {
+		if cf.insecure {
+			return opts, fmt.Errorf("-fips cannot be used with -insecure-skip-verify")
+		}
+		if cf.tlsMinVersion == "1.3" {
+			return opts, fmt.Errorf("-fips uses TLS 1.2, because the TLS 1.3 cipher suites cannot be limited to approved ones")
+		}
+		opts = release.FIPSTransportOptions(opts)
+	}
+	if cf.tlsMinVersion != "" {
+		version, err := release.ParseTLSVersion(cf.tlsMinVersion)
+		if err != nil {
+			return opts, fmt.Errorf("invalid -tls-min-version: %v", err)
+		}
+		opts.MinTLSVersion = version
+	}
+	if cf.tlsCipherSuites != "" {
+		suites, err := release.ParseCipherSuites(cf.tlsCipherSuites)
+		if err != nil {
+			return opts, fmt.Errorf("invalid -tls-cipher-suites: %v", err)
+		}
+		if cf.fips {
+			for _, suite := range suites {
+				if !containsSuite(release.FIPSCipherSuites, suite) {
+					return opts, fmt.Errorf("-fips does not allow the TLS cipher suite %s", tls.CipherSuiteName(suite))
+				}
+			}
+		}
+		opts.CipherSuites = suites
+	}
+	return opts, nil
+}
+
+// containsSuite returns whether the cipher suite is one of the suites.
+func containsSuite(suites []uint16, suite uint16) bool {
+	for _, s := range suites {
+		if s == suite {
+			return true
+		}
+	}
+	return false
+}
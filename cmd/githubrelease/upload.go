@@ -0,0 +1,787 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/imitablerabbit/githubrelease/pkg/release"
+)
+
+// uploadFlags are the flags that control which assets are uploaded and how.
+type uploadFlags struct {
+	uploads        string
+	recursive      bool
+	assets         stringsFlag
+	include        stringsFlag
+	exclude        stringsFlag
+	manifest       string
+	uploadTimeout  time.Duration
+	failFast       bool
+	concurrency    int
+	contentTypes   string
+	checksums      string
+	checksumsFile  string
+	sign           string
+	signKey        string
+	signTarget     string
+	verify         bool
+	clobber        bool
+	skipExisting   bool
+	skipUnchanged  bool
+	quiet          bool
+	resume         bool
+	stateFile      string
+	stateDir       string
+	failPartial    bool
+	sbom           string
+	sbomFiles      stringsFlag
+	sbomModule     string
+	provenance     bool
+	builderID      string
+	signProvenance bool
+	relManifest    bool
+	metadata       string
+	pkg            bool
+	publishPkgs    bool
+	compress       string
+	compressLevel  int
+	recompress     bool
+	assetSHA256    stringsFlag
+	splitLarge     bool
+	splitSize      string
+	scan           string
+	scanClamd      string
+	scanCommand    string
+
+	// flags is the flag set, which is needed to find the config file for -package. The archives
+	// are named after packageTag and projectName, which the command sets before preparing them.
+	flags       *flag.FlagSet
+	packageTag  string
+	projectName string
+
+	// sboms are the SBOM assets found by prepareAssets, which create lists in the release notes.
+	sboms []release.AssetUpload
+
+	// splits are the assets that prepareAssets split into parts, which create explains how to
+	// join in the release notes.
+	splits []splitAsset
+
+	// scans are the results of -scan, which are recorded in the integrity manifest.
+	scans *scanReport
+
+	// client are the api flags of the command, whose -fips also limits the checksums and
+	// signatures to SHA-2.
+	client *clientFlags
+}
+
+// addUploadFlags registers the asset upload flags on the flag set of a command with the api flags
+// cf.
+func addUploadFlags(fs *flag.FlagSet, cf *clientFlags) *uploadFlags {
+	uf := &uploadFlags{flags: fs, client: cf}
+
+	// The folder that contains all of the files that should be uploaded as part of the release.
+	// If there are no files found in the folder, then no files will be uploaded as part of the release. The upload
+	// URL can be retrieved later on for manual upload by using the github api to list details of the release.
+	fs.StringVar(&uf.uploads, "uploads", "uploads/", "Directory that contains all of the tar.gx files that should be uploaded with the release")
+
+	// Assets can also be picked individually or with globs, which avoids restaging build output.
+	fs.Var(&uf.assets, "asset", "File, directory or glob pattern (with ** support) to upload, as pattern[#name][=label]. An http or https URL is streamed from its origin. Can be repeated, replaces the uploads directory scan")
+	fs.Var(&uf.assetSHA256, "asset-sha256", "The expected sha256 of an asset streamed from a URL, as name=sha256. The upload fails if the stream does not match. Can be repeated")
+	fs.BoolVar(&uf.recursive, "recursive", false, "Include files in sub directories of the uploads directory")
+	fs.Var(&uf.include, "include", "Only upload files whose names match this glob pattern. Can be repeated")
+	fs.Var(&uf.exclude, "exclude", "Do not upload files whose names match this glob pattern. Can be repeated")
+
+	// A manifest file listing the files to upload, used instead of scanning the uploads directory.
+	fs.StringVar(&uf.manifest, "manifest", "", "Text or JSON file listing the files to upload, with optional name and label overrides. Replaces the uploads directory scan")
+
+	// Each asset upload gets its own timeout so that one slow upload does not affect the others.
+	fs.DurationVar(&uf.uploadTimeout, "upload-timeout", 0, "Maximum time allowed for a single asset upload, e.g. 20m. Zero means no timeout")
+
+	// Stop uploading any further assets after the first failed upload rather than attempting all of them.
+	fs.BoolVar(&uf.failFast, "fail-fast", false, "Stop uploading assets after the first failed upload")
+
+	// Upload several assets at once, which is a lot faster for releases with many platform archives.
+	fs.IntVar(&uf.concurrency, "upload-concurrency", 1, "Number of assets to upload at the same time")
+
+	// GitHub rejects assets with the same name as one already on the release.
+	fs.BoolVar(&uf.clobber, "clobber", false, "Delete assets already on the release with the same name as an asset being uploaded")
+	fs.BoolVar(&uf.skipExisting, "skip-existing", false, "Skip uploading assets that are already on the release with the same name")
+	fs.BoolVar(&uf.skipUnchanged, "skip-unchanged", false, "Skip uploading assets that are already on the release with the same name, size and sha256, and replace those that have changed")
+
+	// A truncated upload can still get a 201, so check the assets on the release afterwards.
+	fs.BoolVar(&uf.verify, "verify-uploads", true, "After uploading, check that every asset is on the release with the right size and re-upload any that are not")
+
+	// A release that is missing assets is broken, so CI should notice by default.
+	fs.BoolVar(&uf.failPartial, "fail-on-partial-upload", true, "Exit with status 7 if any asset fails to upload. With -fail-on-partial-upload=false the failures are only logged")
+
+	// Completed uploads are recorded so that an interrupted session can be continued.
+	fs.BoolVar(&uf.resume, "resume", false, "Continue the interrupted upload session in -state-file, skipping the assets it uploaded and replacing partial ones")
+	fs.StringVar(&uf.stateFile, "state-file", "", "File that records the completed uploads of the session for -resume. It is removed once every asset is uploaded. No state is kept unless it or -state-dir is given, so runs leave nothing in the working directory")
+	fs.StringVar(&uf.stateDir, "state-dir", "", "Directory to keep a journal of the uploads to each release in, used instead of -state-file. A rerun after a crash continues the release in its journal without -resume")
+
+	// Progress bars are drawn on a terminal, or a line is logged every 25% for CI logs.
+	fs.BoolVar(&uf.quiet, "quiet", false, "Do not report the progress of asset uploads")
+
+	// Checksums of all the assets are generated and uploaded with them.
+	fs.StringVar(&uf.checksums, "checksums", "", "Comma separated checksum algorithms (sha256, sha512, sha1, md5) to generate a checksums file for and upload with the assets")
+	fs.StringVar(&uf.checksumsFile, "checksums-file", "checksums.txt", "Name of the uploaded checksums file")
+
+	// Signatures are generated for the assets, or only the checksums files, and uploaded with them.
+	fs.StringVar(&uf.sign, "sign", "", "Sign the assets with gpg or cosign and upload the signatures with them")
+	fs.StringVar(&uf.signKey, "sign-key", "", "The gpg key id or cosign key to sign with. Defaults to the gpg default key or cosign keyless signing")
+	fs.StringVar(&uf.signTarget, "sign-artifacts", "all", "Which assets to sign, all or checksums")
+
+	// The archives described in the package section of the config file are built and uploaded.
+	fs.BoolVar(&uf.pkg, "package", false, "Build the archives described in the package section of the config file and upload them with the assets")
+
+	// The .deb and .rpm assets are published to the apt and yum repositories in the config file.
+	fs.BoolVar(&uf.publishPkgs, "publish-packages", false, "Publish the uploaded .deb and .rpm assets to the repositories in the package-repos section of the config file")
+
+	// Raw binaries are compressed before they are uploaded, and tarballs can be made smaller.
+	fs.StringVar(&uf.compress, "compress", compressNone, "Compress the assets that aren't already compressed before uploading them, zstd, gzip or none")
+	fs.IntVar(&uf.compressLevel, "compress-level", 0, "The level of -compress and -recompress, 1 to 9 for gzip and 1 to 19 for zstd. Zero uses the default level")
+	fs.BoolVar(&uf.recompress, "recompress", false, "Recompress the .tar.gz and .tgz assets as .tar.zst with zstd")
+
+	// GitHub rejects assets of 2 GiB or more, so larger ones can be uploaded in numbered parts.
+	fs.BoolVar(&uf.splitLarge, "split-large-assets", false, "Split the assets larger than -split-size into numbered parts, e.g. app.iso.001, and explain how to join them in the release notes")
+	fs.StringVar(&uf.splitSize, "split-size", defaultSplitSize, "The largest part of an asset split by -split-large-assets, e.g. 1GiB")
+
+	// The assets are scanned for malware and the release is stopped if any is found.
+	fs.StringVar(&uf.scan, "scan", "", "Scan the assets for malware before uploading them and fail if any is found, with clamd or command")
+	fs.StringVar(&uf.scanClamd, "scan-clamd", "", "The unix socket path or host:port of clamd for -scan clamd. Defaults to the usual socket paths")
+	fs.StringVar(&uf.scanCommand, "scan-command", "", "The command for -scan command, run with the path of each asset as its last argument. It should exit 0 if the asset is clean and 1 if it is infected, like clamscan")
+
+	// A software bill of materials is generated for the Go module, or pre-built ones are attached.
+	fs.StringVar(&uf.sbom, "sbom", "", "Generate an SBOM of the Go module in -sbom-module, spdx or cyclonedx, and upload it with the assets")
+	fs.Var(&uf.sbomFiles, "sbom-file", "A pre-built SPDX or CycloneDX SBOM to upload with the assets. Can be repeated")
+	fs.StringVar(&uf.sbomModule, "sbom-module", ".", "Directory of the Go module to generate the -sbom for")
+
+	// A SLSA provenance statement records where and how the assets were built.
+	fs.BoolVar(&uf.provenance, "provenance", false, "Generate a SLSA v1 provenance statement for the assets and upload it as "+provenanceFileName)
+	fs.StringVar(&uf.builderID, "provenance-builder-id", "", "The builder id of the provenance. Defaults to the workflow in GitHub Actions and is required elsewhere")
+	fs.BoolVar(&uf.signProvenance, "sign-provenance", false, "Sign the provenance with cosign, using -sign-key if -sign is cosign")
+
+	// An integrity manifest records the size, digest and build of every asset for verify.
+	fs.BoolVar(&uf.relManifest, "release-manifest", false, "Generate "+releaseManifestName+" with the size, sha256 and build metadata of every asset and upload it with them")
+
+	// Labels, content types and the upload order can be given for the assets by name.
+	fs.StringVar(&uf.metadata, "asset-metadata", "", "JSON file of asset name patterns with the label, content type and order to upload the matching assets in")
+
+	// The content type is detected from the extension and contents of each file, this overrides it.
+	fs.StringVar(&uf.contentTypes, "content-type-map", "", "Comma separated extension=content-type overrides, e.g. .whl=application/zip,.sum=text/plain")
+
+	return uf
+}
+
+// prepareAssets lists the assets to upload and generates any extra files that are uploaded with
+// them, such as checksums. The returned cleanup function removes the generated files and must
+// be called once the uploads are finished, even if an error is returned.
+func (uf *uploadFlags) prepareAssets() ([]release.AssetUpload, func(), error) {
+	var tempDirs []string
+	cleanup := func() {
+		for _, dir := range tempDirs {
+			os.RemoveAll(dir)
+		}
+	}
+
+	if uf.clobber && uf.skipExisting {
+		return nil, cleanup, fmt.Errorf("-clobber and -skip-existing cannot be used together")
+	}
+	if uf.skipUnchanged && (uf.clobber || uf.skipExisting) {
+		return nil, cleanup, fmt.Errorf("-skip-unchanged cannot be used with -clobber or -skip-existing")
+	}
+	if uf.resume && (uf.clobber || uf.skipExisting || uf.skipUnchanged) {
+		return nil, cleanup, fmt.Errorf("-resume cannot be used with -clobber, -skip-existing or -skip-unchanged")
+	}
+	if err := checkCompress(uf.compress, uf.compressLevel); err != nil {
+		return nil, cleanup, err
+	}
+	if uf.recompress {
+		if err := checkCompress(compressZstd, uf.compressLevel); err != nil {
+			return nil, cleanup, err
+		}
+	}
+	assets, err := uf.listAssets()
+	if err != nil {
+		return nil, cleanup, err
+	}
+	if err := uf.prepareRemoteAssets(assets); err != nil {
+		return nil, cleanup, err
+	}
+	if uf.pkg {
+		packages, dir, err := uf.buildPackages()
+		if err != nil {
+			return nil, cleanup, fmt.Errorf("packaging: %v", err)
+		}
+		tempDirs = append(tempDirs, dir)
+		assets = append(assets, packages...)
+	}
+	// The assets are compressed first so that the checksums and signatures are of what is uploaded.
+	if (uf.compress != "" && uf.compress != compressNone) || uf.recompress {
+		compressed, dir, err := compressAssets(assets, uf.compress, uf.compressLevel, uf.recompress)
+		if err != nil {
+			return nil, cleanup, err
+		}
+		tempDirs = append(tempDirs, dir)
+		assets = compressed
+	}
+	// The parts of split assets are checksummed and signed like any other asset.
+	uf.splits = nil
+	if uf.splitLarge {
+		size, err := parseSplitSize(uf.splitSize)
+		if err != nil {
+			return nil, cleanup, err
+		}
+		var dir string
+		assets, uf.splits, dir, err = splitAssets(assets, size)
+		if dir != "" {
+			tempDirs = append(tempDirs, dir)
+		}
+		if err != nil {
+			return nil, cleanup, err
+		}
+	} else if err := checkAssetSizes(assets); err != nil {
+		return nil, cleanup, err
+	}
+	// What is uploaded is scanned, after it has been compressed and split.
+	uf.scans = nil
+	if uf.scan != "" {
+		if uf.scans, err = uf.scanAssets(assets); err != nil {
+			return nil, cleanup, err
+		}
+	}
+	// The SBOMs are added before the checksums and signatures so that they are covered by them.
+	uf.sboms = nil
+	if uf.sbom != "" {
+		sbom, dir, err := generateSBOM(uf.sbom, uf.sbomModule)
+		if err != nil {
+			return nil, cleanup, fmt.Errorf("generating sbom: %v", err)
+		}
+		tempDirs = append(tempDirs, dir)
+		uf.sboms = append(uf.sboms, sbom)
+	}
+	for _, path := range uf.sbomFiles {
+		sbom, err := sbomFileAsset(path)
+		if err != nil {
+			return nil, cleanup, err
+		}
+		uf.sboms = append(uf.sboms, sbom)
+	}
+	assets = append(assets, uf.sboms...)
+	var checksums []release.AssetUpload
+	if uf.checksums != "" {
+		if err := uf.checkFIPSChecksums(); err != nil {
+			return nil, cleanup, err
+		}
+		var dir string
+		checksums, dir, err = checksumAssets(assets, uf.checksums, uf.checksumsFile)
+		if err != nil {
+			return nil, cleanup, fmt.Errorf("generating checksums: %v", err)
+		}
+		tempDirs = append(tempDirs, dir)
+		assets = append(assets, checksums...)
+	}
+	// The integrity manifest is signed and covered by the provenance like the other assets.
+	if uf.relManifest {
+		m, dir, err := generateReleaseManifest(assets, uf.scans)
+		if err != nil {
+			return nil, cleanup, err
+		}
+		tempDirs = append(tempDirs, dir)
+		assets = append(assets, m)
+	}
+	// The provenance covers every asset but the signatures, which are made from the assets.
+	var provenance []release.AssetUpload
+	if uf.provenance {
+		var dir string
+		signKey := ""
+		if uf.sign == "cosign" {
+			signKey = uf.signKey
+		}
+		provenance, dir, err = generateProvenance(assets, uf.builderID, uf.signProvenance, signKey)
+		if err != nil {
+			return nil, cleanup, fmt.Errorf("generating provenance: %v", err)
+		}
+		tempDirs = append(tempDirs, dir)
+	} else if uf.signProvenance {
+		return nil, cleanup, fmt.Errorf("-sign-provenance requires -provenance")
+	}
+	if uf.sign != "" {
+		signatures, dir, err := uf.signAssets(assets, checksums)
+		if err != nil {
+			return nil, cleanup, err
+		}
+		tempDirs = append(tempDirs, dir)
+		assets = append(assets, signatures...)
+	}
+	assets = append(assets, provenance...)
+	// The metadata applies to the generated assets as well, so that checksums can be put last.
+	if uf.metadata != "" {
+		metadata, err := readAssetMetadata(uf.metadata)
+		if err != nil {
+			return nil, cleanup, err
+		}
+		assets = applyAssetMetadata(assets, metadata)
+		if uf.concurrency > 1 {
+			log.Printf("warn: the -asset-metadata order is only kept with an -upload-concurrency of 1, as the assets are listed in the order they finish uploading")
+		}
+	}
+	if err := checkDuplicateNames(assets); err != nil {
+		return nil, cleanup, err
+	}
+	return assets, cleanup, nil
+}
+
+// fips returns whether -fips is set, which limits the checksums and signatures to SHA-2.
+func (uf *uploadFlags) fips() bool {
+	return uf.client != nil && uf.client.fips
+}
+
+// checkFIPSChecksums returns an error if -fips is set and -checksums has an algorithm that is not
+// SHA-2.
+func (uf *uploadFlags) checkFIPSChecksums() error {
+	if !uf.fips() {
+		return nil
+	}
+	for _, alg := range strings.Split(uf.checksums, ",") {
+		if alg = strings.ToLower(strings.TrimSpace(alg)); !release.IsSHA2(alg) {
+			return fmt.Errorf("-fips only allows sha256 and sha512 -checksums, not %s", alg)
+		}
+	}
+	return nil
+}
+
+// signAssets signs the assets selected by -sign-artifacts, either all of them or only the
+// generated checksums files. Any failure to sign is returned as an error so that an unsigned
+// release is never created.
+func (uf *uploadFlags) signAssets(assets, checksums []release.AssetUpload) ([]release.AssetUpload, string, error) {
+	s, err := newSigner(uf.sign, uf.signKey, uf.fips())
+	if err != nil {
+		return nil, "", err
+	}
+	toSign := assets
+	switch uf.signTarget {
+	case "all":
+	case "checksums":
+		if uf.checksums == "" {
+			return nil, "", fmt.Errorf("-sign-artifacts checksums requires -checksums")
+		}
+		toSign = checksums
+	default:
+		return nil, "", fmt.Errorf("unsupported -sign-artifacts %q, expected all or checksums", uf.signTarget)
+	}
+	signatures, dir, err := signAssets(s, toSign)
+	if err != nil {
+		return nil, "", fmt.Errorf("signing assets: %v", err)
+	}
+	return signatures, dir, nil
+}
+
+// listAssets returns the assets to upload. These come from the manifest and -asset flags if
+// either is given, otherwise the uploads directory is scanned. The include and exclude filters
+// apply to everything except the manifest, which is an explicit list.
+func (uf *uploadFlags) listAssets() ([]release.AssetUpload, error) {
+	var found []release.AssetUpload
+	for _, value := range uf.assets {
+		matched, err := expandAssetFlag(value)
+		if err != nil {
+			return nil, fmt.Errorf("finding assets for %s: %v", value, err)
+		}
+		found = append(found, matched...)
+	}
+	// The manifest, -asset flags and -package each replace the scan of the uploads directory.
+	if uf.manifest == "" && len(uf.assets) == 0 && !uf.pkg {
+		dirAssets, err := listUploadsDir(uf.uploads, uf.recursive)
+		if err != nil {
+			return nil, fmt.Errorf("reading assets dir: %v", err)
+		}
+		found = dirAssets
+	}
+	found, err := filterAssets(found, uf.include, uf.exclude)
+	if err != nil {
+		return nil, err
+	}
+
+	var assets []release.AssetUpload
+	if uf.manifest != "" {
+		assets, err = readManifest(uf.manifest)
+		if err != nil {
+			return nil, fmt.Errorf("reading manifest: %v", err)
+		}
+	}
+	assets = append(assets, found...)
+	if err := checkDuplicateNames(assets); err != nil {
+		return nil, err
+	}
+	for i := range assets {
+		if isRemoteAsset(assets[i].Path) {
+			continue
+		}
+		if assets[i].Path, err = longPath(assets[i].Path); err != nil {
+			return nil, err
+		}
+	}
+	return uf.setContentTypes(assets)
+}
+
+// setContentTypes applies the content-type-map overrides to the assets that don't already have
+// a content type. Assets without an override have their content type detected on upload.
+func (uf *uploadFlags) setContentTypes(assets []release.AssetUpload) ([]release.AssetUpload, error) {
+	if uf.contentTypes == "" {
+		return assets, nil
+	}
+	types := map[string]string{}
+	for _, mapping := range strings.Split(uf.contentTypes, ",") {
+		ext, contentType, ok := strings.Cut(mapping, "=")
+		if !ok || ext == "" || contentType == "" {
+			return nil, fmt.Errorf("invalid -content-type-map entry %q, expected extension=content-type", mapping)
+		}
+		if !strings.HasPrefix(ext, ".") {
+			ext = "." + ext
+		}
+		types[strings.TrimSpace(ext)] = strings.TrimSpace(contentType)
+	}
+	for i, asset := range assets {
+		if asset.ContentType == "" {
+			assets[i].ContentType = release.ContentTypeFromMap(asset.Name, types)
+		}
+	}
+	return assets, nil
+}
+
+// uploadAsset uploads a single asset to the release. If timeout is greater than zero each upload
+// attempt is cancelled once the timeout has passed, without affecting the parent context. A timed
+// out attempt is retried like any other transient failure if the client has retries enabled.
+func uploadAsset(ctx context.Context, c *release.Client, rel *release.Release, asset release.AssetUpload, timeout time.Duration) (*release.Asset, error) {
+	upload := c.UploadAsset
+	// The upload url has the release id but not its tag, which the audit log records.
+	ctx = withAuditNote(ctx, auditNote{tag: rel.TagName})
+	if isRemoteAsset(asset.Path) {
+		upload = func(ctx context.Context, rel *release.Release, asset release.AssetUpload) (*release.Asset, error) {
+			return uploadRemoteAsset(ctx, c, rel, asset)
+		}
+	}
+	if timeout <= 0 {
+		return upload(ctx, rel, asset)
+	}
+	for attempt := 1; ; attempt++ {
+		attemptCtx, cancel := context.WithTimeout(ctx, timeout)
+		uploaded, err := upload(attemptCtx, rel, asset)
+		timedOut := attemptCtx.Err() == context.DeadlineExceeded && ctx.Err() == nil
+		cancel()
+		if err == nil || !timedOut || attempt > c.Retries {
+			return uploaded, err
+		}
+		log.Printf("warn: upload of %s timed out after %s, retrying (%d/%d)", asset.Name, timeout, attempt, c.Retries)
+	}
+}
+
+// uploadAssets uploads all of the assets to the release using a pool of upload-concurrency
+// workers. Every asset is attempted unless fail-fast is set, in which case no new uploads are
+// started after the first failure. A summary is logged at the end and an error listing the
+// failed assets is returned if any of them failed. The result of every asset is returned in
+// the same order as the assets, even if there is an error.
+func uploadAssets(ctx context.Context, c *release.Client, rel *release.Release, assets []release.AssetUpload, uf *uploadFlags) ([]assetResult, error) {
+	workers := uf.concurrency
+	if workers < 1 {
+		workers = 1
+	}
+
+	// Results are stored by index so that the summary is in the same order as the assets.
+	results := make([]assetResult, len(assets))
+	for i, asset := range assets {
+		results[i] = assetResult{Name: asset.Name, Path: asset.Path, State: assetSkipped}
+		if isRemoteAsset(asset.Path) {
+			results[i].Path = displayURL(asset.Path)
+		}
+	}
+	state, resume, err := uf.openUploadState(c, rel)
+	if err != nil {
+		return results, err
+	}
+	var skip map[string]bool
+	if resume {
+		skip, err = state.resumeAssets(ctx, c, rel, assets)
+	} else {
+		skip, err = handleExistingAssets(ctx, c, rel, assets, uf)
+	}
+	if err != nil {
+		return results, err
+	}
+	if !uf.quiet {
+		p := newProgress()
+		c.UploadProgress = p.update
+		defer func() {
+			p.stop()
+			c.UploadProgress = nil
+		}()
+	}
+	jobs := make(chan int)
+	var failed int32
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				uploaded, err := uploadAsset(ctx, c, rel, assets[i], uf.uploadTimeout)
+				if err != nil {
+					log.Printf("warn: uploading an asset: %v\n", err)
+					atomic.StoreInt32(&failed, 1)
+				} else {
+					state.record(assets[i], uploaded)
+				}
+				results[i].set(uploaded, err)
+			}
+		}()
+	}
+	for i := range assets {
+		if skip[assets[i].Name] {
+			continue
+		}
+		if uf.failFast && atomic.LoadInt32(&failed) == 1 {
+			log.Printf("error: aborting remaining uploads because of -fail-fast")
+			break
+		}
+		if ctx.Err() != nil {
+			log.Printf("error: aborting remaining uploads: %v", ctx.Err())
+			break
+		}
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+	if ctx.Err() != nil {
+		return results, ctx.Err()
+	}
+	if uf.verify {
+		if err := verifyUploads(ctx, c, rel, assets, results, uf.uploadTimeout); err != nil {
+			return results, err
+		}
+	}
+
+	var failures []assetResult
+	uploaded := 0
+	for _, result := range results {
+		switch result.State {
+		case assetFailed:
+			failures = append(failures, result)
+		case assetUploaded:
+			uploaded++
+		}
+	}
+	if len(skip) > 0 {
+		log.Printf("info: uploaded %d of %d asset(s), %d already on the release", uploaded, len(assets), len(skip))
+	} else {
+		log.Printf("info: uploaded %d of %d asset(s)", uploaded, len(assets))
+	}
+
+	// The release exists at this point but it is missing assets, make sure that automation
+	// running the tool notices.
+	if len(failures) > 0 {
+		log.Printf("error: %d asset(s) failed to upload:", len(failures))
+		for _, f := range failures {
+			log.Printf("error:   %s: %s", f.Path, f.Error)
+		}
+		if state != nil {
+			if uf.stateDir != "" {
+				log.Printf("info: run again to retry only the failed assets")
+			} else {
+				log.Printf("info: run upload with -resume to retry only the failed assets")
+			}
+		}
+		if !uf.failPartial {
+			log.Printf("warn: the release is missing %d asset(s), not failing because of -fail-on-partial-upload=false", len(failures))
+			return results, nil
+		}
+		return results, withExitCode(exitPartialUpload, fmt.Errorf("%d asset(s) failed to upload", len(failures)))
+	}
+	state.finish()
+	return results, nil
+}
+
+// handleExistingAssets deals with assets that are already on the release with the same name as
+// one of the assets, which GitHub would reject. With -clobber they are deleted, with
+// -skip-existing the names of the assets that should not be uploaded are returned, and with
+// -skip-unchanged those that have changed are deleted and the names of the others are returned.
+func handleExistingAssets(ctx context.Context, c *release.Client, rel *release.Release, assets []release.AssetUpload, uf *uploadFlags) (map[string]bool, error) {
+	switch {
+	case uf.clobber:
+		return nil, deleteExistingAssets(ctx, c, rel, assets)
+	case uf.skipUnchanged:
+		return skipUnchangedAssets(ctx, c, rel, assets)
+	case uf.skipExisting:
+		replaced, err := replacedAssets(ctx, c, rel, assets)
+		if err != nil {
+			return nil, err
+		}
+		skip := map[string]bool{}
+		for _, asset := range replaced {
+			log.Printf("info: skipping %s, it is already on the release", asset.Name)
+			skip[asset.Name] = true
+		}
+		return skip, nil
+	}
+	return nil, nil
+}
+
+// verifyUploads lists the assets on the release and checks that every asset that was uploaded is
+// there, fully uploaded and with the same size as the file. Assets that are not are deleted and
+// uploaded again, up to the client's retries or at least once, and marked as failed if they still
+// do not match.
+func verifyUploads(ctx context.Context, c *release.Client, rel *release.Release, assets []release.AssetUpload, results []assetResult, timeout time.Duration) error {
+	reuploads := c.Retries
+	if reuploads < 1 {
+		reuploads = 1
+	}
+	for attempt := 0; ; attempt++ {
+		existing, err := c.ListReleaseAssets(ctx, rel.ID)
+		if err != nil {
+			return fmt.Errorf("verifying uploads: %v", err)
+		}
+		remote := map[string]*release.Asset{}
+		for i := range existing {
+			remote[existing[i].Name] = &existing[i]
+		}
+
+		bad := 0
+		for i, asset := range assets {
+			if results[i].State != assetUploaded {
+				continue
+			}
+			problem, err := uploadProblem(asset, remote[asset.Name])
+			if err != nil {
+				return err
+			}
+			if problem == "" {
+				continue
+			}
+			bad++
+			if attempt >= reuploads {
+				log.Printf("warn: %s is %s after %d re-upload(s)", asset.Name, problem, reuploads)
+				results[i].set(nil, fmt.Errorf("asset is %s on the release", problem))
+				continue
+			}
+			log.Printf("warn: %s is %s on the release, uploading it again", asset.Name, problem)
+			if r := remote[asset.Name]; r != nil {
+				if err := c.DeleteAsset(withAuditNote(ctx, auditNote{action: "asset.replaced", tag: rel.TagName, asset: asset.Name}), r.ID); err != nil {
+					results[i].set(nil, err)
+					continue
+				}
+			}
+			results[i].set(uploadAsset(ctx, c, rel, asset, timeout))
+		}
+		if bad == 0 || attempt >= reuploads {
+			if bad == 0 {
+				log.Printf("info: verified the uploaded assets on the release")
+			}
+			return nil
+		}
+	}
+}
+
+// uploadProblem compares the local asset with the asset on the release and describes what is
+// wrong with it, or returns an empty string if it was uploaded correctly.
+func uploadProblem(asset release.AssetUpload, remote *release.Asset) (string, error) {
+	if remote == nil {
+		return "missing", nil
+	}
+	localSize, err := assetSize(asset)
+	if err != nil {
+		return "", err
+	}
+	switch {
+	case remote.State != "uploaded":
+		return fmt.Sprintf("in state %s", remote.State), nil
+	case remote.Size != localSize:
+		return fmt.Sprintf("%d bytes instead of %d", remote.Size, localSize), nil
+	}
+	return "", nil
+}
+
+// runUpload uploads assets to an existing release. Files given after the flags are uploaded along
+// with any -asset flags, so each runner of a build matrix can attach its own artifacts to one
+// release, e.g. upload -release-tag v1.2.3 dist/*.
+func runUpload(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("upload", flag.ContinueOnError)
+	cf := addClientFlags(fs)
+	cf.writesReleases = true
+	rf := addReleaseFlags(fs)
+	uf := addUploadFlags(fs, cf)
+	dryRun := addDryRunFlag(fs)
+	output := addOutputFlag(fs)
+	hooksFlag := addHooksFlag(fs)
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if err := checkOutputFormat(*output); err != nil {
+		return err
+	}
+	// Files after the flags are uploaded as if each was given with -asset.
+	uf.assets = append(uf.assets, fs.Args()...)
+
+	ctx, cancel := cf.withTimeout(ctx)
+	defer cancel()
+	client, err := cf.newClient(ctx)
+	if err != nil {
+		return err
+	}
+	rel, err := rf.getRelease(ctx, client)
+	if err != nil {
+		return err
+	}
+	uf.packageTag, uf.projectName = rel.TagName, client.Repo
+	assets, cleanup, err := uf.prepareAssets()
+	defer cleanup()
+	if err != nil {
+		return withExitCode(exitValidation, err)
+	}
+	var pkgRepos []packageRepo
+	if uf.publishPkgs {
+		if pkgRepos, err = readPackageRepos(fs); err != nil {
+			return withExitCode(exitValidation, err)
+		}
+	}
+	hks, err := loadHooks(fs, *hooksFlag)
+	if err != nil {
+		return withExitCode(exitValidation, err)
+	}
+	if *dryRun {
+		p := newPlan(client)
+		if err := p.uploads(rel, assets); err != nil {
+			return err
+		}
+		p.hooks(hks, hookAfterUpload)
+		return p.packageRepos(pkgRepos, client.User+"/"+client.Repo, rel.TagName, assets)
+	}
+	results, err := uploadAssets(ctx, client, rel, assets, uf)
+	// The release already has its notes, so the joining instructions are added to them.
+	if err == nil && len(uf.splits) > 0 {
+		var edited *release.Release
+		if edited, err = client.EditRelease(ctx, rel.ID, &release.EditReleaseRequest{Body: joinBody(rel.Body, splitNotes(uf.splits))}); err == nil {
+			rel = edited
+		}
+	}
+	run := hookRun{command: "upload", repo: client.User + "/" + client.Repo, rel: rel, assets: results}
+	if err == nil {
+		err = hks.run(ctx, hookAfterUpload, run)
+	}
+	if err == nil && len(pkgRepos) > 0 {
+		err = publishPackages(ctx, cf, pkgRepos, client.User+"/"+client.Repo, rel.TagName, results)
+	}
+	if err != nil {
+		run.err = err
+		hks.failed(run)
+	}
+	if outputErr := writeReleaseOutput(*output, rel, results); outputErr != nil {
+		return outputErr
+	}
+	return err
+}
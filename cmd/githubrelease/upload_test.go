@@ -0,0 +1,86 @@
+package main
+
+import (
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"net/url"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/imitablerabbit/githubrelease/pkg/release"
+	"github.com/imitablerabbit/githubrelease/pkg/releasetest"
+)
+
+func TestUploadTimeout(t *testing.T) {
+	tests := []struct {
+		name string
+
+		// slowAttempts is how many uploads of slow.tar.gz hang until they time out.
+		slowAttempts int32
+
+		status   int
+		uploaded []string
+	}{
+		{"retried", 1, exitOK, []string{"fast.tar.gz", "slow.tar.gz"}},
+		{"fails", 2, exitPartialUpload, []string{"fast.tar.gz"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			srv := releasetest.NewServer()
+			defer srv.Close()
+			srv.AddRelease("octo", "app", release.Release{TagName: "v1.0.0"})
+			assets := writeAssets(t, map[string]string{"fast.tar.gz": "fast", "slow.tar.gz": "slow"})
+
+			// Uploads go through a proxy that holds the first uploads of slow.tar.gz until the
+			// client gives up on them.
+			target, _ := url.Parse(srv.URL)
+			proxy := httputil.NewSingleHostReverseProxy(target)
+			var slowUploads int32
+			uploads := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Query().Get("name") == "slow.tar.gz" && atomic.AddInt32(&slowUploads, 1) <= test.slowAttempts {
+					// The body is read so that the server notices when the client hangs up.
+					io.Copy(ioutil.Discard, r.Body)
+					select {
+					case <-r.Context().Done():
+					case <-time.After(5 * time.Second):
+						t.Errorf("upload of slow.tar.gz was not cancelled by -upload-timeout")
+					}
+					return
+				}
+				proxy.ServeHTTP(w, r)
+			}))
+			defer uploads.Close()
+
+			status := runGithubrelease(t, srv, "upload", "-release-tag", "v1.0.0", "-upload-url", uploads.URL,
+				"-upload-timeout", "200ms", "-retries", "1", "-retry-backoff", "1ms", "-quiet",
+				"-state-file", filepath.Join(t.TempDir(), "upload.json"),
+				assets["fast.tar.gz"], assets["slow.tar.gz"])
+			if status != test.status {
+				t.Errorf("upload exited with %d, want %d", status, test.status)
+			}
+			if got := atomic.LoadInt32(&slowUploads); got != 2 {
+				t.Errorf("slow.tar.gz was sent %d times, want 2", got)
+			}
+
+			releases := srv.Releases("octo", "app")
+			var names []string
+			for _, asset := range releases[0].Assets {
+				names = append(names, asset.Name)
+			}
+			if len(names) != len(test.uploaded) {
+				t.Fatalf("release has assets %v, want %v", names, test.uploaded)
+			}
+			for i := range names {
+				if names[i] != test.uploaded[i] {
+					t.Errorf("release has assets %v, want %v", names, test.uploaded)
+					break
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/imitablerabbit/githubrelease/pkg/release"
+)
+
+// watchFlags are the flags of the watch command that are not create flags.
+type watchFlags struct {
+	tagPattern    string
+	interval      time.Duration
+	build         string
+	listen        string
+	webhookSecret string
+}
+
+// newWatchFlagSet returns the flag set of the watch command, which has the create flags for the
+// releases it creates along with its own.
+func newWatchFlagSet() (*flag.FlagSet, *clientFlags, *uploadFlags, *createFlags, *watchFlags) {
+	fs := flag.NewFlagSet("watch", flag.ContinueOnError)
+	cf := addClientFlags(fs)
+	cf.writesReleases = true
+	addProviderFlag(fs, cf)
+	uf := addUploadFlags(fs, cf)
+	f := addCreateFlags(fs)
+	w := &watchFlags{}
+	fs.StringVar(&w.tagPattern, "tag-pattern", "v*", "Release the new tags that match this glob pattern")
+	fs.DurationVar(&w.interval, "interval", time.Minute, "How often to poll for new tags. 0 only checks when a webhook is received")
+	fs.StringVar(&w.build, "build", "", "Shell command that builds the assets of a new tag before its release is created. It is given the tag in RELEASE_TAG and its commit in RELEASE_COMMIT")
+	fs.StringVar(&w.listen, "listen", "", "Address to receive GitHub push and create webhooks on, e.g. :8080, to check for new tags as soon as they are pushed")
+	fs.StringVar(&w.webhookSecret, "webhook-secret", "", "The secret of the webhook, which the signature of each delivery is checked against. Required with -listen")
+	return fs, cf, uf, f, w
+}
+
+// runWatch polls the repository for new tags, and creates a release with the create flags for
+// each one that matches the pattern, after running the build command. Tags that exist when it
+// starts are left alone, backfill creates the releases for those.
+func runWatch(ctx context.Context, args []string) error {
+	fs, cf, _, f, w := newWatchFlagSet()
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	switch {
+	case f.tag != "" || f.bump != "":
+		return withExitCode(exitValidation, fmt.Errorf("-release-tag and -bump cannot be used with watch, the release tag is the new tag"))
+	case f.createTag || f.interactive || f.all || len(f.components) > 0:
+		return withExitCode(exitValidation, fmt.Errorf("-create-tag, -interactive, -all and -component cannot be used with watch"))
+	case w.interval < 0:
+		return withExitCode(exitValidation, fmt.Errorf("-interval cannot be negative"))
+	case w.interval == 0 && w.listen == "":
+		return withExitCode(exitValidation, fmt.Errorf("-interval 0 requires -listen, or no tags would ever be checked"))
+	case w.listen != "" && w.webhookSecret == "":
+		return withExitCode(exitValidation, fmt.Errorf("-listen requires -webhook-secret"))
+	}
+	if _, err := filepath.Match(w.tagPattern, ""); err != nil {
+		return withExitCode(exitValidation, fmt.Errorf("invalid -tag-pattern %s: %v", w.tagPattern, err))
+	}
+	addSecret(w.webhookSecret)
+
+	client, err := cf.newClient(ctx)
+	if err != nil {
+		return err
+	}
+	seen := map[string]bool{}
+	if _, err := w.newTags(ctx, client, seen); err != nil {
+		return err
+	}
+	log.Printf("info: watching %s/%s for new tags matching %s, %d existing tag(s)", client.User, client.Repo, w.tagPattern, len(seen))
+
+	check := make(chan struct{}, 1)
+	if w.listen != "" {
+		server := &http.Server{Addr: w.listen, Handler: w.webhookHandler(check)}
+		go func() {
+			<-ctx.Done()
+			server.Close()
+		}()
+		go func() {
+			log.Printf("info: receiving webhooks on %s", w.listen)
+			if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				log.Printf("error: webhook server: %v", err)
+			}
+		}()
+	}
+	var tick <-chan time.Time
+	if w.interval > 0 {
+		ticker := time.NewTicker(w.interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			log.Printf("info: stopped watching")
+			return nil
+		case <-tick:
+		case <-check:
+		}
+		tags, err := w.newTags(ctx, client, seen)
+		if err != nil {
+			log.Printf("warn: checking for new tags: %v", err)
+			continue
+		}
+		for _, tag := range tags {
+			log.Printf("info: found new tag %s", tag.Name)
+			if err := w.release(ctx, client, args, tag); err != nil {
+				log.Printf("error: releasing %s: %v", tag.Name, err)
+			}
+		}
+	}
+}
+
+// newTags returns the tags matching the pattern that are not in seen, and adds them to it. GitHub
+// lists the newest tags first, so they are returned oldest first to be released in order.
+func (w *watchFlags) newTags(ctx context.Context, client *release.Client, seen map[string]bool) ([]release.RepoTag, error) {
+	tags, err := client.ListAllTags(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var found []release.RepoTag
+	for i := len(tags) - 1; i >= 0; i-- {
+		if match, _ := filepath.Match(w.tagPattern, tags[i].Name); !match || seen[tags[i].Name] {
+			continue
+		}
+		seen[tags[i].Name] = true
+		found = append(found, tags[i])
+	}
+	return found, nil
+}
+
+// release runs the build command for the tag and creates its release. The flags are parsed again
+// for each release so that nothing is left over from the one before. Tags that already have a
+// release, such as one created by hand, are skipped.
+func (w *watchFlags) release(ctx context.Context, client *release.Client, args []string, tag release.RepoTag) error {
+	existing, err := client.FindReleaseByTag(ctx, tag.Name)
+	if err != nil {
+		return err
+	}
+	if existing != nil {
+		log.Printf("info: %s already has release %d, skipping it", tag.Name, existing.ID)
+		return nil
+	}
+	if w.build != "" {
+		log.Printf("info: building %s: %s", tag.Name, w.build)
+		r := hookRun{command: "watch", repo: client.User + "/" + client.Repo, rel: &release.Release{TagName: tag.Name}}
+		cmd := exec.CommandContext(ctx, "sh", "-c", w.build)
+		cmd.Env = append(r.environ("watch.build"), "RELEASE_COMMIT="+tag.Commit.SHA)
+		cmd.Stdout = os.Stderr
+		cmd.Stderr = os.Stderr
+		if err := cmd.Run(); err != nil {
+			return fmt.Errorf("build %q: %v", w.build, err)
+		}
+	}
+
+	fs, cf, uf, f, _ := newWatchFlagSet()
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	uf.assets = append(uf.assets, fs.Args()...)
+	f.tag, f.targetCommitish = tag.Name, tag.Commit.SHA
+	ctx, cancel := cf.withTimeout(ctx)
+	defer cancel()
+	return createReleases(ctx, cf, uf, f)
+}
+
+// webhookHandler returns the handler for GitHub webhooks, which asks for a check whenever a tag
+// is pushed. The signature of each delivery is checked against the secret.
+func (w *watchFlags) webhookHandler(check chan<- struct{}) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(rw, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		body, err := ioutil.ReadAll(http.MaxBytesReader(rw, r.Body, 25<<20))
+		if err != nil {
+			http.Error(rw, "reading body", http.StatusBadRequest)
+			return
+		}
+		mac := hmac.New(sha256.New, []byte(w.webhookSecret))
+		mac.Write(body)
+		expected := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+		if !hmac.Equal([]byte(expected), []byte(r.Header.Get("X-Hub-Signature-256"))) {
+			log.Printf("warn: rejected webhook delivery %s with an invalid signature", r.Header.Get("X-GitHub-Delivery"))
+			http.Error(rw, "invalid signature", http.StatusUnauthorized)
+			return
+		}
+		var event struct {
+			Ref     string `json:"ref"`
+			RefType string `json:"ref_type"`
+		}
+		json.Unmarshal(body, &event)
+		switch r.Header.Get("X-GitHub-Event") {
+		case "push":
+			if !strings.HasPrefix(event.Ref, "refs/tags/") {
+				rw.WriteHeader(http.StatusNoContent)
+				return
+			}
+		case "create":
+			if event.RefType != "tag" {
+				rw.WriteHeader(http.StatusNoContent)
+				return
+			}
+		default:
+			rw.WriteHeader(http.StatusNoContent)
+			return
+		}
+		log.Printf("debug: webhook delivery %s for a tag, checking for new tags", r.Header.Get("X-GitHub-Delivery"))
+		// A check that is already pending will see the tag too.
+		select {
+		case check <- struct{}{}:
+		default:
+		}
+		rw.WriteHeader(http.StatusAccepted)
+	})
+}
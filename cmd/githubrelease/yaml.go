@@ -0,0 +1,347 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// parseYAML parses the subset of YAML that is needed for config files: block mappings, block
+// sequences, flow sequences of scalars, plain and quoted scalars, literal (|) and folded (>) block
+// scalars and comments. All scalars are returned as strings, mappings as map[string]interface{}
+// and sequences as []interface{}. Anchors, tags, flow mappings and multiple documents are not
+// supported.
+func parseYAML(data []byte) (map[string]interface{}, error) {
+	p := &yamlParser{lines: strings.Split(strings.ReplaceAll(string(data), "\r\n", "\n"), "\n")}
+	p.skipBlank()
+	if p.pos < len(p.lines) && strings.TrimSpace(p.lines[p.pos]) == "---" {
+		p.pos++
+	}
+	p.skipBlank()
+	if p.pos >= len(p.lines) {
+		return map[string]interface{}{}, nil
+	}
+	indent, err := p.indent()
+	if err != nil {
+		return nil, err
+	}
+	m, err := p.parseMapping(indent)
+	if err != nil {
+		return nil, err
+	}
+	p.skipBlank()
+	if p.pos < len(p.lines) {
+		return nil, p.errorf("unexpected indentation")
+	}
+	return m, nil
+}
+
+// yamlParser parses YAML line by line, using the indentation of each line to find the end of
+// mappings and sequences.
+type yamlParser struct {
+	lines []string
+	pos   int
+}
+
+func (p *yamlParser) errorf(format string, v ...interface{}) error {
+	return fmt.Errorf("line %d: %s", p.pos+1, fmt.Sprintf(format, v...))
+}
+
+// skipBlank moves past any blank and comment only lines.
+func (p *yamlParser) skipBlank() {
+	for p.pos < len(p.lines) {
+		line := strings.TrimSpace(p.lines[p.pos])
+		if line != "" && !strings.HasPrefix(line, "#") {
+			return
+		}
+		p.pos++
+	}
+}
+
+// indent returns the indentation of the current line. Tabs are not allowed in YAML indentation.
+func (p *yamlParser) indent() (int, error) {
+	line := p.lines[p.pos]
+	n := len(line) - len(strings.TrimLeft(line, " "))
+	if strings.HasPrefix(line[n:], "\t") {
+		return 0, p.errorf("tabs cannot be used for indentation")
+	}
+	return n, nil
+}
+
+// next returns the indentation and trimmed text of the next non blank line, and false at the end.
+func (p *yamlParser) next() (int, string, bool, error) {
+	p.skipBlank()
+	if p.pos >= len(p.lines) {
+		return 0, "", false, nil
+	}
+	indent, err := p.indent()
+	return indent, strings.TrimSpace(p.lines[p.pos]), true, err
+}
+
+// isSequenceItem returns whether the trimmed line is a block sequence item.
+func isSequenceItem(text string) bool {
+	return text == "-" || strings.HasPrefix(text, "- ")
+}
+
+// parseMapping parses the block mapping whose keys are at the indentation.
+func (p *yamlParser) parseMapping(indent int) (map[string]interface{}, error) {
+	m := map[string]interface{}{}
+	for {
+		lineIndent, text, ok, err := p.next()
+		if err != nil {
+			return nil, err
+		}
+		if !ok || lineIndent < indent {
+			return m, nil
+		}
+		if lineIndent > indent {
+			return nil, p.errorf("unexpected indentation")
+		}
+		if isSequenceItem(text) {
+			return nil, p.errorf("unexpected sequence item in mapping")
+		}
+		key, rest, ok := splitMappingKey(text)
+		if !ok {
+			return nil, p.errorf("expected key: value, got %q", text)
+		}
+		if _, dup := m[key]; dup {
+			return nil, p.errorf("duplicate key %q", key)
+		}
+		p.pos++
+		value, err := p.parseValue(indent, rest)
+		if err != nil {
+			return nil, err
+		}
+		m[key] = value
+	}
+}
+
+// parseValue parses the value of a mapping key or sequence item at the indentation, where rest
+// is the text after the key or item marker.
+func (p *yamlParser) parseValue(indent int, rest string) (interface{}, error) {
+	rest = stripYAMLComment(rest)
+	if rest == "|" || rest == ">" || rest == "|-" || rest == ">-" || rest == "|+" || rest == ">+" {
+		return p.parseBlockScalar(indent, rest), nil
+	}
+	if rest != "" {
+		return parseYAMLScalar(rest)
+	}
+	// The value is a nested block, or empty if there isn't one. Sequences are allowed at the
+	// same indentation as their mapping key.
+	childIndent, text, ok, err := p.next()
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case !ok:
+		return "", nil
+	case childIndent == indent && isSequenceItem(text):
+		return p.parseSequence(indent)
+	case childIndent <= indent:
+		return "", nil
+	case isSequenceItem(text):
+		return p.parseSequence(childIndent)
+	}
+	return p.parseMapping(childIndent)
+}
+
+// parseSequence parses the block sequence whose items are at the indentation.
+func (p *yamlParser) parseSequence(indent int) ([]interface{}, error) {
+	var s []interface{}
+	for {
+		lineIndent, text, ok, err := p.next()
+		if err != nil {
+			return nil, err
+		}
+		if !ok || lineIndent < indent || !isSequenceItem(text) {
+			return s, nil
+		}
+		if lineIndent > indent {
+			return nil, p.errorf("unexpected indentation")
+		}
+		item := strings.TrimPrefix(strings.TrimPrefix(text, "-"), " ")
+		if _, _, isMapping := splitMappingKey(item); isMapping {
+			// A mapping that starts on the same line as the item marker, re-read the line as if
+			// the mapping was indented on the next line.
+			p.lines[p.pos] = strings.Repeat(" ", indent+2) + item
+			m, err := p.parseMapping(indent + 2)
+			if err != nil {
+				return nil, err
+			}
+			s = append(s, m)
+			continue
+		}
+		p.pos++
+		value, err := p.parseValue(indent, item)
+		if err != nil {
+			return nil, err
+		}
+		s = append(s, value)
+	}
+}
+
+// parseBlockScalar parses the lines of a literal or folded block scalar that are indented more
+// than the indentation. The style is the indicator, e.g. | or >-.
+func (p *yamlParser) parseBlockScalar(indent int, style string) string {
+	var lines []string
+	blockIndent := -1
+	for ; p.pos < len(p.lines); p.pos++ {
+		line := p.lines[p.pos]
+		trimmed := strings.TrimLeft(line, " ")
+		if trimmed == "" {
+			lines = append(lines, "")
+			continue
+		}
+		n := len(line) - len(trimmed)
+		if blockIndent == -1 {
+			blockIndent = n
+		}
+		if n <= indent || n < blockIndent {
+			break
+		}
+		lines = append(lines, line[blockIndent:])
+	}
+
+	// Trailing blank lines are kept or dropped depending on the chomping indicator.
+	end := len(lines)
+	for end > 0 && lines[end-1] == "" {
+		end--
+	}
+	trailing := lines[end:]
+	lines = lines[:end]
+
+	var text string
+	if strings.HasPrefix(style, ">") {
+		var b strings.Builder
+		for i, line := range lines {
+			// Lines are joined with spaces and blank lines become line breaks.
+			switch {
+			case i == 0 || lines[i-1] == "" && line != "":
+			case line == "":
+				b.WriteString("\n")
+			default:
+				b.WriteString(" ")
+			}
+			b.WriteString(line)
+		}
+		text = b.String()
+	} else {
+		text = strings.Join(lines, "\n")
+	}
+	switch {
+	case strings.HasSuffix(style, "-"):
+	case strings.HasSuffix(style, "+"):
+		text += "\n" + strings.Join(trailing, "\n")
+	case text != "":
+		text += "\n"
+	}
+	return text
+}
+
+// splitMappingKey splits a key: value line. The key may be quoted.
+func splitMappingKey(text string) (string, string, bool) {
+	if strings.HasPrefix(text, `"`) || strings.HasPrefix(text, "'") {
+		end := strings.Index(text[1:], text[:1])
+		if end == -1 {
+			return "", "", false
+		}
+		key, rest := text[1:end+1], text[end+2:]
+		if rest != ":" && !strings.HasPrefix(rest, ": ") {
+			return "", "", false
+		}
+		return key, strings.TrimSpace(rest[1:]), true
+	}
+	for i := 0; i < len(text); i++ {
+		if text[i] == ':' && (i+1 == len(text) || text[i+1] == ' ') {
+			return strings.TrimSpace(text[:i]), strings.TrimSpace(text[i+1:]), i > 0
+		}
+		if text[i] == ' ' && i+1 < len(text) && text[i+1] == '#' {
+			break
+		}
+	}
+	return "", "", false
+}
+
+// stripYAMLComment removes a trailing comment from the value. A # only starts a comment at the
+// start of the value or after a space, and not inside quotes.
+func stripYAMLComment(value string) string {
+	var quote byte
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			} else if c == '\\' && quote == '"' {
+				i++
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#' && (i == 0 || value[i-1] == ' '):
+			return strings.TrimSpace(value[:i])
+		}
+	}
+	return strings.TrimSpace(value)
+}
+
+// parseYAMLScalar parses a plain or quoted scalar, or a flow sequence of scalars.
+func parseYAMLScalar(value string) (interface{}, error) {
+	if strings.HasPrefix(value, "[") {
+		if !strings.HasSuffix(value, "]") {
+			return nil, fmt.Errorf("unterminated flow sequence %q", value)
+		}
+		s := []interface{}{}
+		for _, item := range splitFlowSequence(value[1 : len(value)-1]) {
+			scalar, err := parseYAMLScalar(item)
+			if err != nil {
+				return nil, err
+			}
+			s = append(s, scalar)
+		}
+		return s, nil
+	}
+	if strings.HasPrefix(value, "{") {
+		return nil, fmt.Errorf("flow mappings are not supported")
+	}
+	switch {
+	case strings.HasPrefix(value, `"`):
+		unquoted, err := strconv.Unquote(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid double quoted string %s", value)
+		}
+		return unquoted, nil
+	case strings.HasPrefix(value, "'"):
+		if len(value) < 2 || !strings.HasSuffix(value, "'") {
+			return nil, fmt.Errorf("invalid single quoted string %s", value)
+		}
+		return strings.ReplaceAll(value[1:len(value)-1], "''", "'"), nil
+	case value == "~" || value == "null":
+		return "", nil
+	}
+	return value, nil
+}
+
+// splitFlowSequence splits the contents of a flow sequence on the commas that are not quoted.
+func splitFlowSequence(value string) []string {
+	var items []string
+	var quote byte
+	start := 0
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == ',':
+			items = append(items, strings.TrimSpace(value[start:i]))
+			start = i + 1
+		}
+	}
+	if last := strings.TrimSpace(value[start:]); last != "" {
+		items = append(items, last)
+	}
+	return items
+}
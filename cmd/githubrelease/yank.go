@@ -0,0 +1,173 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/imitablerabbit/githubrelease/pkg/release"
+)
+
+// The ways that -mark can flag a yanked release.
+const (
+	yankPrerelease = "prerelease"
+	yankDraft      = "draft"
+	yankNone       = "none"
+)
+
+// yankBanner starts the warning that is added to the top of the body of a yanked release, which
+// is how a release that has already been yanked is recognized.
+const yankBanner = "> [!WARNING]\n> This release has been yanked"
+
+// yankRecord is the yank in the JSON output of the yank command.
+type yankRecord struct {
+	Reason   string    `json:"reason"`
+	Mark     string    `json:"mark"`
+	YankedAt time.Time `json:"yanked_at"`
+}
+
+// yankOutput is the JSON document written to stdout by yank -output json. The assets are those
+// that were deleted.
+type yankOutput struct {
+	releaseOutput
+	Yank yankRecord `json:"yank"`
+}
+
+// runYank marks a bad release as yanked instead of deleting it, so that the tag, notes and
+// download links stay in place with a warning explaining why the release should not be used.
+func runYank(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("yank", flag.ContinueOnError)
+	cf := addClientFlags(fs)
+	cf.writesReleases = true
+	reason := fs.String("reason", "", "Why the release was yanked, e.g. a CVE id. It is added to the warning at the top of the body")
+	mark := fs.String("mark", yankPrerelease, "How to flag the release, prerelease, draft to hide it from everyone without push access, or none to only add the warning")
+	var deleteAssets stringsFlag
+	fs.Var(&deleteAssets, "delete-assets", "Delete the assets matching this glob pattern, e.g. the vulnerable binaries. Can be repeated")
+	dryRun := addDryRunFlag(fs)
+	output := addOutputFlag(fs)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: githubrelease yank <tag> -reason <reason> [flags]\n")
+		fs.PrintDefaults()
+	}
+	// The tag is usually given before the flags, which the flag package would stop parsing at.
+	tag := ""
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		tag, args = args[0], args[1:]
+	}
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if tag == "" && fs.NArg() == 1 {
+		tag = fs.Arg(0)
+	} else if tag == "" || fs.NArg() != 0 {
+		return withExitCode(exitValidation, fmt.Errorf("expected the tag of the release, e.g. yank v1.4.0 -reason CVE-2024-1234"))
+	}
+	if strings.TrimSpace(*reason) == "" {
+		return withExitCode(exitValidation, fmt.Errorf("-reason is required so that users know why the release was yanked"))
+	}
+	switch *mark {
+	case yankPrerelease, yankDraft, yankNone:
+	default:
+		return withExitCode(exitValidation, fmt.Errorf("unsupported -mark %q, expected prerelease, draft or none", *mark))
+	}
+	if err := checkOutputFormat(*output); err != nil {
+		return err
+	}
+
+	ctx, cancel := cf.withTimeout(ctx)
+	defer cancel()
+	client, err := cf.newClient(ctx)
+	if err != nil {
+		return err
+	}
+	rel, err := client.GetReleaseByTag(ctx, tag)
+	if err != nil {
+		return err
+	}
+	var deleted []releaseAsset
+	if len(deleteAssets) > 0 {
+		if _, deleted, err = listDownloads(ctx, client, rel, deleteAssets, nil); err != nil {
+			return err
+		}
+		if len(deleted) == 0 {
+			log.Printf("warn: no assets of %s match -delete-assets", rel.TagName)
+		}
+	}
+
+	req := &release.EditReleaseRequest{Body: yankedBody(rel.Body, *reason)}
+	yes := true
+	switch *mark {
+	case yankPrerelease:
+		req.PreRelease = &yes
+	case yankDraft:
+		req.Draft = &yes
+	}
+	if *dryRun {
+		p := newPlan(client)
+		if err := p.request("PATCH", fmt.Sprintf("releases/%d", rel.ID), req); err != nil {
+			return err
+		}
+		for _, asset := range deleted {
+			if err := p.request("DELETE", fmt.Sprintf("releases/assets/%d", asset.id), nil); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	// The release is flagged before the assets are deleted so that it is never left looking like a
+	// good release with assets missing.
+	rel, err = client.EditRelease(ctx, rel.ID, req)
+	if err != nil {
+		return err
+	}
+	log.Printf("info: yanked release %d for tag %s: %s", rel.ID, rel.TagName, *reason)
+	results := make([]assetResult, len(deleted))
+	var failed int
+	for i, asset := range deleted {
+		results[i] = assetResult{Name: asset.name, ID: asset.id, Size: asset.size, State: assetDeleted}
+		if err := client.DeleteAsset(withAuditNote(ctx, auditNote{tag: rel.TagName, asset: asset.name}), asset.id); err != nil {
+			log.Printf("error: deleting %s: %v", asset.name, err)
+			results[i].State, results[i].Error = assetFailed, err.Error()
+			failed++
+			continue
+		}
+		log.Printf("info: deleted asset %s", asset.name)
+	}
+
+	if err := writeActionsOutput(rel, results); err != nil {
+		return err
+	}
+	if *output == "json" {
+		out := yankOutput{newReleaseOutput(rel, results), yankRecord{Reason: *reason, Mark: *mark, YankedAt: time.Now().UTC()}}
+		if err := writeJSON(out); err != nil {
+			return err
+		}
+	} else {
+		fmt.Println(rel.HTMLURL)
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d assets could not be deleted", failed, len(deleted))
+	}
+	return nil
+}
+
+// yankedBody returns the body with the yank warning at the top. The warning of an earlier yank is
+// replaced rather than added to.
+func yankedBody(body, reason string) string {
+	if strings.HasPrefix(body, yankBanner) {
+		if i := strings.Index(body, "\n\n"); i >= 0 {
+			body = body[i+2:]
+		} else {
+			body = ""
+		}
+	}
+	banner := fmt.Sprintf("%s: %s. Do not use it, upgrade to a newer release instead.", yankBanner, strings.TrimSuffix(strings.TrimSpace(reason), "."))
+	if body == "" {
+		return banner
+	}
+	return banner + "\n\n" + body
+}
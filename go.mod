@@ -0,0 +1,3 @@
+module github.com/imitablerabbit/githubrelease
+
+go 1.21
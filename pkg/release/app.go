@@ -0,0 +1,191 @@
+package release
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TokenSource provides the token that requests are authenticated with. A Client uses its
+// TokenSource instead of the PAT when one is set, which allows tokens that expire to be refreshed.
+type TokenSource interface {
+	Token(ctx context.Context) (string, error)
+}
+
+// appTokenRefresh is how long before an installation token expires that a new one is requested,
+// so that a token never expires part way through a request such as a large upload.
+const appTokenRefresh = 5 * time.Minute
+
+// AppTokenSource authenticates as a GitHub App installation. A JWT signed with the app's private
+// key is exchanged for an installation token, which is refreshed automatically before it expires.
+type AppTokenSource struct {
+	APIURL string
+	AppID  int64
+
+	// InstallationID is the installation of the app to get tokens for. If it is zero the
+	// installation for the repository Owner/Repo is looked up.
+	InstallationID int64
+	Owner          string
+	Repo           string
+
+	Key        *rsa.PrivateKey
+	HTTPClient *http.Client
+
+	mu      sync.Mutex
+	token   string
+	expires time.Time
+}
+
+// NewAppTokenSource creates an AppTokenSource for the app installation with the PEM encoded RSA
+// private key of the app. An empty apiURL uses the public GitHub api.
+func NewAppTokenSource(apiURL string, appID, installationID int64, pemKey []byte) (*AppTokenSource, error) {
+	key, err := ParseRSAPrivateKey(pemKey)
+	if err != nil {
+		return nil, err
+	}
+	if apiURL == "" {
+		apiURL = DefaultAPIURL
+	}
+	return &AppTokenSource{
+		APIURL:         strings.TrimSuffix(apiURL, "/"),
+		AppID:          appID,
+		InstallationID: installationID,
+		Key:            key,
+		HTTPClient:     &http.Client{},
+	}, nil
+}
+
+// ParseRSAPrivateKey parses a PEM encoded PKCS #1 or PKCS #8 RSA private key, as downloaded from
+// the GitHub App settings.
+func ParseRSAPrivateKey(pemKey []byte) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode(pemKey)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM data found in private key")
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("parsing private key: %w", err)
+	}
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("private key is not an RSA key")
+	}
+	return key, nil
+}
+
+// Token returns the installation token, requesting a new one if there isn't one yet or it is
+// about to expire.
+func (s *AppTokenSource) Token(ctx context.Context) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.token != "" && time.Until(s.expires) > appTokenRefresh {
+		return s.token, nil
+	}
+	jwt, err := s.JWT(time.Now())
+	if err != nil {
+		return "", err
+	}
+	if s.InstallationID == 0 {
+		if s.InstallationID, err = s.findInstallation(ctx, jwt); err != nil {
+			return "", err
+		}
+	}
+
+	tokenURL := fmt.Sprintf("%s/app/installations/%d/access_tokens", s.APIURL, s.InstallationID)
+	token := struct {
+		Token     string    `json:"token"`
+		ExpiresAt time.Time `json:"expires_at"`
+	}{}
+	if err := s.appRequest(ctx, http.MethodPost, tokenURL, jwt, http.StatusCreated, &token); err != nil {
+		return "", fmt.Errorf("creating installation token: %w", err)
+	}
+	log.Printf("info: created installation token for app %d, expires at %s", s.AppID, token.ExpiresAt.Format(time.RFC3339))
+	s.token, s.expires = token.Token, token.ExpiresAt
+	return s.token, nil
+}
+
+// findInstallation looks up the installation of the app on the repository, or on the
+// organization Owner if there is no Repo.
+func (s *AppTokenSource) findInstallation(ctx context.Context, jwt string) (int64, error) {
+	if s.Owner == "" {
+		return 0, fmt.Errorf("an installation id or repository is needed to find the app installation")
+	}
+	installationURL := fmt.Sprintf("%s/repos/%s/%s/installation", s.APIURL, s.Owner, s.Repo)
+	target := s.Owner + "/" + s.Repo
+	if s.Repo == "" {
+		installationURL, target = fmt.Sprintf("%s/orgs/%s/installation", s.APIURL, s.Owner), s.Owner
+	}
+	installation := struct {
+		ID int64 `json:"id"`
+	}{}
+	if err := s.appRequest(ctx, http.MethodGet, installationURL, jwt, http.StatusOK, &installation); err != nil {
+		return 0, fmt.Errorf("finding app installation for %s: %w", target, err)
+	}
+	return installation.ID, nil
+}
+
+// appRequest sends a request authenticated as the app itself and decodes the JSON response.
+func (s *AppTokenSource) appRequest(ctx context.Context, method, url, jwt string, expected int, out interface{}) error {
+	request, err := http.NewRequestWithContext(ctx, method, url, nil)
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Authorization", "Bearer "+jwt)
+	request.Header.Set("Accept", DefaultAccept)
+	request.Header.Set(apiVersionHeader, DefaultAPIVersion)
+	httpClient := s.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	resp, err := httpClient.Do(request)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	respData, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != expected {
+		return responseError(expected, resp, respData)
+	}
+	return json.Unmarshal(respData, out)
+}
+
+// JWT returns a JSON Web Token for the app, signed with RS256, that is valid for 9 minutes from
+// now. The issued at time is set a minute in the past to allow for clock drift.
+func (s *AppTokenSource) JWT(now time.Time) (string, error) {
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"RS256","typ":"JWT"}`))
+	claims, err := json.Marshal(map[string]interface{}{
+		"iat": now.Add(-time.Minute).Unix(),
+		"exp": now.Add(9 * time.Minute).Unix(),
+		"iss": strconv.FormatInt(s.AppID, 10),
+	})
+	if err != nil {
+		return "", err
+	}
+	unsigned := header + "." + base64.RawURLEncoding.EncodeToString(claims)
+	digest := sha256.Sum256([]byte(unsigned))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, s.Key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", fmt.Errorf("signing JWT: %w", err)
+	}
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
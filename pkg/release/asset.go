@@ -0,0 +1,358 @@
+package release
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// AssetUpload is a local file that should be uploaded as a release asset.
+type AssetUpload struct {
+	// Path is the location of the file on disk.
+	Path string `json:"path"`
+
+	// Name is the file name of the asset on the release. Defaults to the base name of Path.
+	Name string `json:"name,omitempty"`
+
+	// Label is an optional display name shown on the release page instead of the name.
+	Label string `json:"label,omitempty"`
+
+	// ContentType is the media type the asset is served with. It is detected from the file
+	// using ContentType if it is empty.
+	ContentType string `json:"content_type,omitempty"`
+}
+
+// MaxAssetSize is the largest file that GitHub accepts as a release asset.
+const MaxAssetSize = 2 << 30
+
+// uploadChunkSize is the size of each read from disk while an asset is streamed to GitHub.
+const uploadChunkSize = 1 << 20
+
+// chunkedFile is an upload body that reads a file from disk in uploadChunkSize chunks, so that
+// the memory used by an upload does not grow with the size of the file.
+type chunkedFile struct {
+	io.Reader
+	io.Closer
+}
+
+// openChunkedFile opens the file for streaming as an upload body and returns its size.
+func openChunkedFile(path string) (*chunkedFile, int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, 0, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, 0, err
+	}
+	return &chunkedFile{Reader: bufio.NewReaderSize(f, uploadChunkSize), Closer: f}, info.Size(), nil
+}
+
+// openUploadBody opens the asset for streaming as an upload body, limited to the client's
+// bandwidth limits and reporting the bytes read to UploadProgress and the Observer if they are set.
+func (c *Client) openUploadBody(ctx context.Context, asset AssetUpload) (*chunkedFile, int64, error) {
+	body, size, err := openChunkedFile(asset.Path)
+	if err != nil {
+		return body, size, err
+	}
+	return c.wrapUploadBody(ctx, asset, body, size), size, nil
+}
+
+// wrapUploadBody limits the body to the client's bandwidth limits and reports the bytes read
+// from it to UploadProgress and the Observer if they are set.
+func (c *Client) wrapUploadBody(ctx context.Context, asset AssetUpload, body *chunkedFile, size int64) *chunkedFile {
+	body.Reader = c.limitBody(ctx, body.Reader)
+	if c.UploadProgress == nil && c.Observer == nil {
+		return body
+	}
+	report := func(n int64) {
+		if c.UploadProgress != nil {
+			c.UploadProgress(asset, n, size)
+		}
+		c.observer().AssetProgress(asset, n, size)
+	}
+	report(0)
+	body.Reader = &countingReader{r: body.Reader, report: report}
+	return body
+}
+
+// countingReader counts the bytes read through it and reports the running total after every read.
+type countingReader struct {
+	r      io.Reader
+	n      int64
+	report func(n int64)
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	if n > 0 {
+		r.n += int64(n)
+		r.report(r.n)
+	}
+	return n, err
+}
+
+// AssetUploadURL returns the URL that the asset is uploaded to for the release, with the name
+// and label in the query.
+func AssetUploadURL(release *Release, asset AssetUpload) string {
+	uploadURL := strings.TrimSuffix(release.UploadURL, "{?name,label}")
+	query := url.Values{}
+	query.Set("name", asset.Name)
+	if asset.Label != "" {
+		query.Set("label", asset.Label)
+	}
+	return uploadURL + "?" + query.Encode()
+}
+
+// AssetUploadURL returns the URL that the asset is uploaded to for the release, with the host
+// replaced by UploadURL if it is set.
+func (c *Client) AssetUploadURL(release *Release, asset AssetUpload) string {
+	assetURL := AssetUploadURL(release, asset)
+	if c.UploadURL == "" {
+		return assetURL
+	}
+	// The upload_url is the upload host followed by /repos/{owner}/{repo}/releases/{id}/assets.
+	if i := strings.Index(assetURL, "/repos/"); i >= 0 {
+		return strings.TrimSuffix(c.UploadURL, "/") + assetURL[i:]
+	}
+	return assetURL
+}
+
+// Asset is a file that has been uploaded to a release.
+type Asset struct {
+	URL    string `json:"url"`
+	ID     int    `json:"id"`
+	NodeID string `json:"node_id"`
+
+	Name        string `json:"name"`
+	Label       string `json:"label"`
+	ContentType string `json:"content_type"`
+
+	// State is uploaded once the upload has completed, or starter while it is in progress or
+	// if it failed part way.
+	State string `json:"state"`
+
+	Size               int64  `json:"size"`
+	DownloadCount      int    `json:"download_count"`
+	BrowserDownloadURL string `json:"browser_download_url"`
+
+	// Digest is the SHA-256 of the asset as sha256:<hex>, if GitHub reports it. Older assets do
+	// not have one.
+	Digest string `json:"digest,omitempty"`
+
+	// Uploader is who uploaded the asset, if it is reported.
+	Uploader *User `json:"uploader,omitempty"`
+
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// UploadAsset will upload an asset to the release and returns the uploaded asset. The file is
+// streamed from disk rather than read into memory, so large assets can be uploaded on small
+// machines. The upload is cancelled if ctx is done before the upload completes.
+func (c *Client) UploadAsset(ctx context.Context, release *Release, asset AssetUpload) (*Asset, error) {
+	return c.observeUpload(release, asset, func() (*Asset, error) {
+		return c.uploadAsset(ctx, release, asset)
+	})
+}
+
+func (c *Client) uploadAsset(ctx context.Context, release *Release, asset AssetUpload) (*Asset, error) {
+	body, size, err := c.openUploadBody(ctx, asset)
+	if err != nil {
+		return nil, fmt.Errorf("opening file for upload: %w", err)
+	}
+	if asset.ContentType == "" {
+		asset.ContentType = ContentType(asset.Path)
+	}
+	return c.upload(ctx, release, asset, body, size, func() (io.ReadCloser, error) {
+		body, _, err := c.openUploadBody(ctx, asset)
+		return body, err
+	})
+}
+
+// UploadAssetStream uploads an asset of the given size that is read from the stream returned by
+// open instead of from a file, such as the download of an asset from another release. open is
+// called again to start over if the upload is retried. The asset's Path is not used, and its
+// ContentType defaults to application/octet-stream.
+func (c *Client) UploadAssetStream(ctx context.Context, release *Release, asset AssetUpload, size int64, open func() (io.ReadCloser, error)) (*Asset, error) {
+	return c.observeUpload(release, asset, func() (*Asset, error) {
+		return c.uploadAssetStream(ctx, release, asset, size, open)
+	})
+}
+
+func (c *Client) uploadAssetStream(ctx context.Context, release *Release, asset AssetUpload, size int64, open func() (io.ReadCloser, error)) (*Asset, error) {
+	if asset.ContentType == "" {
+		asset.ContentType = "application/octet-stream"
+	}
+	reopen := func() (io.ReadCloser, error) {
+		stream, err := open()
+		if err != nil {
+			return nil, err
+		}
+		return c.wrapUploadBody(ctx, asset, &chunkedFile{Reader: stream, Closer: stream}, size), nil
+	}
+	body, err := reopen()
+	if err != nil {
+		return nil, fmt.Errorf("opening stream for upload: %w", err)
+	}
+	return c.upload(ctx, release, asset, body, size, reopen)
+}
+
+// upload sends the body as the asset, opening it again with getBody if the request is retried.
+// The body is closed.
+func (c *Client) upload(ctx context.Context, release *Release, asset AssetUpload, body io.ReadCloser, size int64, getBody func() (io.ReadCloser, error)) (*Asset, error) {
+	defer body.Close()
+	if size > MaxAssetSize {
+		return nil, fmt.Errorf("uploading %s: %d bytes is more than the %d that GitHub accepts: %w", asset.Name, size, MaxAssetSize, ErrAssetTooLarge)
+	}
+	assetURL := c.AssetUploadURL(release, asset)
+	log.Printf("info: sending upload request to %s", assetURL)
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, assetURL, body)
+	if err != nil {
+		return nil, fmt.Errorf("creating upload request: %w", err)
+	}
+	request.ContentLength = size
+	request.GetBody = getBody
+	request.Header.Add("Content-Type", asset.ContentType)
+
+	// GitHub regularly responds with a 502 for large uploads even though the asset was stored,
+	// so check whether it actually landed before re-uploading it or reporting a failure.
+	var uploaded *Asset
+	landed := func(resp *http.Response) bool {
+		found, err := c.findUploadedAsset(ctx, release.ID, asset.Name, size)
+		if err != nil {
+			log.Printf("warn: checking whether %s was uploaded after %s: %v", asset.Name, resp.Status, err)
+		}
+		if found != nil {
+			log.Printf("info: received %s but asset %s is present on the release, treating as uploaded", resp.Status, asset.Name)
+			uploaded = found
+		}
+		return found != nil
+	}
+	resp, err := c.do(request, func(resp *http.Response) bool {
+		return !landed(resp)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("sending upload request: %w", err)
+	}
+	defer resp.Body.Close()
+	respData, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("reading upload response body: %w", err)
+	}
+	if resp.StatusCode >= 500 && (uploaded != nil || landed(resp)) {
+		return uploaded, nil
+	}
+	if resp.StatusCode != 201 {
+		return nil, responseError(http.StatusCreated, resp, respData)
+	}
+	uploadedAsset := &Asset{}
+	if err := json.Unmarshal(respData, uploadedAsset); err != nil {
+		return nil, fmt.Errorf("unmarshaling upload response body: %w", err)
+	}
+	return uploadedAsset, nil
+}
+
+// ListReleaseAssets fetches all of the assets that are currently attached to the release.
+func (c *Client) ListReleaseAssets(ctx context.Context, releaseID int) ([]Asset, error) {
+	var assets []Asset
+	const perPage = 100
+	for page := 1; ; page++ {
+		assetsURL := c.repoURL("releases/%d/assets?per_page=%d&page=%d", releaseID, perPage, page)
+		request, err := http.NewRequestWithContext(ctx, http.MethodGet, assetsURL, nil)
+		if err != nil {
+			return nil, fmt.Errorf("creating list assets request: %w", err)
+		}
+		var pageAssets []Asset
+		if _, err := c.doJSON(request, http.StatusOK, &pageAssets); err != nil {
+			return nil, fmt.Errorf("listing release assets: %w", err)
+		}
+		assets = append(assets, pageAssets...)
+		if len(pageAssets) < perPage {
+			return assets, nil
+		}
+	}
+}
+
+// AssetUploaded checks whether the release has a fully uploaded asset with the given name and size.
+func (c *Client) AssetUploaded(ctx context.Context, releaseID int, name string, size int64) (bool, error) {
+	asset, err := c.findUploadedAsset(ctx, releaseID, name, size)
+	return asset != nil, err
+}
+
+// findUploadedAsset returns the fully uploaded asset on the release with the given name and
+// size, or nil if there isn't one.
+func (c *Client) findUploadedAsset(ctx context.Context, releaseID int, name string, size int64) (*Asset, error) {
+	assets, err := c.ListReleaseAssets(ctx, releaseID)
+	if err != nil {
+		return nil, err
+	}
+	for i, asset := range assets {
+		if asset.Name == name && asset.Size == size && asset.State == "uploaded" {
+			return &assets[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// DownloadAsset starts downloading the contents of the asset from the offset, which allows an
+// interrupted download to be resumed. The returned body must be closed. If the server does not
+// support resuming, the body starts from the beginning of the asset and resumed is false. The body
+// is read no faster than the client's bandwidth limits.
+func (c *Client) DownloadAsset(ctx context.Context, assetID int, offset int64) (body io.ReadCloser, resumed bool, err error) {
+	assetURL := c.repoURL("releases/assets/%d", assetID)
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, assetURL, nil)
+	if err != nil {
+		return nil, false, fmt.Errorf("creating download request: %w", err)
+	}
+	// The api redirects to the storage backend for the contents, the Authorization header is
+	// dropped on the redirect because it is to a different host.
+	request.Header.Set("Accept", "application/octet-stream")
+	if offset > 0 {
+		request.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+	resp, err := c.Do(request)
+	if err != nil {
+		return nil, false, fmt.Errorf("sending download request: %w", err)
+	}
+	body = &limitedReadCloser{Reader: c.limitBody(ctx, resp.Body), Closer: resp.Body}
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return body, false, nil
+	case http.StatusPartialContent:
+		return body, true, nil
+	}
+	defer resp.Body.Close()
+	respData, _ := ioutil.ReadAll(resp.Body)
+	return nil, false, responseError(http.StatusOK, resp, respData)
+}
+
+// DeleteAsset deletes the asset with the given id from its release.
+func (c *Client) DeleteAsset(ctx context.Context, assetID int) error {
+	assetURL := c.repoURL("releases/assets/%d", assetID)
+	log.Printf("info: sending delete asset request to %s", assetURL)
+	request, err := http.NewRequestWithContext(ctx, http.MethodDelete, assetURL, nil)
+	if err != nil {
+		return fmt.Errorf("creating delete asset request: %w", err)
+	}
+	resp, err := c.Do(request)
+	if err != nil {
+		return fmt.Errorf("sending delete asset request: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		respData, _ := ioutil.ReadAll(resp.Body)
+		return responseError(http.StatusNoContent, resp, respData)
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+package release
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestUploadAssetLandedDespite502(t *testing.T) {
+	for _, retries := range []int{0, 2} {
+		t.Run(fmt.Sprintf("retries=%d", retries), func(t *testing.T) {
+			const content = "archive contents"
+			var mu sync.Mutex
+			var stored []Asset
+			requests := map[string]int{}
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				mu.Lock()
+				defer mu.Unlock()
+				requests[r.Method]++
+				w.Header().Set("Content-Type", "application/json")
+				switch {
+				case r.Method == http.MethodPost && r.URL.Path == "/repos/octo/app/releases/1/assets":
+					// The asset is stored, but the response is lost as GitHub sometimes does.
+					body, _ := ioutil.ReadAll(r.Body)
+					stored = append(stored, Asset{ID: 7, Name: r.URL.Query().Get("name"), State: "uploaded", Size: int64(len(body))})
+					w.WriteHeader(http.StatusBadGateway)
+					w.Write([]byte(`{"message":"Bad Gateway"}`))
+				case r.Method == http.MethodGet && r.URL.Path == "/repos/octo/app/releases/1/assets":
+					json.NewEncoder(w).Encode(stored)
+				default:
+					t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+					w.WriteHeader(http.StatusNotFound)
+				}
+			}))
+			defer srv.Close()
+
+			path := filepath.Join(t.TempDir(), "app.tar.gz")
+			if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+				t.Fatal(err)
+			}
+			rel := &Release{ID: 1, UploadURL: srv.URL + "/repos/octo/app/releases/1/assets{?name,label}"}
+			asset, err := testClient(srv, retries).UploadAsset(context.Background(), rel, AssetUpload{Path: path, Name: "app.tar.gz"})
+			if err != nil {
+				t.Fatalf("UploadAsset: %v", err)
+			}
+			if asset == nil || asset.ID != 7 || asset.Name != "app.tar.gz" {
+				t.Errorf("UploadAsset returned %+v, want the listed asset 7", asset)
+			}
+			if requests[http.MethodPost] != 1 {
+				t.Errorf("sent %d upload requests, want 1", requests[http.MethodPost])
+			}
+			if requests[http.MethodDelete] != 0 {
+				t.Errorf("sent %d delete requests, want none", requests[http.MethodDelete])
+			}
+		})
+	}
+}
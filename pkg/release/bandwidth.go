@@ -0,0 +1,96 @@
+package release
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+)
+
+// bandwidthChunk is the most that is read through a limited body at once, so that a transfer
+// waits in small steps rather than in bursts of a whole buffer.
+const bandwidthChunk = 32 << 10
+
+// BandwidthLimiter is a token bucket that limits the number of bytes per second transferred
+// through it. A single limiter can be shared by several transfers to limit their combined
+// bandwidth.
+type BandwidthLimiter struct {
+	mu     sync.Mutex
+	rate   float64
+	tokens float64
+	last   time.Time
+}
+
+// NewBandwidthLimiter returns a limiter that allows bytesPerSecond, with bursts of up to a second
+// of transfer.
+func NewBandwidthLimiter(bytesPerSecond int64) *BandwidthLimiter {
+	return &BandwidthLimiter{rate: float64(bytesPerSecond), tokens: float64(bytesPerSecond), last: time.Now()}
+}
+
+// WaitN blocks until n more bytes can be transferred, or ctx is done. The bytes are taken from
+// the bucket straight away, so a transfer that is ahead of the rate waits for the others.
+func (l *BandwidthLimiter) WaitN(ctx context.Context, n int) error {
+	l.mu.Lock()
+	now := time.Now()
+	l.tokens += now.Sub(l.last).Seconds() * l.rate
+	if l.tokens > l.rate {
+		l.tokens = l.rate
+	}
+	l.last = now
+	l.tokens -= float64(n)
+	wait := time.Duration(-l.tokens / l.rate * float64(time.Second))
+	l.mu.Unlock()
+	if wait <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// limitedReader waits on the limiters for the bytes read through it.
+type limitedReader struct {
+	ctx      context.Context
+	r        io.Reader
+	limiters []*BandwidthLimiter
+}
+
+func (r *limitedReader) Read(p []byte) (int, error) {
+	if len(p) > bandwidthChunk {
+		p = p[:bandwidthChunk]
+	}
+	n, err := r.r.Read(p)
+	for _, l := range r.limiters {
+		if waitErr := l.WaitN(r.ctx, n); waitErr != nil {
+			return n, waitErr
+		}
+	}
+	return n, err
+}
+
+// limitBody returns the reader limited to the client's BandwidthLimit and FileBandwidthLimit, or
+// the reader itself if neither is set. Each call gets its own per file limiter.
+func (c *Client) limitBody(ctx context.Context, r io.Reader) io.Reader {
+	var limiters []*BandwidthLimiter
+	if c.BandwidthLimit != nil {
+		limiters = append(limiters, c.BandwidthLimit)
+	}
+	if c.FileBandwidthLimit > 0 {
+		limiters = append(limiters, NewBandwidthLimiter(c.FileBandwidthLimit))
+	}
+	if len(limiters) == 0 {
+		return r
+	}
+	return &limitedReader{ctx: ctx, r: r, limiters: limiters}
+}
+
+// limitedReadCloser is a limited body that closes the underlying body.
+type limitedReadCloser struct {
+	io.Reader
+	io.Closer
+}
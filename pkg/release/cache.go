@@ -0,0 +1,162 @@
+package release
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ResponseCache stores the responses to GET requests on disk with their ETag and Last-Modified,
+// so that the requests can be sent again as conditional requests. GitHub answers a conditional
+// request for unchanged data with 304 Not Modified, which does not count against the rate limit,
+// and the stored response is used instead.
+type ResponseCache struct {
+	dir string
+}
+
+// NewResponseCache returns a cache that stores the responses in dir, which is created if it does
+// not exist. The responses can contain private repository data, so only the current user can
+// read them.
+func NewResponseCache(dir string) (*ResponseCache, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	return &ResponseCache{dir: dir}, nil
+}
+
+// cachedResponse is a response stored in the cache.
+type cachedResponse struct {
+	URL          string      `json:"url"`
+	ETag         string      `json:"etag,omitempty"`
+	LastModified string      `json:"last_modified,omitempty"`
+	Header       http.Header `json:"header"`
+	Body         []byte      `json:"body"`
+}
+
+// key returns the name of the file for the request. The token, Accept header and api version are
+// part of the key, as they change what the response contains.
+func (rc *ResponseCache) key(request *http.Request, token string) string {
+	h := sha256.New()
+	for _, part := range []string{request.URL.String(), request.Header.Get("Accept"), request.Header.Get(apiVersionHeader), token} {
+		h.Write([]byte(part))
+		h.Write([]byte{0})
+	}
+	return filepath.Join(rc.dir, hex.EncodeToString(h.Sum(nil))+".json")
+}
+
+// cacheable reports whether the response to the request can be cached. Only complete JSON
+// responses to GET requests are, so asset downloads are never stored.
+func cacheable(request *http.Request) bool {
+	return request.Method == http.MethodGet && request.Header.Get("Range") == ""
+}
+
+// lookup returns the stored response for the request, or nil if there isn't one.
+func (rc *ResponseCache) lookup(path string) *cachedResponse {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	cached := &cachedResponse{}
+	if err := json.Unmarshal(data, cached); err != nil {
+		return nil
+	}
+	return cached
+}
+
+// store saves the 200 response to the request if it has an ETag or Last-Modified, replacing its
+// body so that it can still be read by the caller. Failing to store the response only means the
+// next request is not conditional, so errors are logged.
+func (rc *ResponseCache) store(path string, request *http.Request, resp *http.Response) {
+	etag, lastModified := resp.Header.Get("ETag"), resp.Header.Get("Last-Modified")
+	if etag == "" && lastModified == "" || !strings.Contains(resp.Header.Get("Content-Type"), "json") {
+		return
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+	if err != nil {
+		// The caller gets the error when it reads the body.
+		resp.Body = ioutil.NopCloser(&errorReader{err: err})
+		return
+	}
+	cached := &cachedResponse{
+		URL:          request.URL.String(),
+		ETag:         etag,
+		LastModified: lastModified,
+		Header:       resp.Header,
+		Body:         body,
+	}
+	data, err := json.Marshal(cached)
+	if err == nil {
+		err = ioutil.WriteFile(path, data, 0600)
+	}
+	if err != nil {
+		log.Printf("warn: caching response for %s: %v", request.URL, err)
+	}
+}
+
+// response returns the stored response in place of the 304 response, keeping the rate limit
+// headers of the 304 so that they stay current.
+func (cached *cachedResponse) response(request *http.Request, notModified *http.Response) *http.Response {
+	header := cached.Header.Clone()
+	for name, values := range notModified.Header {
+		if strings.HasPrefix(name, "X-Ratelimit-") {
+			header[name] = values
+		}
+	}
+	return &http.Response{
+		Status:        "200 OK",
+		StatusCode:    http.StatusOK,
+		Proto:         notModified.Proto,
+		ProtoMajor:    notModified.ProtoMajor,
+		ProtoMinor:    notModified.ProtoMinor,
+		Header:        header,
+		Body:          ioutil.NopCloser(bytes.NewReader(cached.Body)),
+		ContentLength: int64(len(cached.Body)),
+		Request:       request,
+	}
+}
+
+// errorReader returns the error from every read.
+type errorReader struct {
+	err error
+}
+
+func (r *errorReader) Read([]byte) (int, error) {
+	return 0, r.err
+}
+
+// sendCached sends the GET request through the cache. The stored ETag and Last-Modified are sent
+// as If-None-Match and If-Modified-Since, and a 304 response is replaced with the stored one.
+func (c *Client) sendCached(request *http.Request, token string, send func(*http.Request) (*http.Response, error)) (*http.Response, error) {
+	path := c.Cache.key(request, token)
+	cached := c.Cache.lookup(path)
+	if cached != nil {
+		if cached.ETag != "" {
+			request.Header.Set("If-None-Match", cached.ETag)
+		}
+		if cached.LastModified != "" {
+			request.Header.Set("If-Modified-Since", cached.LastModified)
+		}
+	}
+	resp, err := send(request)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case resp.StatusCode == http.StatusNotModified && cached != nil:
+		resp.Body.Close()
+		c.debugf("%s not modified, using the cached response", request.URL)
+		return cached.response(request, resp), nil
+	case resp.StatusCode == http.StatusOK:
+		c.Cache.store(path, request, resp)
+	}
+	return resp, nil
+}
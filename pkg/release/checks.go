@@ -0,0 +1,87 @@
+package release
+
+import (
+	"context"
+	"fmt"
+)
+
+// CommitCheck is a CI check on a commit, either a check run of a GitHub App such as GitHub
+// Actions or a commit status set by an external CI service.
+type CommitCheck struct {
+	Name string
+
+	// Status is queued, in_progress or completed. Conclusion is set once the check has
+	// completed, e.g. success, failure, neutral, cancelled, skipped or timed_out.
+	Status     string
+	Conclusion string
+
+	// URL is the page with the details of the check.
+	URL string
+}
+
+// Passed reports whether the check completed without failing. Neutral and skipped checks do not
+// fail the commit, as on a pull request.
+func (c CommitCheck) Passed() bool {
+	if c.Status != "completed" {
+		return false
+	}
+	switch c.Conclusion {
+	case "success", "neutral", "skipped":
+		return true
+	}
+	return false
+}
+
+// ListCommitChecks fetches the latest check runs and commit statuses of the commit, following the
+// Link headers of the responses until there are no pages left. The statuses are reported as
+// checks, a pending status is in_progress and a failed or errored status completed with failure.
+func (c *Client) ListCommitChecks(ctx context.Context, sha string) ([]CommitCheck, error) {
+	var checks []CommitCheck
+	pageURL := c.repoURL("commits/%s/check-runs?per_page=100", sha)
+	for pageURL != "" {
+		page := struct {
+			CheckRuns []struct {
+				Name       string `json:"name"`
+				Status     string `json:"status"`
+				Conclusion string `json:"conclusion"`
+				HTMLURL    string `json:"html_url"`
+			} `json:"check_runs"`
+		}{}
+		next, err := c.getJSONPage(ctx, pageURL, &page)
+		if err != nil {
+			return nil, fmt.Errorf("listing check runs of %s: %w", sha, err)
+		}
+		for _, run := range page.CheckRuns {
+			checks = append(checks, CommitCheck{Name: run.Name, Status: run.Status, Conclusion: run.Conclusion, URL: run.HTMLURL})
+		}
+		pageURL = next
+	}
+
+	// The combined status only has the latest status for each context.
+	pageURL = c.repoURL("commits/%s/status?per_page=100", sha)
+	for pageURL != "" {
+		page := struct {
+			Statuses []struct {
+				Context   string `json:"context"`
+				State     string `json:"state"`
+				TargetURL string `json:"target_url"`
+			} `json:"statuses"`
+		}{}
+		next, err := c.getJSONPage(ctx, pageURL, &page)
+		if err != nil {
+			return nil, fmt.Errorf("getting the status of %s: %w", sha, err)
+		}
+		for _, status := range page.Statuses {
+			check := CommitCheck{Name: status.Context, Status: "completed", Conclusion: status.State, URL: status.TargetURL}
+			switch status.State {
+			case "pending":
+				check.Status, check.Conclusion = "in_progress", ""
+			case "error":
+				check.Conclusion = "failure"
+			}
+			checks = append(checks, check)
+		}
+		pageURL = next
+	}
+	return checks, nil
+}
@@ -0,0 +1,103 @@
+package release
+
+import (
+	"bufio"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"strings"
+)
+
+// NewHash returns a hash for the checksum algorithm, one of sha256, sha512, sha1 or md5.
+func NewHash(algorithm string) (hash.Hash, error) {
+	switch algorithm {
+	case "sha256":
+		return sha256.New(), nil
+	case "sha512":
+		return sha512.New(), nil
+	case "sha1":
+		return sha1.New(), nil
+	case "md5":
+		return md5.New(), nil
+	}
+	return nil, fmt.Errorf("unsupported checksum algorithm %q", algorithm)
+}
+
+// IsSHA2 returns whether the checksum algorithm is a SHA-2 hash, sha256 or sha512, which are
+// approved for FIPS 140 unlike sha1 and md5.
+func IsSHA2(algorithm string) bool {
+	return algorithm == "sha256" || algorithm == "sha512"
+}
+
+// FileDigest returns the hex encoded checksum of the file using the algorithm.
+func FileDigest(path, algorithm string) (string, error) {
+	h, err := NewHash(algorithm)
+	if err != nil {
+		return "", err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", fmt.Errorf("hashing %s: %w", path, err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// WriteChecksums writes the checksum of every asset to w in the format used by sha256sum and
+// friends, so the file can be checked with e.g. sha256sum --check. The asset names are used
+// rather than their paths on disk, as that is what they will be called once downloaded.
+func WriteChecksums(w io.Writer, assets []AssetUpload, algorithm string) error {
+	for _, asset := range assets {
+		digest, err := FileDigest(asset.Path, algorithm)
+		if err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(w, "%s  %s\n", digest, asset.Name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ReadChecksums reads a checksums file in the format written by WriteChecksums and sha256sum,
+// returning the digests by file name. Names marked as binary with a leading * are supported.
+func ReadChecksums(r io.Reader) (map[string]string, error) {
+	checksums := map[string]string{}
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		fields := strings.Fields(text)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("line %d: expected a digest and file name", line)
+		}
+		checksums[strings.TrimPrefix(fields[1], "*")] = strings.ToLower(fields[0])
+	}
+	return checksums, scanner.Err()
+}
+
+// DigestAlgorithm returns the checksum algorithm for a hex encoded digest based on its length.
+func DigestAlgorithm(digest string) (string, error) {
+	switch len(digest) {
+	case 64:
+		return "sha256", nil
+	case 128:
+		return "sha512", nil
+	case 40:
+		return "sha1", nil
+	case 32:
+		return "md5", nil
+	}
+	return "", fmt.Errorf("unknown checksum algorithm for digest %s", digest)
+}
@@ -0,0 +1,579 @@
+// Package release creates and manages GitHub releases and their assets using the GitHub api.
+//
+// A Client is created for a single repository and all requests are sent through it:
+//
+//	client := release.NewClient("https://api.github.com", "imitablerabbit", "githubrelease", pat)
+//	r, err := client.CreateRelease(ctx, &release.CreateReleaseRequest{TagName: "v0.0.1"})
+//	if err != nil {
+//		return err
+//	}
+//	_, err = client.UploadAsset(ctx, r, release.AssetUpload{Path: "dist/app.tar.gz", Name: "app.tar.gz"})
+package release
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultAPIURL is the base URL of the public GitHub api.
+const DefaultAPIURL = "https://api.github.com"
+
+// DefaultAccept is the Accept header sent with api requests unless the Client is configured otherwise.
+const DefaultAccept = "application/vnd.github+json"
+
+// DefaultAPIVersion is the version of the GitHub REST api that requests are pinned to, so that the
+// responses do not change shape when GitHub releases a new version.
+const DefaultAPIVersion = "2022-11-28"
+
+// apiVersionHeader is the header that pins a request to a version of the api.
+const apiVersionHeader = "X-GitHub-Api-Version"
+
+// Client sends requests to the GitHub api for a single repository. All requests should go
+// through Do so that authentication and rate limit tracking are handled in one place. A Client
+// is safe for concurrent use once it is configured, and its requests share the connections of
+// its HTTPClient.
+type Client struct {
+	APIURL string
+	User   string
+	Repo   string
+	PAT    string
+
+	// TokenSource provides the token for each request instead of PAT when it is set, e.g. an
+	// AppTokenSource to authenticate as a GitHub App installation.
+	TokenSource TokenSource
+
+	// UserAgent is sent as the User-Agent header with every request.
+	UserAgent string
+
+	// Accept is sent as the Accept header for requests that do not set their own.
+	Accept string
+
+	// APIVersion is sent as the X-GitHub-Api-Version header, e.g. 2022-11-28. GitHub rejects a
+	// version that it does not support. It is not sent if it is empty, as for Gitea and GitLab.
+	APIVersion string
+
+	// RateWarnThreshold is the number of remaining requests below which the rate limit is
+	// logged at info level instead of debug.
+	RateWarnThreshold int
+
+	// Verbose enables debug logging, such as the rate limit status after every request.
+	Verbose bool
+
+	// Retries is the number of times a request is retried after a network error or a 5xx
+	// response. Zero disables retries.
+	Retries int
+
+	// RetryBackoff is the wait before the first retry. The wait doubles for each retry after
+	// that, with jitter added so that concurrent requests do not retry in lockstep.
+	RetryBackoff time.Duration
+
+	// WaitOnRateLimit makes requests that are rejected because the rate limit has been exceeded
+	// wait until the rate limit resets and then try again, instead of failing.
+	WaitOnRateLimit bool
+
+	// UploadProgress is called as the body of an asset upload is sent, with the number of bytes
+	// sent so far and the size of the file. The count starts again from zero if the upload is
+	// retried. It may be called from several goroutines at once when assets are uploaded
+	// concurrently.
+	UploadProgress func(asset AssetUpload, sent, total int64)
+
+	// Observer is told when a release is created or published and as its assets are uploaded,
+	// if it is set.
+	Observer Observer
+
+	// UploadURL replaces the scheme, host and path prefix of the upload_url returned for a
+	// release, e.g. https://ghe.example.com/api/uploads. GitHub Enterprise Server can return an
+	// upload host that is not reachable from the client, such as when it is behind a proxy.
+	UploadURL string
+
+	// BandwidthLimit limits the combined bandwidth of all of the asset uploads and downloads
+	// through the client, if it is set. It can be shared with other clients.
+	BandwidthLimit *BandwidthLimiter
+
+	// FileBandwidthLimit is the most bytes per second that a single asset upload or download
+	// can use, if it is greater than zero.
+	FileBandwidthLimit int64
+
+	// Cache stores the responses to GET requests and sends them again as conditional requests,
+	// so that unchanged data does not count against the rate limit, if it is set.
+	Cache *ResponseCache
+
+	// TokenHeader is the header that the token is sent in, without a scheme. The token is sent
+	// as "Authorization: token ..." if it is empty, which GitHub and Gitea accept. GitLab needs
+	// PRIVATE-TOKEN.
+	TokenHeader string
+
+	// HTTPClient sends the requests. NewClient gives it a transport from NewTransport with the
+	// DefaultTransportOptions, replace it to share a transport between clients or tune it.
+	HTTPClient *http.Client
+
+	mu                sync.Mutex
+	lastRateLimit     *RateLimit
+	deprecationWarned bool
+}
+
+// NewClient creates a Client for the repository user/repo that authenticates with the personal
+// access token pat. An empty apiURL uses the public GitHub api.
+func NewClient(apiURL, user, repo, pat string) *Client {
+	if apiURL == "" {
+		apiURL = DefaultAPIURL
+	}
+	return &Client{
+		APIURL:       strings.TrimSuffix(apiURL, "/"),
+		User:         user,
+		Repo:         repo,
+		PAT:          pat,
+		UserAgent:    "githubrelease",
+		Accept:       DefaultAccept,
+		APIVersion:   DefaultAPIVersion,
+		RetryBackoff: time.Second,
+		HTTPClient:   &http.Client{Transport: NewTransport(DefaultTransportOptions)},
+	}
+}
+
+// NormalizeAPIURL returns the api base URL for the URL of a GitHub instance. A GitHub Enterprise
+// Server URL without a path, e.g. https://ghe.example.com, gets the /api/v3 prefix that its api
+// is served under. URLs on an api. host, such as the public GitHub api, are left as they are.
+func NormalizeAPIURL(apiURL string) string {
+	apiURL = strings.TrimSuffix(apiURL, "/")
+	u, err := url.Parse(apiURL)
+	if err != nil || u.Host == "" || strings.HasPrefix(u.Host, "api.") || u.Path != "" {
+		return apiURL
+	}
+	return apiURL + "/api/v3"
+}
+
+// debugf logs the message with a debug prefix when verbose logging is enabled.
+func (c *Client) debugf(format string, v ...interface{}) {
+	if c.Verbose {
+		log.Printf("debug: "+format, v...)
+	}
+}
+
+// repoURL returns the api URL for the path under the repository, e.g. repoURL("releases/%d", id).
+func (c *Client) repoURL(format string, v ...interface{}) string {
+	return fmt.Sprintf("%s/repos/%s/%s/", c.APIURL, c.User, c.Repo) + fmt.Sprintf(format, v...)
+}
+
+// Do adds the authentication headers to the request and sends it. Requests that fail with a
+// network error or a retryable status code are retried as configured by Retries and
+// RetryBackoff. The rate limit status of the response is recorded and can be retrieved with
+// LastRateLimit.
+func (c *Client) Do(request *http.Request) (*http.Response, error) {
+	return c.do(request, nil)
+}
+
+// send adds the authentication headers to the request and sends it once.
+func (c *Client) send(request *http.Request) (*http.Response, error) {
+	token := c.PAT
+	if c.TokenSource != nil {
+		t, err := c.TokenSource.Token(request.Context())
+		if err != nil {
+			return nil, fmt.Errorf("getting token: %w", err)
+		}
+		token = t
+	}
+	if c.TokenHeader != "" {
+		request.Header.Set(c.TokenHeader, token)
+	} else {
+		request.Header.Set("Authorization", "token "+token)
+	}
+	if c.UserAgent != "" {
+		request.Header.Set("User-Agent", c.UserAgent)
+	}
+	if request.Header.Get("Accept") == "" && c.Accept != "" {
+		request.Header.Set("Accept", c.Accept)
+	}
+	if request.Header.Get(apiVersionHeader) == "" && c.APIVersion != "" {
+		request.Header.Set(apiVersionHeader, c.APIVersion)
+	}
+	httpClient := c.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	send := func(request *http.Request) (*http.Response, error) {
+		resp, err := httpClient.Do(request)
+		if err != nil {
+			return nil, err
+		}
+		c.recordRateLimit(resp.Header)
+		c.warnDeprecation(resp.Header)
+		return resp, nil
+	}
+	if c.Cache != nil && cacheable(request) {
+		return c.sendCached(request, token, send)
+	}
+	return send(request)
+}
+
+// LastRateLimit returns the rate limit status from the most recent response that included the
+// rate limit headers. nil is returned if no such response has been received yet.
+func (c *Client) LastRateLimit() *RateLimit {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.lastRateLimit == nil {
+		return nil
+	}
+	rl := *c.lastRateLimit
+	return &rl
+}
+
+func (c *Client) recordRateLimit(header http.Header) {
+	rl, ok := parseRateLimit(header)
+	if !ok {
+		return
+	}
+	c.mu.Lock()
+	c.lastRateLimit = rl
+	c.mu.Unlock()
+
+	if rl.Remaining < c.RateWarnThreshold {
+		log.Printf("info: rate limit: %d/%d requests remaining, resets at %s", rl.Remaining, rl.Limit, rl.Reset.Format(time.RFC3339))
+		return
+	}
+	c.debugf("rate limit: %d/%d requests remaining, resets at %s", rl.Remaining, rl.Limit, rl.Reset.Format(time.RFC3339))
+}
+
+// warnDeprecation logs a warning the first time that a response says that the api version or
+// endpoint is deprecated, with the date that it will stop working if it is given.
+func (c *Client) warnDeprecation(header http.Header) {
+	if header.Get("Deprecation") == "" {
+		return
+	}
+	c.mu.Lock()
+	warned := c.deprecationWarned
+	c.deprecationWarned = true
+	c.mu.Unlock()
+	if warned {
+		return
+	}
+	version := "the default GitHub api version"
+	if c.APIVersion != "" {
+		version = "GitHub api version " + c.APIVersion
+	}
+	if sunset := header.Get("Sunset"); sunset != "" {
+		log.Printf("warn: %s is deprecated and will stop working after %s, set a newer api version", version, sunset)
+		return
+	}
+	log.Printf("warn: %s is deprecated, set a newer api version", version)
+}
+
+// VerifyAuth checks that the token is valid and can be used with the repository. The token is
+// first checked against GET /user, which also reports the scopes of classic tokens. Installation
+// tokens cannot read the user, so for them only GET /repos/{owner}/{repo} is checked.
+func (c *Client) VerifyAuth(ctx context.Context) error {
+	_, _, err := c.verifyAuth(ctx)
+	return err
+}
+
+// VerifyReleaseAccess is VerifyAuth that also checks that the token can create releases. The
+// repository must not be archived and the user must be able to push to it. Fine-grained and app
+// tokens have their own permissions on top of that, which are checked with
+// CheckReleasePermission.
+func (c *Client) VerifyReleaseAccess(ctx context.Context) error {
+	info, repo, err := c.verifyAuth(ctx)
+	if err != nil {
+		return err
+	}
+	if repo.Archived {
+		return fmt.Errorf("repository %s is archived and read only", repo.FullName)
+	}
+	// Only a user who can read the repository but not push to it has Pull without Push.
+	if !repo.Permissions.Push && repo.Permissions.Pull {
+		return fmt.Errorf("token cannot push to %s, creating releases needs write access to the repository", repo.FullName)
+	}
+	if !info.Classic {
+		if err := c.CheckReleasePermission(ctx); err != nil {
+			return err
+		}
+	}
+	log.Printf("info: token can create releases in %s", repo.FullName)
+	return nil
+}
+
+// verifyAuth checks the token against the user and the repository and returns both.
+func (c *Client) verifyAuth(ctx context.Context) (*TokenInfo, *Repository, error) {
+	info, status, err := c.getTokenInfo(ctx)
+	switch {
+	case status == http.StatusUnauthorized:
+		return nil, nil, fmt.Errorf("token invalid or expired: %w", err)
+	case err != nil:
+		c.debugf("cannot read the user of the token, checking the repository instead: %v", err)
+		info = &TokenInfo{}
+	case info.Classic:
+		log.Printf("info: authenticated as %s with scopes: %s", info.Login, strings.Join(info.Scopes, ", "))
+		if !info.HasRepoScope() {
+			return nil, nil, fmt.Errorf("token missing repo scope: token for %s has scopes %q, creating releases needs repo or public_repo", info.Login, strings.Join(info.Scopes, ", "))
+		}
+	default:
+		log.Printf("info: authenticated as %s", info.Login)
+	}
+	repo, err := c.GetRepository(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	log.Printf("info: authenticated with access to %s", repo.FullName)
+	return info, repo, nil
+}
+
+// TokenInfo describes the token that the client authenticates with.
+type TokenInfo struct {
+	// Login is the user that the token belongs to.
+	Login string
+
+	// Scopes are the scopes of a classic token. Fine-grained and app tokens do not have scopes,
+	// their permissions are set per repository instead.
+	Scopes []string
+
+	// Classic is whether the token is a classic personal access token with scopes.
+	Classic bool
+}
+
+// GetTokenInfo returns the user and scopes of the token from GET /user.
+func (c *Client) GetTokenInfo(ctx context.Context) (*TokenInfo, error) {
+	info, _, err := c.getTokenInfo(ctx)
+	return info, err
+}
+
+// getTokenInfo is GetTokenInfo that also returns the status of the response.
+func (c *Client) getTokenInfo(ctx context.Context) (*TokenInfo, int, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("%s/user", c.APIURL), nil)
+	if err != nil {
+		return nil, 0, fmt.Errorf("creating user request: %w", err)
+	}
+	user := struct {
+		Login string `json:"login"`
+	}{}
+	status, header, err := c.doJSONHeader(request, http.StatusOK, &user)
+	if err != nil {
+		return nil, status, fmt.Errorf("getting authenticated user: %w", err)
+	}
+	info := &TokenInfo{Login: user.Login}
+	if scopes, ok := header["X-Oauth-Scopes"]; ok {
+		info.Classic = true
+		for _, scope := range strings.Split(strings.Join(scopes, ","), ",") {
+			if scope = strings.TrimSpace(scope); scope != "" {
+				info.Scopes = append(info.Scopes, scope)
+			}
+		}
+	}
+	return info, status, nil
+}
+
+// HasRepoScope reports whether a classic token has a scope that allows creating releases.
+// Tokens without scopes are not classic tokens and are always reported as having it.
+func (t *TokenInfo) HasRepoScope() bool {
+	return !t.Classic || hasRepoScope(strings.Join(t.Scopes, ","))
+}
+
+// Repository is the repository that the client manages releases for.
+type Repository struct {
+	Name          string   `json:"name"`
+	FullName      string   `json:"full_name"`
+	Private       bool     `json:"private"`
+	Archived      bool     `json:"archived"`
+	Fork          bool     `json:"fork"`
+	Topics        []string `json:"topics"`
+	DefaultBranch string   `json:"default_branch"`
+
+	// Permissions are what the authenticated user can do in the repository. Creating releases
+	// needs Push. They are all false when they are not reported, as for installation tokens.
+	Permissions struct {
+		Admin bool `json:"admin"`
+		Push  bool `json:"push"`
+		Pull  bool `json:"pull"`
+	} `json:"permissions"`
+}
+
+// GetRepository fetches the repository, including the permissions that the token has on it.
+func (c *Client) GetRepository(ctx context.Context) (*Repository, error) {
+	repo := &Repository{}
+	status, err := c.getJSON(ctx, fmt.Sprintf("%s/repos/%s/%s", c.APIURL, c.User, c.Repo), repo)
+	if status == http.StatusNotFound {
+		return nil, errorOf(ErrNotFound, "repository %s/%s does not exist or the token cannot access it", c.User, c.Repo)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("getting repository: %w", err)
+	}
+	return repo, nil
+}
+
+// ListOrgRepos fetches every repository in the organization that the token can see, following
+// the Link headers of the responses until there are no pages left.
+func (c *Client) ListOrgRepos(ctx context.Context, org string) ([]Repository, error) {
+	var repos []Repository
+	pageURL := fmt.Sprintf("%s/orgs/%s/repos?per_page=100&type=all", c.APIURL, org)
+	for pageURL != "" {
+		var pageRepos []Repository
+		next, err := c.getJSONPage(ctx, pageURL, &pageRepos)
+		if errors.Is(err, ErrNotFound) {
+			return nil, errorOf(ErrNotFound, "organization %s does not exist or the token cannot access it", org)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("listing repositories of %s: %w", org, err)
+		}
+		repos = append(repos, pageRepos...)
+		pageURL = next
+	}
+	return repos, nil
+}
+
+// hasRepoScope checks the comma separated list of classic token scopes for a scope that allows
+// creating releases.
+func hasRepoScope(scopes string) bool {
+	for _, scope := range strings.Split(scopes, ",") {
+		switch strings.TrimSpace(scope) {
+		case "repo", "public_repo":
+			return true
+		}
+	}
+	return false
+}
+
+// RateLimit is the rate limit status that GitHub reports in the X-RateLimit-* response headers.
+type RateLimit struct {
+	Limit     int
+	Remaining int
+	Reset     time.Time
+}
+
+// parseRateLimit reads the rate limit status from the response headers. false is returned if
+// the headers are missing or malformed, which is the case for some endpoints such as uploads.
+func parseRateLimit(header http.Header) (*RateLimit, bool) {
+	limit, err := strconv.Atoi(header.Get("X-RateLimit-Limit"))
+	if err != nil {
+		return nil, false
+	}
+	remaining, err := strconv.Atoi(header.Get("X-RateLimit-Remaining"))
+	if err != nil {
+		return nil, false
+	}
+	reset, err := strconv.ParseInt(header.Get("X-RateLimit-Reset"), 10, 64)
+	if err != nil {
+		return nil, false
+	}
+	return &RateLimit{
+		Limit:     limit,
+		Remaining: remaining,
+		Reset:     time.Unix(reset, 0),
+	}, true
+}
+
+// postJSON sends v as the json body of a POST request to url and unmarshals the 201 response into out.
+func (c *Client) postJSON(ctx context.Context, url string, v, out interface{}) error {
+	_, err := c.sendJSON(ctx, http.MethodPost, url, v, http.StatusCreated, out)
+	return err
+}
+
+// sendJSON sends v as the json body of a request to url and unmarshals the response into out if
+// it has the expected status code.
+func (c *Client) sendJSON(ctx context.Context, method, url string, v interface{}, expected int, out interface{}) (int, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return 0, fmt.Errorf("json marshal request: %w", err)
+	}
+	request, err := newReplayableRequest(ctx, method, url, data)
+	if err != nil {
+		return 0, fmt.Errorf("creating request: %w", err)
+	}
+	request.Header.Add("Content-Type", "application/json")
+	return c.doJSON(request, expected, out)
+}
+
+// newReplayableRequest creates a request with data as the body. Each read of the body gets a
+// fresh reader from the same data and GetBody is set, so the request can be sent again on
+// redirects and retries without the body having already been consumed.
+func newReplayableRequest(ctx context.Context, method, url string, data []byte) (*http.Request, error) {
+	body := func() io.Reader {
+		return bytes.NewReader(data)
+	}
+	request, err := http.NewRequestWithContext(ctx, method, url, body())
+	if err != nil {
+		return nil, err
+	}
+	request.GetBody = func() (io.ReadCloser, error) {
+		return ioutil.NopCloser(body()), nil
+	}
+	return request, nil
+}
+
+// getJSON sends a GET request to url and unmarshals the 200 response into out. The response
+// status code is returned so that callers can check for specific statuses such as 404.
+func (c *Client) getJSON(ctx context.Context, url string, out interface{}) (int, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return 0, fmt.Errorf("creating request: %w", err)
+	}
+	return c.doJSON(request, http.StatusOK, out)
+}
+
+// getJSONPage sends a GET request to the url of a page of a list and unmarshals the response body
+// into out. The url of the next page is returned from the Link header, or an empty string if this
+// is the last page.
+func (c *Client) getJSONPage(ctx context.Context, url string, out interface{}) (string, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return "", fmt.Errorf("creating request: %w", err)
+	}
+	_, header, err := c.doJSONHeader(request, http.StatusOK, out)
+	if err != nil {
+		return "", err
+	}
+	return nextPageURL(header), nil
+}
+
+// nextPageURL returns the url with rel="next" in the Link header, e.g.
+// <https://api.github.com/repositories/1/releases?page=2>; rel="next", <...>; rel="last".
+func nextPageURL(h http.Header) string {
+	for _, link := range strings.Split(h.Get("Link"), ",") {
+		target, params, ok := strings.Cut(link, ";")
+		if !ok {
+			continue
+		}
+		for _, param := range strings.Split(params, ";") {
+			if strings.TrimSpace(param) == `rel="next"` {
+				return strings.Trim(strings.TrimSpace(target), "<>")
+			}
+		}
+	}
+	return ""
+}
+
+// doJSON sends the request and unmarshals the response body into out if the response has the
+// expected status code.
+func (c *Client) doJSON(request *http.Request, expected int, out interface{}) (int, error) {
+	status, _, err := c.doJSONHeader(request, expected, out)
+	return status, err
+}
+
+// doJSONHeader is doJSON that also returns the response headers.
+func (c *Client) doJSONHeader(request *http.Request, expected int, out interface{}) (int, http.Header, error) {
+	resp, err := c.Do(request)
+	if err != nil {
+		return 0, nil, fmt.Errorf("sending request: %w", err)
+	}
+	defer resp.Body.Close()
+	respData, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return resp.StatusCode, resp.Header, fmt.Errorf("reading response body: %w", err)
+	}
+	if resp.StatusCode != expected {
+		return resp.StatusCode, resp.Header, responseError(expected, resp, respData)
+	}
+	if err := json.Unmarshal(respData, out); err != nil {
+		return resp.StatusCode, resp.Header, fmt.Errorf("unmarshaling response body: %w", err)
+	}
+	return resp.StatusCode, resp.Header, nil
+}
@@ -0,0 +1,73 @@
+package release
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMain(m *testing.M) {
+	// The client logs every request it sends.
+	log.SetOutput(ioutil.Discard)
+	os.Exit(m.Run())
+}
+
+// testClient returns a client for the octo/app repo on the server that retries quickly.
+func testClient(srv *httptest.Server, retries int) *Client {
+	c := NewClient(srv.URL, "octo", "app", "token")
+	c.HTTPClient = srv.Client()
+	c.Retries = retries
+	c.RetryBackoff = time.Millisecond
+	return c
+}
+
+func TestCreateReleaseRetrySendsSameBody(t *testing.T) {
+	var mu sync.Mutex
+	var bodies [][]byte
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			t.Errorf("reading request body: %v", err)
+		}
+		mu.Lock()
+		bodies = append(bodies, body)
+		attempt := len(bodies)
+		mu.Unlock()
+
+		w.Header().Set("Content-Type", "application/json")
+		if attempt == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			w.Write([]byte(`{"message":"Service Unavailable"}`))
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"id":1,"tag_name":"v1.0.0","name":"v1.0.0"}`))
+	}))
+	defer srv.Close()
+
+	crr := &CreateReleaseRequest{TagName: "v1.0.0", TargetCommitish: "main", Name: "v1.0.0", Body: "Notes for v1.0.0"}
+	rel, err := testClient(srv, 2).CreateRelease(context.Background(), crr)
+	if err != nil {
+		t.Fatalf("CreateRelease: %v", err)
+	}
+	if rel.ID != 1 {
+		t.Errorf("created release id = %d, want 1", rel.ID)
+	}
+
+	if len(bodies) != 2 {
+		t.Fatalf("server received %d requests, want 2", len(bodies))
+	}
+	if len(bodies[0]) == 0 {
+		t.Fatalf("first request has an empty body")
+	}
+	if !bytes.Equal(bodies[0], bodies[1]) {
+		t.Errorf("retried body differs from the first:\nfirst:  %s\nsecond: %s", bodies[0], bodies[1])
+	}
+}
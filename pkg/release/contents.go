@@ -0,0 +1,88 @@
+package release
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// FileContent is a file in a repository, as returned by the contents api.
+type FileContent struct {
+	Type     string `json:"type"`
+	Name     string `json:"name"`
+	Path     string `json:"path"`
+	SHA      string `json:"sha"`
+	Content  string `json:"content"`
+	Encoding string `json:"encoding"`
+}
+
+// Decode returns the contents of the file, which the api returns base64 encoded.
+func (fc *FileContent) Decode() ([]byte, error) {
+	if fc.Encoding != "base64" {
+		return nil, fmt.Errorf("unsupported content encoding %q", fc.Encoding)
+	}
+	// The content is wrapped onto lines of 60 characters.
+	return base64.StdEncoding.DecodeString(strings.ReplaceAll(fc.Content, "\n", ""))
+}
+
+// UpdateFileRequest is the body of a request to create or update a file with the contents api.
+// The content is base64 encoded when it is marshaled.
+type UpdateFileRequest struct {
+	Message string `json:"message"`
+	Content []byte `json:"content"`
+
+	// SHA is the blob SHA of the file being replaced. It must be set to update an existing file,
+	// and left empty to create a new one.
+	SHA string `json:"sha,omitempty"`
+
+	// Branch is the branch to commit to. The default branch of the repository is used if it is
+	// empty.
+	Branch string `json:"branch,omitempty"`
+}
+
+// contentsURL returns the contents api URL of the file at the path in the repository.
+func (c *Client) contentsURL(filePath string) string {
+	segments := strings.Split(strings.Trim(filePath, "/"), "/")
+	for i, s := range segments {
+		segments[i] = url.PathEscape(s)
+	}
+	return c.repoURL("contents/%s", strings.Join(segments, "/"))
+}
+
+// GetFileContent fetches the file at the path in the repository on the ref, or the default branch
+// if the ref is empty. nil is returned without an error if the file does not exist.
+func (c *Client) GetFileContent(ctx context.Context, filePath, ref string) (*FileContent, error) {
+	u := c.contentsURL(filePath)
+	if ref != "" {
+		u += "?ref=" + url.QueryEscape(ref)
+	}
+	fc := &FileContent{}
+	status, err := c.getJSON(ctx, u, fc)
+	if status == http.StatusNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("getting %s from %s/%s: %w", filePath, c.User, c.Repo, err)
+	}
+	if fc.Type != "file" {
+		return nil, fmt.Errorf("getting %s from %s/%s: it is a %s, not a file", filePath, c.User, c.Repo, fc.Type)
+	}
+	return fc, nil
+}
+
+// UpdateFile commits the file at the path in the repository, creating it if the request has no
+// SHA or replacing the existing file if it does.
+func (c *Client) UpdateFile(ctx context.Context, filePath string, ufr *UpdateFileRequest) error {
+	// GitHub answers 201 for a new file and 200 for an update.
+	expected := http.StatusCreated
+	if ufr.SHA != "" {
+		expected = http.StatusOK
+	}
+	if _, err := c.sendJSON(ctx, http.MethodPut, c.contentsURL(filePath), ufr, expected, &struct{}{}); err != nil {
+		return fmt.Errorf("updating %s in %s/%s: %w", filePath, c.User, c.Repo, err)
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+package release
+
+import (
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// contentTypes are the content types of common release asset extensions. These are checked
+// before the system mime types, which often don't know about packaging formats or compound
+// extensions such as .tar.gz.
+var contentTypes = map[string]string{
+	".tar.gz":    "application/gzip",
+	".tgz":       "application/gzip",
+	".gz":        "application/gzip",
+	".tar.bz2":   "application/x-bzip2",
+	".tar.xz":    "application/x-xz",
+	".xz":        "application/x-xz",
+	".tar.zst":   "application/zstd",
+	".zst":       "application/zstd",
+	".tar":       "application/x-tar",
+	".zip":       "application/zip",
+	".7z":        "application/x-7z-compressed",
+	".deb":       "application/vnd.debian.binary-package",
+	".rpm":       "application/x-rpm",
+	".apk":       "application/vnd.android.package-archive",
+	".exe":       "application/vnd.microsoft.portable-executable",
+	".msi":       "application/x-msi",
+	".dmg":       "application/x-apple-diskimage",
+	".pkg":       "application/octet-stream",
+	".appimage":  "application/x-executable",
+	".iso":       "application/x-iso9660-image",
+	".jar":       "application/java-archive",
+	".json":      "application/json",
+	".spdx.json": "application/spdx+json",
+	".cdx.json":  "application/vnd.cyclonedx+json",
+	".spdx":      "text/spdx",
+	".txt":       "text/plain; charset=utf-8",
+	".md":        "text/markdown; charset=utf-8",
+	".sha256":    "text/plain; charset=utf-8",
+	".sha512":    "text/plain; charset=utf-8",
+	".md5":       "text/plain; charset=utf-8",
+	".sig":       "application/pgp-signature",
+	".asc":       "application/pgp-signature",
+	".pem":       "application/x-pem-file",
+}
+
+// ContentType works out the content type of the file to send when it is uploaded. Known release
+// asset extensions are checked first, then the system mime types, and finally the start of the
+// file is sniffed. application/octet-stream is used if nothing matches.
+func ContentType(path string) string {
+	name := strings.ToLower(filepath.Base(path))
+	if contentType := contentTypeByExtension(name, contentTypes); contentType != "" {
+		return contentType
+	}
+	if contentType := mime.TypeByExtension(filepath.Ext(name)); contentType != "" {
+		return contentType
+	}
+	return sniffContentType(path)
+}
+
+// contentTypeByExtension returns the content type for the longest extension in types that the
+// name ends with, so that .tar.gz is preferred over .gz.
+func contentTypeByExtension(name string, types map[string]string) string {
+	match := ""
+	for ext := range types {
+		if strings.HasSuffix(name, strings.ToLower(ext)) && len(ext) > len(match) {
+			match = ext
+		}
+	}
+	return types[match]
+}
+
+// ContentTypeFromMap returns the content type for the file from the extension map, e.g.
+// {".whl": "application/zip"}. An empty string is returned if no extension matches.
+func ContentTypeFromMap(path string, types map[string]string) string {
+	return contentTypeByExtension(strings.ToLower(filepath.Base(path)), types)
+}
+
+// sniffContentType detects the content type from the first 512 bytes of the file.
+func sniffContentType(path string) string {
+	f, err := os.Open(path)
+	if err != nil {
+		return "application/octet-stream"
+	}
+	defer f.Close()
+	buf := make([]byte, 512)
+	n, _ := f.Read(buf)
+	return http.DetectContentType(buf[:n])
+}
@@ -0,0 +1,121 @@
+package release
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// DeviceFlow gets an OAuth token for a user with the OAuth device authorization flow, where the
+// user enters a code on GitHub in their browser. See
+// https://docs.github.com/en/apps/oauth-apps/building-oauth-apps/authorizing-oauth-apps#device-flow
+type DeviceFlow struct {
+	// BaseURL is the GitHub web URL, e.g. https://github.com, not the api URL.
+	BaseURL string
+
+	// ClientID is the client id of the OAuth app, which must have device flow enabled.
+	ClientID string
+
+	// Scopes are the OAuth scopes to request, e.g. repo.
+	Scopes []string
+
+	HTTPClient *http.Client
+}
+
+// DeviceCode is the code that the user enters at VerificationURI to authorize the token.
+type DeviceCode struct {
+	DeviceCode      string `json:"device_code"`
+	UserCode        string `json:"user_code"`
+	VerificationURI string `json:"verification_uri"`
+	ExpiresIn       int    `json:"expires_in"`
+	Interval        int    `json:"interval"`
+}
+
+// RequestCode starts the device flow and returns the code to show to the user.
+func (d *DeviceFlow) RequestCode(ctx context.Context) (*DeviceCode, error) {
+	code := &DeviceCode{}
+	form := url.Values{"client_id": {d.ClientID}, "scope": {strings.Join(d.Scopes, " ")}}
+	if err := d.post(ctx, "/login/device/code", form, code); err != nil {
+		return nil, fmt.Errorf("requesting device code: %w", err)
+	}
+	return code, nil
+}
+
+// PollToken waits for the user to authorize the device code and returns the access token. The
+// token endpoint is polled at the interval GitHub asks for until the code expires.
+func (d *DeviceFlow) PollToken(ctx context.Context, code *DeviceCode) (string, error) {
+	interval := time.Duration(code.Interval) * time.Second
+	if interval <= 0 {
+		interval = 5 * time.Second
+	}
+	form := url.Values{
+		"client_id":   {d.ClientID},
+		"device_code": {code.DeviceCode},
+		"grant_type":  {"urn:ietf:params:oauth:grant-type:device_code"},
+	}
+	for {
+		if err := sleep(ctx, interval); err != nil {
+			return "", err
+		}
+		token := struct {
+			AccessToken string `json:"access_token"`
+			Error       string `json:"error"`
+			Description string `json:"error_description"`
+			Interval    int    `json:"interval"`
+		}{}
+		if err := d.post(ctx, "/login/oauth/access_token", form, &token); err != nil {
+			return "", fmt.Errorf("polling for access token: %w", err)
+		}
+		switch token.Error {
+		case "":
+			return token.AccessToken, nil
+		case "authorization_pending":
+		case "slow_down":
+			interval = time.Duration(token.Interval) * time.Second
+		default:
+			return "", fmt.Errorf("device authorization failed: %s: %s", token.Error, token.Description)
+		}
+	}
+}
+
+// post sends the form to the path under BaseURL and decodes the JSON response.
+func (d *DeviceFlow) post(ctx context.Context, path string, form url.Values, out interface{}) error {
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimSuffix(d.BaseURL, "/")+path, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Accept", "application/json")
+	httpClient := d.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	resp, err := httpClient.Do(request)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	respData, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return responseError(http.StatusOK, resp, respData)
+	}
+	return json.Unmarshal(respData, out)
+}
+
+// WebURL returns the GitHub web URL for the api URL, e.g. https://github.com for
+// https://api.github.com and https://github.example.com for https://github.example.com/api/v3.
+func WebURL(apiURL string) (string, error) {
+	u, err := url.Parse(apiURL)
+	if err != nil {
+		return "", err
+	}
+	return u.Scheme + "://" + strings.TrimPrefix(u.Host, "api."), nil
+}
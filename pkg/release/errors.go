@@ -0,0 +1,173 @@
+package release
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// The failures that callers can check for with errors.Is. Errors from the API are *APIError,
+// which match the sentinel for their status and payload.
+var (
+	// ErrUnauthorized is a 401 response, the token is missing, invalid or expired.
+	ErrUnauthorized = errors.New("unauthorized")
+
+	// ErrForbidden is a 403 response that is not a rate limit, the token is not allowed to do it.
+	ErrForbidden = errors.New("forbidden")
+
+	// ErrNotFound is a 404 response. GitHub also reports a private repository that the token
+	// cannot access as not found.
+	ErrNotFound = errors.New("not found")
+
+	// ErrRateLimited is a response saying that the primary or secondary rate limit was exceeded.
+	ErrRateLimited = errors.New("rate limited")
+
+	// ErrTagExists is a response saying that the release or tag being created already exists.
+	ErrTagExists = errors.New("tag already exists")
+
+	// ErrAssetExists is a response saying that the release already has an asset with the name.
+	ErrAssetExists = errors.New("asset already exists")
+
+	// ErrAssetTooLarge is an asset larger than MaxAssetSize, which is not uploaded.
+	ErrAssetTooLarge = errors.New("asset too large")
+)
+
+// APIError is a response from the API without the expected status.
+type APIError struct {
+	// StatusCode and Status are the status of the response, Expected is the status that the
+	// request expected.
+	StatusCode int
+	Status     string
+	Expected   int
+
+	// RequestID is the X-GitHub-Request-Id of the response, which GitHub support asks for.
+	RequestID string
+
+	// Message, DocumentationURL and Errors are the error payload of the response, if it has one.
+	Message          string
+	DocumentationURL string
+	Errors           []APIErrorDetail
+
+	// MissingPermission is the permission that a fine-grained or app token needs, from
+	// MissingPermission.
+	MissingPermission string
+
+	// Body is the body of the response.
+	Body []byte
+
+	header http.Header
+}
+
+// APIErrorDetail is one of the errors in the payload of a 422 response, such as a field of the
+// request that is invalid.
+type APIErrorDetail struct {
+	Resource string `json:"resource"`
+	Field    string `json:"field"`
+	Code     string `json:"code"`
+	Message  string `json:"message"`
+}
+
+func (e *APIError) Error() string {
+	msg := fmt.Sprintf("non %d response: %s: %s", e.Expected, e.Status, e.Body)
+	if e.MissingPermission != "" {
+		msg = fmt.Sprintf("token missing %s: %s", e.MissingPermission, msg)
+	}
+	return msg
+}
+
+// Is reports whether the error is the sentinel error for its status and payload.
+func (e *APIError) Is(target error) bool {
+	switch target {
+	case ErrUnauthorized:
+		return e.StatusCode == http.StatusUnauthorized
+	case ErrForbidden:
+		return e.StatusCode == http.StatusForbidden && !e.rateLimited()
+	case ErrNotFound:
+		return e.StatusCode == http.StatusNotFound
+	case ErrRateLimited:
+		return e.rateLimited()
+	case ErrTagExists:
+		return e.StatusCode == http.StatusUnprocessableEntity &&
+			(e.hasDetail("tag_name", "already_exists") || strings.Contains(e.Message, "Reference already exists"))
+	case ErrAssetExists:
+		return e.StatusCode == http.StatusUnprocessableEntity && e.hasDetail("name", "already_exists")
+	}
+	return false
+}
+
+// Header returns the headers of the response.
+func (e *APIError) Header() http.Header {
+	return e.header
+}
+
+// rateLimited reports whether the response is for an exceeded rate limit.
+func (e *APIError) rateLimited() bool {
+	if e.StatusCode != http.StatusForbidden && e.StatusCode != http.StatusTooManyRequests {
+		return false
+	}
+	return e.StatusCode == http.StatusTooManyRequests || e.header.Get("X-RateLimit-Remaining") == "0" ||
+		strings.Contains(strings.ToLower(e.Message), "rate limit")
+}
+
+// hasDetail reports whether the payload has an error with the code for the field.
+func (e *APIError) hasDetail(field, code string) bool {
+	for _, detail := range e.Errors {
+		if detail.Field == field && detail.Code == code {
+			return true
+		}
+	}
+	return false
+}
+
+// newAPIError returns the error for a response without the expected status, with the error
+// payload parsed from the body if it has one.
+func newAPIError(expected int, resp *http.Response, respData []byte) *APIError {
+	e := &APIError{
+		StatusCode:        resp.StatusCode,
+		Status:            resp.Status,
+		Expected:          expected,
+		RequestID:         resp.Header.Get("X-GitHub-Request-Id"),
+		MissingPermission: MissingPermission(resp.StatusCode, resp.Header),
+		Body:              respData,
+		header:            resp.Header,
+	}
+	payload := struct {
+		Message          string            `json:"message"`
+		DocumentationURL string            `json:"documentation_url"`
+		Errors           []json.RawMessage `json:"errors"`
+	}{}
+	if json.Unmarshal(respData, &payload) != nil {
+		return e
+	}
+	e.Message, e.DocumentationURL = payload.Message, payload.DocumentationURL
+	for _, raw := range payload.Errors {
+		// Some endpoints give the errors as plain messages.
+		var detail APIErrorDetail
+		if json.Unmarshal(raw, &detail) != nil {
+			json.Unmarshal(raw, &detail.Message)
+		}
+		e.Errors = append(e.Errors, detail)
+	}
+	return e
+}
+
+// kindError is an error with its own message that matches one of the sentinel errors.
+type kindError struct {
+	kind error
+	msg  string
+}
+
+func (e *kindError) Error() string {
+	return e.msg
+}
+
+func (e *kindError) Is(target error) bool {
+	return target == e.kind
+}
+
+// errorOf returns an error with the formatted message that errors.Is matches with the kind.
+func errorOf(kind error, format string, v ...interface{}) error {
+	return &kindError{kind: kind, msg: fmt.Sprintf(format, v...)}
+}
@@ -0,0 +1,104 @@
+package release
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+)
+
+// GiteaClient creates releases in a Gitea repository. The Gitea releases api follows the GitHub
+// api closely enough that the Client is used for everything except asset uploads, which Gitea
+// takes as a multipart form.
+type GiteaClient struct {
+	*Client
+}
+
+// NewGiteaClient creates a GiteaClient for the repository user/repo that authenticates with the
+// access token. A URL without a path, e.g. https://gitea.example.com, has /api/v1 added.
+func NewGiteaClient(apiURL, user, repo, token string) *GiteaClient {
+	c := NewClient(NormalizeGiteaAPIURL(apiURL), user, repo, token)
+	c.Accept = "application/json"
+	c.APIVersion = ""
+	return &GiteaClient{Client: c}
+}
+
+// NormalizeGiteaAPIURL returns the api base URL for the URL of a Gitea instance, adding /api/v1
+// to a URL without a path.
+func NormalizeGiteaAPIURL(apiURL string) string {
+	return normalizeForgeAPIURL(apiURL, "/api/v1")
+}
+
+// UploadAsset uploads the file to the release as an attachment. The file is streamed from disk
+// as the attachment field of a multipart form.
+func (c *GiteaClient) UploadAsset(ctx context.Context, release *Release, asset AssetUpload) (*Asset, error) {
+	return c.observeUpload(release, asset, func() (*Asset, error) {
+		return c.uploadAsset(ctx, release, asset)
+	})
+}
+
+func (c *GiteaClient) uploadAsset(ctx context.Context, release *Release, asset AssetUpload) (*Asset, error) {
+	assetURL := c.repoURL("releases/%d/assets?name=%s", release.ID, url.QueryEscape(asset.Name))
+	log.Printf("info: sending upload request to %s", assetURL)
+	body, contentType, err := c.multipartBody(ctx, asset)
+	if err != nil {
+		return nil, fmt.Errorf("opening file for upload: %w", err)
+	}
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, assetURL, body)
+	if err != nil {
+		body.Close()
+		return nil, fmt.Errorf("creating upload request: %w", err)
+	}
+	request.GetBody = func() (io.ReadCloser, error) {
+		body, _, err := c.multipartBody(ctx, asset)
+		return body, err
+	}
+	request.Header.Set("Content-Type", contentType)
+	resp, err := c.Do(request)
+	if err != nil {
+		return nil, fmt.Errorf("sending upload request: %w", err)
+	}
+	defer resp.Body.Close()
+	respData, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("reading upload response body: %w", err)
+	}
+	if resp.StatusCode != http.StatusCreated {
+		return nil, responseError(http.StatusCreated, resp, respData)
+	}
+	uploaded := &Asset{}
+	if err := json.Unmarshal(respData, uploaded); err != nil {
+		return nil, fmt.Errorf("unmarshaling upload response body: %w", err)
+	}
+	// Gitea attachments have no state, they only exist once the upload has finished.
+	uploaded.State = "uploaded"
+	return uploaded, nil
+}
+
+// multipartBody returns a body that streams the asset as the attachment field of a multipart
+// form, and the content type of the form.
+func (c *GiteaClient) multipartBody(ctx context.Context, asset AssetUpload) (io.ReadCloser, string, error) {
+	file, _, err := c.openUploadBody(ctx, asset)
+	if err != nil {
+		return nil, "", err
+	}
+	pr, pw := io.Pipe()
+	form := multipart.NewWriter(pw)
+	go func() {
+		defer file.Close()
+		part, err := form.CreateFormFile("attachment", asset.Name)
+		if err == nil {
+			_, err = io.Copy(part, file)
+		}
+		if err == nil {
+			err = form.Close()
+		}
+		pw.CloseWithError(err)
+	}()
+	return pr, form.FormDataContentType(), nil
+}
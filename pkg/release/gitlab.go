@@ -0,0 +1,176 @@
+package release
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+)
+
+// GitLabClient creates releases in a GitLab project. GitLab releases have no assets of their own,
+// so files are uploaded to the generic package registry of the project and linked from the
+// release. GitLab has no draft releases.
+type GitLabClient struct {
+	*Client
+}
+
+// NewGitLabClient creates a GitLabClient for the project user/repo, where user can be a group with
+// subgroups, that authenticates with the access token. A URL without a path, e.g.
+// https://gitlab.example.com, has /api/v4 added.
+func NewGitLabClient(apiURL, user, repo, token string) *GitLabClient {
+	c := NewClient(NormalizeGitLabAPIURL(apiURL), user, repo, token)
+	c.Accept = "application/json"
+	c.APIVersion = ""
+	c.TokenHeader = "PRIVATE-TOKEN"
+	return &GitLabClient{Client: c}
+}
+
+// NormalizeGitLabAPIURL returns the api base URL for the URL of a GitLab instance, adding /api/v4
+// to a URL without a path.
+func NormalizeGitLabAPIURL(apiURL string) string {
+	return normalizeForgeAPIURL(apiURL, "/api/v4")
+}
+
+// projectURL returns the api URL for the path under the project, e.g. projectURL("releases").
+func (c *GitLabClient) projectURL(format string, v ...interface{}) string {
+	return fmt.Sprintf("%s/projects/%s/", c.APIURL, url.PathEscape(c.User+"/"+c.Repo)) + fmt.Sprintf(format, v...)
+}
+
+// gitlabRelease is a release in the GitLab api.
+type gitlabRelease struct {
+	TagName     string    `json:"tag_name"`
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	CreatedAt   time.Time `json:"created_at"`
+	ReleasedAt  time.Time `json:"released_at"`
+	Commit      struct {
+		ID string `json:"id"`
+	} `json:"commit"`
+	Links struct {
+		Self string `json:"self"`
+	} `json:"_links"`
+}
+
+// release converts the GitLab release into a Release. GitLab releases are identified by their
+// tag and have no id.
+func (r *gitlabRelease) release() *Release {
+	return &Release{
+		HTMLURL:         r.Links.Self,
+		TagName:         r.TagName,
+		TargetCommitish: r.Commit.ID,
+		Name:            r.Name,
+		Body:            r.Description,
+		CreatedAt:       r.CreatedAt,
+		PublishedAt:     r.ReleasedAt,
+	}
+}
+
+// CreateRelease creates the release, and the tag from TargetCommitish if it does not exist yet.
+// GitLab has no drafts so an error is returned for a draft, and PreRelease is ignored.
+func (c *GitLabClient) CreateRelease(ctx context.Context, crr *CreateReleaseRequest) (*Release, error) {
+	if crr.Draft {
+		return nil, fmt.Errorf("GitLab releases cannot be drafts")
+	}
+	releaseURL := c.projectURL("releases")
+	log.Printf("info: sending create request to %s", releaseURL)
+	req := map[string]string{
+		"tag_name":    crr.TagName,
+		"name":        crr.Name,
+		"description": crr.Body,
+		"ref":         crr.TargetCommitish,
+	}
+	created := &gitlabRelease{}
+	if err := c.postJSON(ctx, releaseURL, req, created); err != nil {
+		return nil, fmt.Errorf("creating release: %w", err)
+	}
+	release := created.release()
+	c.observeCreated(release)
+	return release, nil
+}
+
+// FindReleaseByTag fetches the release for the tag, or returns nil without an error if there
+// isn't one.
+func (c *GitLabClient) FindReleaseByTag(ctx context.Context, tag string) (*Release, error) {
+	found := &gitlabRelease{}
+	status, err := c.getJSON(ctx, c.projectURL("releases/%s", url.PathEscape(tag)), found)
+	if status == http.StatusNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("getting release for tag %s: %w", tag, err)
+	}
+	return found.release(), nil
+}
+
+// packageURL returns the URL of the file in the generic package named after the project, with the
+// release tag as the version. Package versions cannot contain /, so it is replaced with -.
+func (c *GitLabClient) packageURL(tag, name string) string {
+	return c.projectURL("packages/generic/%s/%s/%s", url.PathEscape(path.Base(c.Repo)),
+		url.PathEscape(strings.ReplaceAll(tag, "/", "-")), url.PathEscape(name))
+}
+
+// UploadAsset uploads the file to the generic package registry and links it from the release. The
+// link is named after the label of the asset, or its name if it has no label.
+func (c *GitLabClient) UploadAsset(ctx context.Context, release *Release, asset AssetUpload) (*Asset, error) {
+	return c.observeUpload(release, asset, func() (*Asset, error) {
+		return c.uploadAsset(ctx, release, asset)
+	})
+}
+
+func (c *GitLabClient) uploadAsset(ctx context.Context, release *Release, asset AssetUpload) (*Asset, error) {
+	body, size, err := c.openUploadBody(ctx, asset)
+	if err != nil {
+		return nil, fmt.Errorf("opening file for upload: %w", err)
+	}
+	defer body.Close()
+	fileURL := c.packageURL(release.TagName, asset.Name)
+	log.Printf("info: sending upload request to %s", fileURL)
+	request, err := http.NewRequestWithContext(ctx, http.MethodPut, fileURL, body)
+	if err != nil {
+		return nil, fmt.Errorf("creating upload request: %w", err)
+	}
+	request.ContentLength = size
+	request.GetBody = func() (io.ReadCloser, error) {
+		body, _, err := c.openUploadBody(ctx, asset)
+		return body, err
+	}
+	request.Header.Set("Content-Type", "application/octet-stream")
+	resp, err := c.Do(request)
+	if err != nil {
+		return nil, fmt.Errorf("sending upload request: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		respData, _ := ioutil.ReadAll(resp.Body)
+		return nil, responseError(http.StatusCreated, resp, respData)
+	}
+
+	name := asset.Label
+	if name == "" {
+		name = asset.Name
+	}
+	link := struct {
+		ID  int    `json:"id"`
+		URL string `json:"url"`
+	}{}
+	linkURL := c.projectURL("releases/%s/assets/links", url.PathEscape(release.TagName))
+	req := map[string]string{"name": name, "url": fileURL, "link_type": "package"}
+	if err := c.postJSON(ctx, linkURL, req, &link); err != nil {
+		return nil, fmt.Errorf("linking %s to the release: %w", asset.Name, err)
+	}
+	return &Asset{
+		ID:                 link.ID,
+		Name:               asset.Name,
+		Label:              asset.Label,
+		ContentType:        "application/octet-stream",
+		State:              "uploaded",
+		Size:               size,
+		BrowserDownloadURL: link.URL,
+	}, nil
+}
@@ -0,0 +1,339 @@
+package release
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// graphQLPageSize is the number of releases fetched by each GraphQL query. Each release brings
+// up to 100 of its assets with it, so this is kept below the 100 that GitHub allows to stop the
+// queries from timing out on repositories with large release notes.
+const graphQLPageSize = 50
+
+// Reactions are the counts of the reactions to a release, in the same form as the REST api.
+type Reactions struct {
+	TotalCount int `json:"total_count"`
+	PlusOne    int `json:"+1"`
+	MinusOne   int `json:"-1"`
+	Laugh      int `json:"laugh"`
+	Hooray     int `json:"hooray"`
+	Confused   int `json:"confused"`
+	Heart      int `json:"heart"`
+	Rocket     int `json:"rocket"`
+	Eyes       int `json:"eyes"`
+}
+
+// add adds the count for a GraphQL ReactionContent value, e.g. THUMBS_UP.
+func (r *Reactions) add(content string, count int) {
+	switch content {
+	case "THUMBS_UP":
+		r.PlusOne += count
+	case "THUMBS_DOWN":
+		r.MinusOne += count
+	case "LAUGH":
+		r.Laugh += count
+	case "HOORAY":
+		r.Hooray += count
+	case "CONFUSED":
+		r.Confused += count
+	case "HEART":
+		r.Heart += count
+	case "ROCKET":
+		r.Rocket += count
+	case "EYES":
+		r.Eyes += count
+	default:
+		return
+	}
+	r.TotalCount += count
+}
+
+// GraphQLURL returns the URL of the GraphQL api, which is /graphql on the public GitHub api and
+// /api/graphql on GitHub Enterprise Server.
+func (c *Client) GraphQLURL() string {
+	if strings.HasSuffix(c.APIURL, "/api/v3") {
+		return strings.TrimSuffix(c.APIURL, "/v3") + "/graphql"
+	}
+	return c.APIURL + "/graphql"
+}
+
+// GraphQLError is an error returned in the errors of a GraphQL response.
+type GraphQLError struct {
+	Type    string `json:"type"`
+	Message string `json:"message"`
+}
+
+// GraphQL sends the query with its variables to the GraphQL api and unmarshals the data of the
+// response into out. An error is returned if the response has any errors, even if it also has
+// data.
+func (c *Client) GraphQL(ctx context.Context, query string, variables map[string]interface{}, out interface{}) error {
+	req := map[string]interface{}{"query": query, "variables": variables}
+	resp := struct {
+		Data   json.RawMessage `json:"data"`
+		Errors []GraphQLError  `json:"errors"`
+	}{}
+	if _, err := c.sendJSON(ctx, http.MethodPost, c.GraphQLURL(), req, http.StatusOK, &resp); err != nil {
+		return err
+	}
+	if len(resp.Errors) > 0 {
+		messages := make([]string, len(resp.Errors))
+		for i, e := range resp.Errors {
+			messages[i] = e.Message
+		}
+		return fmt.Errorf("graphql: %s", strings.Join(messages, "; "))
+	}
+	if err := json.Unmarshal(resp.Data, out); err != nil {
+		return fmt.Errorf("unmarshaling graphql data: %w", err)
+	}
+	return nil
+}
+
+// graphQLReleaseFields are the fields of each release that are fetched by the GraphQL queries.
+const graphQLReleaseFields = `
+	id
+	databaseId
+	url
+	name
+	tagName
+	description
+	isDraft
+	isPrerelease
+	createdAt
+	publishedAt
+	tagCommit { oid }
+	author { login databaseId url avatarUrl }
+	reactionGroups { content reactors { totalCount } }
+	releaseAssets(first: 100) {
+		pageInfo { hasNextPage endCursor }
+		nodes { ...asset }
+	}`
+
+// graphQLAssetFields are the fields of each asset that are fetched by the GraphQL queries.
+const graphQLAssetFields = `
+fragment asset on ReleaseAsset {
+	id
+	name
+	contentType
+	size
+	downloadCount
+	downloadUrl
+	createdAt
+	updatedAt
+	uploadedBy { login }
+}`
+
+// graphQLPageInfo is the paging information of a GraphQL connection.
+type graphQLPageInfo struct {
+	HasNextPage bool   `json:"hasNextPage"`
+	EndCursor   string `json:"endCursor"`
+}
+
+// graphQLAsset is a release asset in the GraphQL api.
+type graphQLAsset struct {
+	ID            string    `json:"id"`
+	Name          string    `json:"name"`
+	ContentType   string    `json:"contentType"`
+	Size          int64     `json:"size"`
+	DownloadCount int       `json:"downloadCount"`
+	DownloadURL   string    `json:"downloadUrl"`
+	CreatedAt     time.Time `json:"createdAt"`
+	UpdatedAt     time.Time `json:"updatedAt"`
+	UploadedBy    *struct {
+		Login string `json:"login"`
+	} `json:"uploadedBy"`
+}
+
+// graphQLAssets is a page of the assets of a release.
+type graphQLAssets struct {
+	PageInfo graphQLPageInfo `json:"pageInfo"`
+	Nodes    []graphQLAsset  `json:"nodes"`
+}
+
+// graphQLRelease is a release in the GraphQL api.
+type graphQLRelease struct {
+	ID           string    `json:"id"`
+	DatabaseID   int       `json:"databaseId"`
+	URL          string    `json:"url"`
+	Name         string    `json:"name"`
+	TagName      string    `json:"tagName"`
+	Description  string    `json:"description"`
+	IsDraft      bool      `json:"isDraft"`
+	IsPrerelease bool      `json:"isPrerelease"`
+	CreatedAt    time.Time `json:"createdAt"`
+	PublishedAt  time.Time `json:"publishedAt"`
+	TagCommit    *struct {
+		OID string `json:"oid"`
+	} `json:"tagCommit"`
+	Author *struct {
+		Login      string `json:"login"`
+		DatabaseID int    `json:"databaseId"`
+		URL        string `json:"url"`
+		AvatarURL  string `json:"avatarUrl"`
+	} `json:"author"`
+	ReactionGroups []struct {
+		Content  string `json:"content"`
+		Reactors struct {
+			TotalCount int `json:"totalCount"`
+		} `json:"reactors"`
+	} `json:"reactionGroups"`
+	ReleaseAssets graphQLAssets `json:"releaseAssets"`
+}
+
+// release converts the GraphQL release into a Release, with the author and assets in the same
+// form as the REST api.
+func (r *graphQLRelease) release() Release {
+	rel := Release{
+		HTMLURL:     r.URL,
+		ID:          r.DatabaseID,
+		NodeID:      r.ID,
+		TagName:     r.TagName,
+		Name:        r.Name,
+		Body:        r.Description,
+		Draft:       r.IsDraft,
+		PreRelease:  r.IsPrerelease,
+		CreatedAt:   r.CreatedAt,
+		PublishedAt: r.PublishedAt,
+		Assets:      []Asset{},
+	}
+	if r.TagCommit != nil {
+		rel.TagCommit = r.TagCommit.OID
+	}
+	if r.Author != nil {
+		rel.Author = &User{Login: r.Author.Login, ID: r.Author.DatabaseID, HTMLURL: r.Author.URL, AvatarURL: r.Author.AvatarURL}
+	}
+	reactions := &Reactions{}
+	for _, g := range r.ReactionGroups {
+		reactions.add(g.Content, g.Reactors.TotalCount)
+	}
+	if reactions.TotalCount > 0 {
+		rel.Reactions = reactions
+	}
+	for _, a := range r.ReleaseAssets.Nodes {
+		asset := Asset{
+			NodeID:             a.ID,
+			Name:               a.Name,
+			ContentType:        a.ContentType,
+			Size:               a.Size,
+			DownloadCount:      a.DownloadCount,
+			BrowserDownloadURL: a.DownloadURL,
+			CreatedAt:          a.CreatedAt,
+			UpdatedAt:          a.UpdatedAt,
+		}
+		if a.UploadedBy != nil {
+			asset.Uploader = &User{Login: a.UploadedBy.Login}
+		}
+		rel.Assets = append(rel.Assets, asset)
+	}
+	return rel
+}
+
+// WalkReleasesGraphQL calls fn for each release in the repository, newest first, like
+// WalkReleases. Each query returns a page of releases with their assets, tag commit, author and
+// reactions, so far fewer requests are needed than with the REST api. It stops early if fn
+// returns false or an error.
+func (c *Client) WalkReleasesGraphQL(ctx context.Context, fn func(Release) (bool, error)) error {
+	query := `query($owner: String!, $name: String!, $first: Int!, $after: String) {
+	repository(owner: $owner, name: $name) {
+		releases(first: $first, after: $after, orderBy: {field: CREATED_AT, direction: DESC}) {
+			pageInfo { hasNextPage endCursor }
+			nodes {` + graphQLReleaseFields + `
+			}
+		}
+	}
+}` + graphQLAssetFields
+	variables := map[string]interface{}{"owner": c.User, "name": c.Repo, "first": graphQLPageSize, "after": nil}
+	for {
+		data := struct {
+			Repository *struct {
+				Releases struct {
+					PageInfo graphQLPageInfo  `json:"pageInfo"`
+					Nodes    []graphQLRelease `json:"nodes"`
+				} `json:"releases"`
+			} `json:"repository"`
+		}{}
+		if err := c.GraphQL(ctx, query, variables, &data); err != nil {
+			return fmt.Errorf("listing releases: %w", err)
+		}
+		if data.Repository == nil {
+			return errorOf(ErrNotFound, "listing releases: repository %s/%s not found", c.User, c.Repo)
+		}
+		releases := data.Repository.Releases
+		for i := range releases.Nodes {
+			if err := c.moreReleaseAssets(ctx, &releases.Nodes[i]); err != nil {
+				return err
+			}
+			more, err := fn(releases.Nodes[i].release())
+			if err != nil || !more {
+				return err
+			}
+		}
+		if !releases.PageInfo.HasNextPage {
+			return nil
+		}
+		variables["after"] = releases.PageInfo.EndCursor
+	}
+}
+
+// GetReleaseByTagGraphQL fetches the release for the tag with the GraphQL api, including its
+// assets, tag commit, author and reactions. nil is returned without an error if there is no
+// release for the tag.
+func (c *Client) GetReleaseByTagGraphQL(ctx context.Context, tag string) (*Release, error) {
+	query := `query($owner: String!, $name: String!, $tag: String!) {
+	repository(owner: $owner, name: $name) {
+		release(tagName: $tag) {` + graphQLReleaseFields + `
+		}
+	}
+}` + graphQLAssetFields
+	data := struct {
+		Repository *struct {
+			Release *graphQLRelease `json:"release"`
+		} `json:"repository"`
+	}{}
+	variables := map[string]interface{}{"owner": c.User, "name": c.Repo, "tag": tag}
+	if err := c.GraphQL(ctx, query, variables, &data); err != nil {
+		return nil, fmt.Errorf("getting release for tag %s: %w", tag, err)
+	}
+	if data.Repository == nil {
+		return nil, errorOf(ErrNotFound, "getting release for tag %s: repository %s/%s not found", tag, c.User, c.Repo)
+	}
+	if data.Repository.Release == nil {
+		return nil, nil
+	}
+	if err := c.moreReleaseAssets(ctx, data.Repository.Release); err != nil {
+		return nil, err
+	}
+	rel := data.Repository.Release.release()
+	return &rel, nil
+}
+
+// moreReleaseAssets fetches the rest of the assets of a release with more than the first page.
+func (c *Client) moreReleaseAssets(ctx context.Context, r *graphQLRelease) error {
+	query := `query($id: ID!, $after: String) {
+	node(id: $id) {
+		... on Release {
+			releaseAssets(first: 100, after: $after) {
+				pageInfo { hasNextPage endCursor }
+				nodes { ...asset }
+			}
+		}
+	}
+}` + graphQLAssetFields
+	for page := r.ReleaseAssets.PageInfo; page.HasNextPage; {
+		data := struct {
+			Node struct {
+				ReleaseAssets graphQLAssets `json:"releaseAssets"`
+			} `json:"node"`
+		}{}
+		variables := map[string]interface{}{"id": r.ID, "after": page.EndCursor}
+		if err := c.GraphQL(ctx, query, variables, &data); err != nil {
+			return fmt.Errorf("listing assets of release %s: %w", r.TagName, err)
+		}
+		r.ReleaseAssets.Nodes = append(r.ReleaseAssets.Nodes, data.Node.ReleaseAssets.Nodes...)
+		page = data.Node.ReleaseAssets.PageInfo
+	}
+	return nil
+}
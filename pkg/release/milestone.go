@@ -0,0 +1,80 @@
+package release
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+)
+
+// Milestone is a milestone in the repository.
+type Milestone struct {
+	Number       int    `json:"number"`
+	Title        string `json:"title"`
+	State        string `json:"state"`
+	HTMLURL      string `json:"html_url"`
+	OpenIssues   int    `json:"open_issues"`
+	ClosedIssues int    `json:"closed_issues"`
+}
+
+// Issue is an issue or pull request in the repository. PullRequest is only set for pull requests.
+type Issue struct {
+	Number  int    `json:"number"`
+	Title   string `json:"title"`
+	State   string `json:"state"`
+	HTMLURL string `json:"html_url"`
+	User    struct {
+		Login string `json:"login"`
+	} `json:"user"`
+	PullRequest *struct {
+		HTMLURL string `json:"html_url"`
+	} `json:"pull_request"`
+}
+
+// FindMilestone returns the open or closed milestone with the title, or nil if there is no such
+// milestone.
+func (c *Client) FindMilestone(ctx context.Context, title string) (*Milestone, error) {
+	pageURL := c.repoURL("milestones?state=all&per_page=100")
+	for pageURL != "" {
+		var milestones []Milestone
+		next, err := c.getJSONPage(ctx, pageURL, &milestones)
+		if err != nil {
+			return nil, fmt.Errorf("listing milestones: %w", err)
+		}
+		for i := range milestones {
+			if milestones[i].Title == title {
+				return &milestones[i], nil
+			}
+		}
+		pageURL = next
+	}
+	return nil, nil
+}
+
+// ListMilestoneIssues fetches the issues and pull requests in the milestone that are in the
+// state: open, closed or all.
+func (c *Client) ListMilestoneIssues(ctx context.Context, number int, state string) ([]Issue, error) {
+	var issues []Issue
+	pageURL := c.repoURL("issues?milestone=%d&state=%s&per_page=100", number, state)
+	for pageURL != "" {
+		var pageIssues []Issue
+		next, err := c.getJSONPage(ctx, pageURL, &pageIssues)
+		if err != nil {
+			return nil, fmt.Errorf("listing milestone issues: %w", err)
+		}
+		issues = append(issues, pageIssues...)
+		pageURL = next
+	}
+	return issues, nil
+}
+
+// CloseMilestone closes the milestone with the number. The closed milestone is returned.
+func (c *Client) CloseMilestone(ctx context.Context, number int) (*Milestone, error) {
+	milestoneURL := c.repoURL("milestones/%d", number)
+	log.Printf("info: sending close milestone request to %s", milestoneURL)
+	milestone := &Milestone{}
+	if _, err := c.sendJSON(ctx, http.MethodPatch, milestoneURL, map[string]string{"state": "closed"}, http.StatusOK, milestone); err != nil {
+		return nil, fmt.Errorf("closing milestone: %w", err)
+	}
+	return milestone, nil
+}
@@ -0,0 +1,72 @@
+package release
+
+// Observer is told about the progress of a release as the client creates it and uploads its
+// assets, so that a GUI or bot embedding the package can show it without parsing the log. Set it
+// as the Observer of a Client. Its methods may be called from several goroutines at once when
+// assets are uploaded concurrently, and should return quickly as they are called inline. Embed
+// NopObserver to implement only some of them.
+type Observer interface {
+	// ReleaseCreated is called after a release has been created, which may be a draft.
+	ReleaseCreated(release *Release)
+
+	// AssetStarted is called before an asset is uploaded to the release.
+	AssetStarted(release *Release, asset AssetUpload)
+
+	// AssetProgress is called as the body of an asset upload is sent, like UploadProgress, with
+	// the number of bytes sent so far and the size of the asset. The count starts again from zero
+	// if the upload is retried.
+	AssetProgress(asset AssetUpload, sent, total int64)
+
+	// AssetFinished is called with the uploaded asset once an upload has succeeded.
+	AssetFinished(release *Release, asset AssetUpload, uploaded *Asset)
+
+	// AssetFailed is called with the error once an upload has failed, after any retries.
+	AssetFailed(release *Release, asset AssetUpload, err error)
+
+	// ReleasePublished is called once a release is visible to everyone, either because it was
+	// created as a full release or because a draft was published.
+	ReleasePublished(release *Release)
+}
+
+// NopObserver implements Observer by ignoring every event. Embed it in an Observer that only
+// needs some of the events.
+type NopObserver struct{}
+
+func (NopObserver) ReleaseCreated(*Release)                     {}
+func (NopObserver) AssetStarted(*Release, AssetUpload)          {}
+func (NopObserver) AssetProgress(AssetUpload, int64, int64)     {}
+func (NopObserver) AssetFinished(*Release, AssetUpload, *Asset) {}
+func (NopObserver) AssetFailed(*Release, AssetUpload, error)    {}
+func (NopObserver) ReleasePublished(*Release)                   {}
+
+var _ Observer = NopObserver{}
+
+// observer returns the client's Observer, or a NopObserver if it has none.
+func (c *Client) observer() Observer {
+	if c.Observer == nil {
+		return NopObserver{}
+	}
+	return c.Observer
+}
+
+// observeCreated tells the observer that the release was created, and that it was published if
+// it is not a draft.
+func (c *Client) observeCreated(release *Release) {
+	c.observer().ReleaseCreated(release)
+	if !release.Draft {
+		c.observer().ReleasePublished(release)
+	}
+}
+
+// observeUpload tells the observer that the asset upload started and then how it ended.
+func (c *Client) observeUpload(release *Release, asset AssetUpload, upload func() (*Asset, error)) (*Asset, error) {
+	o := c.observer()
+	o.AssetStarted(release, asset)
+	uploaded, err := upload()
+	if err != nil {
+		o.AssetFailed(release, asset, err)
+	} else {
+		o.AssetFinished(release, asset, uploaded)
+	}
+	return uploaded, err
+}
@@ -0,0 +1,76 @@
+package release
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+// acceptedPermissionsHeader lists the permissions that a fine-grained or app token needs for the
+// endpoint of a request, e.g. "contents=write". Alternatives are separated by commas and
+// permissions that are all needed by semicolons.
+const acceptedPermissionsHeader = "X-Accepted-GitHub-Permissions"
+
+// MissingPermission returns the permissions from the X-Accepted-GitHub-Permissions header of a
+// 403 or 404 response, in the form shown in the token settings, e.g. "contents:write". An empty
+// string is returned for other responses and for classic tokens, which do not get the header.
+func MissingPermission(status int, header http.Header) string {
+	if status != http.StatusForbidden && status != http.StatusNotFound {
+		return ""
+	}
+	accepted := header.Get(acceptedPermissionsHeader)
+	if accepted == "" {
+		return ""
+	}
+	var alternatives []string
+	for _, alternative := range strings.Split(accepted, ",") {
+		var all []string
+		for _, permission := range strings.Split(alternative, ";") {
+			if permission = strings.TrimSpace(permission); permission != "" {
+				all = append(all, strings.Replace(permission, "=", ":", 1))
+			}
+		}
+		if len(all) > 0 {
+			alternatives = append(alternatives, strings.Join(all, " and "))
+		}
+	}
+	return strings.Join(alternatives, " or ")
+}
+
+// responseError returns the error for a response without the expected status, an *APIError. The
+// permission that the token is missing is added to 403 and 404 errors, as GitHub reports a
+// repository that a fine-grained token has no access to as not found.
+func responseError(expected int, resp *http.Response, respData []byte) error {
+	return newAPIError(expected, resp, respData)
+}
+
+// CheckReleasePermission checks that the token can create releases in the repository. The
+// permissions of fine-grained and app tokens cannot be read, so a release without a tag is
+// created, which GitHub rejects as invalid if the token is allowed to create releases and as
+// forbidden if it is not. Nothing is created either way.
+func (c *Client) CheckReleasePermission(ctx context.Context) error {
+	request, err := newReplayableRequest(ctx, http.MethodPost, c.repoURL("releases"), []byte(`{"tag_name":""}`))
+	if err != nil {
+		return fmt.Errorf("creating permission check request: %w", err)
+	}
+	request.Header.Add("Content-Type", "application/json")
+	resp, err := c.Do(request)
+	if err != nil {
+		return fmt.Errorf("sending permission check request: %w", err)
+	}
+	defer resp.Body.Close()
+	respData, _ := ioutil.ReadAll(resp.Body)
+	switch resp.StatusCode {
+	case http.StatusUnprocessableEntity:
+		return nil
+	case http.StatusForbidden, http.StatusNotFound:
+		permission := MissingPermission(resp.StatusCode, resp.Header)
+		if permission == "" {
+			permission = "contents:write"
+		}
+		return fmt.Errorf("token missing %s on %s/%s: %s: %s", permission, c.User, c.Repo, resp.Status, respData)
+	}
+	return fmt.Errorf("unexpected response to permission check: %s: %s", resp.Status, respData)
+}
@@ -0,0 +1,38 @@
+package release
+
+import (
+	"context"
+	"net/url"
+	"strings"
+)
+
+// ReleaseProvider creates releases and uploads their assets on a forge. Client implements it for
+// GitHub, and GiteaClient and GitLabClient implement it for Gitea and GitLab, so that a release
+// can be created in the same way on any of them. Everything else is only supported on GitHub.
+type ReleaseProvider interface {
+	// CreateRelease creates the release and returns it.
+	CreateRelease(ctx context.Context, crr *CreateReleaseRequest) (*Release, error)
+
+	// FindReleaseByTag returns the release for the tag, or nil if there isn't one.
+	FindReleaseByTag(ctx context.Context, tag string) (*Release, error)
+
+	// UploadAsset uploads the file to the release and returns the uploaded asset.
+	UploadAsset(ctx context.Context, release *Release, asset AssetUpload) (*Asset, error)
+}
+
+var (
+	_ ReleaseProvider = (*Client)(nil)
+	_ ReleaseProvider = (*GiteaClient)(nil)
+	_ ReleaseProvider = (*GitLabClient)(nil)
+)
+
+// normalizeForgeAPIURL returns the api base URL for the URL of a Gitea or GitLab instance. A URL
+// without a path, e.g. https://gitea.example.com, gets the prefix that the api is served under.
+func normalizeForgeAPIURL(apiURL, prefix string) string {
+	apiURL = strings.TrimSuffix(apiURL, "/")
+	u, err := url.Parse(apiURL)
+	if err != nil || u.Host == "" || u.Path != "" {
+		return apiURL
+	}
+	return apiURL + prefix
+}
@@ -0,0 +1,60 @@
+package release
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+)
+
+// Label is a label on an issue or pull request.
+type Label struct {
+	Name string `json:"name"`
+}
+
+// PullRequest is a pull request in the repository.
+type PullRequest struct {
+	Number  int    `json:"number"`
+	Title   string `json:"title"`
+	State   string `json:"state"`
+	HTMLURL string `json:"html_url"`
+	User    struct {
+		Login string `json:"login"`
+	} `json:"user"`
+	Labels         []Label `json:"labels"`
+	MergedAt       string  `json:"merged_at"`
+	MergeCommitSHA string  `json:"merge_commit_sha"`
+}
+
+// HasLabel reports whether the pull request has the label.
+func (pr *PullRequest) HasLabel(name string) bool {
+	for _, label := range pr.Labels {
+		if label.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// ListCommitPullRequests fetches the pull requests that the commit is part of. For a commit on the
+// default branch this is the pull request that merged it.
+func (c *Client) ListCommitPullRequests(ctx context.Context, sha string) ([]PullRequest, error) {
+	var pulls []PullRequest
+	if _, err := c.getJSON(ctx, c.repoURL("commits/%s/pulls", sha), &pulls); err != nil {
+		return nil, fmt.Errorf("listing pull requests for commit %s: %w", sha, err)
+	}
+	return pulls, nil
+}
+
+// CountMergedPullRequests returns how many pull requests by the author have been merged in the
+// repository, using the search api.
+func (c *Client) CountMergedPullRequests(ctx context.Context, author string) (int, error) {
+	query := fmt.Sprintf("repo:%s/%s is:pr is:merged author:%s", c.User, c.Repo, author)
+	result := struct {
+		TotalCount int `json:"total_count"`
+	}{}
+	searchURL := fmt.Sprintf("%s/search/issues?per_page=1&q=%s", c.APIURL, url.QueryEscape(query))
+	if _, err := c.getJSON(ctx, searchURL, &result); err != nil {
+		return 0, fmt.Errorf("searching pull requests by %s: %w", author, err)
+	}
+	return result.TotalCount, nil
+}
@@ -0,0 +1,446 @@
+package release
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// CreateReleaseRequest represents the post data in the request to create a new GitHub release.
+type CreateReleaseRequest struct {
+	TagName         string `json:"tag_name"`
+	TargetCommitish string `json:"target_commitish"`
+	Name            string `json:"name"`
+	Body            string `json:"body"`
+	Draft           bool   `json:"draft"`
+	PreRelease      bool   `json:"prerelease"`
+
+	// GenerateReleaseNotes has GitHub generate the name and body of the release from the
+	// changes since the previous release. A Body that is set is added before the generated notes.
+	GenerateReleaseNotes bool `json:"generate_release_notes,omitempty"`
+
+	// MakeLatest is whether the release is marked as the latest release: "true", "false" or
+	// "legacy", which picks the latest release by creation date and semantic version. GitHub
+	// defaults to "true". Drafts and pre-releases are never marked as the latest release.
+	MakeLatest string `json:"make_latest,omitempty"`
+
+	// DiscussionCategoryName opens a GitHub Discussion in this category that is linked to the
+	// release. The category must already exist in the repository.
+	DiscussionCategoryName string `json:"discussion_category_name,omitempty"`
+}
+
+// MakeLatest values for CreateReleaseRequest and EditReleaseRequest.
+const (
+	MakeLatestTrue   = "true"
+	MakeLatestFalse  = "false"
+	MakeLatestLegacy = "legacy"
+)
+
+// CreateRelease will send the http POST request that will create the GitHub release. The created
+// Release will be returned.
+func (c *Client) CreateRelease(ctx context.Context, crr *CreateReleaseRequest) (*Release, error) {
+	releaseURL := c.repoURL("releases")
+	log.Printf("info: sending create request to %s", releaseURL)
+	data, err := json.Marshal(crr)
+	if err != nil {
+		return nil, fmt.Errorf("json marshal CreateReleaseRequest: %w", err)
+	}
+	request, err := newReplayableRequest(ctx, http.MethodPost, releaseURL, data)
+	if err != nil {
+		return nil, fmt.Errorf("creating release request: %w", err)
+	}
+	request.Header.Add("Content-Type", "application/json")
+	resp, err := c.Do(request)
+	if err != nil {
+		return nil, fmt.Errorf("sending create release request: %w", err)
+	}
+	defer resp.Body.Close()
+	respData, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("reading create release response body: %w", err)
+	}
+	if resp.StatusCode != 201 {
+		return nil, responseError(http.StatusCreated, resp, respData)
+	}
+	log.Printf("info: received 201 response: %s", respData)
+	crResponse := &Release{}
+	if err := json.Unmarshal(respData, crResponse); err != nil {
+		return nil, fmt.Errorf("unmarshaling response body: %w", err)
+	}
+	c.observeCreated(crResponse)
+	return crResponse, nil
+}
+
+// EditReleaseRequest represents the patch data in the request to update an existing GitHub release.
+// Only the fields that are set are changed on the release.
+type EditReleaseRequest struct {
+	TagName         string `json:"tag_name,omitempty"`
+	TargetCommitish string `json:"target_commitish,omitempty"`
+	Name            string `json:"name,omitempty"`
+	Body            string `json:"body,omitempty"`
+	Draft           *bool  `json:"draft,omitempty"`
+	PreRelease      *bool  `json:"prerelease,omitempty"`
+	MakeLatest      string `json:"make_latest,omitempty"`
+
+	// DiscussionCategoryName opens a discussion in this category linked to the release, if it does
+	// not already have one.
+	DiscussionCategoryName string `json:"discussion_category_name,omitempty"`
+}
+
+// EditRelease will send the http PATCH request that updates the release with the given id. The
+// updated release is returned.
+func (c *Client) EditRelease(ctx context.Context, releaseID int, erq *EditReleaseRequest) (*Release, error) {
+	releaseURL := c.repoURL("releases/%d", releaseID)
+	log.Printf("info: sending edit request to %s", releaseURL)
+	release := &Release{}
+	if _, err := c.sendJSON(ctx, http.MethodPatch, releaseURL, erq, http.StatusOK, release); err != nil {
+		return nil, fmt.Errorf("editing release: %w", err)
+	}
+	if erq.Draft != nil && !*erq.Draft && !release.Draft {
+		c.observer().ReleasePublished(release)
+	}
+	return release, nil
+}
+
+// PublishRelease publishes the draft release with the given id, which makes it visible to
+// everyone. The published release is returned.
+func (c *Client) PublishRelease(ctx context.Context, releaseID int) (*Release, error) {
+	return c.PublishReleaseLatest(ctx, releaseID, "")
+}
+
+// PublishReleaseLatest publishes the draft release with the given id like PublishRelease, and
+// sets whether it is marked as the latest release. GitHub ignores make_latest while the release
+// is a draft, so it has to be given when publishing.
+func (c *Client) PublishReleaseLatest(ctx context.Context, releaseID int, makeLatest string) (*Release, error) {
+	draft := false
+	return c.EditRelease(ctx, releaseID, &EditReleaseRequest{Draft: &draft, MakeLatest: makeLatest})
+}
+
+// GetReleaseByTag fetches the release for the tag, including draft releases.
+func (c *Client) GetReleaseByTag(ctx context.Context, tag string) (*Release, error) {
+	release, err := c.FindReleaseByTag(ctx, tag)
+	if err != nil {
+		return nil, err
+	}
+	if release == nil {
+		return nil, errorOf(ErrNotFound, "getting release for tag %s: no release found", tag)
+	}
+	return release, nil
+}
+
+// AppendBody adds the text to the end of the existing release body on a new line. The existing
+// body is kept exactly as it is so that its Markdown formatting is preserved.
+func AppendBody(body, text string) string {
+	if body == "" {
+		return text
+	}
+	return body + "\n" + text
+}
+
+// GenerateNotesRequest represents the post data in the request to generate release notes.
+type GenerateNotesRequest struct {
+	TagName         string `json:"tag_name"`
+	TargetCommitish string `json:"target_commitish,omitempty"`
+	PreviousTagName string `json:"previous_tag_name,omitempty"`
+
+	// ConfigurationFilePath is the path of the release notes configuration file in the
+	// repository, GitHub uses .github/release.yml if it is not set.
+	ConfigurationFilePath string `json:"configuration_file_path,omitempty"`
+}
+
+// ReleaseNotes are the release notes that GitHub generated for a release.
+type ReleaseNotes struct {
+	Name string `json:"name"`
+	Body string `json:"body"`
+}
+
+// GenerateReleaseNotes has GitHub generate the release notes for a release without creating it.
+// This is the same changelog that CreateReleaseRequest.GenerateReleaseNotes adds to a release.
+func (c *Client) GenerateReleaseNotes(ctx context.Context, gnr *GenerateNotesRequest) (*ReleaseNotes, error) {
+	notesURL := c.repoURL("releases/generate-notes")
+	log.Printf("info: sending generate notes request to %s", notesURL)
+	notes := &ReleaseNotes{}
+	if _, err := c.sendJSON(ctx, http.MethodPost, notesURL, gnr, http.StatusOK, notes); err != nil {
+		return nil, fmt.Errorf("generating release notes: %w", err)
+	}
+	return notes, nil
+}
+
+// Release is the data that the GitHub api sends back from the
+// create release endpoint.
+type Release struct {
+	URL        string `json:"url"`
+	HTMLURL    string `json:"html_url"`
+	AssetsURL  string `json:"assets_url"`
+	UploadURL  string `json:"upload_url"`
+	TarballURL string `json:"tarball_url"`
+	ZipballURL string `json:"zipball_url"`
+
+	ID     int    `json:"id"`
+	NodeID string `json:"node_id"`
+
+	TagName         string `json:"tag_name"`
+	TargetCommitish string `json:"target_commitish"`
+	Name            string `json:"name"`
+	Body            string `json:"body"`
+	Draft           bool   `json:"draft"`
+	PreRelease      bool   `json:"prerelease"`
+
+	// BodyHTML is the body rendered as HTML. It is only returned when the Accept header asks for
+	// it, e.g. application/vnd.github.full+json.
+	BodyHTML string `json:"body_html,omitempty"`
+
+	CreatedAt time.Time `json:"created_at"`
+
+	// PublishedAt is zero for a draft, which has not been published.
+	PublishedAt time.Time `json:"published_at"`
+
+	// DiscussionURL is the discussion linked to the release, if there is one
+	DiscussionURL string `json:"discussion_url,omitempty"`
+
+	// TagCommit is the SHA of the commit that the tag points to. It is only set on releases
+	// fetched with the GraphQL api.
+	TagCommit string `json:"tag_commit,omitempty"`
+
+	// Reactions are the counts of each reaction to the release, if it has any.
+	Reactions *Reactions `json:"reactions,omitempty"`
+
+	// Author is who created the release.
+	Author *User `json:"author"`
+
+	// Assets contains all of the assets for that release
+	Assets []Asset `json:"assets"`
+
+	// Extra are the fields of the response that Release does not have, such as fields added in
+	// a newer api version, so that they are kept when the release is written out as JSON.
+	Extra map[string]json.RawMessage `json:"-"`
+}
+
+// User is a GitHub user, or an app or organization, such as the author of a release.
+type User struct {
+	Login  string `json:"login"`
+	ID     int    `json:"id"`
+	NodeID string `json:"node_id"`
+
+	// Type is User, Bot or Organization.
+	Type string `json:"type"`
+
+	HTMLURL   string `json:"html_url"`
+	AvatarURL string `json:"avatar_url"`
+}
+
+// releaseFields are the JSON names of the fields of Release.
+var releaseFields = jsonFieldNames(reflect.TypeOf(Release{}))
+
+// UnmarshalJSON decodes the release, keeping the fields that Release does not have in Extra.
+func (r *Release) UnmarshalJSON(data []byte) error {
+	type plain Release
+	if err := json.Unmarshal(data, (*plain)(r)); err != nil {
+		return err
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+	r.Extra = nil
+	for name, value := range fields {
+		if releaseFields[name] {
+			continue
+		}
+		if r.Extra == nil {
+			r.Extra = map[string]json.RawMessage{}
+		}
+		r.Extra[name] = value
+	}
+	return nil
+}
+
+// MarshalJSON encodes the release with the fields in Extra after its own. The published_at of a
+// draft is null, as it is from the api.
+func (r Release) MarshalJSON() ([]byte, error) {
+	type plain Release
+	out := struct {
+		plain
+		PublishedAt *time.Time `json:"published_at"`
+	}{plain: plain(r)}
+	if !r.PublishedAt.IsZero() {
+		out.PublishedAt = &r.PublishedAt
+	}
+	data, err := json.Marshal(out)
+	if err != nil {
+		return nil, err
+	}
+	return appendJSONFields(data, r.Extra)
+}
+
+// Field returns the decoded value of a field in Extra, or nil if the release does not have it,
+// e.g. {{.Field "make_latest"}} in a template.
+func (r Release) Field(name string) interface{} {
+	var value interface{}
+	if raw, ok := r.Extra[name]; ok {
+		json.Unmarshal(raw, &value)
+	}
+	return value
+}
+
+// jsonFieldNames returns the JSON names of the exported fields of the struct type.
+func jsonFieldNames(t reflect.Type) map[string]bool {
+	names := map[string]bool{}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name := strings.Split(field.Tag.Get("json"), ",")[0]
+		if name == "-" || field.PkgPath != "" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		names[name] = true
+	}
+	return names
+}
+
+// appendJSONFields adds the fields to the end of the encoded JSON object, sorted by name.
+func appendJSONFields(object []byte, fields map[string]json.RawMessage) ([]byte, error) {
+	if len(fields) == 0 {
+		return object, nil
+	}
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	buf := bytes.NewBuffer(object[:len(object)-1])
+	for _, name := range names {
+		key, err := json.Marshal(name)
+		if err != nil {
+			return nil, err
+		}
+		if buf.Len() > 1 {
+			buf.WriteByte(',')
+		}
+		buf.Write(key)
+		buf.WriteByte(':')
+		buf.Write(fields[name])
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// GetRelease fetches the release with the given id.
+func (c *Client) GetRelease(ctx context.Context, releaseID int) (*Release, error) {
+	release := &Release{}
+	if _, err := c.getJSON(ctx, c.repoURL("releases/%d", releaseID), release); err != nil {
+		return nil, fmt.Errorf("getting release %d: %w", releaseID, err)
+	}
+	return release, nil
+}
+
+// GetLatestRelease fetches the latest published full release, which excludes drafts and
+// pre-releases.
+func (c *Client) GetLatestRelease(ctx context.Context) (*Release, error) {
+	release := &Release{}
+	if _, err := c.getJSON(ctx, c.repoURL("releases/latest"), release); err != nil {
+		return nil, fmt.Errorf("getting latest release: %w", err)
+	}
+	return release, nil
+}
+
+// ListReleases fetches a single page of releases for the repository, newest first. Pages start at 1.
+func (c *Client) ListReleases(ctx context.Context, page, perPage int) ([]Release, error) {
+	var releases []Release
+	if _, err := c.getJSON(ctx, c.repoURL("releases?per_page=%d&page=%d", perPage, page), &releases); err != nil {
+		return nil, fmt.Errorf("listing releases: %w", err)
+	}
+	return releases, nil
+}
+
+// ListAllReleases fetches every release for the repository, newest first, following the pages
+// until there are none left.
+func (c *Client) ListAllReleases(ctx context.Context) ([]Release, error) {
+	var releases []Release
+	err := c.WalkReleases(ctx, func(r Release) (bool, error) {
+		releases = append(releases, r)
+		return true, nil
+	})
+	return releases, err
+}
+
+// WalkReleases calls fn for each release in the repository, newest first, fetching the pages by
+// following the Link headers of the responses. It stops early if fn returns false or an error.
+func (c *Client) WalkReleases(ctx context.Context, fn func(Release) (bool, error)) error {
+	pageURL := c.repoURL("releases?per_page=100")
+	for pageURL != "" {
+		var releases []Release
+		next, err := c.getJSONPage(ctx, pageURL, &releases)
+		if err != nil {
+			return fmt.Errorf("listing releases: %w", err)
+		}
+		for _, r := range releases {
+			more, err := fn(r)
+			if err != nil || !more {
+				return err
+			}
+		}
+		pageURL = next
+	}
+	return nil
+}
+
+// DeleteRelease deletes the release with the given id. The git tag for the release is not deleted.
+func (c *Client) DeleteRelease(ctx context.Context, releaseID int) error {
+	releaseURL := c.repoURL("releases/%d", releaseID)
+	log.Printf("info: sending delete request to %s", releaseURL)
+	request, err := http.NewRequestWithContext(ctx, http.MethodDelete, releaseURL, nil)
+	if err != nil {
+		return fmt.Errorf("creating delete release request: %w", err)
+	}
+	resp, err := c.Do(request)
+	if err != nil {
+		return fmt.Errorf("sending delete release request: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		respData, _ := ioutil.ReadAll(resp.Body)
+		return responseError(http.StatusNoContent, resp, respData)
+	}
+	return nil
+}
+
+// FindReleaseByTag fetches the release for the tag, including draft releases. Unlike
+// GetReleaseByTag, nil is returned without an error if there is no release for the tag.
+func (c *Client) FindReleaseByTag(ctx context.Context, tag string) (*Release, error) {
+	release := &Release{}
+	status, err := c.getJSON(ctx, c.repoURL("releases/tags/%s", tag), release)
+	if status == http.StatusNotFound {
+		// Draft releases are not returned by the tag endpoint, so look for one in the list of
+		// all releases instead.
+		return c.findDraftByTag(ctx, tag)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("getting release for tag %s: %w", tag, err)
+	}
+	return release, nil
+}
+
+// findDraftByTag returns the draft release for the tag, or nil if there isn't one.
+func (c *Client) findDraftByTag(ctx context.Context, tag string) (*Release, error) {
+	releases, err := c.ListAllReleases(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("looking for a draft release for tag %s: %w", tag, err)
+	}
+	for i := range releases {
+		if releases[i].Draft && releases[i].TagName == tag {
+			return &releases[i], nil
+		}
+	}
+	return nil, nil
+}
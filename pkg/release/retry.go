@@ -0,0 +1,136 @@
+package release
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"log"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// do sends the request, retrying network errors and retryable status codes up to c.Retries
+// times. Requests with a body can only be retried if GetBody is set so that the body can be
+// replayed. If beforeRetry is set it is called with each retryable response before the request
+// is retried, and the response is returned as it is if beforeRetry returns false.
+func (c *Client) do(request *http.Request, beforeRetry func(*http.Response) bool) (*http.Response, error) {
+	replayable := request.Body == nil || request.Body == http.NoBody || request.GetBody != nil
+	attempt := 1
+	for {
+		resp, err := c.send(request)
+
+		// Waiting for the rate limit to reset is not a failed attempt, the request would have
+		// succeeded otherwise.
+		if wait, limited := rateLimitWait(resp, err); limited && c.WaitOnRateLimit && replayable {
+			io.Copy(ioutil.Discard, resp.Body)
+			resp.Body.Close()
+			log.Printf("warn: rate limit exceeded, waiting %s for it to reset before retrying %s %s", wait.Round(time.Second), request.Method, request.URL)
+			if err := sleep(request.Context(), wait); err != nil {
+				return nil, err
+			}
+			if request, err = rewind(request); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		if attempt > c.Retries || !replayable || !retryable(resp, err) {
+			return resp, err
+		}
+		if resp != nil {
+			if beforeRetry != nil && !beforeRetry(resp) {
+				return resp, nil
+			}
+			io.Copy(ioutil.Discard, resp.Body)
+			resp.Body.Close()
+		}
+
+		wait := c.backoff(attempt)
+		if err != nil {
+			log.Printf("warn: %s %s failed, retrying in %s (%d/%d): %v", request.Method, request.URL, wait, attempt, c.Retries, err)
+		} else {
+			log.Printf("warn: %s %s received %s, retrying in %s (%d/%d)", request.Method, request.URL, resp.Status, wait, attempt, c.Retries)
+		}
+		if err := sleep(request.Context(), wait); err != nil {
+			return nil, err
+		}
+		if request, err = rewind(request); err != nil {
+			return nil, err
+		}
+		attempt++
+	}
+}
+
+// rateLimitWait works out whether the response was rejected because of the rate limit, and if
+// so how long to wait before sending the request again. Secondary rate limits set Retry-After,
+// otherwise the wait is until the primary rate limit resets.
+func rateLimitWait(resp *http.Response, err error) (time.Duration, bool) {
+	if err != nil || (resp.StatusCode != http.StatusForbidden && resp.StatusCode != http.StatusTooManyRequests) {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil {
+		return time.Duration(seconds) * time.Second, true
+	}
+	rl, ok := parseRateLimit(resp.Header)
+	if !ok || rl.Remaining > 0 {
+		return 0, false
+	}
+	wait := time.Until(rl.Reset) + time.Second
+	if wait < time.Second {
+		wait = time.Second
+	}
+	return wait, true
+}
+
+// retryable reports whether a request that received the response or error should be retried.
+// Network errors and the 5xx responses that GitHub returns for transient failures are retried,
+// but not the cancellation of the request itself.
+func retryable(resp *http.Response, err error) bool {
+	if err != nil {
+		return !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded)
+	}
+	switch resp.StatusCode {
+	case http.StatusInternalServerError, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// backoff returns the wait before the retry attempt, starting at 1. The wait doubles for each
+// attempt and up to half of it is random jitter.
+func (c *Client) backoff(attempt int) time.Duration {
+	wait := c.RetryBackoff << uint(attempt-1)
+	if wait <= 0 {
+		return 0
+	}
+	half := int64(wait / 2)
+	return time.Duration(half + rand.Int63n(half+1))
+}
+
+// sleep waits for the duration, returning early with an error if the context is done.
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// rewind returns a copy of the request with a fresh body so that it can be sent again.
+func rewind(request *http.Request) (*http.Request, error) {
+	retry := request.Clone(request.Context())
+	if request.GetBody != nil {
+		body, err := request.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		retry.Body = body
+	}
+	return retry, nil
+}
@@ -0,0 +1,418 @@
+package release
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Tagger is the author information attached to an annotated tag object.
+type Tagger struct {
+	Name  string `json:"name"`
+	Email string `json:"email"`
+	Date  string `json:"date,omitempty"`
+}
+
+// GitObject is a reference to an object in the git database.
+type GitObject struct {
+	Type string `json:"type"`
+	SHA  string `json:"sha"`
+	URL  string `json:"url"`
+}
+
+// CreateTagRequest represents the post data in the request to create a new annotated tag object.
+// Creating the tag object does not create the reference in the repository, a CreateRefRequest
+// must be sent afterwards for the tag to be visible.
+type CreateTagRequest struct {
+	Tag     string  `json:"tag"`
+	Message string  `json:"message"`
+	Object  string  `json:"object"`
+	Type    string  `json:"type"`
+	Tagger  *Tagger `json:"tagger,omitempty"`
+}
+
+// Tag is the data that the GitHub api sends back from the create tag endpoint.
+type Tag struct {
+	NodeID  string    `json:"node_id"`
+	Tag     string    `json:"tag"`
+	SHA     string    `json:"sha"`
+	URL     string    `json:"url"`
+	Message string    `json:"message"`
+	Tagger  Tagger    `json:"tagger"`
+	Object  GitObject `json:"object"`
+}
+
+// CreateTagObject will send the http POST request that creates the annotated tag object.
+func (c *Client) CreateTagObject(ctx context.Context, ctr *CreateTagRequest) (*Tag, error) {
+	tagURL := c.repoURL("git/tags")
+	log.Printf("info: sending create tag request to %s", tagURL)
+	tag := &Tag{}
+	if err := c.postJSON(ctx, tagURL, ctr, tag); err != nil {
+		return nil, fmt.Errorf("creating tag object: %w", err)
+	}
+	return tag, nil
+}
+
+// CreateRefRequest represents the post data in the request to create a new git reference.
+type CreateRefRequest struct {
+	Ref string `json:"ref"`
+	SHA string `json:"sha"`
+}
+
+// Ref is the data that the GitHub api sends back for a git reference.
+type Ref struct {
+	Ref    string    `json:"ref"`
+	NodeID string    `json:"node_id"`
+	URL    string    `json:"url"`
+	Object GitObject `json:"object"`
+}
+
+// CreateRef will send the http POST request that creates the git reference.
+func (c *Client) CreateRef(ctx context.Context, crr *CreateRefRequest) (*Ref, error) {
+	refURL := c.repoURL("git/refs")
+	log.Printf("info: sending create ref request to %s", refURL)
+	ref := &Ref{}
+	if err := c.postJSON(ctx, refURL, crr, ref); err != nil {
+		return nil, fmt.Errorf("creating ref: %w", err)
+	}
+	return ref, nil
+}
+
+// TagExists checks whether the tag reference already exists in the repository.
+func (c *Client) TagExists(ctx context.Context, tag string) (bool, error) {
+	status, err := c.getJSON(ctx, c.repoURL("git/ref/tags/%s", tag), &Ref{})
+	if status == http.StatusNotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// ResolveCommit returns the commit SHA that the commitish (branch, tag or SHA) points to. An
+// error saying that the commit does not exist is returned if GitHub cannot find it.
+func (c *Client) ResolveCommit(ctx context.Context, commitish string) (string, error) {
+	commit := struct {
+		SHA string `json:"sha"`
+	}{}
+	status, err := c.getJSON(ctx, c.repoURL("commits/%s", commitish), &commit)
+	if status == http.StatusNotFound || status == http.StatusUnprocessableEntity {
+		return "", errorOf(ErrNotFound, "commit %s does not exist in %s/%s", commitish, c.User, c.Repo)
+	}
+	if err != nil {
+		return "", fmt.Errorf("resolving commit %s: %w", commitish, err)
+	}
+	return commit.SHA, nil
+}
+
+// The kinds of commitish that a Target can be.
+const (
+	TargetBranch = "branch"
+	TargetTag    = "tag"
+	TargetCommit = "commit"
+)
+
+// Target is a commitish resolved to the commit that it points to.
+type Target struct {
+	// Commitish is the branch, tag or full or short SHA that was resolved, and Kind is which of
+	// TargetBranch, TargetTag or TargetCommit it is.
+	Commitish string
+	Kind      string
+
+	// SHA is the full SHA of the commit.
+	SHA string
+}
+
+// ResolveTarget works out whether the commitish is a branch, a tag or a full or short SHA, in that
+// order as git does, and resolves it to its commit. An error matching ErrNotFound is returned if
+// it is none of them.
+func (c *Client) ResolveTarget(ctx context.Context, commitish string) (*Target, error) {
+	t := &Target{Commitish: commitish}
+	ref := &Ref{}
+	status, err := c.getJSON(ctx, c.repoURL("git/ref/heads/%s", commitish), ref)
+	switch {
+	case status == http.StatusOK:
+		t.Kind, t.SHA = TargetBranch, ref.Object.SHA
+		return t, nil
+	case status != http.StatusNotFound && err != nil:
+		return nil, fmt.Errorf("resolving %s: %w", commitish, err)
+	}
+	exists, err := c.TagExists(ctx, commitish)
+	if err != nil {
+		return nil, fmt.Errorf("resolving %s: %w", commitish, err)
+	}
+	t.Kind = TargetCommit
+	if exists {
+		t.Kind = TargetTag
+	}
+	// An annotated tag points to a tag object, so the commit is looked up in both cases.
+	if t.SHA, err = c.ResolveCommit(ctx, commitish); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// TagSigner returns an ASCII armored detached signature of the payload, such as the output of
+// gpg --armor --detach-sign.
+type TagSigner func(payload []byte) (string, error)
+
+// CreateTagOptions are the optional parts of an annotated tag.
+type CreateTagOptions struct {
+	// Message is the tag message.
+	Message string
+
+	// Tagger is the author of the tag. GitHub uses the authenticated user if it is nil.
+	Tagger *Tagger
+
+	// Sign signs the tag object if it is set. Tagger is required to sign a tag, as the signed
+	// payload must match the tag object that GitHub creates exactly.
+	Sign TagSigner
+}
+
+// CreateTag creates an annotated tag object and its reference for the tag at the commitish.
+// Nothing is created if the tag already exists.
+func (c *Client) CreateTag(ctx context.Context, tag, commitish, message string) error {
+	return c.CreateAnnotatedTag(ctx, tag, commitish, CreateTagOptions{Message: message})
+}
+
+// CreateAnnotatedTag creates an annotated tag object with the tagger and message in the options
+// and its reference for the tag at the commitish, signing it if a signer is given. Nothing is
+// created if the tag already exists.
+func (c *Client) CreateAnnotatedTag(ctx context.Context, tag, commitish string, opts CreateTagOptions) error {
+	exists, err := c.TagExists(ctx, tag)
+	if err != nil {
+		return fmt.Errorf("checking tag exists: %w", err)
+	}
+	if exists {
+		log.Printf("info: tag %s already exists, skipping tag creation", tag)
+		return nil
+	}
+	sha, err := c.ResolveCommit(ctx, commitish)
+	if err != nil {
+		return err
+	}
+	ctr := &CreateTagRequest{
+		Tag:     tag,
+		Message: opts.Message,
+		Object:  sha,
+		Type:    "commit",
+		Tagger:  opts.Tagger,
+	}
+	if opts.Sign != nil {
+		if err := signTag(ctr, opts.Sign); err != nil {
+			return err
+		}
+	}
+	tagObject, err := c.CreateTagObject(ctx, ctr)
+	if err != nil {
+		return err
+	}
+	_, err = c.CreateRef(ctx, &CreateRefRequest{
+		Ref: "refs/tags/" + tag,
+		SHA: tagObject.SHA,
+	})
+	if err != nil {
+		return err
+	}
+	log.Printf("info: created tag %s at %s", tag, sha)
+	return nil
+}
+
+// signTag appends the signature of the tag object to the message, which is how git stores a
+// signed tag. The tagger date is set to now if it is empty, so that it is the same in the signed
+// payload and the tag object.
+func signTag(ctr *CreateTagRequest, sign TagSigner) error {
+	if ctr.Tagger == nil || ctr.Tagger.Name == "" || ctr.Tagger.Email == "" {
+		return fmt.Errorf("signing tag: the tagger name and email are required")
+	}
+	if ctr.Tagger.Date == "" {
+		ctr.Tagger.Date = time.Now().UTC().Format(time.RFC3339)
+	}
+	payload, err := TagPayload(ctr)
+	if err != nil {
+		return fmt.Errorf("signing tag: %w", err)
+	}
+	signature, err := sign(payload)
+	if err != nil {
+		return fmt.Errorf("signing tag: %w", err)
+	}
+	ctr.Message = tagMessage(ctr.Message) + signature
+	return nil
+}
+
+// TagPayload returns the tag object as git serializes it, without a signature. This is the data
+// that is signed for a signed tag.
+func TagPayload(ctr *CreateTagRequest) ([]byte, error) {
+	if ctr.Tagger == nil {
+		return nil, fmt.Errorf("tag has no tagger")
+	}
+	date, err := time.Parse(time.RFC3339, ctr.Tagger.Date)
+	if err != nil {
+		return nil, fmt.Errorf("tagger date: %w", err)
+	}
+	_, offset := date.Zone()
+	sign := '+'
+	if offset < 0 {
+		sign, offset = '-', -offset
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "object %s\ntype %s\ntag %s\n", ctr.Object, ctr.Type, ctr.Tag)
+	fmt.Fprintf(&b, "tagger %s <%s> %d %c%02d%02d\n\n", ctr.Tagger.Name, ctr.Tagger.Email, date.Unix(), sign, offset/3600, offset%3600/60)
+	b.WriteString(tagMessage(ctr.Message))
+	return []byte(b.String()), nil
+}
+
+// tagMessage returns the message with the trailing newline that git adds to tag messages.
+func tagMessage(message string) string {
+	if message == "" || strings.HasSuffix(message, "\n") {
+		return message
+	}
+	return message + "\n"
+}
+
+// DeleteTag deletes the reference for the tag. The tag object, if it is an annotated tag, is left
+// for git to garbage collect.
+func (c *Client) DeleteTag(ctx context.Context, tag string) error {
+	refURL := c.repoURL("git/refs/tags/%s", tag)
+	log.Printf("info: sending delete tag request to %s", refURL)
+	request, err := http.NewRequestWithContext(ctx, http.MethodDelete, refURL, nil)
+	if err != nil {
+		return fmt.Errorf("creating delete tag request: %w", err)
+	}
+	resp, err := c.Do(request)
+	if err != nil {
+		return fmt.Errorf("sending delete tag request: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		respData, _ := ioutil.ReadAll(resp.Body)
+		return responseError(http.StatusNoContent, resp, respData)
+	}
+	return nil
+}
+
+// RepoTag is a tag in the repository as returned by the list tags endpoint.
+type RepoTag struct {
+	Name   string `json:"name"`
+	Commit struct {
+		SHA string `json:"sha"`
+	} `json:"commit"`
+}
+
+// ListAllTags fetches every tag in the repository, following the Link headers of the responses
+// until there are no pages left.
+func (c *Client) ListAllTags(ctx context.Context) ([]RepoTag, error) {
+	var tags []RepoTag
+	pageURL := c.repoURL("tags?per_page=100")
+	for pageURL != "" {
+		var pageTags []RepoTag
+		next, err := c.getJSONPage(ctx, pageURL, &pageTags)
+		if err != nil {
+			return nil, fmt.Errorf("listing tags: %w", err)
+		}
+		tags = append(tags, pageTags...)
+		pageURL = next
+	}
+	return tags, nil
+}
+
+// Commit is a commit in a comparison between two commits.
+type Commit struct {
+	SHA    string `json:"sha"`
+	Commit struct {
+		Message string `json:"message"`
+
+		// Committer is who committed the commit and when, which for a rebased commit is later
+		// than when it was written.
+		Committer struct {
+			Date time.Time `json:"date"`
+		} `json:"committer"`
+	} `json:"commit"`
+
+	// Author is the GitHub user of the commit author, nil if the email is not linked to a user.
+	Author *struct {
+		Login string `json:"login"`
+	} `json:"author"`
+}
+
+// GetCommit fetches the commit that the commitish (branch, tag or SHA) points to.
+func (c *Client) GetCommit(ctx context.Context, commitish string) (*Commit, error) {
+	commit := &Commit{}
+	status, err := c.getJSON(ctx, c.repoURL("commits/%s", commitish), commit)
+	if status == http.StatusNotFound || status == http.StatusUnprocessableEntity {
+		return nil, errorOf(ErrNotFound, "commit %s does not exist in %s/%s", commitish, c.User, c.Repo)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("getting commit %s: %w", commitish, err)
+	}
+	return commit, nil
+}
+
+// CompareCommits returns the commits that are in head but not in base, oldest first. GitHub
+// returns at most 250 commits for a comparison.
+func (c *Client) CompareCommits(ctx context.Context, base, head string) ([]Commit, error) {
+	comparison := struct {
+		Commits []Commit `json:"commits"`
+	}{}
+	if _, err := c.getJSON(ctx, c.repoURL("compare/%s...%s", base, head), &comparison); err != nil {
+		return nil, fmt.Errorf("comparing %s to %s: %w", base, head, err)
+	}
+	return comparison.Commits, nil
+}
+
+// HasCommitsBy reports whether the user authored any of the commits reachable from ref.
+func (c *Client) HasCommitsBy(ctx context.Context, login, ref string) (bool, error) {
+	var commits []Commit
+	commitsURL := c.repoURL("commits?per_page=1&author=%s&sha=%s", url.QueryEscape(login), url.QueryEscape(ref))
+	if _, err := c.getJSON(ctx, commitsURL, &commits); err != nil {
+		return false, fmt.Errorf("listing commits by %s: %w", login, err)
+	}
+	return len(commits) > 0, nil
+}
+
+// Branch is a branch in the repository as returned by the list branches endpoint.
+type Branch struct {
+	Name      string `json:"name"`
+	Protected bool   `json:"protected"`
+	Commit    struct {
+		SHA string `json:"sha"`
+	} `json:"commit"`
+}
+
+// ListBranches fetches every branch in the repository, or only the protected branches if
+// protected is true.
+func (c *Client) ListBranches(ctx context.Context, protected bool) ([]Branch, error) {
+	var branches []Branch
+	pageURL := c.repoURL("branches?per_page=100")
+	if protected {
+		pageURL += "&protected=true"
+	}
+	for pageURL != "" {
+		var pageBranches []Branch
+		next, err := c.getJSONPage(ctx, pageURL, &pageBranches)
+		if err != nil {
+			return nil, fmt.Errorf("listing branches: %w", err)
+		}
+		branches = append(branches, pageBranches...)
+		pageURL = next
+	}
+	return branches, nil
+}
+
+// IsAncestor reports whether the commit is reachable from the head commitish, such as a branch,
+// i.e. whether head is the commit or comes after it.
+func (c *Client) IsAncestor(ctx context.Context, commit, head string) (bool, error) {
+	comparison := struct {
+		Status string `json:"status"`
+	}{}
+	if _, err := c.getJSON(ctx, c.repoURL("compare/%s...%s", head, commit), &comparison); err != nil {
+		return false, fmt.Errorf("comparing %s to %s: %w", head, commit, err)
+	}
+	return comparison.Status == "identical" || comparison.Status == "behind", nil
+}
@@ -0,0 +1,150 @@
+package release
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// TransportOptions tune the connection pool of the http.Transport that a Client sends its
+// requests through.
+type TransportOptions struct {
+	// MaxIdleConns is the most idle connections kept open across all hosts. Zero means no limit.
+	MaxIdleConns int
+
+	// MaxIdleConnsPerHost is the most idle connections kept open to each host, which should be at
+	// least the number of concurrent uploads so that every upload reuses its connection.
+	MaxIdleConnsPerHost int
+
+	// MaxConnsPerHost limits the connections to each host, including those in use. Zero means no
+	// limit.
+	MaxConnsPerHost int
+
+	// IdleConnTimeout is how long an idle connection is kept open. Zero means no limit.
+	IdleConnTimeout time.Duration
+
+	// DisableHTTP2 sends requests over HTTP/1.1 only, for proxies that mishandle HTTP/2.
+	DisableHTTP2 bool
+
+	// DisableKeepAlives opens a new connection for every request.
+	DisableKeepAlives bool
+
+	// MinTLSVersion is the oldest TLS version to connect with, e.g. tls.VersionTLS13. Zero uses
+	// the Go default, TLS 1.2.
+	MinTLSVersion uint16
+
+	// MaxTLSVersion is the newest TLS version to connect with. Zero uses the Go default, TLS 1.3.
+	MaxTLSVersion uint16
+
+	// CipherSuites are the TLS 1.2 cipher suites to offer, nil offers the Go defaults. The TLS 1.3
+	// cipher suites cannot be configured in Go.
+	CipherSuites []uint16
+
+	// CurvePreferences are the key exchange curves to offer, nil offers the Go defaults.
+	CurvePreferences []tls.CurveID
+}
+
+// FIPSCipherSuites are the TLS 1.2 cipher suites that are approved for FIPS 140: ECDHE key
+// exchange with AES-GCM.
+var FIPSCipherSuites = []uint16{
+	tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+	tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+	tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+	tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+}
+
+// FIPSCurves are the key exchange curves that are approved for FIPS 140.
+var FIPSCurves = []tls.CurveID{tls.CurveP256, tls.CurveP384}
+
+// FIPSTransportOptions returns the options with TLS limited to what is approved for FIPS 140:
+// TLS 1.2 with FIPSCipherSuites and FIPSCurves. TLS 1.3 is turned off because Go can negotiate
+// ChaCha20-Poly1305 for it, which is not approved, and its suites cannot be limited.
+func FIPSTransportOptions(opts TransportOptions) TransportOptions {
+	opts.MinTLSVersion = tls.VersionTLS12
+	opts.MaxTLSVersion = tls.VersionTLS12
+	opts.CipherSuites = FIPSCipherSuites
+	opts.CurvePreferences = FIPSCurves
+	return opts
+}
+
+// ParseTLSVersion returns the TLS version for 1.2 or 1.3. Older versions are not supported.
+func ParseTLSVersion(version string) (uint16, error) {
+	switch version {
+	case "1.2":
+		return tls.VersionTLS12, nil
+	case "1.3":
+		return tls.VersionTLS13, nil
+	}
+	return 0, fmt.Errorf("unsupported TLS version %q, expected 1.2 or 1.3", version)
+}
+
+// ParseCipherSuites returns the TLS 1.2 cipher suites for the comma separated names, e.g.
+// TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256. The suites that Go considers insecure are rejected.
+func ParseCipherSuites(names string) ([]uint16, error) {
+	known := map[string]*tls.CipherSuite{}
+	for _, suite := range tls.CipherSuites() {
+		known[suite.Name] = suite
+	}
+	var ids []uint16
+	for _, name := range strings.Split(names, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		suite, ok := known[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown or insecure TLS cipher suite %q", name)
+		}
+		if !supportsVersion(suite, tls.VersionTLS12) {
+			return nil, fmt.Errorf("TLS cipher suite %s is for TLS 1.3, whose cipher suites cannot be configured", name)
+		}
+		ids = append(ids, suite.ID)
+	}
+	return ids, nil
+}
+
+// supportsVersion returns whether the cipher suite can be used with the TLS version.
+func supportsVersion(suite *tls.CipherSuite, version uint16) bool {
+	for _, v := range suite.SupportedVersions {
+		if v == version {
+			return true
+		}
+	}
+	return false
+}
+
+// DefaultTransportOptions are the options of the transport of a Client made by NewClient. The
+// standard library keeps only 2 idle connections per host, so concurrent uploads to the upload
+// host would keep opening new connections.
+var DefaultTransportOptions = TransportOptions{
+	MaxIdleConns:        100,
+	MaxIdleConnsPerHost: 16,
+	IdleConnTimeout:     90 * time.Second,
+}
+
+// NewTransport returns a transport with the proxy and timeouts of http.DefaultTransport and the
+// connection pool, TLS versions and cipher suites configured by the options. A transport is safe
+// for concurrent use and should be shared by the clients of a program, so that they reuse each
+// other's connections.
+func NewTransport(opts TransportOptions) *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.MaxIdleConns = opts.MaxIdleConns
+	transport.MaxIdleConnsPerHost = opts.MaxIdleConnsPerHost
+	transport.MaxConnsPerHost = opts.MaxConnsPerHost
+	transport.IdleConnTimeout = opts.IdleConnTimeout
+	transport.DisableKeepAlives = opts.DisableKeepAlives
+	transport.TLSClientConfig = &tls.Config{
+		MinVersion:       opts.MinTLSVersion,
+		MaxVersion:       opts.MaxTLSVersion,
+		CipherSuites:     opts.CipherSuites,
+		CurvePreferences: opts.CurvePreferences,
+	}
+	if opts.DisableHTTP2 {
+		// A non-nil empty TLSNextProto turns off the automatic HTTP/2 upgrade.
+		transport.ForceAttemptHTTP2 = false
+		transport.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{}
+	}
+	return transport
+}
@@ -0,0 +1,235 @@
+package releasetest
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/imitablerabbit/githubrelease/pkg/release"
+)
+
+// defaultBranches are the branches that every repository starts with, pointing at the same
+// commit, so that the commands work with either default -target.
+var defaultBranches = []string{"main", "master"}
+
+// fakeGit is the part of the git database of a repository that the release automation uses:
+// the branch and tag references, the commits they point to and annotated tag objects.
+type fakeGit struct {
+	// refs are the SHAs that the full reference names, e.g. refs/heads/main, point to.
+	refs map[string]string
+
+	// commits are the SHAs of the commits, and tags the commits that the annotated tag objects
+	// point to by the SHA of the tag object.
+	commits map[string]bool
+	tags    map[string]string
+}
+
+func newFakeGit(owner, name string) *fakeGit {
+	g := &fakeGit{refs: map[string]string{}, commits: map[string]bool{}, tags: map[string]string{}}
+	sha := g.commit(owner + "/" + name)
+	for _, branch := range defaultBranches {
+		g.refs["refs/heads/"+branch] = sha
+	}
+	return g
+}
+
+// commit adds a commit made from the seed and returns its SHA.
+func (g *fakeGit) commit(seed string) string {
+	sum := sha1.Sum([]byte(fmt.Sprintf("commit %d %s", len(g.commits), seed)))
+	sha := hex.EncodeToString(sum[:])
+	g.commits[sha] = true
+	return sha
+}
+
+// resolve returns the commit that the branch, tag or full or short SHA points to, or an empty
+// string if there is no such commit.
+func (g *fakeGit) resolve(commitish string) string {
+	for _, ref := range []string{"refs/heads/" + commitish, "refs/tags/" + commitish} {
+		if sha, ok := g.refs[ref]; ok {
+			if commit, isTag := g.tags[sha]; isTag {
+				return commit
+			}
+			return sha
+		}
+	}
+	if len(commitish) < 7 {
+		return ""
+	}
+	match := ""
+	for sha := range g.commits {
+		if strings.HasPrefix(sha, commitish) {
+			if match != "" {
+				// An ambiguous short SHA is not resolved.
+				return ""
+			}
+			match = sha
+		}
+	}
+	return match
+}
+
+// tagRelease creates the lightweight tag for a release that is published, as GitHub does, if the
+// tag does not exist yet. The tag is at the target of the release, or the default branch if the
+// target is not a commit.
+func (g *fakeGit) tagRelease(rel release.Release) {
+	ref := "refs/tags/" + rel.TagName
+	if _, ok := g.refs[ref]; ok || rel.Draft {
+		return
+	}
+	sha := g.resolve(rel.TargetCommitish)
+	if sha == "" {
+		sha = g.refs["refs/heads/"+defaultBranches[0]]
+	}
+	g.refs[ref] = sha
+}
+
+// AddCommit adds a new commit to the branch of the repository, creating the branch if it does not
+// exist, and returns the SHA of the commit.
+func (s *Server) AddCommit(owner, repo, branch string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	g := s.repo(owner, repo).git
+	sha := g.commit(branch)
+	g.refs["refs/heads/"+branch] = sha
+	return sha
+}
+
+// Ref returns the SHA that the full reference name, e.g. refs/tags/v1.0.0, points to in the
+// repository, and whether it exists. The SHA of an annotated tag is that of the tag object.
+func (s *Server) Ref(owner, repo, ref string) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sha, ok := s.repo(owner, repo).git.refs[ref]
+	return sha, ok
+}
+
+// serveGit serves the git database endpoints under /repos/owner/repo/git.
+func (s *Server) serveGit(w http.ResponseWriter, req *http.Request, r *fakeRepo, parts []string) {
+	g := r.git
+	switch {
+	case len(parts) >= 3 && parts[1] == "ref" && req.Method == http.MethodGet:
+		ref := "refs/" + strings.Join(parts[2:], "/")
+		if _, ok := g.refs[ref]; !ok {
+			writeError(w, http.StatusNotFound, "Not Found")
+			return
+		}
+		writeJSON(w, http.StatusOK, s.refJSON(r, ref))
+	case len(parts) == 2 && parts[1] == "refs" && req.Method == http.MethodPost:
+		var crr release.CreateRefRequest
+		if err := json.NewDecoder(req.Body).Decode(&crr); err != nil {
+			writeError(w, http.StatusBadRequest, "Problems parsing JSON")
+			return
+		}
+		if !strings.HasPrefix(crr.Ref, "refs/") || strings.Count(crr.Ref, "/") < 2 {
+			writeError(w, http.StatusUnprocessableEntity, "Reference name is not valid")
+			return
+		}
+		if _, ok := g.refs[crr.Ref]; ok {
+			writeError(w, http.StatusUnprocessableEntity, "Reference already exists")
+			return
+		}
+		if _, isTag := g.tags[crr.SHA]; !isTag && !g.commits[crr.SHA] {
+			writeError(w, http.StatusUnprocessableEntity, "Object does not exist")
+			return
+		}
+		g.refs[crr.Ref] = crr.SHA
+		writeJSON(w, http.StatusCreated, s.refJSON(r, crr.Ref))
+	case len(parts) >= 4 && parts[1] == "refs" && req.Method == http.MethodDelete:
+		ref := "refs/" + strings.Join(parts[2:], "/")
+		if _, ok := g.refs[ref]; !ok {
+			writeError(w, http.StatusUnprocessableEntity, "Reference does not exist")
+			return
+		}
+		delete(g.refs, ref)
+		w.WriteHeader(http.StatusNoContent)
+	case len(parts) == 2 && parts[1] == "tags" && req.Method == http.MethodPost:
+		var ctr release.CreateTagRequest
+		if err := json.NewDecoder(req.Body).Decode(&ctr); err != nil {
+			writeError(w, http.StatusBadRequest, "Problems parsing JSON")
+			return
+		}
+		if ctr.Tag == "" || ctr.Type != "commit" || !g.commits[ctr.Object] {
+			writeError(w, http.StatusUnprocessableEntity, "Object does not exist")
+			return
+		}
+		sum := sha1.Sum([]byte(fmt.Sprintf("tag %s %s %s", ctr.Tag, ctr.Object, ctr.Message)))
+		sha := hex.EncodeToString(sum[:])
+		g.tags[sha] = ctr.Object
+		tag := release.Tag{
+			NodeID:  "TAG_" + sha[:10],
+			Tag:     ctr.Tag,
+			SHA:     sha,
+			URL:     fmt.Sprintf("%s/repos/%s/%s/git/tags/%s", s.URL, r.owner, r.name, sha),
+			Message: ctr.Message,
+			Object:  s.objectJSON(r, ctr.Object),
+		}
+		if ctr.Tagger != nil {
+			tag.Tagger = *ctr.Tagger
+		}
+		writeJSON(w, http.StatusCreated, tag)
+	default:
+		writeError(w, http.StatusNotFound, "Not Found")
+	}
+}
+
+// serveCommit serves the commit endpoint, which resolves a branch, tag or SHA to its commit.
+func (s *Server) serveCommit(w http.ResponseWriter, r *fakeRepo, commitish string) {
+	sha := r.git.resolve(commitish)
+	if sha == "" {
+		// GitHub sends a 422 rather than a 404 for a commitish that is not a commit.
+		writeError(w, http.StatusUnprocessableEntity, "No commit found for SHA: "+commitish)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"sha":      sha,
+		"node_id":  "C_" + sha[:10],
+		"url":      fmt.Sprintf("%s/repos/%s/%s/commits/%s", s.URL, r.owner, r.name, sha),
+		"html_url": fmt.Sprintf("%s/%s/%s/commit/%s", s.URL, r.owner, r.name, sha),
+	})
+}
+
+// listTags serves the list of tags with the commits they point to, sorted by name.
+func (s *Server) listTags(w http.ResponseWriter, req *http.Request, r *fakeRepo) {
+	var names []string
+	for ref := range r.git.refs {
+		if name := strings.TrimPrefix(ref, "refs/tags/"); name != ref {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	tags := make([]interface{}, 0, len(names))
+	for _, name := range names {
+		var tag release.RepoTag
+		tag.Name = name
+		tag.Commit.SHA = r.git.resolve(name)
+		tags = append(tags, tag)
+	}
+	writePage(w, req, tags)
+}
+
+// refJSON returns the reference as the api returns it.
+func (s *Server) refJSON(r *fakeRepo, ref string) release.Ref {
+	return release.Ref{
+		Ref:    ref,
+		NodeID: "REF_" + hex.EncodeToString([]byte(ref)),
+		URL:    fmt.Sprintf("%s/repos/%s/%s/git/%s", s.URL, r.owner, r.name, ref),
+		Object: s.objectJSON(r, r.git.refs[ref]),
+	}
+}
+
+// objectJSON returns the reference to the commit or tag object with the SHA as the api returns it.
+func (s *Server) objectJSON(r *fakeRepo, sha string) release.GitObject {
+	kind := "commit"
+	if _, isTag := r.git.tags[sha]; isTag {
+		kind = "tag"
+	}
+	return release.GitObject{
+		Type: kind,
+		SHA:  sha,
+		URL:  fmt.Sprintf("%s/repos/%s/%s/git/%ss/%s", s.URL, r.owner, r.name, kind, sha),
+	}
+}
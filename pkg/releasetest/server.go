@@ -0,0 +1,735 @@
+// Package releasetest provides an in-memory fake of the GitHub releases API, so that release
+// automation built on the release package can be tested offline.
+//
+//	srv := releasetest.NewServer()
+//	defer srv.Close()
+//	client := srv.Client("octo", "app")
+//	rel, err := client.CreateRelease(ctx, &release.CreateReleaseRequest{TagName: "v1.0.0"})
+//
+// Any owner and repository can be used, each starts out with no releases and with main and
+// master branches at the same commit. Failures and rate limits can be injected to test how the
+// automation copes with them.
+package releasetest
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/imitablerabbit/githubrelease/pkg/release"
+)
+
+// Token is the token that Client authenticates with. The server accepts any token, but
+// requests without one fail with 401 as they would on GitHub.
+const Token = "releasetest-token"
+
+// Server is a fake GitHub releases API. It serves the release and asset endpoints of the REST
+// api, the repository endpoint, the git reference, tag and commit endpoints that are used to
+// resolve and create tags, and the browser download URLs of the assets.
+type Server struct {
+	// URL is the base URL of the server, which is the API URL of the clients.
+	URL string
+
+	server *httptest.Server
+
+	mu       sync.Mutex
+	nextID   int
+	repos    map[string]*fakeRepo
+	failures []*Failure
+	requests []Request
+
+	rateLimit int
+	rateReset time.Duration
+	rateUsed  int
+	rateStart time.Time
+}
+
+// Failure makes the requests that match it fail with the status, to test how the automation
+// copes with errors from GitHub.
+type Failure struct {
+	// Method is the method of the requests to fail, or any method if it is empty.
+	Method string
+
+	// Path is a path.Match pattern for the paths of the requests to fail, e.g.
+	// /repos/*/*/releases/*/assets for uploads. Any path matches if it is empty.
+	Path string
+
+	// Status is the status of the response.
+	Status int
+
+	// Body is the body of the response. It defaults to a GitHub error payload with the status
+	// text as the message.
+	Body string
+
+	// Header is added to the headers of the response.
+	Header http.Header
+
+	// Times is how many requests fail before the failure is removed. Zero fails every request
+	// until ClearFailures is called.
+	Times int
+}
+
+// Request is a request that the server received.
+type Request struct {
+	Method string
+	Path   string
+	Query  string
+	Status int
+}
+
+// fakeRepo is the releases and git database of a repository.
+type fakeRepo struct {
+	owner, name string
+	releases    []*fakeRelease
+	git         *fakeGit
+}
+
+// fakeRelease is a release and the contents of its assets.
+type fakeRelease struct {
+	release release.Release
+	assets  []*fakeAsset
+}
+
+// fakeAsset is an uploaded asset.
+type fakeAsset struct {
+	asset     release.Asset
+	content   []byte
+	createdAt time.Time
+	downloads int
+}
+
+// NewServer starts a fake GitHub releases API. It should be closed when the test is done.
+func NewServer() *Server {
+	s := &Server{repos: map[string]*fakeRepo{}}
+	s.server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	s.URL = s.server.URL
+	return s
+}
+
+// Close shuts the server down.
+func (s *Server) Close() {
+	s.server.Close()
+}
+
+// Client returns a client for the repository on the server. It does not retry, so that injected
+// failures are seen by the caller. Set Retries on the client to test retrying.
+func (s *Server) Client(owner, repo string) *release.Client {
+	c := release.NewClient(s.URL, owner, repo, Token)
+	c.HTTPClient = s.server.Client()
+	return c
+}
+
+// Fail adds a failure for the requests that match it. The failures are checked in the order that
+// they were added.
+func (s *Server) Fail(f Failure) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failures = append(s.failures, &f)
+}
+
+// ClearFailures removes all of the failures.
+func (s *Server) ClearFailures() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failures = nil
+}
+
+// SetRateLimit limits the server to limit requests in each window of reset, after which requests
+// fail with 403 and the rate limit headers that GitHub sends until the window ends. A limit of 0
+// removes the rate limit, and the window is an hour if reset is not positive.
+func (s *Server) SetRateLimit(limit int, reset time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if reset <= 0 {
+		reset = time.Hour
+	}
+	s.rateLimit, s.rateReset, s.rateUsed, s.rateStart = limit, reset, 0, time.Now()
+}
+
+// Requests returns the requests that the server has received, in order.
+func (s *Server) Requests() []Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Request(nil), s.requests...)
+}
+
+// AddRelease adds the release to the repository as if it was created, tagging it if it is not a
+// draft, and returns it with its id and URLs filled in. It is for setting up the releases that a
+// test starts with.
+func (s *Server) AddRelease(owner, repo string, r release.Release) release.Release {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	fr := s.repo(owner, repo)
+	rel := s.addRelease(fr, r)
+	fr.git.tagRelease(rel.release)
+	return rel.json(s, fr)
+}
+
+// AddAsset adds an asset with the content to the release, as if it was uploaded.
+func (s *Server) AddAsset(owner, repo string, releaseID int, name string, content []byte) (release.Asset, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r := s.repo(owner, repo)
+	rel := r.find(releaseID)
+	if rel == nil {
+		return release.Asset{}, fmt.Errorf("release %d not found in %s/%s", releaseID, owner, repo)
+	}
+	a := s.addAsset(r, rel, name, "", "application/octet-stream", content)
+	return a.asset, nil
+}
+
+// Releases returns the releases of the repository, newest first, including drafts.
+func (s *Server) Releases(owner, repo string) []release.Release {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r := s.repo(owner, repo)
+	releases := make([]release.Release, 0, len(r.releases))
+	for i := len(r.releases) - 1; i >= 0; i-- {
+		releases = append(releases, r.releases[i].json(s, r))
+	}
+	return releases
+}
+
+// AssetContent returns the content of the asset with the id, and whether it exists.
+func (s *Server) AssetContent(owner, repo string, assetID int) ([]byte, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, a := s.repo(owner, repo).findAsset(assetID)
+	if a == nil {
+		return nil, false
+	}
+	return append([]byte(nil), a.content...), true
+}
+
+// repo returns the repository, creating it if it has not been used before.
+func (s *Server) repo(owner, name string) *fakeRepo {
+	key := strings.ToLower(owner + "/" + name)
+	r := s.repos[key]
+	if r == nil {
+		r = &fakeRepo{owner: owner, name: name, git: newFakeGit(owner, name)}
+		s.repos[key] = r
+	}
+	return r
+}
+
+func (s *Server) id() int {
+	s.nextID++
+	return s.nextID
+}
+
+func (s *Server) addRelease(r *fakeRepo, rel release.Release) *fakeRelease {
+	now := time.Now().UTC().Truncate(time.Second)
+	rel.ID = s.id()
+	rel.NodeID = fmt.Sprintf("RE_%d", rel.ID)
+	if rel.TargetCommitish == "" {
+		rel.TargetCommitish = "main"
+	}
+	rel.CreatedAt = now
+	rel.PublishedAt = time.Time{}
+	if !rel.Draft {
+		rel.PublishedAt = now
+	}
+	fr := &fakeRelease{release: rel}
+	r.releases = append(r.releases, fr)
+	return fr
+}
+
+func (s *Server) addAsset(r *fakeRepo, rel *fakeRelease, name, label, contentType string, content []byte) *fakeAsset {
+	a := &fakeAsset{
+		asset: release.Asset{
+			ID:          s.id(),
+			Name:        name,
+			Label:       label,
+			ContentType: contentType,
+			State:       "uploaded",
+			Size:        int64(len(content)),
+		},
+		content:   content,
+		createdAt: time.Now().UTC().Truncate(time.Second),
+	}
+	a.asset.BrowserDownloadURL = fmt.Sprintf("%s/%s/%s/releases/download/%s/%s", s.URL, r.owner, r.name, rel.release.TagName, name)
+	rel.assets = append(rel.assets, a)
+	return a
+}
+
+func (r *fakeRepo) find(id int) *fakeRelease {
+	for _, rel := range r.releases {
+		if rel.release.ID == id {
+			return rel
+		}
+	}
+	return nil
+}
+
+func (r *fakeRepo) findTag(tag string) *fakeRelease {
+	for _, rel := range r.releases {
+		if rel.release.TagName == tag {
+			return rel
+		}
+	}
+	return nil
+}
+
+func (r *fakeRepo) findAsset(id int) (*fakeRelease, *fakeAsset) {
+	for _, rel := range r.releases {
+		for _, a := range rel.assets {
+			if a.asset.ID == id {
+				return rel, a
+			}
+		}
+	}
+	return nil, nil
+}
+
+// json returns the release as the api returns it.
+func (rel *fakeRelease) json(s *Server, r *fakeRepo) release.Release {
+	out := rel.release
+	base := fmt.Sprintf("%s/repos/%s/%s/releases/%d", s.URL, r.owner, r.name, out.ID)
+	out.URL = base
+	out.AssetsURL = base + "/assets"
+	out.UploadURL = base + "/assets{?name,label}"
+	out.HTMLURL = fmt.Sprintf("%s/%s/%s/releases/tag/%s", s.URL, r.owner, r.name, out.TagName)
+	out.TarballURL = fmt.Sprintf("%s/repos/%s/%s/tarball/%s", s.URL, r.owner, r.name, out.TagName)
+	out.ZipballURL = fmt.Sprintf("%s/repos/%s/%s/zipball/%s", s.URL, r.owner, r.name, out.TagName)
+	out.Author = &release.User{Login: "releasetest", Type: "User"}
+	out.Assets = make([]release.Asset, 0, len(rel.assets))
+	for _, a := range rel.assets {
+		out.Assets = append(out.Assets, a.json(s, r))
+	}
+	return out
+}
+
+// json returns the asset as the api returns it.
+func (a *fakeAsset) json(s *Server, r *fakeRepo) release.Asset {
+	sum := sha256.Sum256(a.content)
+	out := a.asset
+	out.NodeID = fmt.Sprintf("RA_%d", out.ID)
+	out.URL = fmt.Sprintf("%s/repos/%s/%s/releases/assets/%d", s.URL, r.owner, r.name, out.ID)
+	out.Digest = "sha256:" + hex.EncodeToString(sum[:])
+	out.DownloadCount = a.downloads
+	out.Uploader = &release.User{Login: "releasetest", Type: "User"}
+	out.CreatedAt = a.createdAt
+	out.UpdatedAt = a.createdAt
+	return out
+}
+
+// serveHTTP records the request, applies any failure or rate limit and then serves the endpoint.
+func (s *Server) serveHTTP(w http.ResponseWriter, req *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p := strings.TrimPrefix(req.URL.Path, "/api/v3")
+	rw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+	defer func() {
+		s.requests = append(s.requests, Request{Method: req.Method, Path: p, Query: req.URL.RawQuery, Status: rw.status})
+	}()
+
+	if s.rateLimited(rw) {
+		return
+	}
+	if f := s.failure(req.Method, p); f != nil {
+		for key, values := range f.Header {
+			rw.Header()[key] = values
+		}
+		body := f.Body
+		if body == "" {
+			b, _ := json.Marshal(map[string]string{"message": http.StatusText(f.Status)})
+			body = string(b)
+		}
+		rw.Header().Set("Content-Type", "application/json")
+		rw.WriteHeader(f.Status)
+		rw.Write([]byte(body))
+		return
+	}
+
+	parts := strings.Split(strings.Trim(p, "/"), "/")
+	if len(parts) >= 6 && parts[2] == "releases" && parts[3] == "download" {
+		s.serveDownload(rw, s.repo(parts[0], parts[1]), parts[4], strings.Join(parts[5:], "/"))
+		return
+	}
+	if len(parts) < 3 || parts[0] != "repos" {
+		writeError(rw, http.StatusNotFound, "Not Found")
+		return
+	}
+	if req.Header.Get("Authorization") == "" {
+		writeError(rw, http.StatusUnauthorized, "Requires authentication")
+		return
+	}
+	r := s.repo(parts[1], parts[2])
+	s.serveRepo(rw, req, r, parts[3:])
+}
+
+// serveRepo serves the endpoints under /repos/owner/repo.
+func (s *Server) serveRepo(w http.ResponseWriter, req *http.Request, r *fakeRepo, parts []string) {
+	method := req.Method
+	switch {
+	case len(parts) == 0 && method == http.MethodGet:
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"name":           r.name,
+			"full_name":      r.owner + "/" + r.name,
+			"owner":          map[string]interface{}{"login": r.owner},
+			"html_url":       fmt.Sprintf("%s/%s/%s", s.URL, r.owner, r.name),
+			"default_branch": "main",
+			"archived":       false,
+			"permissions":    map[string]bool{"admin": true, "push": true, "pull": true},
+		})
+	case len(parts) >= 1 && parts[0] == "git":
+		s.serveGit(w, req, r, parts)
+	case len(parts) >= 2 && parts[0] == "commits" && method == http.MethodGet:
+		s.serveCommit(w, r, strings.Join(parts[1:], "/"))
+	case len(parts) == 1 && parts[0] == "tags" && method == http.MethodGet:
+		s.listTags(w, req, r)
+	case len(parts) == 0 || parts[0] != "releases":
+		writeError(w, http.StatusNotFound, "Not Found")
+	case len(parts) == 1 && method == http.MethodGet:
+		s.listReleases(w, req, r)
+	case len(parts) == 1 && method == http.MethodPost:
+		s.createRelease(w, req, r)
+	case len(parts) == 2 && parts[1] == "latest" && method == http.MethodGet:
+		for i := len(r.releases) - 1; i >= 0; i-- {
+			if rel := r.releases[i]; !rel.release.Draft && !rel.release.PreRelease {
+				writeJSON(w, http.StatusOK, rel.json(s, r))
+				return
+			}
+		}
+		writeError(w, http.StatusNotFound, "Not Found")
+	case len(parts) >= 3 && parts[1] == "tags" && method == http.MethodGet:
+		// Drafts are not returned by tag, as on GitHub.
+		if rel := r.findTag(strings.Join(parts[2:], "/")); rel != nil && !rel.release.Draft {
+			writeJSON(w, http.StatusOK, rel.json(s, r))
+			return
+		}
+		writeError(w, http.StatusNotFound, "Not Found")
+	case len(parts) == 3 && parts[1] == "assets":
+		s.serveAsset(w, req, r, parts[2])
+	default:
+		id, err := strconv.Atoi(parts[1])
+		rel := r.find(id)
+		if err != nil || rel == nil {
+			writeError(w, http.StatusNotFound, "Not Found")
+			return
+		}
+		switch {
+		case len(parts) == 2:
+			s.serveRelease(w, req, r, rel)
+		case len(parts) == 3 && parts[2] == "assets" && method == http.MethodGet:
+			assets := make([]interface{}, 0, len(rel.assets))
+			for _, a := range rel.assets {
+				assets = append(assets, a.json(s, r))
+			}
+			writePage(w, req, assets)
+		case len(parts) == 3 && parts[2] == "assets" && method == http.MethodPost:
+			s.uploadAsset(w, req, r, rel)
+		default:
+			writeError(w, http.StatusNotFound, "Not Found")
+		}
+	}
+}
+
+func (s *Server) listReleases(w http.ResponseWriter, req *http.Request, r *fakeRepo) {
+	releases := make([]interface{}, 0, len(r.releases))
+	for i := len(r.releases) - 1; i >= 0; i-- {
+		releases = append(releases, r.releases[i].json(s, r))
+	}
+	writePage(w, req, releases)
+}
+
+// releaseRequest is the body of a create or edit release request. The fields are pointers so
+// that an edit only changes the fields that it sends.
+type releaseRequest struct {
+	TagName         *string `json:"tag_name"`
+	TargetCommitish *string `json:"target_commitish"`
+	Name            *string `json:"name"`
+	Body            *string `json:"body"`
+	Draft           *bool   `json:"draft"`
+	PreRelease      *bool   `json:"prerelease"`
+}
+
+func (rr *releaseRequest) apply(rel *release.Release) {
+	for _, f := range []struct {
+		value *string
+		field *string
+	}{{rr.TagName, &rel.TagName}, {rr.TargetCommitish, &rel.TargetCommitish}, {rr.Name, &rel.Name}, {rr.Body, &rel.Body}} {
+		if f.value != nil {
+			*f.field = *f.value
+		}
+	}
+	if rr.Draft != nil {
+		if rel.Draft && !*rr.Draft {
+			rel.PublishedAt = time.Now().UTC().Truncate(time.Second)
+		}
+		rel.Draft = *rr.Draft
+	}
+	if rr.PreRelease != nil {
+		rel.PreRelease = *rr.PreRelease
+	}
+}
+
+func (s *Server) createRelease(w http.ResponseWriter, req *http.Request, r *fakeRepo) {
+	var rr releaseRequest
+	if err := json.NewDecoder(req.Body).Decode(&rr); err != nil {
+		writeError(w, http.StatusBadRequest, "Problems parsing JSON")
+		return
+	}
+	if rr.TagName == nil || *rr.TagName == "" {
+		writeValidation(w, "Release", "tag_name", "missing_field")
+		return
+	}
+	if r.findTag(*rr.TagName) != nil {
+		writeValidation(w, "Release", "tag_name", "already_exists")
+		return
+	}
+	var rel release.Release
+	rr.apply(&rel)
+	created := s.addRelease(r, rel)
+	r.git.tagRelease(created.release)
+	writeJSON(w, http.StatusCreated, created.json(s, r))
+}
+
+func (s *Server) serveRelease(w http.ResponseWriter, req *http.Request, r *fakeRepo, rel *fakeRelease) {
+	switch req.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, rel.json(s, r))
+	case http.MethodPatch:
+		var rr releaseRequest
+		if err := json.NewDecoder(req.Body).Decode(&rr); err != nil {
+			writeError(w, http.StatusBadRequest, "Problems parsing JSON")
+			return
+		}
+		if rr.TagName != nil {
+			if other := r.findTag(*rr.TagName); other != nil && other != rel {
+				writeValidation(w, "Release", "tag_name", "already_exists")
+				return
+			}
+		}
+		rr.apply(&rel.release)
+		r.git.tagRelease(rel.release)
+		writeJSON(w, http.StatusOK, rel.json(s, r))
+	case http.MethodDelete:
+		for i, other := range r.releases {
+			if other == rel {
+				r.releases = append(r.releases[:i], r.releases[i+1:]...)
+				break
+			}
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "Method Not Allowed")
+	}
+}
+
+func (s *Server) uploadAsset(w http.ResponseWriter, req *http.Request, r *fakeRepo, rel *fakeRelease) {
+	name := req.URL.Query().Get("name")
+	if name == "" {
+		writeValidation(w, "ReleaseAsset", "name", "missing_field")
+		return
+	}
+	for _, a := range rel.assets {
+		if a.asset.Name == name {
+			writeValidation(w, "ReleaseAsset", "name", "already_exists")
+			return
+		}
+	}
+	content, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "reading body: "+err.Error())
+		return
+	}
+	if req.ContentLength >= 0 && int64(len(content)) != req.ContentLength {
+		writeError(w, http.StatusBadRequest, "body does not match Content-Length")
+		return
+	}
+	if int64(len(content)) > release.MaxAssetSize {
+		writeValidation(w, "ReleaseAsset", "size", "invalid")
+		return
+	}
+	contentType := req.Header.Get("Content-Type")
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	a := s.addAsset(r, rel, name, req.URL.Query().Get("label"), contentType, content)
+	writeJSON(w, http.StatusCreated, a.json(s, r))
+}
+
+func (s *Server) serveAsset(w http.ResponseWriter, req *http.Request, r *fakeRepo, id string) {
+	assetID, _ := strconv.Atoi(id)
+	rel, a := r.findAsset(assetID)
+	if a == nil {
+		writeError(w, http.StatusNotFound, "Not Found")
+		return
+	}
+	switch req.Method {
+	case http.MethodGet:
+		if req.Header.Get("Accept") == "application/octet-stream" {
+			a.downloads++
+			w.Header().Set("Content-Type", "application/octet-stream")
+			http.ServeContent(w, req, a.asset.Name, time.Time{}, bytes.NewReader(a.content))
+			return
+		}
+		writeJSON(w, http.StatusOK, a.json(s, r))
+	case http.MethodPatch:
+		var edit struct {
+			Name  *string `json:"name"`
+			Label *string `json:"label"`
+		}
+		if err := json.NewDecoder(req.Body).Decode(&edit); err != nil {
+			writeError(w, http.StatusBadRequest, "Problems parsing JSON")
+			return
+		}
+		if edit.Name != nil {
+			a.asset.Name = *edit.Name
+		}
+		if edit.Label != nil {
+			a.asset.Label = *edit.Label
+		}
+		writeJSON(w, http.StatusOK, a.json(s, r))
+	case http.MethodDelete:
+		for i, other := range rel.assets {
+			if other == a {
+				rel.assets = append(rel.assets[:i], rel.assets[i+1:]...)
+				break
+			}
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "Method Not Allowed")
+	}
+}
+
+// serveDownload serves the browser download URL of an asset, which drafts do not have.
+func (s *Server) serveDownload(w http.ResponseWriter, r *fakeRepo, tag, name string) {
+	rel := r.findTag(tag)
+	if rel == nil || rel.release.Draft {
+		http.NotFound(w, nil)
+		return
+	}
+	for _, a := range rel.assets {
+		if a.asset.Name == name {
+			a.downloads++
+			w.Header().Set("Content-Type", a.asset.ContentType)
+			w.Header().Set("Content-Length", strconv.Itoa(len(a.content)))
+			w.Write(a.content)
+			return
+		}
+	}
+	http.NotFound(w, nil)
+}
+
+// rateLimited counts the request against the rate limit, and writes the rate limit response if
+// it is exceeded.
+func (s *Server) rateLimited(w http.ResponseWriter) bool {
+	if s.rateLimit <= 0 {
+		return false
+	}
+	now := time.Now()
+	if now.Sub(s.rateStart) >= s.rateReset {
+		s.rateUsed, s.rateStart = 0, now
+	}
+	reset := s.rateStart.Add(s.rateReset)
+	exceeded := s.rateUsed >= s.rateLimit
+	if !exceeded {
+		s.rateUsed++
+	}
+	w.Header().Set("X-RateLimit-Limit", strconv.Itoa(s.rateLimit))
+	w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(s.rateLimit-s.rateUsed))
+	w.Header().Set("X-RateLimit-Used", strconv.Itoa(s.rateUsed))
+	w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(reset.Unix(), 10))
+	if exceeded {
+		writeError(w, http.StatusForbidden, "API rate limit exceeded for user.")
+	}
+	return exceeded
+}
+
+// failure returns the first failure that matches the request, removing it once it has failed
+// the number of times it was added for.
+func (s *Server) failure(method, p string) *Failure {
+	for i, f := range s.failures {
+		if f.Method != "" && !strings.EqualFold(f.Method, method) {
+			continue
+		}
+		if f.Path != "" {
+			if match, _ := path.Match(f.Path, p); !match {
+				continue
+			}
+		}
+		if f.Times > 0 {
+			f.Times--
+			if f.Times == 0 {
+				s.failures = append(s.failures[:i], s.failures[i+1:]...)
+			}
+		}
+		return f
+	}
+	return nil
+}
+
+// writePage writes the page of the items selected by the page and per_page query parameters,
+// with a Link header for the next page as GitHub sends.
+func writePage(w http.ResponseWriter, req *http.Request, items []interface{}) {
+	query := req.URL.Query()
+	perPage, _ := strconv.Atoi(query.Get("per_page"))
+	if perPage <= 0 || perPage > 100 {
+		perPage = 30
+	}
+	page, _ := strconv.Atoi(query.Get("page"))
+	if page <= 0 {
+		page = 1
+	}
+	start := (page - 1) * perPage
+	if start > len(items) {
+		start = len(items)
+	}
+	end := start + perPage
+	if end > len(items) {
+		end = len(items)
+	}
+	if end < len(items) {
+		next := *req.URL
+		query.Set("page", strconv.Itoa(page+1))
+		query.Set("per_page", strconv.Itoa(perPage))
+		next.RawQuery = query.Encode()
+		next.Scheme, next.Host = "http", req.Host
+		w.Header().Set("Link", fmt.Sprintf(`<%s>; rel="next"`, next.String()))
+	}
+	writeJSON(w, http.StatusOK, items[start:end])
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	data, _ := json.Marshal(v)
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	w.Write(data)
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"message": message, "documentation_url": "https://docs.github.com/rest"})
+}
+
+// writeValidation writes the 422 that GitHub sends for an invalid field.
+func writeValidation(w http.ResponseWriter, resource, field, code string) {
+	writeJSON(w, http.StatusUnprocessableEntity, map[string]interface{}{
+		"message":           "Validation Failed",
+		"errors":            []release.APIErrorDetail{{Resource: resource, Field: field, Code: code}},
+		"documentation_url": "https://docs.github.com/rest/releases",
+	})
+}
+
+// statusWriter records the status of the response for Requests.
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusWriter) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
@@ -0,0 +1,226 @@
+package releasetest_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/imitablerabbit/githubrelease/pkg/release"
+	"github.com/imitablerabbit/githubrelease/pkg/releasetest"
+)
+
+func TestMain(m *testing.M) {
+	// The client logs every request it sends.
+	log.SetOutput(ioutil.Discard)
+	os.Exit(m.Run())
+}
+
+func TestCreateReleaseAndUpload(t *testing.T) {
+	srv := releasetest.NewServer()
+	defer srv.Close()
+	client := srv.Client("octo", "app")
+	ctx := context.Background()
+
+	rel, err := client.CreateRelease(ctx, &release.CreateReleaseRequest{TagName: "v1.0.0", TargetCommitish: "main", Draft: true})
+	if err != nil {
+		t.Fatalf("CreateRelease: %v", err)
+	}
+	if !rel.Draft || rel.TagName != "v1.0.0" {
+		t.Fatalf("created release = %+v, want a draft of v1.0.0", rel)
+	}
+	if _, ok := srv.Ref("octo", "app", "refs/tags/v1.0.0"); ok {
+		t.Errorf("draft release was tagged")
+	}
+
+	path := filepath.Join(t.TempDir(), "app.tar.gz")
+	if err := ioutil.WriteFile(path, []byte("archive"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	asset, err := client.UploadAsset(ctx, rel, release.AssetUpload{Path: path, Name: "app.tar.gz", Label: "App"})
+	if err != nil {
+		t.Fatalf("UploadAsset: %v", err)
+	}
+	if asset.Name != "app.tar.gz" || asset.Label != "App" || asset.Size != 7 {
+		t.Errorf("uploaded asset = %+v", asset)
+	}
+	if content, ok := srv.AssetContent("octo", "app", asset.ID); !ok || string(content) != "archive" {
+		t.Errorf("asset content = %q, %v, want %q", content, ok, "archive")
+	}
+
+	if _, err := client.PublishRelease(ctx, rel.ID); err != nil {
+		t.Fatalf("PublishRelease: %v", err)
+	}
+	releases := srv.Releases("octo", "app")
+	if len(releases) != 1 || releases[0].Draft || len(releases[0].Assets) != 1 {
+		t.Fatalf("releases = %+v, want one published release with one asset", releases)
+	}
+	sha, ok := srv.Ref("octo", "app", "refs/tags/v1.0.0")
+	main, _ := srv.Ref("octo", "app", "refs/heads/main")
+	if !ok || sha != main {
+		t.Errorf("tag of published release = %q, %v, want main at %q", sha, ok, main)
+	}
+}
+
+func TestCreateReleaseExistingTag(t *testing.T) {
+	srv := releasetest.NewServer()
+	defer srv.Close()
+	srv.AddRelease("octo", "app", release.Release{TagName: "v1.0.0"})
+
+	_, err := srv.Client("octo", "app").CreateRelease(context.Background(), &release.CreateReleaseRequest{TagName: "v1.0.0"})
+	if !errors.Is(err, release.ErrTagExists) {
+		t.Errorf("CreateRelease of an existing tag: %v, want ErrTagExists", err)
+	}
+}
+
+func TestResolveTarget(t *testing.T) {
+	srv := releasetest.NewServer()
+	defer srv.Close()
+	client := srv.Client("octo", "app")
+	ctx := context.Background()
+	main, _ := srv.Ref("octo", "app", "refs/heads/main")
+	feature := srv.AddCommit("octo", "app", "feature/x")
+	srv.AddRelease("octo", "app", release.Release{TagName: "v1.0.0", TargetCommitish: "main"})
+
+	tests := []struct {
+		commitish string
+		kind      string
+		sha       string
+	}{
+		{"main", release.TargetBranch, main},
+		{"master", release.TargetBranch, main},
+		{"feature/x", release.TargetBranch, feature},
+		{"v1.0.0", release.TargetTag, main},
+		{feature, release.TargetCommit, feature},
+		{feature[:7], release.TargetCommit, feature},
+	}
+	for _, test := range tests {
+		target, err := client.ResolveTarget(ctx, test.commitish)
+		if err != nil {
+			t.Errorf("ResolveTarget(%q): %v", test.commitish, err)
+			continue
+		}
+		if target.Kind != test.kind || target.SHA != test.sha {
+			t.Errorf("ResolveTarget(%q) = %s %s, want %s %s", test.commitish, target.Kind, target.SHA, test.kind, test.sha)
+		}
+	}
+
+	if _, err := client.ResolveTarget(ctx, "missing"); !errors.Is(err, release.ErrNotFound) {
+		t.Errorf("ResolveTarget of a missing branch: %v, want ErrNotFound", err)
+	}
+}
+
+func TestCreateAndDeleteTag(t *testing.T) {
+	srv := releasetest.NewServer()
+	defer srv.Close()
+	client := srv.Client("octo", "app")
+	ctx := context.Background()
+	main, _ := srv.Ref("octo", "app", "refs/heads/main")
+
+	if err := client.CreateTag(ctx, "v2.0.0", "main", "Release v2.0.0"); err != nil {
+		t.Fatalf("CreateTag: %v", err)
+	}
+	if exists, err := client.TagExists(ctx, "v2.0.0"); err != nil || !exists {
+		t.Fatalf("TagExists after CreateTag = %v, %v", exists, err)
+	}
+	// The tag is annotated, so its reference points to the tag object and not the commit.
+	if sha, _ := srv.Ref("octo", "app", "refs/tags/v2.0.0"); sha == main {
+		t.Errorf("annotated tag points at the commit")
+	}
+	if sha, err := client.ResolveCommit(ctx, "v2.0.0"); err != nil || sha != main {
+		t.Errorf("ResolveCommit(v2.0.0) = %q, %v, want %q", sha, err, main)
+	}
+	tags, err := client.ListAllTags(ctx)
+	if err != nil || len(tags) != 1 || tags[0].Name != "v2.0.0" || tags[0].Commit.SHA != main {
+		t.Errorf("ListAllTags = %+v, %v", tags, err)
+	}
+
+	if _, err := client.CreateRef(ctx, &release.CreateRefRequest{Ref: "refs/tags/v2.0.0", SHA: main}); err == nil {
+		t.Errorf("CreateRef of an existing tag succeeded")
+	}
+	if err := client.DeleteTag(ctx, "v2.0.0"); err != nil {
+		t.Fatalf("DeleteTag: %v", err)
+	}
+	if exists, err := client.TagExists(ctx, "v2.0.0"); err != nil || exists {
+		t.Errorf("TagExists after DeleteTag = %v, %v", exists, err)
+	}
+}
+
+func TestFail(t *testing.T) {
+	srv := releasetest.NewServer()
+	defer srv.Close()
+	client := srv.Client("octo", "app")
+	ctx := context.Background()
+	srv.Fail(releasetest.Failure{Method: http.MethodPost, Path: "/repos/*/*/releases", Status: http.StatusBadGateway, Times: 1})
+
+	if _, err := client.CreateRelease(ctx, &release.CreateReleaseRequest{TagName: "v1.0.0"}); err == nil {
+		t.Fatalf("CreateRelease succeeded despite the failure")
+	}
+	if _, err := client.CreateRelease(ctx, &release.CreateReleaseRequest{TagName: "v1.0.0"}); err != nil {
+		t.Fatalf("CreateRelease after the failure was used up: %v", err)
+	}
+
+	requests := srv.Requests()
+	if len(requests) != 2 || requests[0].Status != http.StatusBadGateway || requests[1].Status != http.StatusCreated {
+		t.Errorf("requests = %+v, want a 502 and then a 201", requests)
+	}
+	if requests[0].Path != "/repos/octo/app/releases" {
+		t.Errorf("request path = %q, want the path without the /api/v3 prefix", requests[0].Path)
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	srv := releasetest.NewServer()
+	defer srv.Close()
+	client := srv.Client("octo", "app")
+	ctx := context.Background()
+	srv.SetRateLimit(1, time.Hour)
+
+	if _, err := client.ListAllReleases(ctx); err != nil {
+		t.Fatalf("first request: %v", err)
+	}
+	_, err := client.ListAllReleases(ctx)
+	if !errors.Is(err, release.ErrRateLimited) {
+		t.Fatalf("request over the rate limit: %v, want ErrRateLimited", err)
+	}
+	if rl := client.LastRateLimit(); rl == nil || rl.Limit != 1 || rl.Remaining != 0 {
+		t.Errorf("LastRateLimit = %+v, want a limit of 1 with none remaining", rl)
+	}
+}
+
+func TestPagination(t *testing.T) {
+	srv := releasetest.NewServer()
+	defer srv.Close()
+	for i := 0; i < 150; i++ {
+		srv.AddRelease("octo", "app", release.Release{TagName: fmt.Sprintf("v0.0.%d", i)})
+	}
+
+	releases, err := srv.Client("octo", "app").ListAllReleases(context.Background())
+	if err != nil {
+		t.Fatalf("ListAllReleases: %v", err)
+	}
+	if len(releases) != 150 {
+		t.Errorf("ListAllReleases returned %d releases, want 150", len(releases))
+	}
+	if releases[0].TagName != "v0.0.149" {
+		t.Errorf("first release = %s, want the newest", releases[0].TagName)
+	}
+}
+
+func TestRequiresAuthentication(t *testing.T) {
+	srv := releasetest.NewServer()
+	defer srv.Close()
+	client := srv.Client("octo", "app")
+	// Sending the token in another header leaves the request without an Authorization header.
+	client.TokenHeader = "Private-Token"
+
+	if _, err := client.ListAllReleases(context.Background()); !errors.Is(err, release.ErrUnauthorized) {
+		t.Errorf("request without a token: %v, want ErrUnauthorized", err)
+	}
+}